@@ -1,17 +1,16 @@
 package build
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/containers/image/v5/signature"
 	"k8s.io/klog/v2"
 
@@ -27,17 +26,19 @@ import (
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	batchv1informer "k8s.io/client-go/informers/batch/v1"
 	kubeinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
 	ktypedclient "k8s.io/client-go/kubernetes/typed/core/v1"
+	batchv1lister "k8s.io/client-go/listers/batch/v1"
 	v1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
-	sysregistriesv2 "github.com/containers/image/v5/pkg/sysregistriesv2"
-	rutil "github.com/openshift/runtime-utils/pkg/registries"
-
 	buildv1 "github.com/openshift/api/build/v1"
 	configv1 "github.com/openshift/api/config/v1"
 	imagev1 "github.com/openshift/api/image/v1"
@@ -60,11 +61,15 @@ import (
 	"github.com/openshift/openshift-controller-manager/pkg/build/buildscheme"
 	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
 	builddefaults "github.com/openshift/openshift-controller-manager/pkg/build/controller/build/defaults"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/multiarch"
 	buildoverrides "github.com/openshift/openshift-controller-manager/pkg/build/controller/build/overrides"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/provenance"
 	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
 	"github.com/openshift/openshift-controller-manager/pkg/build/controller/policy"
 	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
 	metrics "github.com/openshift/openshift-controller-manager/pkg/build/metrics/prometheus"
+	"github.com/openshift/openshift-controller-manager/pkg/image/registryconf"
 )
 
 const (
@@ -144,9 +149,13 @@ type BuildController struct {
 	buildLister                 buildv1lister.BuildLister
 	buildConfigLister           buildv1lister.BuildConfigLister
 	buildDeleter                buildclientv1.BuildsGetter
+	buildCreator                buildclientv1.BuildsGetter
+	buildConfigPatcher          buildclientv1.BuildConfigsGetter
 	buildControllerConfigLister configv1lister.BuildLister
 	imageConfigLister           configv1lister.ImageLister
 	podClient                   ktypedclient.PodsGetter
+	jobClient                   batchv1client.JobsGetter
+	dynamicClient               dynamic.Interface
 	configMapClient             ktypedclient.ConfigMapsGetter
 	kubeClient                  kubernetes.Interface
 	proxyCfgLister              configv1lister.ProxyLister
@@ -159,12 +168,15 @@ type BuildController struct {
 	imageStreamQueue      *resourceTriggerQueue
 	buildConfigQueue      workqueue.RateLimitingInterface
 	controllerConfigQueue workqueue.RateLimitingInterface
+	logArchiveQueue       workqueue.RateLimitingInterface
 
 	buildStore                      buildv1lister.BuildLister
 	secretStore                     v1lister.SecretLister
 	configMapStore                  v1lister.ConfigMapLister
 	serviceAccountStore             v1lister.ServiceAccountLister
 	podStore                        v1lister.PodLister
+	jobStore                        batchv1lister.JobLister
+	pipelineRunStore                cache.GenericLister
 	imageStreamStore                imagev1lister.ImageStreamLister
 	openShiftConfigConfigMapStore   v1lister.ConfigMapLister
 	controllerManagerConfigMapStore v1lister.ConfigMapLister
@@ -181,6 +193,8 @@ type BuildController struct {
 	buildControllerConfigStoreSynced      cache.InformerSynced
 	imageConfigStoreSynced                cache.InformerSynced
 	podStoreSynced                        cache.InformerSynced
+	jobStoreSynced                        cache.InformerSynced
+	pipelineRunStoreSynced                cache.InformerSynced
 	secretStoreSynced                     cache.InformerSynced
 	serviceAccountStoreSynced             cache.InformerSynced
 	imageStreamStoreSynced                cache.InformerSynced
@@ -196,6 +210,15 @@ type BuildController struct {
 	buildDefaults            builddefaults.BuildDefaults
 	buildOverrides           buildoverrides.BuildOverrides
 	internalRegistryHostname string
+	provenanceConfig         provenance.Config
+	logRedactionPatterns     []*regexp.Regexp
+	logArchiveSink           logarchive.Sink
+	kueueConfig              KueueConfig
+	executionConfig          ExecutionConfig
+	sharedConfigMapsConfig   SharedConfigMapsConfig
+	usageConfig              UsageAccountingConfig
+	memoryRightSizingConfig  MemoryRightSizingConfig
+	pipelineConfig           PipelineConfig
 
 	recorder                record.EventRecorder
 	registryConfData        string
@@ -213,6 +236,7 @@ type BuildControllerParams struct {
 	ImageConfigInformer                configv1informer.ImageInformer
 	ImageStreamInformer                imagev1informer.ImageStreamInformer
 	PodInformer                        kubeinformers.PodInformer
+	JobInformer                        batchv1informer.JobInformer
 	SecretInformer                     kubeinformers.SecretInformer
 	ConfigMapInformer                  kubeinformers.ConfigMapInformer
 	ServiceAccountInformer             kubeinformers.ServiceAccountInformer
@@ -227,9 +251,27 @@ type BuildControllerParams struct {
 	DockerBuildStrategy                *strategy.DockerBuildStrategy
 	SourceBuildStrategy                *strategy.SourceBuildStrategy
 	CustomBuildStrategy                *strategy.CustomBuildStrategy
+	BuildpacksBuildStrategy            *strategy.BuildpacksBuildStrategy
 	BuildDefaults                      builddefaults.BuildDefaults
 	BuildOverrides                     buildoverrides.BuildOverrides
 	InternalRegistryHostname           string
+	Provenance                         provenance.Config
+	LogRedactionPatterns               []*regexp.Regexp
+	LogArchiveSink                     logarchive.Sink
+	Kueue                              KueueConfig
+	// Execution selects how builds are run. JobInformer is required by the Job backend.
+	Execution ExecutionConfig
+	// SharedConfigMaps controls the sharing of build ConfigMaps within a namespace.
+	SharedConfigMaps SharedConfigMapsConfig
+	// Usage controls the accounting of the capacity used by builds.
+	Usage UsageAccountingConfig
+	// MemoryRightSizing controls the retry of OOM-killed builds with larger memory limits.
+	MemoryRightSizing MemoryRightSizingConfig
+	// Pipeline controls the Tekton backend of JenkinsPipeline builds. DynamicClient and
+	// PipelineRunInformer are required by the Tekton backend.
+	Pipeline            PipelineConfig
+	DynamicClient       dynamic.Interface
+	PipelineRunInformer informers.GenericInformer
 }
 
 // NewBuildController creates a new BuildController.
@@ -244,6 +286,8 @@ func NewBuildController(params *BuildControllerParams) *BuildController {
 		buildLister:                      buildLister,
 		buildConfigLister:                buildConfigGetter,
 		buildDeleter:                     params.BuildClient.BuildV1(),
+		buildCreator:                     params.BuildClient.BuildV1(),
+		buildConfigPatcher:               params.BuildClient.BuildV1(),
 		buildControllerConfigLister:      params.BuildControllerConfigInformer.Lister(),
 		proxyCfgLister:                   params.ProxyConfigInformer.Lister(),
 		imageContentSourcePolicyLister:   params.ImageContentSourcePolicyInformer.Lister(),
@@ -268,18 +312,29 @@ func NewBuildController(params *BuildControllerParams) *BuildController {
 		imageTagMirrorSetInformer:        params.ImageTagMirrorSetInformer.Informer(),
 		imageStreamStore:                 params.ImageStreamInformer.Lister(),
 		createStrategy: &typeBasedFactoryStrategy{
-			dockerBuildStrategy: params.DockerBuildStrategy,
-			sourceBuildStrategy: params.SourceBuildStrategy,
-			customBuildStrategy: params.CustomBuildStrategy,
+			dockerBuildStrategy:     params.DockerBuildStrategy,
+			sourceBuildStrategy:     params.SourceBuildStrategy,
+			customBuildStrategy:     params.CustomBuildStrategy,
+			buildpacksBuildStrategy: params.BuildpacksBuildStrategy,
 		},
 		buildDefaults:            params.BuildDefaults,
 		buildOverrides:           params.BuildOverrides,
 		internalRegistryHostname: params.InternalRegistryHostname,
+		provenanceConfig:         params.Provenance,
+		logRedactionPatterns:     params.LogRedactionPatterns,
+		logArchiveSink:           params.LogArchiveSink,
+		kueueConfig:              params.Kueue,
+		executionConfig:          params.Execution,
+		sharedConfigMapsConfig:   params.SharedConfigMaps,
+		usageConfig:              params.Usage,
+		memoryRightSizingConfig:  params.MemoryRightSizing,
+		pipelineConfig:           params.Pipeline,
 
 		buildQueue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "build"),
 		imageStreamQueue:      newResourceTriggerQueue(),
 		buildConfigQueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "build-completed"),
 		controllerConfigQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "build-controller-config"),
+		logArchiveQueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "build-log-archive"),
 
 		recorder:    eventBroadcaster.NewRecorder(buildscheme.EncoderScheme, corev1.EventSource{Component: "build-controller"}),
 		runPolicies: policy.GetAllRunPolicies(buildLister, params.BuildClient.BuildV1()),
@@ -289,6 +344,24 @@ func NewBuildController(params *BuildControllerParams) *BuildController {
 		UpdateFunc: c.podUpdated,
 		DeleteFunc: c.podDeleted,
 	})
+	if params.JobInformer != nil {
+		c.jobClient = params.KubeClient.BatchV1()
+		c.jobStore = params.JobInformer.Lister()
+		c.jobStoreSynced = params.JobInformer.Informer().HasSynced
+		params.JobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: c.jobUpdated,
+			DeleteFunc: c.jobDeleted,
+		})
+	}
+	if params.DynamicClient != nil && params.PipelineRunInformer != nil {
+		c.dynamicClient = params.DynamicClient
+		c.pipelineRunStore = params.PipelineRunInformer.Lister()
+		c.pipelineRunStoreSynced = params.PipelineRunInformer.Informer().HasSynced
+		params.PipelineRunInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: c.pipelineRunUpdated,
+			DeleteFunc: c.pipelineRunDeleted,
+		})
+	}
 	c.buildInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    c.buildAdded,
 		UpdateFunc: c.buildUpdated,
@@ -469,6 +542,7 @@ func (bc *BuildController) Run(workers int, stopCh <-chan struct{}) {
 	defer bc.buildQueue.ShutDown()
 	defer bc.buildConfigQueue.ShutDown()
 	defer bc.controllerConfigQueue.ShutDown()
+	defer bc.logArchiveQueue.ShutDown()
 
 	// Wait for the controller stores to sync before starting any work in this controller.
 	if !cache.WaitForCacheSync(stopCh,
@@ -482,6 +556,14 @@ func (bc *BuildController) Run(workers int, stopCh <-chan struct{}) {
 		utilruntime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
 		return
 	}
+	if bc.jobStoreSynced != nil && !cache.WaitForCacheSync(stopCh, bc.jobStoreSynced) {
+		utilruntime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
+		return
+	}
+	if bc.pipelineRunStoreSynced != nil && !cache.WaitForCacheSync(stopCh, bc.pipelineRunStoreSynced) {
+		utilruntime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
+		return
+	}
 
 	// Integration tests currently do not support cache sync for operator-installed custom resource definitions
 	if os.Getenv("OS_INTEGRATION_TEST") != "true" {
@@ -514,6 +596,12 @@ func (bc *BuildController) Run(workers int, stopCh <-chan struct{}) {
 		go wait.Until(bc.buildConfigWorker, time.Second, stopCh)
 	}
 
+	// Build logs are archived apart from the build workers, as reading and storing them
+	// may take minutes.
+	for i := 0; i < workers; i++ {
+		go wait.Until(bc.logArchiveWorker, time.Second, stopCh)
+	}
+
 	metrics.IntializeMetricsCollector(bc.buildLister)
 
 	<-stopCh
@@ -603,12 +691,23 @@ func (bc *BuildController) handleBuild(build *buildv1.Build) error {
 		}
 	}
 
+	if bc.usePipelineBackend(build) {
+		return bc.handlePipelineBuild(build)
+	}
+
 	if shouldIgnore(build) {
 		return nil
 	}
 
 	klog.V(4).Infof("Handling build %s", buildDesc(build))
 
+	if multiarch.IsMultiArch(build) {
+		return bc.handleMultiArchBuild(build)
+	}
+	if bc.useJobBackend() {
+		return bc.handleJobBuild(build)
+	}
+
 	pod, podErr := bc.podStore.Pods(build.Namespace).Get(buildutil.GetBuildPodName(build))
 
 	// Technically the only error that is returned from retrieving the pod is the
@@ -695,6 +794,7 @@ func (bc *BuildController) cancelBuild(build *buildv1.Build) (*buildUpdate, erro
 	klog.V(4).Infof("Cancelling build %s", buildDesc(build))
 
 	podName := buildutil.GetBuildPodName(build)
+	bc.releaseGatedPod(build, podName)
 	err := bc.podClient.Pods(build.Namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return nil, fmt.Errorf("could not delete build pod %s/%s to cancel build %s: %v", build.Namespace, podName, buildDesc(build), err)
@@ -751,6 +851,34 @@ func (bc *BuildController) handleNewBuild(build *buildv1.Build, pod *corev1.Pod)
 	return bc.createBuildPod(build)
 }
 
+// applySourceMode copies the source mode annotation of the BuildConfig of a Source
+// strategy build onto the build, so that the build pod is created for that mode.
+// An annotation on the build itself takes precedence.
+func (bc *BuildController) applySourceMode(build *buildv1.Build) {
+	if build.Spec.Strategy.SourceStrategy == nil {
+		return
+	}
+	if _, ok := build.Annotations[strategy.SourceModeAnnotation]; ok {
+		return
+	}
+	bcName := sharedbuildutil.ConfigNameForBuild(build)
+	if len(bcName) == 0 {
+		return
+	}
+	config, err := bc.buildConfigLister.BuildConfigs(build.Namespace).Get(bcName)
+	if err != nil {
+		return
+	}
+	mode, ok := config.Annotations[strategy.SourceModeAnnotation]
+	if !ok {
+		return
+	}
+	if build.Annotations == nil {
+		build.Annotations = map[string]string{}
+	}
+	build.Annotations[strategy.SourceModeAnnotation] = mode
+}
+
 // createPodSpec creates a pod spec for the given build, with all references already resolved.
 func (bc *BuildController) createPodSpec(build *buildv1.Build, caData map[string]string) (*corev1.Pod, error) {
 	if build.Spec.Output.To != nil {
@@ -764,6 +892,9 @@ func (bc *BuildController) createPodSpec(build *buildv1.Build, caData map[string
 	build.Status.Reason = ""
 	build.Status.Message = ""
 
+	bc.applyRecommendedMemoryLimit(build)
+	bc.applySourceMode(build)
+
 	// Invoke the strategy to create a build pod.
 	podSpec, err := bc.createStrategy.CreateBuildPod(build, caData, bc.internalRegistryHostname)
 	if err != nil {
@@ -778,6 +909,7 @@ func (bc *BuildController) createPodSpec(build *buildv1.Build, caData map[string
 	if err := bc.buildOverrides.ApplyOverrides(podSpec); err != nil {
 		return nil, fmt.Errorf("failed to apply build overrides for build %s/%s: %v", build.Namespace, build.Name, err)
 	}
+	bc.applyKueue(build, podSpec)
 
 	// Handle resolving ValueFrom references in build environment variables
 	if err := common.ResolveValueFrom(podSpec, bc.kubeClient); err != nil {
@@ -1121,15 +1253,15 @@ func (bc *BuildController) resolveImageReferences(build *buildv1.Build, update *
 	return nil
 }
 
-func retryOnOwnerRef(build *buildv1.Build, pod *corev1.Pod) error {
-	if len(pod.OwnerReferences) > 0 {
+func retryOnOwnerRef(build *buildv1.Build, pod metav1.Object) error {
+	if len(pod.GetOwnerReferences()) > 0 {
 		// check to see if we have retried long enough for the old pod to get GC'ed
 		twoMinutesAgo := metav1.Now().Add(-2 * time.Minute)
 		if !build.CreationTimestamp.Time.Before(twoMinutesAgo) {
 			// requeue for retry via returning an error
 			return fmt.Errorf("waiting since %s to see if pod %s/%s with incorrect uid %s is "+
 				"gc'ed before commencing build %s/%s",
-				build.CreationTimestamp.String(), build.Namespace, pod.Name, pod.UID,
+				build.CreationTimestamp.String(), build.Namespace, pod.GetName(), pod.GetUID(),
 				build.Namespace, build.Name)
 		}
 	}
@@ -1270,6 +1402,17 @@ func (bc *BuildController) createBuildPod(build *buildv1.Build) (*buildUpdate, e
 		return update, nil
 	}
 
+	if multiarch.IsMultiArch(build) {
+		return bc.createMultiArchBuildPods(build, buildPod, pushSecret, additionalCAs)
+	}
+	var sharedConfigMaps []sharedConfigMap
+	if bc.sharedConfigMapsConfig.Enabled {
+		sharedConfigMaps = bc.shareBuildConfigMaps(build, buildPod, additionalCAs)
+	}
+	if bc.useJobBackend() {
+		return bc.createBuildJob(build, buildPod, pushSecret, additionalCAs, sharedConfigMaps)
+	}
+
 	klog.V(4).Infof("Pod %s/%s for build %s is about to be created", build.Namespace, buildPod.Name, buildDesc(build))
 	pod, err := bc.podClient.Pods(build.Namespace).Create(context.TODO(), buildPod, metav1.CreateOptions{})
 	if err != nil && !errors.IsAlreadyExists(err) {
@@ -1310,40 +1453,21 @@ func (bc *BuildController) createBuildPod(build *buildv1.Build) (*buildUpdate, e
 		}
 
 		klog.V(4).Infof("Recognised pod %s/%s as belonging to build %s", build.Namespace, buildPod.Name, buildDesc(build))
-		// Check if the existing pod has the CA ConfigMap properly attached
-		hasCAMap, err := bc.findOwnedConfigMap(existingPod, build.Namespace, buildutil.GetBuildCAConfigMapName(build))
-		if err != nil {
-			return update, fmt.Errorf("could not find certificate authority for build: %v", err)
-		}
-		if !hasCAMap {
-			// Create the CA ConfigMap to mount certificate authorities to the existing build pod
-			update, err = bc.createBuildCAConfigMap(build, existingPod, update, additionalCAs)
-			if err != nil {
-				return update, err
-			}
+		if len(sharedConfigMaps) > 0 {
+			update, err = bc.ensureSharedConfigMaps(build, makeBuildPodOwnerRef(existingPod), sharedConfigMaps, update)
+		} else {
+			update, err = bc.ensureBuildConfigMaps(build, existingPod, update, additionalCAs)
 		}
-
-		hasGlobalCAMap, err := bc.findOwnedConfigMap(existingPod, build.Namespace, buildutil.GetBuildGlobalCAConfigMapName(build))
 		if err != nil {
-			return update, fmt.Errorf("could not find global certificate authority for build: %v", err)
-		}
-		if !hasGlobalCAMap {
-			update, err = bc.createBuildGlobalCAConfigMap(build, existingPod, update)
-			if err != nil {
-				return update, err
-			}
+			return update, err
 		}
 
-		hasRegistryConf, err := bc.findOwnedConfigMap(existingPod, build.Namespace, buildutil.GetBuildSystemConfigMapName(build))
+	} else if len(sharedConfigMaps) > 0 {
+		klog.V(4).Infof("Created pod %s/%s for build %s", build.Namespace, buildPod.Name, buildDesc(build))
+		// Mount the ConfigMaps shared with the other builds of the namespace
+		update, err = bc.ensureSharedConfigMaps(build, makeBuildPodOwnerRef(pod), sharedConfigMaps, update)
 		if err != nil {
-			return update, fmt.Errorf("could not find registry config for build: %v", err)
-		}
-		if !hasRegistryConf {
-			// Create the registry config ConfigMap to mount the registry config to the existing build pod
-			update, err = bc.createBuildSystemConfConfigMap(build, existingPod, update)
-			if err != nil {
-				return update, err
-			}
+			return update, err
 		}
 
 	} else {
@@ -1422,6 +1546,12 @@ func (bc *BuildController) handleActiveBuild(build *buildv1.Build, pod *corev1.P
 					update = transitionToPhase(buildv1.BuildPhasePending, buildv1.StatusReasonMissingPushSecret, "Missing push secret.")
 				}
 			}
+			// A missing push secret is reported in favor of the admission of the pod.
+			if update == nil || update.reason == nil || len(*update.reason) == 0 {
+				if admission := admissionUpdate(build, pod); admission != nil {
+					update = admission
+				}
+			}
 		default:
 			bc.recorder.Eventf(build, corev1.EventTypeWarning, "UnexpectedPodPhase", "Build %s received a pod in pending phase event while in %s phase", resourceName(build.Namespace, build.Name), string(build.Status.Phase))
 		}
@@ -1510,7 +1640,7 @@ func (bc *BuildController) handleCompletedBuild(build *buildv1.Build, pod *corev
 	if isOOMKilled(pod) {
 		update = transitionToPhase(buildv1.BuildPhaseFailed, buildv1.StatusReasonOutOfMemoryKilled, "The build pod was killed due to an out of memory condition.")
 	}
-	setBuildCompletionData(build, pod, update)
+	setBuildCompletionData(build, pod, update, bc.logSnippetRedactor(build, pod))
 
 	return update, nil
 }
@@ -1549,7 +1679,7 @@ func (bc *BuildController) updateBuild(build *buildv1.Build, update *buildUpdate
 
 		// Update build completion timestamp if transitioning to a terminal phase
 		if buildutil.IsTerminalPhase(*update.phase) {
-			setBuildCompletionData(build, pod, update)
+			setBuildCompletionData(build, pod, update, bc.logSnippetRedactor(build, pod))
 		}
 		klog.V(4).Infof("Updating build %s -> %s%s", buildDesc(build), *update.phase, reasonText)
 	}
@@ -1585,6 +1715,18 @@ func (bc *BuildController) updateBuild(build *buildv1.Build, update *buildUpdate
 		if buildutil.IsTerminalPhase(*update.phase) {
 			bc.handleBuildCompletion(patchedBuild)
 		}
+		observeBuildTransition(build.Status.Phase, patchedBuild, pod, update.completionTime != nil)
+	}
+	// Record provenance once the completion data of a successful build has been set,
+	// whether the controller or the build pod moved the build to the Complete phase.
+	if stateTransition || update.completionTime != nil {
+		bc.recordProvenance(patchedBuild, pod)
+	}
+	// The completion time is only set once, when the build reaches a terminal phase.
+	if update.completionTime != nil {
+		bc.recordBuildUsage(patchedBuild, pod)
+		bc.rightSizeBuildMemory(patchedBuild, pod)
+		bc.enqueueLogArchive(patchedBuild)
 	}
 	return nil
 }
@@ -1835,6 +1977,47 @@ func (bc *BuildController) handleBuildConfigError(err error, key interface{}) {
 	bc.buildConfigQueue.Forget(key)
 }
 
+// ensureBuildConfigMaps creates the ConfigMaps mounted into the build pod unless they
+// already exist and are owned by the pod.
+func (bc *BuildController) ensureBuildConfigMaps(build *buildv1.Build, pod *corev1.Pod, update *buildUpdate, additionalCAs map[string]string) (*buildUpdate, error) {
+	// Check if the existing pod has the CA ConfigMap properly attached
+	hasCAMap, err := bc.findOwnedConfigMap(pod, build.Namespace, buildutil.GetBuildCAConfigMapName(build))
+	if err != nil {
+		return update, fmt.Errorf("could not find certificate authority for build: %v", err)
+	}
+	if !hasCAMap {
+		// Create the CA ConfigMap to mount certificate authorities to the existing build pod
+		update, err = bc.createBuildCAConfigMap(build, pod, update, additionalCAs)
+		if err != nil {
+			return update, err
+		}
+	}
+
+	hasGlobalCAMap, err := bc.findOwnedConfigMap(pod, build.Namespace, buildutil.GetBuildGlobalCAConfigMapName(build))
+	if err != nil {
+		return update, fmt.Errorf("could not find global certificate authority for build: %v", err)
+	}
+	if !hasGlobalCAMap {
+		update, err = bc.createBuildGlobalCAConfigMap(build, pod, update)
+		if err != nil {
+			return update, err
+		}
+	}
+
+	hasRegistryConf, err := bc.findOwnedConfigMap(pod, build.Namespace, buildutil.GetBuildSystemConfigMapName(build))
+	if err != nil {
+		return update, fmt.Errorf("could not find registry config for build: %v", err)
+	}
+	if !hasRegistryConf {
+		// Create the registry config ConfigMap to mount the registry config to the existing build pod
+		update, err = bc.createBuildSystemConfConfigMap(build, pod, update)
+		if err != nil {
+			return update, err
+		}
+	}
+	return update, nil
+}
+
 // createBuildGlobalCAConfigMap creates a ConfigMap container certificate authorities used by the build pod
 // that are injected via the platform's proxy support based on setting a particular annotation on the config map
 func (bc *BuildController) createBuildGlobalCAConfigMap(build *buildv1.Build, buildPod *corev1.Pod, update *buildUpdate) (*buildUpdate, error) {
@@ -2175,40 +2358,7 @@ func (bc *BuildController) getAdditionalTrustedCAData(config *configv1.Image) (m
 
 func (bc *BuildController) createBuildRegistriesConfigData(config *configv1.Image, policies []*operatorv1alpha1.ImageContentSourcePolicy,
 	idmsRules []*configv1.ImageDigestMirrorSet, itmsRules []*configv1.ImageTagMirrorSet) (string, error) {
-
-	blockedRegs := []string{}
-	insecureRegs := []string{}
-	if config != nil {
-		insecureRegs = config.Spec.RegistrySources.InsecureRegistries
-		blockedRegs = config.Spec.RegistrySources.BlockedRegistries
-	}
-	if len(insecureRegs) == 0 && len(blockedRegs) == 0 && len(policies) == 0 && len(idmsRules) == 0 && len(itmsRules) == 0 {
-		klog.V(4).Info("using default registry settings for builds")
-		return "", nil
-	}
-
-	configObj := sysregistriesv2.V2RegistriesConf{}
-	// line up with the search list in the default registries.conf in openshift/builder, see PR #266 there
-	configObj.UnqualifiedSearchRegistries = []string{"registry.redhat.io", "registry.access.redhat.com", "quay.io", "docker.io"}
-	err := rutil.EditRegistriesConfig(&configObj, insecureRegs, blockedRegs, policies, idmsRules, itmsRules)
-	if err != nil {
-		klog.V(0).Infof("MCO library had problem building registries config: %s", err.Error())
-		return "", err
-	}
-
-	var newData bytes.Buffer
-	encoder := toml.NewEncoder(&newData)
-	if err := encoder.Encode(configObj); err != nil {
-		return "", err
-	}
-
-	if len(newData.Bytes()) == 0 {
-		klog.V(4).Info("using default insecure registry settings for builds")
-		return "", nil
-	}
-	klog.V(4).Info("overrode registry settings for builds")
-	klog.V(5).Infof("generated registries.conf for build pods: \n%s", string(newData.Bytes()))
-	return string(newData.Bytes()), nil
+	return registryconf.TOML(config, policies, idmsRules, itmsRules)
 }
 
 func (bc *BuildController) createBuildSignaturePolicyData(config *configv1.Image) (string, error) {
@@ -2632,13 +2782,16 @@ func isBadPodStatus(pod *corev1.Pod) (bool, bool, int) {
 
 // setBuildCompletionData sets the build completion time and duration as well as the start time
 // if not already set on the given buildUpdate object.  It also sets the log tail data
-// if applicable.
-func setBuildCompletionData(build *buildv1.Build, pod *corev1.Pod, update *buildUpdate) {
+// if applicable, passing the termination message through redact (if not nil) before
+// it is excerpted.
+func setBuildCompletionData(build *buildv1.Build, pod *corev1.Pod, update *buildUpdate, redact func(string) string) {
 	now := metav1.Now()
 
 	startTime := build.Status.StartTimestamp
 	if startTime == nil {
-		if pod != nil {
+		// Keep a start time already determined by the caller.
+		startTime = update.startTime
+		if startTime == nil && pod != nil {
 			startTime = pod.Status.StartTime
 		}
 
@@ -2648,8 +2801,12 @@ func setBuildCompletionData(build *buildv1.Build, pod *corev1.Pod, update *build
 		update.setStartTime(*startTime)
 	}
 	if build.Status.CompletionTimestamp == nil {
-		update.setCompletionTime(now)
-		update.setDuration(now.Rfc3339Copy().Time.Sub(startTime.Rfc3339Copy().Time))
+		completionTime := now
+		if update.completionTime != nil {
+			completionTime = *update.completionTime
+		}
+		update.setCompletionTime(completionTime)
+		update.setDuration(completionTime.Rfc3339Copy().Time.Sub(startTime.Rfc3339Copy().Time))
 	}
 
 	badContState, badInitContState, initContainerTerminated := isBadPodStatus(pod)
@@ -2663,6 +2820,9 @@ func setBuildCompletionData(build *buildv1.Build, pod *corev1.Pod, update *build
 		if len(msg) == 0 && badInitContState {
 			msg = pod.Status.InitContainerStatuses[initContainerTerminated].State.Terminated.Message
 		}
+		if len(msg) != 0 && redact != nil {
+			msg = redact(msg)
+		}
 		if len(msg) != 0 {
 			parts := strings.Split(strings.TrimRight(msg, "\n"), "\n")
 
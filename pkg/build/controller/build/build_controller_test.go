@@ -1287,7 +1287,7 @@ func TestSetBuildCompletionTimestampAndDurationAndErrorLog(t *testing.T) {
 				},
 			}
 		}
-		setBuildCompletionData(test.build, pod, update)
+		setBuildCompletionData(test.build, pod, update, nil)
 		if len(test.containerErrorMsg) > 0 {
 			if test.containerErrorMsg != *update.logSnippet {
 				t.Errorf("%s: logSnippet should be set to %s", test.name, test.containerErrorMsg)
@@ -2176,8 +2176,11 @@ func newFakeBuildController(buildClient buildv1client.Interface, imageClient ima
 			Image: "test/image:latest",
 		},
 		CustomBuildStrategy: &strategy.CustomBuildStrategy{},
-		BuildDefaults:       builddefaults.BuildDefaults{},
-		BuildOverrides:      buildoverrides.BuildOverrides{},
+		BuildpacksBuildStrategy: &strategy.BuildpacksBuildStrategy{
+			Image: "test/image:latest",
+		},
+		BuildDefaults:  builddefaults.BuildDefaults{},
+		BuildOverrides: buildoverrides.BuildOverrides{},
 	}
 	bc := &fakeBuildController{
 		BuildController:       NewBuildController(params),
@@ -0,0 +1,442 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+// ExecutionBackend selects the kind of workload build pods are run as.
+type ExecutionBackend string
+
+const (
+	// ExecutionBackendPod runs every build as a bare pod created by the build controller.
+	ExecutionBackendPod ExecutionBackend = "Pod"
+	// ExecutionBackendJob wraps the build pod template in a batch/v1 Job, which retries
+	// build pods disrupted by the infrastructure and cleans up finished builds.
+	ExecutionBackendJob ExecutionBackend = "Job"
+)
+
+// ExecutionConfig controls how the build controller runs builds.
+type ExecutionConfig struct {
+	// Backend is the kind of workload builds are run as. Defaults to Pod.
+	Backend ExecutionBackend `json:"backend,omitempty"`
+	// Job holds the settings of the Job backend.
+	Job JobExecutionConfig `json:"job"`
+}
+
+// JobExecutionConfig holds the settings of the Job backend.
+type JobExecutionConfig struct {
+	// BackoffLimit is the number of failed build pods retried before the build fails.
+	// Build pods disrupted by evictions, preemptions or node shutdowns are always retried,
+	// and build pods whose containers exited with an error are never retried.
+	BackoffLimit int32 `json:"backoffLimit"`
+	// TTLSecondsAfterFinished deletes the Job, its pod and the ConfigMaps of the build the
+	// given number of seconds after the build finished. Unset keeps them until the build
+	// is deleted.
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// ValidateExecutionConfig returns an error if the execution configuration is invalid.
+func ValidateExecutionConfig(config ExecutionConfig) error {
+	switch config.Backend {
+	case "", ExecutionBackendPod, ExecutionBackendJob:
+	default:
+		return fmt.Errorf("unknown build execution backend %q, expected %q or %q", config.Backend, ExecutionBackendPod, ExecutionBackendJob)
+	}
+	if config.Job.BackoffLimit < 0 {
+		return fmt.Errorf("the build Job backoffLimit must not be negative")
+	}
+	if ttl := config.Job.TTLSecondsAfterFinished; ttl != nil && *ttl < 0 {
+		return fmt.Errorf("the build Job ttlSecondsAfterFinished must not be negative")
+	}
+	return nil
+}
+
+// useJobBackend returns true if builds are run as Jobs.
+func (bc *BuildController) useJobBackend() bool {
+	return bc.executionConfig.Backend == ExecutionBackendJob
+}
+
+// handleJobBuild drives a build run by the Job backend. The Job carries the name the build
+// pod would have had, while the pods of the Job are named by the Job controller; the pod
+// name annotation of the build follows the current pod of the Job.
+func (bc *BuildController) handleJobBuild(build *buildv1.Build) error {
+	job, err := bc.jobStore.Jobs(build.Namespace).Get(buildutil.GetBuildPodName(build))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err != nil {
+		job = nil
+	}
+	pod, err := bc.getBuildJobPod(job)
+	if err != nil {
+		return err
+	}
+
+	var update *buildUpdate
+	var updateErr error
+
+	switch {
+	case shouldCancel(build):
+		update, err = bc.cancelJobBuild(build)
+	case build.Status.Phase == buildv1.BuildPhaseNew:
+		if job != nil {
+			update, err = bc.handleExistingBuildJob(build, job, pod)
+		} else {
+			update, err = bc.handleNewBuild(build, nil)
+		}
+	case build.Status.Phase == buildv1.BuildPhasePending,
+		build.Status.Phase == buildv1.BuildPhaseRunning:
+		update, err = bc.handleActiveJobBuild(build, job, pod)
+	case buildutil.IsBuildComplete(build):
+		update, err = bc.handleCompletedBuild(build, pod)
+	}
+	if update != nil && !update.isEmpty() {
+		updateErr = bc.updateBuild(build, update, pod)
+	}
+	if err != nil {
+		return err
+	}
+	return updateErr
+}
+
+// handleExistingBuildJob handles a new build whose Job already exists. A Job controlled by
+// the build was created by an earlier sync that failed to update the build.
+func (bc *BuildController) handleExistingBuildJob(build *buildv1.Build, job *batchv1.Job, pod *corev1.Pod) (*buildUpdate, error) {
+	if metav1.IsControlledBy(job, build) {
+		return bc.handleActiveJobBuild(build, job, pod)
+	}
+	if err := retryOnOwnerRef(build, job); err != nil {
+		return nil, err
+	}
+	return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodExists, "The job for this build already exists and is older than the build."), nil
+}
+
+// createBuildJob creates the Job running the given build pod, and the ConfigMaps mounted
+// into its pods.
+func (bc *BuildController) createBuildJob(build *buildv1.Build, buildPod *corev1.Pod, pushSecret *corev1.LocalObjectReference, additionalCAs map[string]string, sharedConfigMaps []sharedConfigMap) (*buildUpdate, error) {
+	update := &buildUpdate{}
+	jobSpec := bc.newBuildJob(build, buildPod)
+
+	klog.V(4).Infof("Job %s/%s for build %s is about to be created", build.Namespace, jobSpec.Name, buildDesc(build))
+	job, err := bc.jobClient.Jobs(build.Namespace).Create(context.TODO(), jobSpec, metav1.CreateOptions{})
+	switch {
+	case err == nil:
+		klog.V(4).Infof("Created job %s/%s for build %s", build.Namespace, job.Name, buildDesc(build))
+	case errors.IsAlreadyExists(err):
+		job, err = bc.jobClient.Jobs(build.Namespace).Get(context.TODO(), jobSpec.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if !metav1.IsControlledBy(job, build) {
+			if err := retryOnOwnerRef(build, job); err != nil {
+				return nil, err
+			}
+			bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Job already exists: %s/%s", job.Namespace, job.Name)
+			return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodExists, "The job for this build already exists and is older than the build."), nil
+		}
+		klog.V(4).Infof("Recognised job %s/%s as belonging to build %s", build.Namespace, job.Name, buildDesc(build))
+	default:
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating build job: %v", err)
+		update.setReason(buildv1.StatusReasonCannotCreateBuildPod)
+		update.setMessage(fmt.Sprintf("Failed creating build job: %s", err.Error()))
+		return update, fmt.Errorf("failed to create build job: %v", err)
+	}
+
+	if len(sharedConfigMaps) > 0 {
+		update, err = bc.ensureSharedConfigMaps(build, makeBuildJobOwnerRef(job), sharedConfigMaps, update)
+	} else {
+		update, err = bc.createBuildJobConfigMaps(build, buildPod, job, update, additionalCAs)
+	}
+	if err != nil {
+		return update, err
+	}
+
+	update = transitionToPhase(buildv1.BuildPhasePending, "", "")
+	if pushSecret != nil {
+		update.setPushSecret(*pushSecret)
+	}
+	update.setPodNameAnnotation(job.Name)
+	if build.Spec.Output.To != nil {
+		update.setOutputRef(build.Spec.Output.To.Name)
+	}
+	return update, nil
+}
+
+// newBuildJob wraps the build pod in a Job. The Job takes over the owner reference to the
+// build and the deadline of the build, and holds the pod template while Kueue has not
+// admitted it.
+func (bc *BuildController) newBuildJob(build *buildv1.Build, buildPod *corev1.Pod) *batchv1.Job {
+	pod := buildPod.DeepCopy()
+	labels := map[string]string{}
+	for k, v := range pod.Labels {
+		labels[k] = v
+	}
+	backoffLimit := bc.executionConfig.Job.BackoffLimit
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			Labels:          labels,
+			Annotations:     map[string]string{buildv1.BuildAnnotation: build.Name},
+			OwnerReferences: pod.OwnerReferences,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   pod.Spec.ActiveDeadlineSeconds,
+			TTLSecondsAfterFinished: bc.executionConfig.Job.TTLSecondsAfterFinished,
+			PodFailurePolicy:        buildJobPodFailurePolicy(),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+				},
+				Spec: pod.Spec,
+			},
+		},
+	}
+
+	// Kueue admits Jobs by resuming them rather than by removing the scheduling gate of
+	// their pods.
+	if hasAdmissionGate(pod) {
+		gates := []corev1.PodSchedulingGate{}
+		for _, gate := range pod.Spec.SchedulingGates {
+			if gate.Name != KueueAdmissionGate {
+				gates = append(gates, gate)
+			}
+		}
+		if len(gates) == 0 {
+			gates = nil
+		}
+		job.Spec.Template.Spec.SchedulingGates = gates
+		delete(job.Spec.Template.Labels, KueueQueueNameLabel)
+		suspend := true
+		job.Spec.Suspend = &suspend
+	}
+	return job
+}
+
+// buildJobPodFailurePolicy retries build pods disrupted by the infrastructure without
+// counting them against the backoff limit, and fails the build as soon as one of its
+// containers exits with an error.
+func buildJobPodFailurePolicy() *batchv1.PodFailurePolicy {
+	return &batchv1.PodFailurePolicy{
+		Rules: []batchv1.PodFailurePolicyRule{
+			{
+				Action: batchv1.PodFailurePolicyActionIgnore,
+				OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{
+					{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue},
+				},
+			},
+			{
+				Action: batchv1.PodFailurePolicyActionFailJob,
+				OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+					Operator: batchv1.PodFailurePolicyOnExitCodesOpNotIn,
+					Values:   []int32{0},
+				},
+			},
+		},
+	}
+}
+
+// createBuildJobConfigMaps creates the ConfigMaps mounted into the pods of the build Job.
+// They are owned by the Job so they are collected along with it.
+func (bc *BuildController) createBuildJobConfigMaps(build *buildv1.Build, buildPod *corev1.Pod, job *batchv1.Job, update *buildUpdate, additionalCAs map[string]string) (*buildUpdate, error) {
+	configMaps := []struct {
+		spec    *corev1.ConfigMap
+		reason  buildv1.StatusReason
+		message string
+	}{
+		{bc.createBuildCAConfigMapSpec(build, buildPod, additionalCAs), "CannotCreateCAConfigMap", "Failed creating build certificate authority configMap."},
+		{bc.createBuildSystemConfigMapSpec(build, buildPod), "CannotCreateBuildSysConfigMap", "Failed creating build system config configMap."},
+		{bc.createBuildGlobalCAConfigMapSpec(build, buildPod), "CannotCreateGlobalCAConfigMap", "Failed creating build proxy certificate authority configMap."},
+	}
+	for _, cm := range configMaps {
+		cm.spec.OwnerReferences = []metav1.OwnerReference{makeBuildJobOwnerRef(job)}
+		_, err := bc.configMapClient.ConfigMaps(build.Namespace).Create(context.TODO(), cm.spec, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating configMap %s: %v", cm.spec.Name, err)
+			update.setReason(cm.reason)
+			update.setMessage(cm.message)
+			return update, fmt.Errorf("failed to create configMap %s/%s: %v", build.Namespace, cm.spec.Name, err)
+		}
+	}
+	return update, nil
+}
+
+// handleActiveJobBuild maps the status of the Job, and of its current pod, to the phase of
+// the build. Failed pods the Job replaces do not fail the build.
+func (bc *BuildController) handleActiveJobBuild(build *buildv1.Build, job *batchv1.Job, pod *corev1.Pod) (*buildUpdate, error) {
+	if job == nil {
+		job = bc.findMissingJob(build)
+		if job == nil {
+			klog.V(4).Infof("Failed to find the build job for build %s. Moving it to Error state", buildDesc(build))
+			return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodDeleted, "The job for this build was deleted before the build completed."), nil
+		}
+	}
+
+	var update *buildUpdate
+	var err error
+	condition := jobFinishedCondition(job)
+	switch {
+	case condition != nil && condition.Type == batchv1.JobComplete:
+		if pod == nil {
+			update = transitionToPhase(buildv1.BuildPhaseComplete, "", "")
+			break
+		}
+		update, err = bc.handleActiveBuild(build, pod)
+	case condition != nil:
+		if pod == nil || pod.Status.Phase != corev1.PodFailed || condition.Reason == batchv1.JobReasonDeadlineExceeded {
+			update = transitionToPhase(buildv1.BuildPhaseFailed, buildv1.StatusReasonGenericBuildFailed, condition.Message)
+			break
+		}
+		update, err = bc.handleActiveBuild(build, pod)
+	case job.Spec.Suspend != nil && *job.Spec.Suspend:
+		if build.Status.Phase == buildv1.BuildPhasePending && build.Status.Reason != StatusReasonWaitingForAdmission {
+			update = transitionToPhase(buildv1.BuildPhasePending, StatusReasonWaitingForAdmission, statusMessageWaitingForAdmission)
+		}
+	case pod == nil || isPodFinished(pod):
+		// The Job has not created its pod yet, or is about to replace a failed pod.
+		if build.Status.Phase == buildv1.BuildPhaseNew {
+			update = transitionToPhase(buildv1.BuildPhasePending, "", "")
+		}
+	default:
+		update, err = bc.handleActiveBuild(build, pod)
+	}
+	if err != nil {
+		return update, err
+	}
+
+	if pod != nil && pod.Name != build.Annotations[buildv1.BuildPodNameAnnotation] {
+		if update == nil {
+			update = &buildUpdate{}
+		}
+		update.setPodNameAnnotation(pod.Name)
+	}
+	return update, nil
+}
+
+// cancelJobBuild deletes the Job of a build, along with its pods, and returns an update to
+// mark the build as cancelled.
+func (bc *BuildController) cancelJobBuild(build *buildv1.Build) (*buildUpdate, error) {
+	klog.V(4).Infof("Cancelling build %s", buildDesc(build))
+
+	jobName := buildutil.GetBuildPodName(build)
+	propagation := metav1.DeletePropagationBackground
+	err := bc.jobClient.Jobs(build.Namespace).Delete(context.TODO(), jobName, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not delete build job %s/%s to cancel build %s: %v", build.Namespace, jobName, buildDesc(build), err)
+	}
+
+	return transitionToPhase(buildv1.BuildPhaseCancelled, buildv1.StatusReasonCancelledBuild, "The build was cancelled by the user."), nil
+}
+
+// getBuildJobPod returns the current pod of a build Job: its newest active pod, or its
+// newest pod if all of them finished. It returns nil if the Job has no pod.
+func (bc *BuildController) getBuildJobPod(job *batchv1.Job) (*corev1.Pod, error) {
+	if job == nil || job.Spec.Selector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := bc.podStore.Pods(job.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	owned := []*corev1.Pod{}
+	for _, pod := range pods {
+		if metav1.IsControlledBy(pod, job) {
+			owned = append(owned, pod)
+		}
+	}
+	if len(owned) == 0 {
+		return nil, nil
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		if isPodFinished(owned[i]) != isPodFinished(owned[j]) {
+			return !isPodFinished(owned[i])
+		}
+		return owned[j].CreationTimestamp.Before(&owned[i].CreationTimestamp)
+	})
+	return owned[0], nil
+}
+
+// findMissingJob makes one last attempt to fetch the Job of a build using the REST client.
+func (bc *BuildController) findMissingJob(build *buildv1.Build) *batchv1.Job {
+	job, err := bc.jobClient.Jobs(build.Namespace).Get(context.TODO(), buildutil.GetBuildPodName(build), metav1.GetOptions{})
+	if err == nil {
+		klog.V(2).Infof("Found missing job for build %s by using direct client.", buildDesc(build))
+		return job
+	}
+	return nil
+}
+
+// jobFinishedCondition returns the Complete or Failed condition of a finished Job, or nil.
+func jobFinishedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// isPodFinished returns true if the pod succeeded, failed or is being deleted.
+func isPodFinished(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed || pod.DeletionTimestamp != nil
+}
+
+// jobUpdated gets called by the job informer event handler whenever a job is updated.
+func (bc *BuildController) jobUpdated(old, cur interface{}) {
+	curJob := cur.(*batchv1.Job)
+	oldJob := old.(*batchv1.Job)
+	if curJob.ResourceVersion == oldJob.ResourceVersion {
+		return
+	}
+	if name := getBuildName(curJob); len(name) > 0 {
+		bc.buildQueue.Add(resourceName(curJob.Namespace, name))
+	}
+}
+
+// jobDeleted gets called by the job informer event handler whenever a job is deleted.
+func (bc *BuildController) jobDeleted(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("couldn't get object from tombstone: %+v", obj))
+			return
+		}
+		job, ok = tombstone.Obj.(*batchv1.Job)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a job: %+v", obj))
+			return
+		}
+	}
+	if name := getBuildName(job); len(name) > 0 {
+		bc.buildQueue.Add(resourceName(job.Namespace, name))
+	}
+}
+
+func makeBuildJobOwnerRef(job *batchv1.Job) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Name:       job.Name,
+		UID:        job.UID,
+	}
+}
@@ -0,0 +1,317 @@
+package build
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+func newFakeJobBuildController(kubeClient kubernetes.Interface) *fakeBuildController {
+	bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+	bc.executionConfig = ExecutionConfig{Backend: ExecutionBackendJob, Job: JobExecutionConfig{BackoffLimit: 1}}
+	bc.jobClient = bc.kubeClient.BatchV1()
+	bc.jobStore = bc.kubeExternalInformers.Batch().V1().Jobs().Lister()
+	return bc
+}
+
+func mockBuildJob(build *buildv1.Build) *batchv1.Job {
+	controller := true
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        buildutil.GetBuildPodName(build),
+			Namespace:   build.Namespace,
+			UID:         "job-uid",
+			Annotations: map[string]string{buildv1.BuildAnnotation: build.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "build.openshift.io/v1", Kind: "Build", Name: build.Name, UID: build.UID, Controller: &controller},
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{batchv1.ControllerUidLabel: "job-uid"}},
+		},
+	}
+}
+
+func mockBuildJobPod(build *buildv1.Build, job *batchv1.Job, suffix string, phase corev1.PodPhase, created time.Time) *corev1.Pod {
+	controller := true
+	pod := mockBuildPod(build)
+	pod.Name = job.Name + "-" + suffix
+	pod.CreationTimestamp = metav1.NewTime(created)
+	pod.Labels = map[string]string{batchv1.ControllerUidLabel: string(job.UID)}
+	pod.OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: "batch/v1", Kind: "Job", Name: job.Name, UID: job.UID, Controller: &controller},
+	}
+	pod.Status.Phase = phase
+	if phase == corev1.PodSucceeded {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}}}
+	}
+	return pod
+}
+
+func TestValidateExecutionConfig(t *testing.T) {
+	negative := int32(-1)
+	for _, tc := range []struct {
+		config    ExecutionConfig
+		expectErr bool
+	}{
+		{config: ExecutionConfig{}},
+		{config: ExecutionConfig{Backend: ExecutionBackendPod}},
+		{config: ExecutionConfig{Backend: ExecutionBackendJob, Job: JobExecutionConfig{BackoffLimit: 2}}},
+		{config: ExecutionConfig{Backend: "Deployment"}, expectErr: true},
+		{config: ExecutionConfig{Backend: ExecutionBackendJob, Job: JobExecutionConfig{BackoffLimit: -1}}, expectErr: true},
+		{config: ExecutionConfig{Backend: ExecutionBackendJob, Job: JobExecutionConfig{TTLSecondsAfterFinished: &negative}}, expectErr: true},
+	} {
+		if err := ValidateExecutionConfig(tc.config); tc.expectErr != (err != nil) {
+			t.Errorf("%#v: expected error %v, got %v", tc.config, tc.expectErr, err)
+		}
+	}
+}
+
+func TestCreateBuildJob(t *testing.T) {
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+	bc := newFakeJobBuildController(kubeClient)
+	defer bc.stop()
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+	build.UID = "build-uid"
+
+	update, err := bc.createBuildPod(build)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobName := buildutil.GetBuildPodName(build)
+	if update.phase == nil || *update.phase != buildv1.BuildPhasePending || update.podNameAnnotation == nil || *update.podNameAnnotation != jobName {
+		t.Errorf("expected the build to be pending on job %s, got %v", jobName, update)
+	}
+
+	if _, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), jobName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no bare build pod to be created, got %v", err)
+	}
+	job, err := kubeClient.BatchV1().Jobs(build.Namespace).Get(context.TODO(), jobName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the build job to be created: %v", err)
+	}
+	if !metav1.IsControlledBy(job, build) {
+		t.Errorf("expected the job to be controlled by the build, got %v", job.OwnerReferences)
+	}
+	if job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 1 {
+		t.Errorf("expected backoff limit 1, got %v", job.Spec.BackoffLimit)
+	}
+	if job.Spec.ActiveDeadlineSeconds == nil {
+		t.Errorf("expected the build deadline to be set on the job")
+	}
+	if policy := job.Spec.PodFailurePolicy; policy == nil || len(policy.Rules) != 2 || policy.Rules[0].Action != batchv1.PodFailurePolicyActionIgnore {
+		t.Errorf("unexpected pod failure policy %#v", policy)
+	}
+	if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever || len(job.Spec.Template.OwnerReferences) != 0 {
+		t.Errorf("unexpected pod template %#v", job.Spec.Template.ObjectMeta)
+	}
+	if getBuildName(&job.Spec.Template) != build.Name || getBuildName(job) != build.Name {
+		t.Errorf("expected the job and its pods to be annotated with the build name")
+	}
+	if job.Spec.Suspend != nil {
+		t.Errorf("expected the job not to be suspended")
+	}
+
+	for _, name := range []string{buildutil.GetBuildCAConfigMapName(build), buildutil.GetBuildSystemConfigMapName(build), buildutil.GetBuildGlobalCAConfigMapName(build)} {
+		cm, err := kubeClient.CoreV1().ConfigMaps(build.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected configMap %s to be created: %v", name, err)
+		}
+		if len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].Kind != "Job" || cm.OwnerReferences[0].Name != jobName {
+			t.Errorf("expected configMap %s to be owned by the job, got %v", name, cm.OwnerReferences)
+		}
+	}
+
+	// A second sync recognises the job it created.
+	if _, err := bc.createBuildPod(build); err != nil {
+		t.Errorf("unexpected error recreating the job: %v", err)
+	}
+}
+
+func TestCreateBuildJobKueue(t *testing.T) {
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+	bc := newFakeJobBuildController(kubeClient)
+	defer bc.stop()
+	bc.kueueConfig = KueueConfig{Enabled: true, QueueName: "builds"}
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+
+	if _, err := bc.createBuildPod(build); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	job, err := kubeClient.BatchV1().Jobs(build.Namespace).Get(context.TODO(), buildutil.GetBuildPodName(build), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Suspend == nil || !*job.Spec.Suspend || job.Labels[KueueQueueNameLabel] != "builds" {
+		t.Errorf("expected a suspended job submitted to the builds queue, got %v %v", job.Spec.Suspend, job.Labels)
+	}
+	if len(job.Spec.Template.Spec.SchedulingGates) != 0 || len(job.Spec.Template.Labels[KueueQueueNameLabel]) != 0 {
+		t.Errorf("expected the pod template to be left to Kueue, got %#v", job.Spec.Template)
+	}
+}
+
+func TestHandleActiveJobBuild(t *testing.T) {
+	now := time.Now()
+	oomKilled := func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}}}
+	}
+
+	tests := []struct {
+		name              string
+		noJob             bool
+		jobCondition      *batchv1.JobCondition
+		suspended         bool
+		pods              map[string]corev1.PodPhase
+		mutatePod         func(*corev1.Pod)
+		expectedPhase     *buildv1.BuildPhase
+		expectedReason    buildv1.StatusReason
+		expectedPodName   string
+		expectNoPodUpdate bool
+	}{
+		{
+			name:              "no pod yet",
+			expectNoPodUpdate: true,
+		},
+		{
+			name:            "running",
+			pods:            map[string]corev1.PodPhase{"a": corev1.PodRunning},
+			expectedPhase:   phasePtr(buildv1.BuildPhaseRunning),
+			expectedPodName: "a",
+		},
+		{
+			name:            "disrupted pod replaced",
+			pods:            map[string]corev1.PodPhase{"a": corev1.PodFailed, "b": corev1.PodPending},
+			expectedPodName: "b",
+		},
+		{
+			name:            "failed pod awaiting replacement",
+			pods:            map[string]corev1.PodPhase{"a": corev1.PodFailed},
+			expectedPodName: "a",
+		},
+		{
+			name:            "complete",
+			jobCondition:    &batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			pods:            map[string]corev1.PodPhase{"a": corev1.PodFailed, "b": corev1.PodSucceeded},
+			expectedPhase:   phasePtr(buildv1.BuildPhaseComplete),
+			expectedPodName: "b",
+		},
+		{
+			name:            "failed by pod failure policy",
+			jobCondition:    &batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonPodFailurePolicy},
+			pods:            map[string]corev1.PodPhase{"a": corev1.PodFailed},
+			mutatePod:       oomKilled,
+			expectedPhase:   phasePtr(buildv1.BuildPhaseFailed),
+			expectedReason:  buildv1.StatusReasonOutOfMemoryKilled,
+			expectedPodName: "a",
+		},
+		{
+			name:           "deadline exceeded",
+			jobCondition:   &batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: batchv1.JobReasonDeadlineExceeded, Message: "Job was active longer than specified deadline"},
+			expectedPhase:  phasePtr(buildv1.BuildPhaseFailed),
+			expectedReason: buildv1.StatusReasonGenericBuildFailed,
+		},
+		{
+			name:           "waiting for admission",
+			suspended:      true,
+			expectedPhase:  phasePtr(buildv1.BuildPhasePending),
+			expectedReason: StatusReasonWaitingForAdmission,
+		},
+		{
+			name:           "job deleted",
+			noJob:          true,
+			expectedPhase:  phasePtr(buildv1.BuildPhaseError),
+			expectedReason: buildv1.StatusReasonBuildPodDeleted,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bc := newFakeJobBuildController(nil)
+			defer bc.stop()
+
+			build := dockerStrategy(mockBuild(buildv1.BuildPhasePending, buildv1.BuildOutput{}))
+			build.Annotations[buildv1.BuildPodNameAnnotation] = buildutil.GetBuildPodName(build)
+			var job *batchv1.Job
+			if !tc.noJob {
+				job = mockBuildJob(build)
+				if tc.jobCondition != nil {
+					job.Status.Conditions = []batchv1.JobCondition{*tc.jobCondition}
+				}
+				if tc.suspended {
+					suspend := true
+					job.Spec.Suspend = &suspend
+				}
+				created := now
+				for _, suffix := range []string{"a", "b"} {
+					phase, ok := tc.pods[suffix]
+					if !ok {
+						continue
+					}
+					pod := mockBuildJobPod(build, job, suffix, phase, created)
+					if tc.mutatePod != nil {
+						tc.mutatePod(pod)
+					}
+					if err := bc.podInformer.GetIndexer().Add(pod); err != nil {
+						t.Fatal(err)
+					}
+					created = created.Add(time.Minute)
+				}
+			}
+
+			pod, err := bc.getBuildJobPod(job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			update, err := bc.handleActiveJobBuild(build, job, pod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if update == nil {
+				update = &buildUpdate{}
+			}
+			if (tc.expectedPhase == nil) != (update.phase == nil) || (tc.expectedPhase != nil && *tc.expectedPhase != *update.phase) {
+				t.Errorf("expected phase %v, got %v", tc.expectedPhase, update)
+			}
+			if len(tc.expectedReason) > 0 && (update.reason == nil || *update.reason != tc.expectedReason) {
+				t.Errorf("expected reason %s, got %v", tc.expectedReason, update)
+			}
+			if len(tc.expectedPodName) > 0 {
+				expected := buildutil.GetBuildPodName(build) + "-" + tc.expectedPodName
+				if update.podNameAnnotation == nil || *update.podNameAnnotation != expected {
+					t.Errorf("expected the pod name annotation to follow pod %s, got %v", expected, update)
+				}
+			}
+			if tc.expectNoPodUpdate && !update.isEmpty() {
+				t.Errorf("expected no update, got %v", update)
+			}
+		})
+	}
+}
+
+func TestCancelJobBuild(t *testing.T) {
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseRunning, buildv1.BuildOutput{}))
+	build.Status.Cancelled = true
+	job := mockBuildJob(build)
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap, job)
+	bc := newFakeJobBuildController(kubeClient)
+	defer bc.stop()
+
+	update, err := bc.cancelJobBuild(build)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update.phase == nil || *update.phase != buildv1.BuildPhaseCancelled {
+		t.Errorf("expected the build to be cancelled, got %v", update)
+	}
+	if _, err := kubeClient.BatchV1().Jobs(build.Namespace).Get(context.TODO(), job.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the build job to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
+)
+
+// logArchiveTimeout bounds the time spent reading and storing the logs of a build.
+const logArchiveTimeout = 2 * time.Minute
+
+// enqueueLogArchive queues the logs of a terminal build to be archived, unless no sink is
+// configured or they have already been archived.
+func (bc *BuildController) enqueueLogArchive(build *buildv1.Build) {
+	if bc.logArchiveSink == nil || len(build.Annotations[logarchive.LocationAnnotation]) > 0 {
+		return
+	}
+	bc.logArchiveQueue.Add(resourceName(build.Namespace, build.Name))
+}
+
+func (bc *BuildController) logArchiveWorker() {
+	for {
+		if quit := bc.logArchiveWork(); quit {
+			return
+		}
+	}
+}
+
+// logArchiveWork gets the next build from the logArchiveQueue and archives its logs
+func (bc *BuildController) logArchiveWork() bool {
+	key, quit := bc.logArchiveQueue.Get()
+	if quit {
+		return true
+	}
+	defer bc.logArchiveQueue.Done(key)
+
+	err := bc.archiveBuildLogs(key.(string))
+	bc.handleLogArchiveError(err, key)
+	return false
+}
+
+// archiveBuildLogs stores the logs of all containers of the build pods in the configured
+// sink, one entry per pod, and records the archive location in the build annotations. It
+// runs once the completion data of the build is set, while the build pods still exist.
+// Builds whose pods are gone are skipped.
+func (bc *BuildController) archiveBuildLogs(key string) error {
+	build, err := bc.getBuildByKey(key)
+	if err != nil || build == nil {
+		return err
+	}
+	if bc.logArchiveSink == nil || len(build.Annotations[logarchive.LocationAnnotation]) > 0 {
+		return nil
+	}
+	pods, err := bc.getBuildLogsPods(build)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		klog.V(2).Infof("Not archiving logs of build %s, whose pods no longer exist", buildDesc(build))
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), logArchiveTimeout)
+	defer cancel()
+
+	entries := make([]logarchive.Entry, 0, len(pods))
+	for _, pod := range pods {
+		logs, err := bc.readBuildPodLogs(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("error reading logs of build pod %s: %v", pod.Name, err)
+		}
+		entries = append(entries, logarchive.Entry{
+			Name: pod.Name,
+			Logs: []byte(bc.logSnippetRedactor(build, pod)(string(logs))),
+		})
+	}
+
+	location, err := bc.logArchiveSink.Archive(ctx, build, entries)
+	if err != nil {
+		return fmt.Errorf("error archiving build logs: %v", err)
+	}
+	klog.V(4).Infof("Archived logs of %d pods of build %s to %s", len(entries), buildDesc(build), location)
+
+	// retry the patch on its own, so that the logs are not stored again
+	update := &buildUpdate{}
+	update.setLogArchiveAnnotation(location)
+	return retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return !errors.IsNotFound(err)
+	}, func() error {
+		_, err := bc.patchBuild(build, update)
+		return err
+	})
+}
+
+// getBuildLogsPods returns every pod labelled with the build, sorted by name. This covers
+// the per architecture and manifest list pods of multi-architecture builds. If no labelled
+// pod is cached, the pod named in the build's pod name annotation is looked up instead,
+// falling back to the default build pod name.
+func (bc *BuildController) getBuildLogsPods(build *buildv1.Build) ([]*corev1.Pod, error) {
+	selector := labels.SelectorFromSet(labels.Set{buildv1.BuildLabel: buildutil.LabelValue(build.Name)})
+	labelled, err := bc.podStore.Pods(build.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	var pods []*corev1.Pod
+	for _, pod := range labelled {
+		// the label value may be truncated, so make sure the pod belongs to this build
+		if pod.Annotations[buildv1.BuildAnnotation] == build.Name {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) > 0 {
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+		return pods, nil
+	}
+
+	podName := build.Annotations[buildv1.BuildPodNameAnnotation]
+	if len(podName) == 0 {
+		podName = buildutil.GetBuildPodName(build)
+	}
+	pod, err := bc.podClient.Pods(build.Namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*corev1.Pod{pod}, nil
+}
+
+// handleLogArchiveError is called by the log archive work loop to check the return of
+// calling archiveBuildLogs. Failures are retried, and reported as an event on the build
+// once the logs are given up on. They do not affect the build.
+func (bc *BuildController) handleLogArchiveError(err error, key interface{}) {
+	if err == nil {
+		bc.logArchiveQueue.Forget(key)
+		return
+	}
+
+	if bc.logArchiveQueue.NumRequeues(key) < maxRetries {
+		klog.V(4).Infof("Retrying log archive of key %v: %v", key, err)
+		bc.logArchiveQueue.AddRateLimited(key)
+		return
+	}
+
+	klog.V(2).Infof("Giving up archiving logs of %v: %v", key, err)
+	bc.logArchiveQueue.Forget(key)
+	if build, getErr := bc.getBuildByKey(key.(string)); getErr == nil && build != nil {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedLogArchive", "Error archiving build logs: %v", err)
+	}
+}
+
+// readBuildPodLogs returns the logs of the init and regular containers of the build pod,
+// each preceded by a header naming the container. Containers whose logs cannot be read,
+// for example because they never started, are noted in the output; an error is only
+// returned if no logs could be read at all.
+func (bc *BuildController) readBuildPodLogs(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	var (
+		buf     bytes.Buffer
+		read    int
+		lastErr error
+	)
+	for _, c := range containers {
+		fmt.Fprintf(&buf, "==> container %s <==\n", c.Name)
+		logs, err := bc.readContainerLogs(ctx, pod, c.Name)
+		if err != nil {
+			lastErr = err
+			fmt.Fprintf(&buf, "unable to read logs: %v\n", err)
+			continue
+		}
+		read++
+		buf.Write(logs)
+		if len(logs) > 0 && logs[len(logs)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	if read == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return buf.Bytes(), nil
+}
+
+func (bc *BuildController) readContainerLogs(ctx context.Context, pod *corev1.Pod, container string) ([]byte, error) {
+	stream, err := bc.podClient.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container}).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return io.ReadAll(stream)
+}
@@ -0,0 +1,133 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	fakebuildv1client "github.com/openshift/client-go/build/clientset/versioned/fake"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/multiarch"
+)
+
+func TestArchiveBuildLogs(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := logarchive.NewSink(logarchive.Config{Directory: &logarchive.DirectoryConfig{Path: dir}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseComplete, buildv1.BuildOutput{}))
+	pod := mockBuildPod(build)
+	pod.Spec.InitContainers = []corev1.Container{{Name: "git-clone"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "docker-build"}}
+	var patchedBuild *buildv1.Build
+	buildClient := fakeBuildClient(build)
+	buildClient.(*fakebuildv1client.Clientset).PrependReactor("patch", "builds", applyBuildPatchReaction(t, build, &patchedBuild))
+	bc := newFakeBuildController(buildClient, nil, fakeKubeExternalClientSet(pod, registryCAConfigMap), nil, nil)
+	defer bc.stop()
+	key := resourceName(build.Namespace, build.Name)
+
+	// Without a configured sink no logs are queued or archived.
+	bc.enqueueLogArchive(build)
+	if bc.logArchiveQueue.Len() > 0 {
+		t.Errorf("expected no log archive to be queued without a sink")
+	}
+	if err := bc.archiveBuildLogs(key); err != nil || patchedBuild != nil {
+		t.Errorf("expected no log archive without a sink, got %v, %v", patchedBuild, err)
+	}
+
+	bc.logArchiveSink = sink
+	bc.enqueueLogArchive(build)
+	bc.logArchiveWork()
+	if bc.logArchiveQueue.Len() > 0 {
+		t.Errorf("expected the log archive queue to be empty")
+	}
+	archive := filepath.Join(dir, build.Namespace, build.Name)
+	if patchedBuild == nil || patchedBuild.Annotations[logarchive.LocationAnnotation] != "file://"+archive+"/" {
+		t.Fatalf("expected log archive annotation for %s, got %v", archive, patchedBuild)
+	}
+	data, err := os.ReadFile(filepath.Join(archive, pod.Name+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "==> container git-clone <==\nfake logs\n==> container docker-build <==\nfake logs\n"
+	if string(data) != expected {
+		t.Errorf("expected archived logs %q, got %q", expected, data)
+	}
+
+	// Builds whose logs have already been archived are skipped.
+	bc.enqueueLogArchive(patchedBuild)
+	if bc.logArchiveQueue.Len() > 0 {
+		t.Errorf("expected already archived build not to be queued")
+	}
+}
+
+func TestArchiveMultiArchBuildLogs(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := logarchive.NewSink(logarchive.Config{Directory: &logarchive.DirectoryConfig{Path: dir}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseComplete, buildv1.BuildOutput{}))
+	buildPod := func(name string, labels map[string]string) *corev1.Pod {
+		pod := mockBuildPod(build)
+		pod.Name = name
+		pod.Labels = map[string]string{buildv1.BuildLabel: buildutil.LabelValue(build.Name)}
+		for k, v := range labels {
+			pod.Labels[k] = v
+		}
+		pod.Spec.Containers = []corev1.Container{{Name: "docker-build"}}
+		return pod
+	}
+	pods := []*corev1.Pod{
+		buildPod(multiarch.PodName(build, "amd64"), map[string]string{multiarch.ArchitectureLabel: "amd64"}),
+		buildPod(multiarch.PodName(build, "arm64"), map[string]string{multiarch.ArchitectureLabel: "arm64"}),
+		buildPod(multiarch.ManifestListPodName(build), map[string]string{multiarch.ManifestListLabel: "true"}),
+	}
+	pods[2].Spec.Containers = []corev1.Container{{Name: multiarch.ManifestListContainer}}
+	// a pod of another build whose truncated label value collides is not archived
+	other := buildPod("other-build", nil)
+	other.Annotations[buildv1.BuildAnnotation] = "other"
+
+	var patchedBuild *buildv1.Build
+	buildClient := fakeBuildClient(build)
+	buildClient.(*fakebuildv1client.Clientset).PrependReactor("patch", "builds", applyBuildPatchReaction(t, build, &patchedBuild))
+	bc := newFakeBuildController(buildClient, nil, fakeKubeExternalClientSet(pods[0], pods[1], pods[2], other, registryCAConfigMap), nil, nil)
+	defer bc.stop()
+	for _, pod := range append(pods, other) {
+		bc.podInformer.GetIndexer().Add(pod)
+	}
+	bc.logArchiveSink = sink
+
+	if err := bc.archiveBuildLogs(resourceName(build.Namespace, build.Name)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive := filepath.Join(dir, build.Namespace, build.Name)
+	if patchedBuild == nil || patchedBuild.Annotations[logarchive.LocationAnnotation] != "file://"+archive+"/" {
+		t.Fatalf("expected log archive annotation for %s, got %v", archive, patchedBuild)
+	}
+	entries, err := os.ReadDir(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(pods) {
+		t.Fatalf("expected %d archive entries, got %v", len(pods), entries)
+	}
+	for _, pod := range pods {
+		data, err := os.ReadFile(filepath.Join(archive, pod.Name+".log"))
+		if err != nil {
+			t.Fatalf("expected the logs of pod %s to be archived: %v", pod.Name, err)
+		}
+		expected := fmt.Sprintf("==> container %s <==\nfake logs\n", pod.Spec.Containers[0].Name)
+		if string(data) != expected {
+			t.Errorf("expected archived logs %q of pod %s, got %q", expected, pod.Name, data)
+		}
+	}
+}
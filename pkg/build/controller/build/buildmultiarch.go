@@ -0,0 +1,464 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/library-go/pkg/image/reference"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/multiarch"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
+)
+
+// handleMultiArchBuild drives a build that requested multiple architectures. Such builds
+// run one build pod per architecture instead of the single build pod, and complete once
+// the manifest list pod has pushed a manifest list referencing the image of every
+// architecture.
+func (bc *BuildController) handleMultiArchBuild(build *buildv1.Build) error {
+	var update *buildUpdate
+	var pod *corev1.Pod
+	var err, updateErr error
+
+	switch {
+	case shouldCancel(build):
+		update, err = bc.cancelMultiArchBuild(build)
+	case build.Status.Phase == buildv1.BuildPhaseNew:
+		update, err = bc.handleNewBuild(build, nil)
+	case build.Status.Phase == buildv1.BuildPhasePending,
+		build.Status.Phase == buildv1.BuildPhaseRunning:
+		update, pod, err = bc.handleActiveMultiArchBuild(build)
+	case buildutil.IsBuildComplete(build):
+		pod = bc.getMultiArchBuildPod(build)
+		update, err = bc.handleCompletedBuild(build, pod)
+	}
+	if update != nil && !update.isEmpty() {
+		updateErr = bc.updateBuild(build, update, pod)
+	}
+	if err != nil {
+		return err
+	}
+	return updateErr
+}
+
+// createMultiArchBuildPods creates a build pod for each requested architecture from the
+// given build pod spec. It is invoked by createBuildPod in place of creating the single
+// build pod. The ConfigMaps mounted into the pods are shared and owned by the pod of the
+// first architecture.
+func (bc *BuildController) createMultiArchBuildPods(build *buildv1.Build, buildPod *corev1.Pod, pushSecret *corev1.LocalObjectReference, additionalCAs map[string]string) (*buildUpdate, error) {
+	update := &buildUpdate{}
+	architectures, err := multiarch.Architectures(build)
+	if err != nil {
+		return transitionToPhase(buildv1.BuildPhaseError, multiarch.StatusReasonInvalidArchitectures, err.Error()), nil
+	}
+	if build.Spec.Output.To == nil || len(build.Spec.Output.To.Name) == 0 {
+		return transitionToPhase(buildv1.BuildPhaseError, multiarch.StatusReasonInvalidArchitectures, "Multi-architecture builds require an output image."), nil
+	}
+	if build.Spec.Strategy.CustomStrategy != nil {
+		return transitionToPhase(buildv1.BuildPhaseError, multiarch.StatusReasonInvalidArchitectures, "Multi-architecture builds are not supported by the custom build strategy."), nil
+	}
+
+	status := map[string]multiarch.ArchitectureStatus{}
+	var firstPod *corev1.Pod
+	for _, arch := range architectures {
+		archPod, err := newArchitectureBuildPod(build, buildPod, arch)
+		if err != nil {
+			return transitionToPhase(buildv1.BuildPhaseError, multiarch.StatusReasonInvalidArchitectures, err.Error()), nil
+		}
+
+		klog.V(4).Infof("Pod %s/%s for architecture %s of build %s is about to be created", build.Namespace, archPod.Name, arch, buildDesc(build))
+		pod, err := bc.podClient.Pods(build.Namespace).Create(context.TODO(), archPod, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			pod, err = bc.podClient.Pods(build.Namespace).Get(context.TODO(), archPod.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			if !strategy.HasOwnerReference(pod, build) {
+				bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Pod already exists: %s/%s", archPod.Namespace, archPod.Name)
+				return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodExists, "The pod for this build already exists and is older than the build."), nil
+			}
+		} else if err != nil {
+			bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating build pod: %v", err)
+			update.setReason(buildv1.StatusReasonCannotCreateBuildPod)
+			update.setMessage(fmt.Sprintf("Failed creating build pod: %s", err.Error()))
+			return update, fmt.Errorf("failed to create build pod: %v", err)
+		} else {
+			klog.V(4).Infof("Created pod %s/%s for architecture %s of build %s", build.Namespace, pod.Name, arch, buildDesc(build))
+		}
+		if firstPod == nil {
+			firstPod = pod
+		}
+		status[arch] = multiarch.ArchitectureStatus{Phase: buildv1.BuildPhasePending, PodName: pod.Name}
+	}
+
+	update, err = bc.ensureBuildConfigMaps(build, firstPod, update, additionalCAs)
+	if err != nil {
+		return update, err
+	}
+
+	statusValue, err := multiarch.FormatStatus(status)
+	if err != nil {
+		return update, err
+	}
+	update = transitionToPhase(buildv1.BuildPhasePending, "", "")
+	if pushSecret != nil {
+		update.setPushSecret(*pushSecret)
+	}
+	update.setPodNameAnnotation(firstPod.Name)
+	update.setOutputRef(build.Spec.Output.To.Name)
+	update.setArchitectureStatus(statusValue)
+	return update, nil
+}
+
+// newArchitectureBuildPod returns the build pod of the given architecture. The pod is
+// pinned to nodes of the architecture and pushes to the output image tagged with the
+// architecture.
+func newArchitectureBuildPod(build *buildv1.Build, buildPod *corev1.Pod, arch string) (*corev1.Pod, error) {
+	pod := buildPod.DeepCopy()
+	pod.Name = multiarch.PodName(build, arch)
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[multiarch.ArchitectureLabel] = arch
+	if pod.Spec.NodeSelector == nil {
+		pod.Spec.NodeSelector = map[string]string{}
+	}
+	pod.Spec.NodeSelector[corev1.LabelArchStable] = arch
+
+	podBuild, err := common.GetBuildFromPod(pod)
+	if err != nil {
+		return nil, err
+	}
+	image, err := multiarch.ArchitectureImage(podBuild.Spec.Output.To.Name, arch)
+	if err != nil {
+		return nil, err
+	}
+	podBuild.Spec.Output.To = &corev1.ObjectReference{Kind: "DockerImage", Name: image}
+	podBuild.Status.OutputDockerImageReference = image
+	if err := common.SetBuildInPod(pod, podBuild); err != nil {
+		return nil, err
+	}
+
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return nil, err
+	}
+	registry := ref.Registry
+	ref.Registry = ""
+	containers := [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers}
+	for _, list := range containers {
+		for i := range list {
+			for j, env := range list[i].Env {
+				switch env.Name {
+				case "OUTPUT_REGISTRY":
+					list[i].Env[j].Value = registry
+				case "OUTPUT_IMAGE":
+					list[i].Env[j].Value = ref.String()
+				}
+			}
+		}
+	}
+	return pod, nil
+}
+
+// handleActiveMultiArchBuild updates the status of each architecture from its build pod.
+// The build fails as soon as one architecture fails, and the manifest list pod is run once
+// all architectures have been built. The returned pod is the one whose status determines
+// the completion data of the build.
+func (bc *BuildController) handleActiveMultiArchBuild(build *buildv1.Build) (*buildUpdate, *corev1.Pod, error) {
+	architectures, err := multiarch.Architectures(build)
+	if err != nil {
+		return transitionToPhase(buildv1.BuildPhaseError, multiarch.StatusReasonInvalidArchitectures, err.Error()), nil, nil
+	}
+
+	var (
+		status     = map[string]multiarch.ArchitectureStatus{}
+		pods       = map[string]*corev1.Pod{}
+		firstPod   *corev1.Pod
+		failed     *buildUpdate
+		failedPod  *corev1.Pod
+		running    bool
+		gated      bool
+		startTime  *metav1.Time
+		succeeded  int
+		activePods []string
+	)
+	for _, arch := range architectures {
+		podName := multiarch.PodName(build, arch)
+		pod, err := bc.podStore.Pods(build.Namespace).Get(podName)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, nil, err
+		}
+		if pod == nil {
+			pod = bc.findMissingMultiArchPod(build, podName)
+		}
+		pods[arch] = pod
+		if firstPod == nil {
+			firstPod = pod
+		}
+
+		gated = gated || hasAdmissionGate(pod)
+		phase, reason, message := architecturePhase(pod)
+		status[arch] = multiarch.ArchitectureStatus{Phase: phase, PodName: podName, Message: message}
+		switch phase {
+		case buildv1.BuildPhaseFailed, buildv1.BuildPhaseError:
+			if failed == nil {
+				failed = transitionToPhase(phase, reason, fmt.Sprintf("The build for architecture %s failed: %s", arch, message))
+				failedPod = pod
+			}
+		case buildv1.BuildPhaseRunning:
+			running = true
+			activePods = append(activePods, podName)
+			if pod.Status.StartTime != nil && (startTime == nil || pod.Status.StartTime.Before(startTime)) {
+				startTime = pod.Status.StartTime
+			}
+		case buildv1.BuildPhaseComplete:
+			succeeded++
+		default:
+			activePods = append(activePods, podName)
+		}
+	}
+
+	update := &buildUpdate{}
+	pod := firstPod
+	switch {
+	case failed != nil:
+		update, pod = failed, failedPod
+		// The remaining architectures cannot produce a usable manifest list anymore.
+		for _, name := range activePods {
+			if err := bc.podClient.Pods(build.Namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				utilruntime.HandleError(fmt.Errorf("could not delete build pod %s/%s of failed build %s: %v", build.Namespace, name, buildDesc(build), err))
+			}
+		}
+	case succeeded == len(architectures):
+		update, pod, err = bc.handleManifestListPod(build, firstPod, architectures)
+		if err != nil {
+			return update, pod, err
+		}
+	case running && build.Status.Phase != buildv1.BuildPhaseRunning:
+		update = transitionToPhase(buildv1.BuildPhaseRunning, "", "")
+		if startTime != nil {
+			update.setStartTime(*startTime)
+		}
+	case build.Status.Phase == buildv1.BuildPhasePending:
+		// The build waits for admission as long as the pod of any architecture is gated.
+		switch {
+		case gated && build.Status.Reason != StatusReasonWaitingForAdmission:
+			update = transitionToPhase(buildv1.BuildPhasePending, StatusReasonWaitingForAdmission, statusMessageWaitingForAdmission)
+		case !gated && build.Status.Reason == StatusReasonWaitingForAdmission:
+			update = transitionToPhase(buildv1.BuildPhasePending, "", "")
+		}
+	}
+
+	statusValue, err := multiarch.FormatStatus(status)
+	if err != nil {
+		return update, pod, err
+	}
+	if build.Annotations[multiarch.ArchitectureStatusAnnotation] != statusValue {
+		update.setArchitectureStatus(statusValue)
+	}
+	return update, pod, nil
+}
+
+// architecturePhase returns the phase of the build of a single architecture from its
+// build pod, along with the reason and message of failed builds.
+func architecturePhase(pod *corev1.Pod) (buildv1.BuildPhase, buildv1.StatusReason, string) {
+	if pod == nil {
+		return buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodDeleted, "The pod for this build was deleted before the build completed."
+	}
+	switch pod.Status.Phase {
+	case corev1.PodPending:
+		for _, initContainer := range pod.Status.InitContainerStatuses {
+			if initContainer.Name == strategy.GitCloneContainer && (initContainer.State.Running != nil || initContainer.State.Terminated != nil) {
+				return buildv1.BuildPhaseRunning, "", ""
+			}
+		}
+		return buildv1.BuildPhasePending, "", ""
+	case corev1.PodRunning:
+		return buildv1.BuildPhaseRunning, "", ""
+	case corev1.PodSucceeded:
+		if len(pod.Status.ContainerStatuses) == 0 {
+			return buildv1.BuildPhaseError, buildv1.StatusReasonNoBuildContainerStatus, "The pod for this build has no container statuses indicating success or failure."
+		}
+		for _, info := range pod.Status.ContainerStatuses {
+			if info.State.Terminated != nil && info.State.Terminated.ExitCode != 0 {
+				return buildv1.BuildPhaseError, buildv1.StatusReasonFailedContainer, "The pod for this build has at least one container with a non-zero exit status."
+			}
+		}
+		return buildv1.BuildPhaseComplete, "", ""
+	case corev1.PodFailed:
+		switch {
+		case isOOMKilled(pod):
+			return buildv1.BuildPhaseFailed, buildv1.StatusReasonOutOfMemoryKilled, "The build pod was killed due to an out of memory condition."
+		case isPodEvicted(pod):
+			return buildv1.BuildPhaseFailed, buildv1.StatusReasonBuildPodEvicted, pod.Status.Message
+		case pod.DeletionTimestamp != nil:
+			return buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodDeleted, "The pod for this build was deleted before the build completed."
+		default:
+			return buildv1.BuildPhaseFailed, buildv1.StatusReasonGenericBuildFailed, "Generic Build failure - check logs for details."
+		}
+	}
+	return buildv1.BuildPhasePending, "", ""
+}
+
+// handleManifestListPod creates the manifest list pod of a build whose architectures have
+// all been built, and completes the build with the digest of the manifest list once the
+// pod has pushed it. The returned pod is the one whose status determines the completion
+// data of the build.
+func (bc *BuildController) handleManifestListPod(build *buildv1.Build, firstPod *corev1.Pod, architectures []string) (*buildUpdate, *corev1.Pod, error) {
+	podName := multiarch.ManifestListPodName(build)
+	pod, err := bc.podStore.Pods(build.Namespace).Get(podName)
+	if err != nil && !errors.IsNotFound(err) {
+		return &buildUpdate{}, firstPod, err
+	}
+	if pod == nil {
+		pod = bc.findMissingMultiArchPod(build, podName)
+	}
+	if pod == nil {
+		return bc.createManifestListPod(build, firstPod, architectures)
+	}
+	if !strategy.HasOwnerReference(pod, build) {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Pod already exists: %s/%s", pod.Namespace, pod.Name)
+		return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodExists, "The pod for this build already exists and is older than the build."), firstPod, nil
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		digest, err := multiarch.ManifestListDigest(pod)
+		if err != nil {
+			return transitionToPhase(buildv1.BuildPhaseFailed, multiarch.StatusReasonManifestListPushFailed, fmt.Sprintf("Failed to push the manifest list: %v", err)), pod, nil
+		}
+		klog.V(4).Infof("Pushed manifest list %s@%s for build %s", build.Status.OutputDockerImageReference, digest, buildDesc(build))
+		update := transitionToPhase(buildv1.BuildPhaseComplete, "", "")
+		update.setOutputDigest(digest)
+		return update, firstPod, nil
+	case corev1.PodFailed:
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedManifestListPush", "Error pushing the manifest list to %s, see the logs of pod %s", build.Status.OutputDockerImageReference, pod.Name)
+		return transitionToPhase(buildv1.BuildPhaseFailed, multiarch.StatusReasonManifestListPushFailed, fmt.Sprintf("Failed to push the manifest list, see the logs of pod %s for details.", pod.Name)), pod, nil
+	}
+	return &buildUpdate{}, firstPod, nil
+}
+
+// createManifestListPod creates the pod pushing the manifest list of the build.
+func (bc *BuildController) createManifestListPod(build *buildv1.Build, firstPod *corev1.Pod, architectures []string) (*buildUpdate, *corev1.Pod, error) {
+	if firstPod == nil {
+		return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodDeleted, "The pod for this build was deleted before the build completed."), nil, nil
+	}
+	pod, err := newManifestListPod(build, firstPod, architectures)
+	if err != nil {
+		return transitionToPhase(buildv1.BuildPhaseFailed, multiarch.StatusReasonManifestListPushFailed, fmt.Sprintf("Failed to push the manifest list: %v", err)), firstPod, nil
+	}
+	klog.V(4).Infof("Manifest list pod %s/%s of build %s is about to be created", build.Namespace, pod.Name, buildDesc(build))
+	if _, err := bc.podClient.Pods(build.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating manifest list pod: %v", err)
+		return &buildUpdate{}, firstPod, fmt.Errorf("failed to create manifest list pod: %v", err)
+	}
+	return &buildUpdate{}, firstPod, nil
+}
+
+// newManifestListPod returns the pod assembling the images of every architecture into a
+// manifest list and pushing it to the output image. It is derived from the build pod of
+// the first architecture, whose service account, volumes and environment give it the push
+// secret, registries.conf and certificate authorities of the build, and runs buildah in
+// the builder image on nodes of any architecture.
+func newManifestListPod(build *buildv1.Build, archPod *corev1.Pod, architectures []string) (*corev1.Pod, error) {
+	if len(archPod.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("the build pod %s/%s has no containers", archPod.Namespace, archPod.Name)
+	}
+	target := build.Status.OutputDockerImageReference
+	images := make([]string, 0, len(architectures))
+	for _, arch := range architectures {
+		image, err := multiarch.ArchitectureImage(target, arch)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	archPod = archPod.DeepCopy()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            multiarch.ManifestListPodName(build),
+			Namespace:       archPod.Namespace,
+			Labels:          archPod.Labels,
+			Annotations:     archPod.Annotations,
+			OwnerReferences: archPod.OwnerReferences,
+		},
+		Spec: archPod.Spec,
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	delete(pod.Labels, multiarch.ArchitectureLabel)
+	pod.Labels[multiarch.ManifestListLabel] = "true"
+	pod.Spec.NodeName = ""
+	delete(pod.Spec.NodeSelector, corev1.LabelArchStable)
+	pod.Spec.SchedulingGates = nil
+	pod.Spec.InitContainers = nil
+
+	container := pod.Spec.Containers[0]
+	container.Name = multiarch.ManifestListContainer
+	container.Command = []string{"/bin/sh", "-c", multiarch.ManifestListScript}
+	container.Args = nil
+	container.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: multiarch.ArchitectureImagesEnv, Value: strings.Join(images, " ")},
+		corev1.EnvVar{Name: multiarch.ManifestListImageEnv, Value: target},
+		corev1.EnvVar{Name: multiarch.CertsDirEnv, Value: strategy.ConfigMapCertsMountPath},
+		corev1.EnvVar{Name: multiarch.GlobalCADirEnv, Value: strategy.ConfigMapBuildGlobalCAMountPath},
+	)
+	pod.Spec.Containers = []corev1.Container{container}
+	return pod, nil
+}
+
+// cancelMultiArchBuild deletes the build pods of all architectures and the manifest list
+// pod, and cancels the build.
+func (bc *BuildController) cancelMultiArchBuild(build *buildv1.Build) (*buildUpdate, error) {
+	architectures, _ := multiarch.Architectures(build)
+	for _, arch := range architectures {
+		podName := multiarch.PodName(build, arch)
+		bc.releaseGatedPod(build, podName)
+		err := bc.podClient.Pods(build.Namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("could not delete build pod %s/%s to cancel build %s: %v", build.Namespace, podName, buildDesc(build), err)
+		}
+	}
+	podName := multiarch.ManifestListPodName(build)
+	if err := bc.podClient.Pods(build.Namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not delete manifest list pod %s/%s to cancel build %s: %v", build.Namespace, podName, buildDesc(build), err)
+	}
+	return bc.cancelBuild(build)
+}
+
+// getMultiArchBuildPod returns the pod named in the build's pod name annotation, which
+// is the pod of the first architecture.
+func (bc *BuildController) getMultiArchBuildPod(build *buildv1.Build) *corev1.Pod {
+	podName := build.Annotations[buildv1.BuildPodNameAnnotation]
+	if len(podName) == 0 {
+		return nil
+	}
+	pod, err := bc.podStore.Pods(build.Namespace).Get(podName)
+	if err != nil {
+		return nil
+	}
+	return pod
+}
+
+// findMissingMultiArchPod uses the REST client directly to determine if the pod of an
+// architecture exists when it is not found in the cache.
+func (bc *BuildController) findMissingMultiArchPod(build *buildv1.Build, podName string) *corev1.Pod {
+	pod, err := bc.podClient.Pods(build.Namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err == nil {
+		klog.V(2).Infof("Found missing pod %s for build %s by using direct client.", podName, buildDesc(build))
+		return pod
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/multiarch"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
+)
+
+func mockMultiArchBuild(phase buildv1.BuildPhase) *buildv1.Build {
+	build := dockerStrategy(mockBuild(phase, buildv1.BuildOutput{
+		To: &corev1.ObjectReference{Kind: "DockerImage", Name: "registry.io/ns/app:v1"},
+	}))
+	build.Annotations[multiarch.ArchitecturesAnnotation] = "amd64,arm64"
+	return build
+}
+
+func TestCreateMultiArchBuildPods(t *testing.T) {
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+	bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+	defer bc.stop()
+	build := mockMultiArchBuild(buildv1.BuildPhaseNew)
+
+	update, err := bc.createBuildPod(build)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update.phase == nil || *update.phase != buildv1.BuildPhasePending {
+		t.Fatalf("expected the build to be pending, got %v", update)
+	}
+	if update.podNameAnnotation == nil || *update.podNameAnnotation != multiarch.PodName(build, "amd64") {
+		t.Errorf("expected the pod name annotation to name the first architecture pod, got %v", update)
+	}
+	if update.archStatus == nil {
+		t.Fatalf("expected the architecture status to be set")
+	}
+
+	if _, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), buildutil.GetBuildPodName(build), metav1.GetOptions{}); err == nil {
+		t.Errorf("expected no single build pod to be created")
+	}
+	for _, arch := range []string{"amd64", "arm64"} {
+		pod, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), multiarch.PodName(build, arch), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected the pod of architecture %s: %v", arch, err)
+		}
+		if pod.Spec.NodeSelector[corev1.LabelArchStable] != arch || pod.Labels[multiarch.ArchitectureLabel] != arch {
+			t.Errorf("expected pod of architecture %s to be pinned, got %v", arch, pod.Spec.NodeSelector)
+		}
+		podBuild, err := common.GetBuildFromPod(pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "registry.io/ns/app:v1-" + arch; podBuild.Spec.Output.To.Name != expected {
+			t.Errorf("expected pod of architecture %s to push %s, got %s", arch, expected, podBuild.Spec.Output.To.Name)
+		}
+		if podBuild.Name != build.Name {
+			t.Errorf("expected the pod of architecture %s to report to build %s, got %s", arch, build.Name, podBuild.Name)
+		}
+	}
+}
+
+func TestCreateMultiArchBuildPodsInvalid(t *testing.T) {
+	bc := newFakeBuildController(nil, nil, nil, nil, nil)
+	defer bc.stop()
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+	build.Annotations[multiarch.ArchitecturesAnnotation] = "amd64"
+
+	update, err := bc.createBuildPod(build)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update.phase == nil || *update.phase != buildv1.BuildPhaseError || *update.reason != multiarch.StatusReasonInvalidArchitectures {
+		t.Errorf("expected the build to fail for a missing output, got %v", update)
+	}
+}
+
+func TestHandleActiveMultiArchBuild(t *testing.T) {
+	const listDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	controller := true
+	ownedPod := func(build *buildv1.Build, name string, phase corev1.PodPhase) *corev1.Pod {
+		pod := mockBuildPod(build)
+		pod.Name = name
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: strategy.BuildControllerRefKind.GroupVersion().String(),
+			Kind:       strategy.BuildControllerRefKind.Kind,
+			Name:       build.Name,
+			UID:        build.UID,
+			Controller: &controller,
+		}}
+		pod.Spec.Containers = []corev1.Container{{Name: "docker-build", Image: "builder:latest"}}
+		pod.Status.Phase = phase
+		return pod
+	}
+	archPod := func(build *buildv1.Build, arch string, phase corev1.PodPhase) *corev1.Pod {
+		pod := ownedPod(build, multiarch.PodName(build, arch), phase)
+		pod.Labels = map[string]string{multiarch.ArchitectureLabel: arch}
+		pod.Spec.NodeSelector = map[string]string{corev1.LabelArchStable: arch}
+		if phase == corev1.PodSucceeded {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}}}
+		}
+		return pod
+	}
+	manifestListPod := func(build *buildv1.Build, phase corev1.PodPhase, message string) *corev1.Pod {
+		pod := ownedPod(build, multiarch.ManifestListPodName(build), phase)
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  multiarch.ManifestListContainer,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+		}}
+		return pod
+	}
+
+	tests := []struct {
+		name                  string
+		amd64, arm64          corev1.PodPhase
+		manifestListPhase     corev1.PodPhase
+		manifestListMessage   string
+		expectedPhase         *buildv1.BuildPhase
+		expectedReason        buildv1.StatusReason
+		expectManifestListPod bool
+	}{
+		{
+			name:          "running",
+			amd64:         corev1.PodRunning,
+			arm64:         corev1.PodPending,
+			expectedPhase: phasePtr(buildv1.BuildPhaseRunning),
+		},
+		{
+			name:  "one architecture done",
+			amd64: corev1.PodSucceeded,
+			arm64: corev1.PodPending,
+		},
+		{
+			name:           "one architecture failed",
+			amd64:          corev1.PodSucceeded,
+			arm64:          corev1.PodFailed,
+			expectedPhase:  phasePtr(buildv1.BuildPhaseFailed),
+			expectedReason: buildv1.StatusReasonGenericBuildFailed,
+		},
+		{
+			name:                  "all architectures done",
+			amd64:                 corev1.PodSucceeded,
+			arm64:                 corev1.PodSucceeded,
+			expectManifestListPod: true,
+		},
+		{
+			name:              "manifest list pushing",
+			amd64:             corev1.PodSucceeded,
+			arm64:             corev1.PodSucceeded,
+			manifestListPhase: corev1.PodRunning,
+		},
+		{
+			name:                "manifest list pushed",
+			amd64:               corev1.PodSucceeded,
+			arm64:               corev1.PodSucceeded,
+			manifestListPhase:   corev1.PodSucceeded,
+			manifestListMessage: listDigest,
+			expectedPhase:       phasePtr(buildv1.BuildPhaseComplete),
+		},
+		{
+			name:                "manifest list push failed",
+			amd64:               corev1.PodSucceeded,
+			arm64:               corev1.PodSucceeded,
+			manifestListPhase:   corev1.PodFailed,
+			manifestListMessage: "Error: unauthorized",
+			expectedPhase:       phasePtr(buildv1.BuildPhaseFailed),
+			expectedReason:      multiarch.StatusReasonManifestListPushFailed,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+			bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+			defer bc.stop()
+
+			build := mockMultiArchBuild(buildv1.BuildPhasePending)
+			build.Status.OutputDockerImageReference = "registry.io/ns/app:v1"
+			for arch, phase := range map[string]corev1.PodPhase{"amd64": tc.amd64, "arm64": tc.arm64} {
+				if err := bc.podInformer.GetIndexer().Add(archPod(build, arch, phase)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(tc.manifestListPhase) > 0 {
+				if err := bc.podInformer.GetIndexer().Add(manifestListPod(build, tc.manifestListPhase, tc.manifestListMessage)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			update, _, err := bc.handleActiveMultiArchBuild(build)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (tc.expectedPhase == nil) != (update.phase == nil) || (tc.expectedPhase != nil && *tc.expectedPhase != *update.phase) {
+				t.Errorf("expected phase %v, got %v", tc.expectedPhase, update)
+			}
+			if len(tc.expectedReason) > 0 && (update.reason == nil || *update.reason != tc.expectedReason) {
+				t.Errorf("expected reason %s, got %v", tc.expectedReason, update)
+			}
+			if tc.expectedPhase != nil && *tc.expectedPhase == buildv1.BuildPhaseComplete && (update.outputDigest == nil || *update.outputDigest != listDigest) {
+				t.Errorf("expected the manifest list digest to be recorded, got %v", update)
+			}
+
+			pod, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), multiarch.ManifestListPodName(build), metav1.GetOptions{})
+			if tc.expectManifestListPod != (err == nil) {
+				t.Fatalf("expected manifest list pod %v, got %v", tc.expectManifestListPod, err)
+			}
+			if tc.expectManifestListPod {
+				if len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Image != "builder:latest" || len(pod.Spec.InitContainers) != 0 {
+					t.Errorf("expected a single container running the builder image, got %v", pod.Spec)
+				}
+				if _, ok := pod.Spec.NodeSelector[corev1.LabelArchStable]; ok {
+					t.Errorf("expected the manifest list pod not to be pinned to an architecture, got %v", pod.Spec.NodeSelector)
+				}
+				if !strategy.HasOwnerReference(pod, build) || pod.Annotations[buildv1.BuildAnnotation] != build.Name {
+					t.Errorf("expected the manifest list pod to belong to the build, got %v", pod.ObjectMeta)
+				}
+				env := map[string]string{}
+				for _, e := range pod.Spec.Containers[0].Env {
+					env[e.Name] = e.Value
+				}
+				if env[multiarch.ManifestListImageEnv] != "registry.io/ns/app:v1" || !strings.Contains(env[multiarch.ArchitectureImagesEnv], "registry.io/ns/app:v1-arm64") {
+					t.Errorf("unexpected manifest list pod environment %v", env)
+				}
+			}
+
+			if update.archStatus == nil {
+				t.Fatalf("expected the architecture status to be recorded")
+			}
+			build.Annotations[multiarch.ArchitectureStatusAnnotation] = *update.archStatus
+			status, err := multiarch.ParseStatus(build)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(status) != 2 || status["amd64"].PodName != multiarch.PodName(build, "amd64") {
+				t.Errorf("unexpected architecture status %v", status)
+			}
+		})
+	}
+}
+
+func phasePtr(phase buildv1.BuildPhase) *buildv1.BuildPhase {
+	return &phase
+}
@@ -0,0 +1,290 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	sharedbuildutil "github.com/openshift/library-go/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/multiarch"
+)
+
+const (
+	// OOMRetryOfAnnotation is set on builds started to retry an OOM-killed build, and holds
+	// the name of the first build that was killed.
+	OOMRetryOfAnnotation = "build.openshift.io/oom-retry-of"
+	// OOMRetryAttemptAnnotation is the number of the retry of an OOM-killed build.
+	OOMRetryAttemptAnnotation = "build.openshift.io/oom-retry-attempt"
+	// RecommendedMemoryLimitAnnotation is set on a BuildConfig to the memory limit of the
+	// last retry of an OOM-killed build that completed. Builds of the BuildConfig that do
+	// not set a memory limit of their own use it.
+	RecommendedMemoryLimitAnnotation = "build.openshift.io/recommended-memory-limit"
+
+	// defaultOOMRetryMemoryFactor is the memory limit factor of a retried build by default.
+	defaultOOMRetryMemoryFactor = 2.0
+)
+
+// MemoryRightSizingConfig controls the retry of builds killed due to an out of memory
+// condition with larger memory limits.
+type MemoryRightSizingConfig struct {
+	// Enabled starts a follow-up build for every build killed due to an out of memory
+	// condition, with the memory limit of its pod raised by MemoryFactor up to
+	// MaxMemoryLimit. The memory limit of a follow-up build that completes is recorded on
+	// its BuildConfig, and used by the builds of the BuildConfig that do not set a memory
+	// limit.
+	Enabled bool `json:"enabled"`
+	// MemoryFactor multiplies the memory limit of a killed build. Defaults to 2.
+	MemoryFactor float64 `json:"memoryFactor,omitempty"`
+	// MaxMemoryLimit caps the memory limit of follow-up builds. Builds killed with a memory
+	// limit at the cap are not retried.
+	MaxMemoryLimit resource.Quantity `json:"maxMemoryLimit"`
+}
+
+// ValidateMemoryRightSizingConfig returns an error if the memory right-sizing configuration
+// is invalid.
+func ValidateMemoryRightSizingConfig(config MemoryRightSizingConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if config.MemoryFactor != 0 && config.MemoryFactor <= 1 {
+		return fmt.Errorf("the build memory right-sizing memoryFactor must be greater than 1, got %v", config.MemoryFactor)
+	}
+	if config.MaxMemoryLimit.Sign() <= 0 {
+		return fmt.Errorf("the build memory right-sizing maxMemoryLimit must be set")
+	}
+	return nil
+}
+
+// rightSizeBuildMemory retries a build killed due to an out of memory condition with a
+// larger memory limit, and records the memory limit of a completed retry on its
+// BuildConfig. Failures are reported as events and do not affect the build.
+func (bc *BuildController) rightSizeBuildMemory(build *buildv1.Build, pod *corev1.Pod) {
+	if !bc.memoryRightSizingConfig.Enabled {
+		return
+	}
+	switch {
+	case build.Status.Phase == buildv1.BuildPhaseFailed && build.Status.Reason == buildv1.StatusReasonOutOfMemoryKilled:
+		bc.retryOOMKilledBuild(build, pod)
+	case build.Status.Phase == buildv1.BuildPhaseComplete && len(build.Annotations[OOMRetryOfAnnotation]) > 0:
+		if err := bc.recordRecommendedMemoryLimit(build); err != nil {
+			bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedMemoryRecommendation", "Error recording the memory limit of the build on its BuildConfig: %v", err)
+			klog.V(2).Infof("Failed to record the memory limit of build %s on its BuildConfig: %v", buildDesc(build), err)
+		}
+	}
+}
+
+// retryOOMKilledBuild starts a follow-up build of an OOM-killed build with its memory limit
+// raised by the configured factor, up to the configured cap.
+func (bc *BuildController) retryOOMKilledBuild(build *buildv1.Build, pod *corev1.Pod) {
+	if build.Spec.Source.Binary != nil {
+		bc.recorder.Eventf(build, corev1.EventTypeNormal, "OOMRetrySkipped", "Builds with binary input cannot be retried with a larger memory limit")
+		return
+	}
+	current := podMemoryLimit(pod)
+	if current.IsZero() {
+		current = build.Spec.Resources.Limits[corev1.ResourceMemory]
+	}
+	if current.IsZero() {
+		bc.recorder.Eventf(build, corev1.EventTypeNormal, "OOMRetrySkipped", "The build had no memory limit to raise")
+		return
+	}
+	limit := bc.raisedMemoryLimit(current)
+	if limit.Cmp(current) <= 0 {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "OOMRetryExhausted", "The build was killed with the maximum memory limit of %s", current.String())
+		return
+	}
+
+	retry := newOOMRetryBuild(build, limit)
+	if _, err := bc.buildLister.Builds(retry.Namespace).Get(retry.Name); err == nil {
+		klog.V(4).Infof("Follow-up build %s/%s of OOM-killed build %s already exists", retry.Namespace, retry.Name, buildDesc(build))
+		return
+	}
+	if err := bc.numberOOMRetryBuild(retry); err != nil {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedOOMRetry", "Error numbering build %s: %v", retry.Name, err)
+		klog.V(2).Infof("Failed to number the follow-up build of OOM-killed build %s: %v", buildDesc(build), err)
+		return
+	}
+	if _, err := bc.buildCreator.Builds(retry.Namespace).Create(context.TODO(), retry, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedOOMRetry", "Error starting build %s with a memory limit of %s: %v", retry.Name, limit.String(), err)
+		klog.V(2).Infof("Failed to retry OOM-killed build %s: %v", buildDesc(build), err)
+		return
+	}
+	bc.recorder.Eventf(build, corev1.EventTypeNormal, "OOMRetry", "Started build %s with a memory limit of %s", retry.Name, limit.String())
+	klog.V(4).Infof("Retrying OOM-killed build %s as %s/%s with a memory limit of %s", buildDesc(build), retry.Namespace, retry.Name, limit.String())
+}
+
+// raisedMemoryLimit returns the given memory limit raised by the configured factor and
+// rounded up to a whole mebibyte, up to the configured cap.
+func (bc *BuildController) raisedMemoryLimit(current resource.Quantity) resource.Quantity {
+	factor := bc.memoryRightSizingConfig.MemoryFactor
+	if factor <= 1 {
+		factor = defaultOOMRetryMemoryFactor
+	}
+	const mebibyte = 1024 * 1024
+	raised := int64(math.Ceil(float64(current.Value())*factor/mebibyte)) * mebibyte
+	limit := *resource.NewQuantity(raised, resource.BinarySI)
+	if max := bc.memoryRightSizingConfig.MaxMemoryLimit; limit.Cmp(max) > 0 {
+		limit = max.DeepCopy()
+	}
+	return limit
+}
+
+// numberOOMRetryBuild gives a follow-up build of a BuildConfig the next build number of the
+// BuildConfig, as if it had been instantiated from it, so that the run policy of the
+// BuildConfig orders it after the builds queued before it.
+func (bc *BuildController) numberOOMRetryBuild(build *buildv1.Build) error {
+	bcName := sharedbuildutil.ConfigNameForBuild(build)
+	if len(bcName) == 0 {
+		return nil
+	}
+	configs := bc.buildConfigPatcher.BuildConfigs(build.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config, err := configs.Get(context.TODO(), bcName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		config.Status.LastVersion++
+		if _, err := configs.Update(context.TODO(), config, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		build.Annotations[buildv1.BuildNumberAnnotation] = strconv.FormatInt(config.Status.LastVersion, 10)
+		return nil
+	})
+}
+
+// newOOMRetryBuild returns a follow-up build of an OOM-killed build running with the given
+// memory limit. The follow-up builds of a build are named by their attempt, which keeps
+// the creation of a follow-up build idempotent.
+func newOOMRetryBuild(build *buildv1.Build, limit resource.Quantity) *buildv1.Build {
+	first := build.Name
+	if of := build.Annotations[OOMRetryOfAnnotation]; len(of) > 0 {
+		first = of
+	}
+	attempt, _ := strconv.Atoi(build.Annotations[OOMRetryAttemptAnnotation])
+	attempt++
+
+	retry := &buildv1.Build{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-oom-%d", first, attempt),
+			Namespace:       build.Namespace,
+			Labels:          map[string]string{},
+			Annotations:     map[string]string{},
+			OwnerReferences: build.OwnerReferences,
+		},
+		Spec: *build.Spec.DeepCopy(),
+		Status: buildv1.BuildStatus{
+			Phase: buildv1.BuildPhaseNew,
+		},
+	}
+	for k, v := range build.Labels {
+		retry.Labels[k] = v
+	}
+	for k, v := range build.Annotations {
+		retry.Annotations[k] = v
+	}
+	// Drop the annotations describing the run of the killed build.
+	delete(retry.Annotations, buildv1.BuildPodNameAnnotation)
+	delete(retry.Annotations, logarchive.LocationAnnotation)
+	delete(retry.Annotations, multiarch.ArchitectureStatusAnnotation)
+	retry.Annotations[OOMRetryOfAnnotation] = first
+	retry.Annotations[OOMRetryAttemptAnnotation] = strconv.Itoa(attempt)
+
+	if retry.Spec.Resources.Limits == nil {
+		retry.Spec.Resources.Limits = corev1.ResourceList{}
+	}
+	retry.Spec.Resources.Limits[corev1.ResourceMemory] = limit
+	retry.Spec.TriggeredBy = append(retry.Spec.TriggeredBy, buildv1.BuildTriggerCause{
+		Message: fmt.Sprintf("Retry of build %s killed due to an out of memory condition", build.Name),
+	})
+	return retry
+}
+
+// podMemoryLimit returns the largest memory limit of the containers of a pod.
+func podMemoryLimit(pod *corev1.Pod) resource.Quantity {
+	var limit resource.Quantity
+	if pod == nil {
+		return limit
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		if q := c.Resources.Limits[corev1.ResourceMemory]; q.Cmp(limit) > 0 {
+			limit = q.DeepCopy()
+		}
+	}
+	return limit
+}
+
+// recordRecommendedMemoryLimit records the memory limit of a completed follow-up build of
+// an OOM-killed build on its BuildConfig.
+func (bc *BuildController) recordRecommendedMemoryLimit(build *buildv1.Build) error {
+	bcName := sharedbuildutil.ConfigNameForBuild(build)
+	limit, ok := build.Spec.Resources.Limits[corev1.ResourceMemory]
+	if len(bcName) == 0 || !ok {
+		return nil
+	}
+	if config, err := bc.buildConfigLister.BuildConfigs(build.Namespace).Get(bcName); err == nil && config.Annotations[RecommendedMemoryLimitAnnotation] == limit.String() {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{RecommendedMemoryLimitAnnotation: limit.String()},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := bc.buildConfigPatcher.BuildConfigs(build.Namespace).Patch(context.TODO(), bcName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	klog.V(4).Infof("Recorded the memory limit %s of build %s on BuildConfig %s/%s", limit.String(), buildDesc(build), build.Namespace, bcName)
+	return nil
+}
+
+// applyRecommendedMemoryLimit sets the memory limit recommended by the BuildConfig of a
+// build that does not set a memory limit of its own.
+func (bc *BuildController) applyRecommendedMemoryLimit(build *buildv1.Build) {
+	if !bc.memoryRightSizingConfig.Enabled {
+		return
+	}
+	if _, ok := build.Spec.Resources.Limits[corev1.ResourceMemory]; ok {
+		return
+	}
+	bcName := sharedbuildutil.ConfigNameForBuild(build)
+	if len(bcName) == 0 {
+		return
+	}
+	config, err := bc.buildConfigLister.BuildConfigs(build.Namespace).Get(bcName)
+	if err != nil {
+		return
+	}
+	value, ok := config.Annotations[RecommendedMemoryLimitAnnotation]
+	if !ok {
+		return
+	}
+	limit, err := resource.ParseQuantity(value)
+	if err != nil || limit.Sign() <= 0 {
+		klog.V(2).Infof("Ignoring invalid recommended memory limit %q of BuildConfig %s/%s", value, build.Namespace, bcName)
+		return
+	}
+	// The memory limit may not be lower than the memory request.
+	if request, ok := build.Spec.Resources.Requests[corev1.ResourceMemory]; ok && request.Cmp(limit) > 0 {
+		limit = request.DeepCopy()
+	}
+	if build.Spec.Resources.Limits == nil {
+		build.Spec.Resources.Limits = corev1.ResourceList{}
+	}
+	build.Spec.Resources.Limits[corev1.ResourceMemory] = limit
+	klog.V(4).Infof("Using the recommended memory limit %s of BuildConfig %s/%s for build %s", limit.String(), build.Namespace, bcName, buildDesc(build))
+}
@@ -0,0 +1,211 @@
+package build
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/policy"
+)
+
+func TestValidateMemoryRightSizingConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      MemoryRightSizingConfig
+		expectError bool
+	}{
+		{name: "disabled"},
+		{name: "default factor", config: MemoryRightSizingConfig{Enabled: true, MaxMemoryLimit: resource.MustParse("8Gi")}},
+		{name: "factor", config: MemoryRightSizingConfig{Enabled: true, MemoryFactor: 1.5, MaxMemoryLimit: resource.MustParse("8Gi")}},
+		{name: "factor too low", config: MemoryRightSizingConfig{Enabled: true, MemoryFactor: 1, MaxMemoryLimit: resource.MustParse("8Gi")}, expectError: true},
+		{name: "no cap", config: MemoryRightSizingConfig{Enabled: true}, expectError: true},
+	}
+	for _, tc := range tests {
+		if err := ValidateMemoryRightSizingConfig(tc.config); (err != nil) != tc.expectError {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.expectError, err)
+		}
+	}
+}
+
+func oomKilledBuild(memoryLimit string) (*buildv1.Build, *corev1.Pod) {
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseRunning, buildv1.BuildOutput{}))
+	build.Annotations[buildv1.BuildPodNameAnnotation] = "data-build-build"
+	build.Annotations[buildv1.BuildNumberAnnotation] = "1"
+	build.Spec.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memoryLimit)}
+	pod := mockBuildPod(build)
+	pod.Spec.Containers = []corev1.Container{{Resources: build.Spec.Resources}}
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.Reason = "OOMKilled"
+	return build, pod
+}
+
+func oomKilledBuildConfig(lastVersion int64) *buildv1.BuildConfig {
+	return &buildv1.BuildConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-bc", Namespace: "namespace"},
+		Status:     buildv1.BuildConfigStatus{LastVersion: lastVersion},
+	}
+}
+
+func TestRetryOOMKilledBuild(t *testing.T) {
+	build, pod := oomKilledBuild("1Gi")
+	buildClient := fakeBuildClient(build, oomKilledBuildConfig(1))
+	bc := newFakeBuildController(buildClient, nil, nil, nil, nil)
+	defer bc.stop()
+	bc.memoryRightSizingConfig = MemoryRightSizingConfig{Enabled: true, MemoryFactor: 1.5, MaxMemoryLimit: resource.MustParse("2Gi")}
+
+	update, err := bc.handleActiveBuild(build, pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bc.updateBuild(build, update, pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	retry, err := buildClient.BuildV1().Builds(build.Namespace).Get(context.TODO(), "data-build-oom-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected a follow-up build: %v", err)
+	}
+	if limit := retry.Spec.Resources.Limits[corev1.ResourceMemory]; limit.Cmp(resource.MustParse("1536Mi")) != 0 {
+		t.Errorf("expected a memory limit of 1536Mi, got %s", limit.String())
+	}
+	if retry.Status.Phase != buildv1.BuildPhaseNew {
+		t.Errorf("expected the follow-up build to be New, got %s", retry.Status.Phase)
+	}
+	if retry.Annotations[OOMRetryOfAnnotation] != build.Name || retry.Annotations[OOMRetryAttemptAnnotation] != "1" {
+		t.Errorf("unexpected retry annotations %v", retry.Annotations)
+	}
+	if _, ok := retry.Annotations[buildv1.BuildPodNameAnnotation]; ok {
+		t.Errorf("expected the pod name annotation of the killed build to be dropped")
+	}
+	if retry.Labels[buildv1.BuildConfigLabel] != "test-bc" {
+		t.Errorf("expected the follow-up build to belong to the BuildConfig, got labels %v", retry.Labels)
+	}
+	if retry.Annotations[buildv1.BuildNumberAnnotation] != "2" {
+		t.Errorf("expected the follow-up build to be build number 2, got %q", retry.Annotations[buildv1.BuildNumberAnnotation])
+	}
+	config, err := buildClient.BuildV1().BuildConfigs(build.Namespace).Get(context.TODO(), "test-bc", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Status.LastVersion != 2 {
+		t.Errorf("expected the last version of the BuildConfig to be 2, got %d", config.Status.LastVersion)
+	}
+
+	// The second retry is capped, and the third is not started.
+	second := newOOMRetryBuild(retry, bc.raisedMemoryLimit(resource.MustParse("1536Mi")))
+	if second.Name != "data-build-oom-2" {
+		t.Errorf("expected the second retry to be named data-build-oom-2, got %s", second.Name)
+	}
+	if limit := second.Spec.Resources.Limits[corev1.ResourceMemory]; limit.Cmp(resource.MustParse("2Gi")) != 0 {
+		t.Errorf("expected the memory limit to be capped at 2Gi, got %s", limit.String())
+	}
+}
+
+func TestRetryOOMKilledBuildRunPolicy(t *testing.T) {
+	build, pod := oomKilledBuild("1Gi")
+	build.Labels[buildv1.BuildRunPolicyLabel] = string(buildv1.BuildRunPolicySerial)
+	// A build of the BuildConfig queued while the killed build was running.
+	queued := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+	queued.Name = "data-build-2"
+	queued.Labels[buildv1.BuildRunPolicyLabel] = string(buildv1.BuildRunPolicySerial)
+	queued.Annotations[buildv1.BuildNumberAnnotation] = "2"
+	buildClient := fakeBuildClient(build, queued, oomKilledBuildConfig(2))
+	bc := newFakeBuildController(buildClient, nil, nil, nil, nil)
+	defer bc.stop()
+	bc.memoryRightSizingConfig = MemoryRightSizingConfig{Enabled: true, MaxMemoryLimit: resource.MustParse("2Gi")}
+
+	if err := bc.updateBuild(build, transitionToPhase(buildv1.BuildPhaseFailed, buildv1.StatusReasonOutOfMemoryKilled, ""), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	retry, err := buildClient.BuildV1().Builds(build.Namespace).Get(context.TODO(), "data-build-oom-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected a follow-up build: %v", err)
+	}
+	if retry.Annotations[buildv1.BuildNumberAnnotation] != "3" {
+		t.Fatalf("expected the follow-up build to be build number 3, got %q", retry.Annotations[buildv1.BuildNumberAnnotation])
+	}
+
+	// The serial run policy runs the queued build before the follow-up build.
+	killed, _ := buildClient.BuildV1().Builds(build.Namespace).Get(context.TODO(), build.Name, metav1.GetOptions{})
+	indexer := bc.buildInformers.Build().V1().Builds().Informer().GetIndexer()
+	for _, b := range []*buildv1.Build{killed, queued, retry} {
+		indexer.Add(b)
+	}
+	for _, tc := range []struct {
+		build    *buildv1.Build
+		runnable bool
+	}{
+		{build: queued, runnable: true},
+		{build: retry, runnable: false},
+	} {
+		runnable, err := policy.ForBuild(tc.build, bc.runPolicies).IsRunnable(tc.build)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if runnable != tc.runnable {
+			t.Errorf("expected build %s to be runnable %v, got %v", tc.build.Name, tc.runnable, runnable)
+		}
+	}
+}
+
+func TestRetryOOMKilledBuildAtCap(t *testing.T) {
+	build, pod := oomKilledBuild("2Gi")
+	buildClient := fakeBuildClient(build)
+	bc := newFakeBuildController(buildClient, nil, nil, nil, nil)
+	defer bc.stop()
+	bc.memoryRightSizingConfig = MemoryRightSizingConfig{Enabled: true, MaxMemoryLimit: resource.MustParse("2Gi")}
+
+	if err := bc.updateBuild(build, transitionToPhase(buildv1.BuildPhaseFailed, buildv1.StatusReasonOutOfMemoryKilled, ""), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	builds, err := buildClient.BuildV1().Builds(build.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds.Items) != 1 {
+		t.Errorf("expected no follow-up build at the memory cap, got %d builds", len(builds.Items))
+	}
+}
+
+func TestRecommendedMemoryLimit(t *testing.T) {
+	config := &buildv1.BuildConfig{ObjectMeta: metav1.ObjectMeta{Name: "test-bc", Namespace: "namespace"}}
+	build, _ := oomKilledBuild("1536Mi")
+	build.Name = "data-build-oom-1"
+	build.Annotations[OOMRetryOfAnnotation] = "data-build"
+	build.Status.Phase = buildv1.BuildPhaseRunning
+	buildClient := fakeBuildClient(build, config)
+	bc := newFakeBuildController(buildClient, nil, nil, nil, nil)
+	defer bc.stop()
+	bc.memoryRightSizingConfig = MemoryRightSizingConfig{Enabled: true, MaxMemoryLimit: resource.MustParse("2Gi")}
+
+	if err := bc.updateBuild(build, transitionToPhase(buildv1.BuildPhaseComplete, "", ""), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config, err := buildClient.BuildV1().BuildConfigs("namespace").Get(context.TODO(), "test-bc", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := config.Annotations[RecommendedMemoryLimitAnnotation]; value != "1536Mi" {
+		t.Fatalf("expected a recommended memory limit of 1536Mi, got %q", value)
+	}
+
+	// Builds of the BuildConfig without a memory limit of their own use the recommendation.
+	bc.buildInformers.Build().V1().BuildConfigs().Informer().GetIndexer().Update(config)
+	next := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+	next.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")}
+	bc.applyRecommendedMemoryLimit(next)
+	if limit := next.Spec.Resources.Limits[corev1.ResourceMemory]; limit.Cmp(resource.MustParse("1536Mi")) != 0 {
+		t.Errorf("expected the recommended memory limit, got %s", limit.String())
+	}
+
+	explicit := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+	explicit.Spec.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")}
+	bc.applyRecommendedMemoryLimit(explicit)
+	if limit := explicit.Spec.Resources.Limits[corev1.ResourceMemory]; limit.Cmp(resource.MustParse("256Mi")) != 0 {
+		t.Errorf("expected the explicit memory limit to be kept, got %s", limit.String())
+	}
+}
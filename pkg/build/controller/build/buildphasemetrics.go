@@ -0,0 +1,60 @@
+package build
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/build/metrics/prometheus"
+)
+
+// observeBuildTransition observes the durations of a build that transitioned from the given
+// phase, as updated by the controller.
+func observeBuildTransition(from buildv1.BuildPhase, build *buildv1.Build, pod *corev1.Pod, completed bool) {
+	d := buildPhaseDurations(from, build, pod, completed, time.Now())
+	metrics.ObserveBuildPhaseDurations(metrics.StrategyType(build.Spec.Strategy), string(build.Status.Phase), string(build.Status.Reason), d)
+}
+
+// buildPhaseDurations returns the durations of a build that transitioned from the given
+// phase at the given time:
+//   - the time spent in New, from the creation of the build to the creation of its pod,
+//     when it leaves New.
+//   - the time spent in Pending, from the creation of its pod, when it leaves Pending. This
+//     includes scheduling and pulling the builder image.
+//   - the running and total durations when it completes.
+func buildPhaseDurations(from buildv1.BuildPhase, build *buildv1.Build, pod *corev1.Pod, completed bool, now time.Time) metrics.BuildPhaseDurations {
+	d := metrics.BuildPhaseDurations{}
+	to := build.Status.Phase
+	var podCreated *time.Time
+	if pod != nil && !pod.CreationTimestamp.IsZero() && !pod.CreationTimestamp.Time.After(now) {
+		podCreated = &pod.CreationTimestamp.Time
+	}
+
+	if from == buildv1.BuildPhaseNew && to != buildv1.BuildPhaseNew {
+		left := now
+		if podCreated != nil {
+			left = *podCreated
+		}
+		d.New = durationPtr(left.Sub(build.CreationTimestamp.Time))
+	}
+	// A build whose pod is already past pending when first seen leaves New and Pending at once.
+	leftPending := from == buildv1.BuildPhasePending || (from == buildv1.BuildPhaseNew && to != buildv1.BuildPhasePending)
+	if leftPending && to != buildv1.BuildPhasePending && podCreated != nil {
+		d.Pending = durationPtr(now.Sub(*podCreated))
+	}
+
+	if completed && build.Status.CompletionTimestamp != nil {
+		d.Total = durationPtr(build.Status.CompletionTimestamp.Sub(build.CreationTimestamp.Time))
+		ran := from == buildv1.BuildPhaseRunning ||
+			(pod != nil && (pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed))
+		if ran {
+			d.Running = durationPtr(build.Status.Duration)
+		}
+	}
+	return d
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
@@ -0,0 +1,137 @@
+package build
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestBuildPhaseDurations(t *testing.T) {
+	created := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	now := created.Add(10 * time.Minute)
+
+	podAt := func(offset time.Duration, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: created.Add(offset)}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	buildIn := func(phase buildv1.BuildPhase, completed bool) *buildv1.Build {
+		build := &buildv1.Build{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: created}},
+			Status:     buildv1.BuildStatus{Phase: phase},
+		}
+		if completed {
+			build.Status.CompletionTimestamp = &metav1.Time{Time: now}
+			build.Status.Duration = 4 * time.Minute
+		}
+		return build
+	}
+
+	tests := []struct {
+		name      string
+		from      buildv1.BuildPhase
+		build     *buildv1.Build
+		pod       *corev1.Pod
+		completed bool
+
+		expectNew     time.Duration
+		expectPending time.Duration
+		expectRunning time.Duration
+		expectTotal   time.Duration
+	}{
+		{
+			name:      "new to pending",
+			from:      buildv1.BuildPhaseNew,
+			build:     buildIn(buildv1.BuildPhasePending, false),
+			pod:       podAt(time.Minute, corev1.PodPending),
+			expectNew: time.Minute,
+		},
+		{
+			name:          "pending to running",
+			from:          buildv1.BuildPhasePending,
+			build:         buildIn(buildv1.BuildPhaseRunning, false),
+			pod:           podAt(time.Minute, corev1.PodRunning),
+			expectPending: 9 * time.Minute,
+		},
+		{
+			name:          "new to running",
+			from:          buildv1.BuildPhaseNew,
+			build:         buildIn(buildv1.BuildPhaseRunning, false),
+			pod:           podAt(2*time.Minute, corev1.PodRunning),
+			expectNew:     2 * time.Minute,
+			expectPending: 8 * time.Minute,
+		},
+		{
+			name:          "running to complete",
+			from:          buildv1.BuildPhaseRunning,
+			build:         buildIn(buildv1.BuildPhaseComplete, true),
+			pod:           podAt(time.Minute, corev1.PodSucceeded),
+			completed:     true,
+			expectRunning: 4 * time.Minute,
+			expectTotal:   10 * time.Minute,
+		},
+		{
+			name:          "pending to failed",
+			from:          buildv1.BuildPhasePending,
+			build:         buildIn(buildv1.BuildPhaseFailed, true),
+			pod:           podAt(time.Minute, corev1.PodFailed),
+			completed:     true,
+			expectPending: 9 * time.Minute,
+			expectRunning: 4 * time.Minute,
+			expectTotal:   10 * time.Minute,
+		},
+		{
+			name:        "new cancelled",
+			from:        buildv1.BuildPhaseNew,
+			build:       buildIn(buildv1.BuildPhaseCancelled, true),
+			completed:   true,
+			expectNew:   10 * time.Minute,
+			expectTotal: 10 * time.Minute,
+		},
+		{
+			name:          "pending cancelled",
+			from:          buildv1.BuildPhasePending,
+			build:         buildIn(buildv1.BuildPhaseCancelled, true),
+			pod:           podAt(time.Minute, corev1.PodPending),
+			completed:     true,
+			expectPending: 9 * time.Minute,
+			expectTotal:   10 * time.Minute,
+		},
+		{
+			name:  "pending reason change",
+			from:  buildv1.BuildPhasePending,
+			build: buildIn(buildv1.BuildPhasePending, false),
+			pod:   podAt(time.Minute, corev1.PodPending),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := buildPhaseDurations(tc.from, tc.build, tc.pod, tc.completed, now)
+			for _, o := range []struct {
+				name     string
+				actual   *time.Duration
+				expected time.Duration
+			}{
+				{"new", d.New, tc.expectNew},
+				{"pending", d.Pending, tc.expectPending},
+				{"running", d.Running, tc.expectRunning},
+				{"total", d.Total, tc.expectTotal},
+			} {
+				switch {
+				case o.expected == 0 && o.actual != nil:
+					t.Errorf("expected no %s duration, got %v", o.name, *o.actual)
+				case o.expected != 0 && o.actual == nil:
+					t.Errorf("expected a %s duration of %v, got none", o.name, o.expected)
+				case o.actual != nil && *o.actual != o.expected:
+					t.Errorf("expected a %s duration of %v, got %v", o.name, o.expected, *o.actual)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/policy"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
+)
+
+// PipelineRunResource is the Tekton resource JenkinsPipeline builds are run as.
+var PipelineRunResource = schema.GroupVersionResource{Group: "tekton.dev", Version: "v1", Resource: "pipelineruns"}
+
+const (
+	// The parameters passed to the Tekton Pipeline of a JenkinsPipeline build. Parameters
+	// without a value in the build are not passed.
+	pipelineParamJenkinsfilePath = "jenkinsfile-path"
+	pipelineParamJenkinsfile     = "jenkinsfile"
+	pipelineParamGitURL          = "git-url"
+	pipelineParamGitRevision     = "git-revision"
+	pipelineParamContextDir      = "context-dir"
+	pipelineParamEnv             = "env"
+
+	// defaultJenkinsfilePath is the path of the Jenkinsfile of builds setting neither a path
+	// nor the content of their Jenkinsfile.
+	defaultJenkinsfilePath = "Jenkinsfile"
+
+	// tektonConditionSucceeded is the condition reporting the outcome of a PipelineRun.
+	tektonConditionSucceeded = "Succeeded"
+	// tektonReasonPending is the reason of a PipelineRun that has not been started.
+	tektonReasonPending = "PipelineRunPending"
+	// tektonStatusCancelled cancels a PipelineRun when set as its spec.status.
+	tektonStatusCancelled = "Cancelled"
+)
+
+// tektonCancelledReasons are the reasons of PipelineRuns that were cancelled.
+var tektonCancelledReasons = map[string]bool{
+	"Cancelled":            true,
+	"PipelineRunCancelled": true,
+	"CancelledRunFinally":  true,
+	"StoppedRunFinally":    true,
+}
+
+// PipelineConfig controls the Tekton backend of builds with the JenkinsPipeline strategy.
+type PipelineConfig struct {
+	// Enabled runs builds with the JenkinsPipeline strategy as Tekton PipelineRuns, rather
+	// than leaving them to the Jenkins sync plugin. The PipelineRun is passed the Jenkinsfile
+	// path or content, the git source, and the environment of the build as parameters.
+	// The backend stays disabled if Tekton PipelineRuns are not served when the build
+	// controller starts.
+	Enabled bool `json:"enabled"`
+	// PipelineRef is the name of the Tekton Pipeline in the namespace of a build that its
+	// PipelineRun runs.
+	PipelineRef string `json:"pipelineRef,omitempty"`
+	// PipelineSpec is a Tekton Pipeline spec embedded into the PipelineRuns of all builds.
+	// Exactly one of PipelineRef and PipelineSpec must be set.
+	PipelineSpec *runtime.RawExtension `json:"pipelineSpec,omitempty"`
+}
+
+// ValidatePipelineConfig returns an error if the pipeline configuration is invalid.
+func ValidatePipelineConfig(config PipelineConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	hasSpec := config.PipelineSpec != nil && len(config.PipelineSpec.Raw) > 0
+	switch {
+	case len(config.PipelineRef) > 0 && hasSpec:
+		return fmt.Errorf("only one of the build pipeline pipelineRef and pipelineSpec may be set")
+	case len(config.PipelineRef) == 0 && !hasSpec:
+		return fmt.Errorf("one of the build pipeline pipelineRef and pipelineSpec must be set")
+	}
+	if hasSpec {
+		spec := map[string]interface{}{}
+		if err := json.Unmarshal(config.PipelineSpec.Raw, &spec); err != nil {
+			return fmt.Errorf("invalid build pipeline pipelineSpec: %v", err)
+		}
+	}
+	return nil
+}
+
+// usePipelineBackend returns true if the given build is run as a Tekton PipelineRun.
+func (bc *BuildController) usePipelineBackend(build *buildv1.Build) bool {
+	return bc.pipelineConfig.Enabled && bc.dynamicClient != nil && build.Spec.Strategy.JenkinsPipelineStrategy != nil
+}
+
+// handlePipelineBuild drives a JenkinsPipeline build run as a Tekton PipelineRun named
+// after the build. Pipeline builds have no build pod, and thus no pod name annotation.
+func (bc *BuildController) handlePipelineBuild(build *buildv1.Build) error {
+	if build.DeletionTimestamp != nil || (buildutil.IsBuildComplete(build) && build.Status.CompletionTimestamp != nil) {
+		return nil
+	}
+	klog.V(4).Infof("Handling pipeline build %s", buildDesc(build))
+
+	run, err := bc.getPipelineRun(build)
+	if err != nil {
+		return err
+	}
+
+	var update *buildUpdate
+	var updateErr error
+
+	switch {
+	case shouldCancel(build):
+		update, err = bc.cancelPipelineBuild(build, run)
+	case build.Status.Phase == buildv1.BuildPhaseNew:
+		update, err = bc.handleNewPipelineBuild(build, run)
+	case build.Status.Phase == buildv1.BuildPhasePending,
+		build.Status.Phase == buildv1.BuildPhaseRunning:
+		update = bc.handleActivePipelineBuild(build, run)
+	case buildutil.IsBuildComplete(build):
+		update = &buildUpdate{}
+		setBuildCompletionData(build, nil, update, nil)
+	}
+	if update != nil && !update.isEmpty() {
+		updateErr = bc.updateBuild(build, update, nil)
+	}
+	if err != nil {
+		return err
+	}
+	return updateErr
+}
+
+// getPipelineRun returns the PipelineRun of a build from the cache, or nil if it does not
+// exist.
+func (bc *BuildController) getPipelineRun(build *buildv1.Build) (*unstructured.Unstructured, error) {
+	obj, err := bc.pipelineRunStore.ByNamespace(build.Namespace).Get(build.Name)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	run, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected PipelineRun object %T", obj)
+	}
+	return run, nil
+}
+
+// handleNewPipelineBuild creates the PipelineRun of a new build once its run policy allows
+// it to run.
+func (bc *BuildController) handleNewPipelineBuild(build *buildv1.Build, run *unstructured.Unstructured) (*buildUpdate, error) {
+	if run != nil {
+		return bc.handleExistingPipelineRun(build, run)
+	}
+
+	runPolicy := policy.ForBuild(build, bc.runPolicies)
+	if runPolicy == nil {
+		return nil, fmt.Errorf("unable to determine build policy for %s", buildDesc(build))
+	}
+	if runnable, err := runPolicy.IsRunnable(build); err != nil || !runnable {
+		return nil, err
+	}
+
+	spec, err := bc.newPipelineRun(build)
+	if err != nil {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating pipeline run: %v", err)
+		return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonCannotCreateBuildPodSpec, "Failed to create the pipeline run specification."), nil
+	}
+	run, err = bc.dynamicClient.Resource(PipelineRunResource).Namespace(build.Namespace).Create(context.TODO(), spec, metav1.CreateOptions{})
+	switch {
+	case err == nil:
+		klog.V(4).Infof("Created pipeline run %s/%s for build %s", build.Namespace, run.GetName(), buildDesc(build))
+	case errors.IsAlreadyExists(err):
+		run, err = bc.dynamicClient.Resource(PipelineRunResource).Namespace(build.Namespace).Get(context.TODO(), spec.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return bc.handleExistingPipelineRun(build, run)
+	default:
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating pipeline run: %v", err)
+		update := &buildUpdate{}
+		update.setReason(buildv1.StatusReasonCannotCreateBuildPod)
+		update.setMessage(fmt.Sprintf("Failed creating pipeline run: %s", err.Error()))
+		return update, fmt.Errorf("failed to create pipeline run: %v", err)
+	}
+
+	return transitionToPhase(buildv1.BuildPhasePending, "", ""), nil
+}
+
+// handleExistingPipelineRun handles a new build whose PipelineRun already exists. A
+// PipelineRun controlled by the build was created by an earlier sync that failed to update
+// the build.
+func (bc *BuildController) handleExistingPipelineRun(build *buildv1.Build, run *unstructured.Unstructured) (*buildUpdate, error) {
+	if metav1.IsControlledBy(run, build) {
+		return bc.handleActivePipelineBuild(build, run), nil
+	}
+	if err := retryOnOwnerRef(build, run); err != nil {
+		return nil, err
+	}
+	return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodExists, "The pipeline run for this build already exists and is older than the build."), nil
+}
+
+// newPipelineRun returns the PipelineRun of a JenkinsPipeline build.
+func (bc *BuildController) newPipelineRun(build *buildv1.Build) (*unstructured.Unstructured, error) {
+	spec := map[string]interface{}{
+		"params": pipelineRunParams(build),
+	}
+	if len(bc.pipelineConfig.PipelineRef) > 0 {
+		spec["pipelineRef"] = map[string]interface{}{"name": bc.pipelineConfig.PipelineRef}
+	} else {
+		pipelineSpec := map[string]interface{}{}
+		if bc.pipelineConfig.PipelineSpec != nil {
+			if err := json.Unmarshal(bc.pipelineConfig.PipelineSpec.Raw, &pipelineSpec); err != nil {
+				return nil, fmt.Errorf("invalid pipeline spec: %v", err)
+			}
+		}
+		spec["pipelineSpec"] = pipelineSpec
+	}
+	if len(build.Spec.ServiceAccount) > 0 {
+		spec["taskRunTemplate"] = map[string]interface{}{"serviceAccountName": build.Spec.ServiceAccount}
+	}
+	if build.Spec.CompletionDeadlineSeconds != nil {
+		spec["timeouts"] = map[string]interface{}{
+			"pipeline": (time.Duration(*build.Spec.CompletionDeadlineSeconds) * time.Second).String(),
+		}
+	}
+
+	run := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	run.SetGroupVersionKind(PipelineRunResource.GroupVersion().WithKind("PipelineRun"))
+	run.SetName(build.Name)
+	run.SetNamespace(build.Namespace)
+	run.SetLabels(map[string]string{buildv1.BuildLabel: buildutil.LabelValue(build.Name)})
+	run.SetAnnotations(map[string]string{buildv1.BuildAnnotation: build.Name})
+	run.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(build, strategy.BuildControllerRefKind)})
+	return run, nil
+}
+
+// pipelineRunParams returns the parameters passed to the Pipeline of a JenkinsPipeline
+// build.
+func pipelineRunParams(build *buildv1.Build) []interface{} {
+	params := []interface{}{}
+	add := func(name string, value interface{}) {
+		params = append(params, map[string]interface{}{"name": name, "value": value})
+	}
+	pipeline := build.Spec.Strategy.JenkinsPipelineStrategy
+	switch {
+	case len(pipeline.Jenkinsfile) > 0:
+		add(pipelineParamJenkinsfile, pipeline.Jenkinsfile)
+	case len(pipeline.JenkinsfilePath) > 0:
+		add(pipelineParamJenkinsfilePath, pipeline.JenkinsfilePath)
+	default:
+		add(pipelineParamJenkinsfilePath, defaultJenkinsfilePath)
+	}
+	if git := build.Spec.Source.Git; git != nil {
+		add(pipelineParamGitURL, git.URI)
+		revision := git.Ref
+		if build.Spec.Revision != nil && build.Spec.Revision.Git != nil && len(build.Spec.Revision.Git.Commit) > 0 {
+			revision = build.Spec.Revision.Git.Commit
+		}
+		if len(revision) > 0 {
+			add(pipelineParamGitRevision, revision)
+		}
+	}
+	if len(build.Spec.Source.ContextDir) > 0 {
+		add(pipelineParamContextDir, build.Spec.Source.ContextDir)
+	}
+	env := []interface{}{}
+	for _, e := range pipeline.Env {
+		if e.ValueFrom != nil {
+			klog.V(4).Infof("Not passing environment variable %s of build %s with a value source to its pipeline run", e.Name, buildDesc(build))
+			continue
+		}
+		env = append(env, fmt.Sprintf("%s=%s", e.Name, e.Value))
+	}
+	if len(env) > 0 {
+		add(pipelineParamEnv, env)
+	}
+	return params
+}
+
+// handleActivePipelineBuild maps the status of the PipelineRun of a build onto the build.
+func (bc *BuildController) handleActivePipelineBuild(build *buildv1.Build, run *unstructured.Unstructured) *buildUpdate {
+	if run == nil {
+		return transitionToPhase(buildv1.BuildPhaseError, buildv1.StatusReasonBuildPodDeleted, "The pipeline run for this build was deleted before the build completed.")
+	}
+
+	phase, reason, message := pipelineRunPhase(run)
+	update := &buildUpdate{}
+	if phase != build.Status.Phase || (reason != build.Status.Reason && len(reason) > 0) {
+		update = transitionToPhase(phase, reason, message)
+	}
+	if build.Status.StartTimestamp == nil {
+		if startTime := pipelineRunTime(run, "startTime"); startTime != nil && phase != buildv1.BuildPhasePending {
+			update.setStartTime(*startTime)
+		}
+	}
+	if buildutil.IsTerminalPhase(phase) {
+		if completionTime := pipelineRunTime(run, "completionTime"); completionTime != nil {
+			update.setCompletionTime(*completionTime)
+		}
+	}
+	return update
+}
+
+// pipelineRunPhase returns the build phase, reason and message of a PipelineRun from its
+// Succeeded condition.
+func pipelineRunPhase(run *unstructured.Unstructured) (buildv1.BuildPhase, buildv1.StatusReason, string) {
+	conditions, _, _ := unstructured.NestedSlice(run.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != tektonConditionSucceeded {
+			continue
+		}
+		status, _ := condition["status"].(string)
+		reason, _ := condition["reason"].(string)
+		message, _ := condition["message"].(string)
+		switch corev1.ConditionStatus(status) {
+		case corev1.ConditionTrue:
+			return buildv1.BuildPhaseComplete, "", ""
+		case corev1.ConditionFalse:
+			if tektonCancelledReasons[reason] {
+				return buildv1.BuildPhaseCancelled, buildv1.StatusReasonCancelledBuild, "The pipeline run for this build was cancelled."
+			}
+			if len(message) == 0 {
+				message = "The pipeline run for this build failed."
+			}
+			return buildv1.BuildPhaseFailed, buildv1.StatusReasonGenericBuildFailed, message
+		default:
+			if reason == tektonReasonPending {
+				return buildv1.BuildPhasePending, "", ""
+			}
+			return buildv1.BuildPhaseRunning, "", ""
+		}
+	}
+	return buildv1.BuildPhasePending, "", ""
+}
+
+// pipelineRunTime returns the given timestamp of the status of a PipelineRun.
+func pipelineRunTime(run *unstructured.Unstructured, field string) *metav1.Time {
+	value, ok, _ := unstructured.NestedString(run.Object, "status", field)
+	if !ok {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	mt := metav1.NewTime(t)
+	return &mt
+}
+
+// cancelPipelineBuild cancels the PipelineRun of a build and returns an update to mark the
+// build as cancelled.
+func (bc *BuildController) cancelPipelineBuild(build *buildv1.Build, run *unstructured.Unstructured) (*buildUpdate, error) {
+	klog.V(4).Infof("Cancelling pipeline build %s", buildDesc(build))
+	if run != nil {
+		patch := []byte(fmt.Sprintf(`{"spec":{"status":%q}}`, tektonStatusCancelled))
+		_, err := bc.dynamicClient.Resource(PipelineRunResource).Namespace(build.Namespace).Patch(context.TODO(), run.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("could not cancel pipeline run %s/%s of build %s: %v", build.Namespace, run.GetName(), buildDesc(build), err)
+		}
+	}
+	return transitionToPhase(buildv1.BuildPhaseCancelled, buildv1.StatusReasonCancelledBuild, "The build was cancelled by the user."), nil
+}
+
+// pipelineRunUpdated gets called by the PipelineRun informer event handler whenever a
+// PipelineRun is updated.
+func (bc *BuildController) pipelineRunUpdated(old, cur interface{}) {
+	curRun, ok := cur.(metav1.Object)
+	if !ok {
+		return
+	}
+	if oldRun, ok := old.(metav1.Object); ok && curRun.GetResourceVersion() == oldRun.GetResourceVersion() {
+		return
+	}
+	if name := getBuildName(curRun); len(name) > 0 {
+		bc.buildQueue.Add(resourceName(curRun.GetNamespace(), name))
+	}
+}
+
+// pipelineRunDeleted gets called by the PipelineRun informer event handler whenever a
+// PipelineRun is deleted.
+func (bc *BuildController) pipelineRunDeleted(obj interface{}) {
+	run, ok := obj.(metav1.Object)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("couldn't get object from tombstone: %+v", obj))
+			return
+		}
+		run, ok = tombstone.Obj.(metav1.Object)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a pipeline run: %+v", obj))
+			return
+		}
+	}
+	if name := getBuildName(run); len(name) > 0 {
+		bc.buildQueue.Add(resourceName(run.GetNamespace(), name))
+	}
+}
@@ -0,0 +1,258 @@
+package build
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clientgotesting "k8s.io/client-go/testing"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
+)
+
+func newFakePipelineBuildController(build *buildv1.Build, runs ...runtime.Object) (*fakeBuildController, *dynamicfake.FakeDynamicClient) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		PipelineRunResource: "PipelineRunList",
+	}, runs...)
+	informer := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0).ForResource(PipelineRunResource)
+	for _, run := range runs {
+		informer.Informer().GetIndexer().Add(run)
+	}
+
+	bc := newFakeBuildController(fakeBuildClient(build), nil, nil, nil, nil)
+	bc.pipelineConfig = PipelineConfig{Enabled: true, PipelineRef: "jenkins-compat"}
+	bc.dynamicClient = dynamicClient
+	bc.pipelineRunStore = informer.Lister()
+	return bc, dynamicClient
+}
+
+func mockPipelineRun(build *buildv1.Build, status string, reason string, started, completed *time.Time) *unstructured.Unstructured {
+	run := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	run.SetGroupVersionKind(PipelineRunResource.GroupVersion().WithKind("PipelineRun"))
+	run.SetName(build.Name)
+	run.SetNamespace(build.Namespace)
+	run.SetAnnotations(map[string]string{buildv1.BuildAnnotation: build.Name})
+	run.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(build, strategy.BuildControllerRefKind)})
+	if len(status) > 0 {
+		unstructured.SetNestedSlice(run.Object, []interface{}{
+			map[string]interface{}{"type": "Succeeded", "status": status, "reason": reason, "message": "pipeline message"},
+		}, "status", "conditions")
+	}
+	if started != nil {
+		unstructured.SetNestedField(run.Object, started.UTC().Format(time.RFC3339), "status", "startTime")
+	}
+	if completed != nil {
+		unstructured.SetNestedField(run.Object, completed.UTC().Format(time.RFC3339), "status", "completionTime")
+	}
+	return run
+}
+
+func mockPipelineBuild(phase buildv1.BuildPhase) *buildv1.Build {
+	build := pipelineStrategy(mockBuild(phase, buildv1.BuildOutput{}))
+	build.UID = "build-uid"
+	build.Spec.Strategy.JenkinsPipelineStrategy.JenkinsfilePath = "ci/Jenkinsfile"
+	build.Spec.Strategy.JenkinsPipelineStrategy.Env = []corev1.EnvVar{
+		{Name: "STAGE", Value: "test"},
+		{Name: "SECRET", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "key"}}},
+	}
+	return build
+}
+
+func TestValidatePipelineConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      PipelineConfig
+		expectError bool
+	}{
+		{name: "disabled"},
+		{name: "pipeline ref", config: PipelineConfig{Enabled: true, PipelineRef: "pipeline"}},
+		{name: "pipeline spec", config: PipelineConfig{Enabled: true, PipelineSpec: &runtime.RawExtension{Raw: []byte(`{"tasks":[]}`)}}},
+		{name: "none", config: PipelineConfig{Enabled: true}, expectError: true},
+		{name: "both", config: PipelineConfig{Enabled: true, PipelineRef: "pipeline", PipelineSpec: &runtime.RawExtension{Raw: []byte(`{}`)}}, expectError: true},
+		{name: "invalid spec", config: PipelineConfig{Enabled: true, PipelineSpec: &runtime.RawExtension{Raw: []byte(`[`)}}, expectError: true},
+	}
+	for _, tc := range tests {
+		if err := ValidatePipelineConfig(tc.config); (err != nil) != tc.expectError {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.expectError, err)
+		}
+	}
+}
+
+func TestCreatePipelineRun(t *testing.T) {
+	build := mockPipelineBuild(buildv1.BuildPhaseNew)
+	bc, dynamicClient := newFakePipelineBuildController(build)
+	defer bc.stop()
+
+	if err := bc.handleBuild(build); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	run, err := dynamicClient.Resource(PipelineRunResource).Namespace(build.Namespace).Get(context.TODO(), build.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected a pipeline run: %v", err)
+	}
+	if !metav1.IsControlledBy(run, build) {
+		t.Errorf("expected the pipeline run to be controlled by the build, got %v", run.GetOwnerReferences())
+	}
+	if ref, _, _ := unstructured.NestedString(run.Object, "spec", "pipelineRef", "name"); ref != "jenkins-compat" {
+		t.Errorf("expected the pipeline run to reference the configured pipeline, got %q", ref)
+	}
+	params, _, _ := unstructured.NestedSlice(run.Object, "spec", "params")
+	values := map[string]interface{}{}
+	for _, p := range params {
+		param := p.(map[string]interface{})
+		values[param["name"].(string)] = param["value"]
+	}
+	if values[pipelineParamJenkinsfilePath] != "ci/Jenkinsfile" {
+		t.Errorf("expected the Jenkinsfile path to be passed, got %v", values)
+	}
+	if values[pipelineParamGitURL] != build.Spec.Source.Git.URI || values[pipelineParamContextDir] != "contextimage" {
+		t.Errorf("expected the git source to be passed, got %v", values)
+	}
+	if env, ok := values[pipelineParamEnv].([]interface{}); !ok || len(env) != 1 || env[0] != "STAGE=test" {
+		t.Errorf("expected the environment without value sources to be passed, got %v", values[pipelineParamEnv])
+	}
+
+	updated, err := bc.buildPatcher.Builds(build.Namespace).Get(context.TODO(), build.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Phase != buildv1.BuildPhasePending {
+		t.Errorf("expected the build to be pending, got %s", updated.Status.Phase)
+	}
+}
+
+func TestHandleActivePipelineBuild(t *testing.T) {
+	started := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	completed := started.Add(5 * time.Minute)
+
+	tests := []struct {
+		name           string
+		phase          buildv1.BuildPhase
+		run            func(*buildv1.Build) *unstructured.Unstructured
+		expectedUpdate *buildUpdate
+	}{
+		{
+			name:           "pipeline run deleted",
+			phase:          buildv1.BuildPhaseRunning,
+			run:            func(*buildv1.Build) *unstructured.Unstructured { return nil },
+			expectedUpdate: newUpdate().phase(buildv1.BuildPhaseError).reason(buildv1.StatusReasonBuildPodDeleted).message("The pipeline run for this build was deleted before the build completed.").update,
+		},
+		{
+			name:  "pipeline run pending",
+			phase: buildv1.BuildPhasePending,
+			run: func(b *buildv1.Build) *unstructured.Unstructured {
+				return mockPipelineRun(b, "Unknown", "PipelineRunPending", nil, nil)
+			},
+			expectedUpdate: newUpdate().update,
+		},
+		{
+			name:  "pipeline run running",
+			phase: buildv1.BuildPhasePending,
+			run: func(b *buildv1.Build) *unstructured.Unstructured {
+				return mockPipelineRun(b, "Unknown", "Running", &started, nil)
+			},
+			expectedUpdate: newUpdate().phase(buildv1.BuildPhaseRunning).reason("").message("").startTime(metav1.NewTime(started)).update,
+		},
+		{
+			name:  "pipeline run succeeded",
+			phase: buildv1.BuildPhaseRunning,
+			run: func(b *buildv1.Build) *unstructured.Unstructured {
+				return mockPipelineRun(b, "True", "Succeeded", &started, &completed)
+			},
+			expectedUpdate: newUpdate().phase(buildv1.BuildPhaseComplete).reason("").message("").startTime(metav1.NewTime(started)).completionTime(metav1.NewTime(completed)).update,
+		},
+		{
+			name:  "pipeline run failed",
+			phase: buildv1.BuildPhaseRunning,
+			run: func(b *buildv1.Build) *unstructured.Unstructured {
+				return mockPipelineRun(b, "False", "Failed", &started, &completed)
+			},
+			expectedUpdate: newUpdate().phase(buildv1.BuildPhaseFailed).reason(buildv1.StatusReasonGenericBuildFailed).message("pipeline message").startTime(metav1.NewTime(started)).completionTime(metav1.NewTime(completed)).update,
+		},
+		{
+			name:  "pipeline run cancelled",
+			phase: buildv1.BuildPhaseRunning,
+			run: func(b *buildv1.Build) *unstructured.Unstructured {
+				return mockPipelineRun(b, "False", "Cancelled", &started, &completed)
+			},
+			expectedUpdate: newUpdate().phase(buildv1.BuildPhaseCancelled).reason(buildv1.StatusReasonCancelledBuild).message("The pipeline run for this build was cancelled.").startTime(metav1.NewTime(started)).completionTime(metav1.NewTime(completed)).update,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			build := mockPipelineBuild(tc.phase)
+			bc, _ := newFakePipelineBuildController(build)
+			defer bc.stop()
+
+			update := bc.handleActivePipelineBuild(build, tc.run(build))
+			validateUpdate(t, tc.name, tc.expectedUpdate, update)
+			if (tc.expectedUpdate.completionTime == nil) != (update.completionTime == nil) ||
+				(update.completionTime != nil && !update.completionTime.Equal(tc.expectedUpdate.completionTime)) {
+				t.Errorf("expected completion time %v, got %v", tc.expectedUpdate.completionTime, update.completionTime)
+			}
+		})
+	}
+}
+
+func TestPipelineBuildCompletionTimes(t *testing.T) {
+	started := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	completed := started.Add(5 * time.Minute)
+	build := mockPipelineBuild(buildv1.BuildPhaseRunning)
+	bc, _ := newFakePipelineBuildController(build, mockPipelineRun(build, "True", "Succeeded", &started, &completed))
+	defer bc.stop()
+
+	if err := bc.handleBuild(build); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := bc.buildPatcher.Builds(build.Namespace).Get(context.TODO(), build.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Phase != buildv1.BuildPhaseComplete {
+		t.Errorf("expected the build to be complete, got %s", updated.Status.Phase)
+	}
+	if updated.Status.CompletionTimestamp == nil || !updated.Status.CompletionTimestamp.Time.Equal(completed) {
+		t.Errorf("expected the completion time of the pipeline run, got %v", updated.Status.CompletionTimestamp)
+	}
+	if updated.Status.Duration != 5*time.Minute {
+		t.Errorf("expected a duration of 5m, got %v", updated.Status.Duration)
+	}
+}
+
+func TestCancelPipelineBuild(t *testing.T) {
+	build := mockPipelineBuild(buildv1.BuildPhaseRunning)
+	build.Status.Cancelled = true
+	bc, dynamicClient := newFakePipelineBuildController(build, mockPipelineRun(build, "Unknown", "Running", nil, nil))
+	defer bc.stop()
+
+	if err := bc.handleBuild(build); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	patched := false
+	for _, action := range dynamicClient.Actions() {
+		if patch, ok := action.(clientgotesting.PatchAction); ok && patch.GetResource() == PipelineRunResource {
+			patched = string(patch.GetPatch()) == `{"spec":{"status":"Cancelled"}}`
+		}
+	}
+	if !patched {
+		t.Errorf("expected the pipeline run to be cancelled, got actions %v", dynamicClient.Actions())
+	}
+	updated, err := bc.buildPatcher.Builds(build.Namespace).Get(context.TODO(), build.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.Phase != buildv1.BuildPhaseCancelled {
+		t.Errorf("expected the build to be cancelled, got %s", updated.Status.Phase)
+	}
+}
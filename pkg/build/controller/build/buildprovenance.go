@@ -0,0 +1,113 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/library-go/pkg/build/naming"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/provenance"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
+)
+
+const (
+	provenanceConfigMapSuffix = "provenance"
+
+	// provenanceStatementKey is the ConfigMap entry holding the provenance statement.
+	provenanceStatementKey = "provenance.json"
+	// provenanceEnvelopeKey is the ConfigMap entry holding the signed DSSE envelope.
+	provenanceEnvelopeKey = "provenance.dsse.json"
+)
+
+// getBuildProvenanceConfigMapName returns the name of the ConfigMap holding the
+// provenance of the build.
+func getBuildProvenanceConfigMapName(build *buildv1.Build) string {
+	return naming.GetConfigMapName(build.Name, provenanceConfigMapSuffix)
+}
+
+// recordProvenance stores the provenance statement of a completed build in a ConfigMap
+// owned by the build. Failures are reported as events and do not affect the build.
+func (bc *BuildController) recordProvenance(build *buildv1.Build, pod *corev1.Pod) {
+	if !bc.provenanceConfig.Enabled || !provenance.ShouldGenerate(build) {
+		return
+	}
+	configMap, err := bc.createBuildProvenanceConfigMapSpec(build, pod)
+	if err != nil {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedProvenance", "Error generating build provenance: %v", err)
+		klog.V(2).Infof("Failed to generate provenance for build %s: %v", buildDesc(build), err)
+		return
+	}
+	_, err = bc.configMapClient.ConfigMaps(build.Namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating build provenance configMap: %v", err)
+		klog.V(2).Infof("Failed to create provenance configMap for build %s: %v", buildDesc(build), err)
+		return
+	}
+	klog.V(4).Infof("Recorded provenance configMap %s/%s for build %s", build.Namespace, configMap.Name, buildDesc(build))
+}
+
+// createBuildProvenanceConfigMapSpec creates a ConfigMap template holding the provenance
+// statement of the build and, when a signing key is configured, its signed envelope.
+// The returned ConfigMap has an owner reference to the build so it is removed with it.
+func (bc *BuildController) createBuildProvenanceConfigMapSpec(build *buildv1.Build, pod *corev1.Pod) (*corev1.ConfigMap, error) {
+	statement, err := provenance.Generate(build, pod)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	t := true
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: getBuildProvenanceConfigMapName(build),
+			Labels: map[string]string{
+				buildv1.BuildLabel: buildutil.LabelValue(build.Name),
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: strategy.BuildControllerRefKind.GroupVersion().String(),
+					Kind:       strategy.BuildControllerRefKind.Kind,
+					Name:       build.Name,
+					UID:        build.UID,
+					Controller: &t,
+				},
+			},
+		},
+		Data: map[string]string{
+			provenanceStatementKey: string(payload),
+		},
+	}
+
+	secretRef := bc.provenanceConfig.SigningKeySecret
+	if secretRef == nil {
+		return cm, nil
+	}
+	secret, err := bc.secretStore.Secrets(secretRef.Namespace).Get(secretRef.Name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read provenance signing key %s/%s: %v", secretRef.Namespace, secretRef.Name, err)
+	}
+	signer, err := provenance.ParsePrivateKey(secret.Data[provenance.SigningKeySecretKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance signing key %s/%s: %v", secretRef.Namespace, secretRef.Name, err)
+	}
+	envelope, err := provenance.Sign(payload, signer)
+	if err != nil {
+		return nil, err
+	}
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	cm.Data[provenanceEnvelopeKey] = string(envelopeJSON)
+	return cm, nil
+}
@@ -0,0 +1,63 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/provenance"
+)
+
+func TestRecordProvenance(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		phase     buildv1.BuildPhase
+		expectMap bool
+	}{
+		{name: "disabled", enabled: false, phase: buildv1.BuildPhaseComplete},
+		{name: "failed build", enabled: true, phase: buildv1.BuildPhaseFailed},
+		{name: "completed build", enabled: true, phase: buildv1.BuildPhaseComplete, expectMap: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			build := dockerStrategy(mockBuild(tc.phase, buildv1.BuildOutput{}))
+			build.UID = "build-uid"
+			build.Status.OutputDockerImageReference = "registry:5000/namespace/out:latest"
+			build.Status.Output.To = &buildv1.BuildStatusOutputTo{ImageDigest: "sha256:abc"}
+
+			bc := newFakeBuildController(nil, nil, nil, nil, nil)
+			defer bc.stop()
+			bc.provenanceConfig = provenance.Config{Enabled: tc.enabled}
+
+			bc.recordProvenance(build, mockBuildPod(build))
+
+			cm, err := bc.kubeClient.CoreV1().ConfigMaps(build.Namespace).Get(context.TODO(), getBuildProvenanceConfigMapName(build), metav1.GetOptions{})
+			if !tc.expectMap {
+				if err == nil {
+					t.Fatalf("expected no provenance configMap to be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected provenance configMap: %v", err)
+			}
+			if len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].UID != build.UID {
+				t.Errorf("expected configMap to be owned by the build, got %v", cm.OwnerReferences)
+			}
+			statement := &provenance.Statement{}
+			if err := json.Unmarshal([]byte(cm.Data[provenanceStatementKey]), statement); err != nil {
+				t.Fatalf("invalid provenance statement: %v", err)
+			}
+			if statement.Subject[0].Digest["sha256"] != "abc" {
+				t.Errorf("unexpected subject %#v", statement.Subject)
+			}
+			if _, ok := cm.Data[provenanceEnvelopeKey]; ok {
+				t.Errorf("expected no signed envelope without a signing key")
+			}
+		})
+	}
+}
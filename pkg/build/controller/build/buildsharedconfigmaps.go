@@ -0,0 +1,148 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	// SharedConfigMapLabel marks the content-addressed ConfigMaps shared by the build pods
+	// of a namespace.
+	SharedConfigMapLabel = "build.openshift.io/shared-configmap"
+
+	// sharedConfigMapHashLength is the number of hexadecimal digits of the content hash
+	// naming a shared ConfigMap.
+	sharedConfigMapHashLength = 16
+)
+
+// SharedConfigMapsConfig controls the sharing of the certificate authority and registry
+// configuration ConfigMaps between the builds of a namespace.
+type SharedConfigMapsConfig struct {
+	// Enabled mounts content-addressed ConfigMaps shared by all builds of a namespace in
+	// place of the three ConfigMaps created for every build. A shared ConfigMap is owned by
+	// every build pod mounting it, and garbage collected once all of them are deleted. A
+	// build whose content is not shared with other builds simply ends up with a ConfigMap
+	// of its own.
+	Enabled bool `json:"enabled"`
+}
+
+// sharedConfigMap is a shared ConfigMap mounted into a build pod.
+type sharedConfigMap struct {
+	spec    *corev1.ConfigMap
+	reason  buildv1.StatusReason
+	message string
+}
+
+// shareBuildConfigMaps points the ConfigMap volumes of the build pod at the shared
+// ConfigMaps holding the same content as the per-build ConfigMaps, and returns them.
+func (bc *BuildController) shareBuildConfigMaps(build *buildv1.Build, buildPod *corev1.Pod, additionalCAs map[string]string) []sharedConfigMap {
+	caData := make(map[string]string, len(additionalCAs))
+	for k, v := range additionalCAs {
+		caData[k] = v
+	}
+	volumes := []struct {
+		volume string
+		prefix string
+		shared sharedConfigMap
+	}{
+		{"build-ca-bundles", "build-ca", sharedConfigMap{bc.createBuildCAConfigMapSpec(build, buildPod, caData), "CannotCreateCAConfigMap", "Failed creating build certificate authority configMap."}},
+		{"build-proxy-ca-bundles", "build-proxy-ca", sharedConfigMap{bc.createBuildGlobalCAConfigMapSpec(build, buildPod), "CannotCreateGlobalCAConfigMap", "Failed creating build proxy certificate authority configMap."}},
+		{"build-system-configs", "build-sys-config", sharedConfigMap{bc.createBuildSystemConfigMapSpec(build, buildPod), "CannotCreateBuildSysConfigMap", "Failed creating build system config configMap."}},
+	}
+
+	shared := []sharedConfigMap{}
+	for _, v := range volumes {
+		cm := v.shared.spec
+		name := fmt.Sprintf("%s-%s", v.prefix, configMapDataHash(cm.Data))
+		mounted := false
+		for i := range buildPod.Spec.Volumes {
+			source := buildPod.Spec.Volumes[i].ConfigMap
+			if buildPod.Spec.Volumes[i].Name == v.volume && source != nil && source.Name == cm.Name {
+				source.Name = name
+				mounted = true
+			}
+		}
+		if !mounted {
+			continue
+		}
+		cm.Name = name
+		cm.Namespace = build.Namespace
+		cm.Labels = map[string]string{SharedConfigMapLabel: "true"}
+		cm.OwnerReferences = nil
+		shared = append(shared, v.shared)
+	}
+	return shared
+}
+
+// ensureSharedConfigMaps creates the shared ConfigMaps mounted into a build pod, or adds
+// the owner of the build pod to the existing ones. The owner keeps a shared ConfigMap from
+// being garbage collected for as long as it exists.
+func (bc *BuildController) ensureSharedConfigMaps(build *buildv1.Build, owner metav1.OwnerReference, shared []sharedConfigMap, update *buildUpdate) (*buildUpdate, error) {
+	for _, s := range shared {
+		err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+			// The ConfigMap may be created, updated or collected concurrently.
+			return errors.IsConflict(err) || errors.IsNotFound(err) || errors.IsAlreadyExists(err)
+		}, func() error {
+			return bc.addSharedConfigMapOwner(build.Namespace, s.spec, owner)
+		})
+		if err != nil {
+			bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedCreate", "Error creating shared configMap %s: %v", s.spec.Name, err)
+			update.setReason(s.reason)
+			update.setMessage(s.message)
+			return update, fmt.Errorf("failed to create shared configMap %s/%s: %v", build.Namespace, s.spec.Name, err)
+		}
+		klog.V(4).Infof("Mounted shared configMap %s/%s into build %s", build.Namespace, s.spec.Name, buildDesc(build))
+	}
+	return update, nil
+}
+
+// addSharedConfigMapOwner creates the shared ConfigMap owned by the given owner, or adds
+// the owner to the existing shared ConfigMap.
+func (bc *BuildController) addSharedConfigMapOwner(namespace string, spec *corev1.ConfigMap, owner metav1.OwnerReference) error {
+	cm, err := bc.configMapClient.ConfigMaps(namespace).Get(context.TODO(), spec.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = spec.DeepCopy()
+		cm.OwnerReferences = []metav1.OwnerReference{owner}
+		_, err = bc.configMapClient.ConfigMaps(namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if configMapDataHash(cm.Data) != configMapDataHash(spec.Data) {
+		return fmt.Errorf("the content of configMap %s/%s does not match its name", namespace, spec.Name)
+	}
+	for _, ref := range cm.OwnerReferences {
+		if ref.Kind == owner.Kind && ref.Name == owner.Name && ref.UID == owner.UID {
+			return nil
+		}
+	}
+	cm.OwnerReferences = append(cm.OwnerReferences, owner)
+	_, err = bc.configMapClient.ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
+
+// configMapDataHash returns a hash of the given ConfigMap data.
+func configMapDataHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(k), k, len(data[k]), data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:sharedConfigMapHashLength]
+}
@@ -0,0 +1,104 @@
+package build
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+func TestCreateBuildPodSharedConfigMaps(t *testing.T) {
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+	bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+	defer bc.stop()
+	bc.sharedConfigMapsConfig = SharedConfigMapsConfig{Enabled: true}
+
+	var sharedNames []string
+	for i, name := range []string{"first-build", "second-build"} {
+		build := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+		build.Name = name
+		if _, err := bc.createBuildPod(build); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		pod, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), buildutil.GetBuildPodName(build), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := []string{}
+		for _, v := range pod.Spec.Volumes {
+			switch v.Name {
+			case "build-ca-bundles", "build-proxy-ca-bundles", "build-system-configs":
+				names = append(names, v.ConfigMap.Name)
+			}
+		}
+		if len(names) != 3 {
+			t.Fatalf("%s: expected three ConfigMap volumes, got %v", name, names)
+		}
+		if i == 0 {
+			sharedNames = names
+		} else if strings.Join(names, ",") != strings.Join(sharedNames, ",") {
+			t.Errorf("expected both builds to mount %v, got %v", sharedNames, names)
+		}
+
+		for _, perBuild := range []string{buildutil.GetBuildCAConfigMapName(build), buildutil.GetBuildGlobalCAConfigMapName(build), buildutil.GetBuildSystemConfigMapName(build)} {
+			if _, err := kubeClient.CoreV1().ConfigMaps(build.Namespace).Get(context.TODO(), perBuild, metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("expected no per-build configMap %s, got %v", perBuild, err)
+			}
+		}
+	}
+
+	for _, name := range sharedNames {
+		cm, err := kubeClient.CoreV1().ConfigMaps("namespace").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected shared configMap %s: %v", name, err)
+		}
+		if cm.Labels[SharedConfigMapLabel] != "true" {
+			t.Errorf("expected configMap %s to be labelled as shared", name)
+		}
+		if len(cm.OwnerReferences) != 2 {
+			t.Errorf("expected configMap %s to be owned by both build pods, got %v", name, cm.OwnerReferences)
+		}
+	}
+	if !strings.Contains(strings.Join(sharedNames, ","), "build-ca-") {
+		t.Errorf("expected a shared certificate authority configMap, got %v", sharedNames)
+	}
+}
+
+func TestAddSharedConfigMapOwnerMismatch(t *testing.T) {
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-ca-0123456789abcdef", Namespace: "namespace"},
+		Data:       map[string]string{"key": "tampered"},
+	}
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap, existing)
+	bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+	defer bc.stop()
+
+	spec := existing.DeepCopy()
+	spec.Data = map[string]string{"key": "value"}
+	if err := bc.addSharedConfigMapOwner("namespace", spec, metav1.OwnerReference{Kind: "Pod", Name: "pod", UID: "uid"}); err == nil {
+		t.Errorf("expected an error for a shared configMap with different content")
+	}
+}
+
+func TestConfigMapDataHash(t *testing.T) {
+	a := configMapDataHash(map[string]string{"a": "1", "b": "2"})
+	if b := configMapDataHash(map[string]string{"b": "2", "a": "1"}); a != b {
+		t.Errorf("expected the hash not to depend on key order")
+	}
+	if b := configMapDataHash(map[string]string{"a": "12"}); a == b {
+		t.Errorf("expected different content to hash differently")
+	}
+	if b := configMapDataHash(map[string]string{"a1": "", "b": "2"}); a == b {
+		t.Errorf("expected different content to hash differently")
+	}
+	if len(a) != sharedConfigMapHashLength {
+		t.Errorf("expected a hash of %d digits, got %s", sharedConfigMapHashLength, a)
+	}
+}
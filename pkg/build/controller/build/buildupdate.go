@@ -9,6 +9,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/multiarch"
 	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
 )
 
@@ -29,6 +31,9 @@ type buildUpdate struct {
 	outputRef         *string
 	logSnippet        *string
 	pushSecret        *corev1.LocalObjectReference
+	logArchive        *string
+	archStatus        *string
+	outputDigest      *string
 }
 
 func (u *buildUpdate) setPhase(phase buildv1.BuildPhase) {
@@ -71,6 +76,18 @@ func (u *buildUpdate) setPushSecret(pushSecret corev1.LocalObjectReference) {
 	u.pushSecret = &pushSecret
 }
 
+func (u *buildUpdate) setLogArchiveAnnotation(location string) {
+	u.logArchive = &location
+}
+
+func (u *buildUpdate) setArchitectureStatus(status string) {
+	u.archStatus = &status
+}
+
+func (u *buildUpdate) setOutputDigest(digest string) {
+	u.outputDigest = &digest
+}
+
 func (u *buildUpdate) reset() {
 	u.podNameAnnotation = nil
 	u.phase = nil
@@ -82,6 +99,9 @@ func (u *buildUpdate) reset() {
 	u.outputRef = nil
 	u.logSnippet = nil
 	u.pushSecret = nil
+	u.logArchive = nil
+	u.archStatus = nil
+	u.outputDigest = nil
 }
 
 func (u *buildUpdate) isEmpty() bool {
@@ -94,7 +114,10 @@ func (u *buildUpdate) isEmpty() bool {
 		u.duration == nil &&
 		u.outputRef == nil &&
 		u.logSnippet == nil &&
-		u.pushSecret == nil
+		u.pushSecret == nil &&
+		u.logArchive == nil &&
+		u.archStatus == nil &&
+		u.outputDigest == nil
 }
 
 func (u *buildUpdate) apply(build *buildv1.Build) {
@@ -128,6 +151,18 @@ func (u *buildUpdate) apply(build *buildv1.Build) {
 	if u.pushSecret != nil {
 		build.Spec.Output.PushSecret = u.pushSecret
 	}
+	if u.logArchive != nil {
+		metav1.SetMetaDataAnnotation(&build.ObjectMeta, logarchive.LocationAnnotation, *u.logArchive)
+	}
+	if u.archStatus != nil {
+		metav1.SetMetaDataAnnotation(&build.ObjectMeta, multiarch.ArchitectureStatusAnnotation, *u.archStatus)
+	}
+	if u.outputDigest != nil {
+		if build.Status.Output.To == nil {
+			build.Status.Output.To = &buildv1.BuildStatusOutputTo{}
+		}
+		build.Status.Output.To.ImageDigest = *u.outputDigest
+	}
 }
 
 // String returns a string representation of this update
@@ -164,5 +199,14 @@ func (u *buildUpdate) String() string {
 	if u.pushSecret != nil {
 		updates = append(updates, fmt.Sprintf("pushSecret: %v", *u.pushSecret))
 	}
+	if u.logArchive != nil {
+		updates = append(updates, fmt.Sprintf("logArchive: %q", *u.logArchive))
+	}
+	if u.archStatus != nil {
+		updates = append(updates, fmt.Sprintf("architectureStatus: %s", *u.archStatus))
+	}
+	if u.outputDigest != nil {
+		updates = append(updates, fmt.Sprintf("outputDigest: %q", *u.outputDigest))
+	}
 	return fmt.Sprintf("buildUpdate(%s)", strings.Join(updates, ", "))
 }
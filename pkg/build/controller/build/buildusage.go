@@ -0,0 +1,237 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	sharedbuildutil "github.com/openshift/library-go/pkg/build/buildutil"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/build/metrics/prometheus"
+)
+
+const (
+	// BuildUsageConfigMapName is the name of the ConfigMap holding the daily build usage
+	// summaries of a namespace.
+	BuildUsageConfigMapName = "build-usage"
+	// BuildUsageLabel marks the ConfigMap holding the daily build usage summaries.
+	BuildUsageLabel = "build.openshift.io/usage-summary"
+
+	// defaultUsageSummaryRetentionDays is the number of daily summaries kept by default.
+	defaultUsageSummaryRetentionDays = 31
+	// usageSummaryDateFormat formats the date keys of the usage summary ConfigMap.
+	usageSummaryDateFormat = "2006-01-02"
+	// noBuildConfig is the BuildConfig key of the usage of builds without a BuildConfig.
+	noBuildConfig = "<none>"
+)
+
+// UsageAccountingConfig controls the accounting of the capacity used by builds.
+type UsageAccountingConfig struct {
+	// Enabled records the duration and the requested CPU and memory of every terminal build
+	// in per-namespace Prometheus counters and in a daily summary kept in the build-usage
+	// ConfigMap of the namespace.
+	Enabled bool `json:"enabled"`
+	// SummaryRetentionDays is the number of daily summaries kept in the ConfigMap.
+	// Defaults to 31.
+	SummaryRetentionDays int `json:"summaryRetentionDays,omitempty"`
+}
+
+// buildUsage is the capacity used by a terminal build.
+type buildUsage struct {
+	namespace         string
+	buildConfig       string
+	strategy          string
+	day               string
+	seconds           float64
+	cpuCoreSeconds    float64
+	memoryByteSeconds float64
+}
+
+// UsageTotals sums the capacity used by builds.
+type UsageTotals struct {
+	Builds            int64   `json:"builds"`
+	BuildSeconds      float64 `json:"buildSeconds"`
+	CPUCoreSeconds    float64 `json:"cpuCoreSeconds"`
+	MemoryByteSeconds float64 `json:"memoryByteSeconds"`
+}
+
+// DailyUsageSummary is the capacity used by the builds of a namespace that finished on a
+// given day, in total and broken down by BuildConfig and strategy.
+type DailyUsageSummary struct {
+	UsageTotals
+	ByBuildConfig map[string]*UsageTotals `json:"byBuildConfig,omitempty"`
+	ByStrategy    map[string]*UsageTotals `json:"byStrategy,omitempty"`
+}
+
+func (t *UsageTotals) add(usage *buildUsage) {
+	t.Builds++
+	t.BuildSeconds += usage.seconds
+	t.CPUCoreSeconds += usage.cpuCoreSeconds
+	t.MemoryByteSeconds += usage.memoryByteSeconds
+}
+
+// recordBuildUsage accounts for the capacity used by a terminal build. Failures to update
+// the daily summary are reported as events and do not affect the build.
+func (bc *BuildController) recordBuildUsage(build *buildv1.Build, pod *corev1.Pod) {
+	if !bc.usageConfig.Enabled {
+		return
+	}
+	usage := newBuildUsage(build, pod)
+	metrics.RecordBuildUsage(usage.namespace, usage.seconds, usage.cpuCoreSeconds, usage.memoryByteSeconds)
+	if err := bc.addToUsageSummary(usage); err != nil {
+		bc.recorder.Eventf(build, corev1.EventTypeWarning, "FailedUsageSummary", "Error updating the build usage summary: %v", err)
+		klog.V(2).Infof("Failed to record the usage of build %s in the usage summary: %v", buildDesc(build), err)
+		return
+	}
+	klog.V(4).Infof("Recorded usage of build %s: %.0fs, %.1f core-seconds, %.0f byte-seconds", buildDesc(build), usage.seconds, usage.cpuCoreSeconds, usage.memoryByteSeconds)
+}
+
+// newBuildUsage returns the capacity used by a terminal build: its duration, and the CPU
+// and memory requested by its pod times its duration.
+func newBuildUsage(build *buildv1.Build, pod *corev1.Pod) *buildUsage {
+	usage := &buildUsage{
+		namespace:   build.Namespace,
+		buildConfig: sharedbuildutil.ConfigNameForBuild(build),
+		strategy:    metrics.StrategyType(build.Spec.Strategy),
+	}
+	if len(usage.buildConfig) == 0 {
+		usage.buildConfig = noBuildConfig
+	}
+	completed := time.Now()
+	if build.Status.CompletionTimestamp != nil {
+		completed = build.Status.CompletionTimestamp.Time
+	}
+	usage.day = completed.UTC().Format(usageSummaryDateFormat)
+
+	switch {
+	case build.Status.Duration > 0:
+		usage.seconds = build.Status.Duration.Seconds()
+	case build.Status.StartTimestamp != nil:
+		usage.seconds = completed.Sub(build.Status.StartTimestamp.Time).Seconds()
+	}
+	if usage.seconds < 0 {
+		usage.seconds = 0
+	}
+
+	cpu, memory := podRequests(pod)
+	usage.cpuCoreSeconds = float64(cpu.MilliValue()) / 1000 * usage.seconds
+	usage.memoryByteSeconds = float64(memory.Value()) * usage.seconds
+	return usage
+}
+
+// podRequests returns the CPU and memory requested by a pod: the larger of the sum of the
+// requests of its containers and the largest request of its init containers.
+func podRequests(pod *corev1.Pod) (resource.Quantity, resource.Quantity) {
+	var cpu, memory resource.Quantity
+	if pod == nil {
+		return cpu, memory
+	}
+	for _, c := range pod.Spec.Containers {
+		cpu.Add(c.Resources.Requests[corev1.ResourceCPU])
+		memory.Add(c.Resources.Requests[corev1.ResourceMemory])
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if q := c.Resources.Requests[corev1.ResourceCPU]; q.Cmp(cpu) > 0 {
+			cpu = q.DeepCopy()
+		}
+		if q := c.Resources.Requests[corev1.ResourceMemory]; q.Cmp(memory) > 0 {
+			memory = q.DeepCopy()
+		}
+	}
+	return cpu, memory
+}
+
+// addToUsageSummary adds the usage of a build to the summary of the day it finished, and
+// drops the summaries past the retention period.
+func (bc *BuildController) addToUsageSummary(usage *buildUsage) error {
+	retention := bc.usageConfig.SummaryRetentionDays
+	if retention <= 0 {
+		retention = defaultUsageSummaryRetentionDays
+	}
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		cm, err := bc.configMapClient.ConfigMaps(usage.namespace).Get(context.TODO(), BuildUsageConfigMapName, metav1.GetOptions{})
+		create := errors.IsNotFound(err)
+		switch {
+		case create:
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      BuildUsageConfigMapName,
+					Namespace: usage.namespace,
+					Labels:    map[string]string{BuildUsageLabel: "true"},
+				},
+			}
+		case err != nil:
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		summary := &DailyUsageSummary{}
+		if data, ok := cm.Data[usage.day]; ok {
+			if err := json.Unmarshal([]byte(data), summary); err != nil {
+				klog.V(2).Infof("Replacing invalid build usage summary %s in %s/%s: %v", usage.day, usage.namespace, BuildUsageConfigMapName, err)
+				summary = &DailyUsageSummary{}
+			}
+		}
+		summary.add(usage)
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+		cm.Data[usage.day] = string(data)
+		pruneUsageSummaries(cm.Data, retention)
+
+		if create {
+			_, err = bc.configMapClient.ConfigMaps(usage.namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = bc.configMapClient.ConfigMaps(usage.namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		}
+		return err
+	})
+}
+
+func (s *DailyUsageSummary) add(usage *buildUsage) {
+	s.UsageTotals.add(usage)
+	if s.ByBuildConfig == nil {
+		s.ByBuildConfig = map[string]*UsageTotals{}
+	}
+	if s.ByBuildConfig[usage.buildConfig] == nil {
+		s.ByBuildConfig[usage.buildConfig] = &UsageTotals{}
+	}
+	s.ByBuildConfig[usage.buildConfig].add(usage)
+	if s.ByStrategy == nil {
+		s.ByStrategy = map[string]*UsageTotals{}
+	}
+	if s.ByStrategy[usage.strategy] == nil {
+		s.ByStrategy[usage.strategy] = &UsageTotals{}
+	}
+	s.ByStrategy[usage.strategy].add(usage)
+}
+
+// pruneUsageSummaries keeps the given number of most recent daily summaries.
+func pruneUsageSummaries(data map[string]string, retention int) {
+	days := []string{}
+	for day := range data {
+		if _, err := time.Parse(usageSummaryDateFormat, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	if len(days) <= retention {
+		return
+	}
+	sort.Strings(days)
+	for _, day := range days[:len(days)-retention] {
+		delete(data, day)
+	}
+}
@@ -0,0 +1,127 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestNewBuildUsage(t *testing.T) {
+	start := time.Date(2026, 10, 17, 23, 59, 0, 0, time.UTC)
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseComplete, buildv1.BuildOutput{}))
+	build.Status.StartTimestamp = &metav1.Time{Time: start}
+	build.Status.CompletionTimestamp = &metav1.Time{Time: start.Add(100 * time.Second)}
+
+	pod := mockBuildPod(build)
+	pod.Spec.InitContainers = []corev1.Container{
+		{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("64Mi")}}},
+	}
+	pod.Spec.Containers = []corev1.Container{
+		{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("1Gi")}}},
+		{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}}},
+	}
+
+	usage := newBuildUsage(build, pod)
+	if usage.buildConfig != "test-bc" || usage.strategy != "Docker" || usage.day != "2026-10-18" {
+		t.Errorf("unexpected usage keys %#v", usage)
+	}
+	if usage.seconds != 100 {
+		t.Errorf("expected 100 build seconds, got %v", usage.seconds)
+	}
+	// The init container requests more CPU than all containers, but less memory.
+	if usage.cpuCoreSeconds != 200 {
+		t.Errorf("expected 200 core-seconds, got %v", usage.cpuCoreSeconds)
+	}
+	if usage.memoryByteSeconds != float64(100<<30) {
+		t.Errorf("expected %v byte-seconds, got %v", float64(100<<30), usage.memoryByteSeconds)
+	}
+
+	build.Status.Duration = 40 * time.Second
+	delete(build.Annotations, buildv1.BuildConfigAnnotation)
+	delete(build.Labels, buildv1.BuildConfigLabel)
+	usage = newBuildUsage(build, nil)
+	if usage.seconds != 40 || usage.cpuCoreSeconds != 0 || usage.buildConfig != noBuildConfig {
+		t.Errorf("unexpected usage of a build without pod or BuildConfig %#v", usage)
+	}
+}
+
+func TestAddToUsageSummary(t *testing.T) {
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+	bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+	defer bc.stop()
+	bc.usageConfig = UsageAccountingConfig{Enabled: true, SummaryRetentionDays: 2}
+
+	for _, usage := range []*buildUsage{
+		{namespace: "namespace", buildConfig: "app", strategy: "Docker", day: "2026-10-16", seconds: 1},
+		{namespace: "namespace", buildConfig: "app", strategy: "Docker", day: "2026-10-17", seconds: 10, cpuCoreSeconds: 5},
+		{namespace: "namespace", buildConfig: "app", strategy: "Source", day: "2026-10-18", seconds: 20, cpuCoreSeconds: 10},
+		{namespace: "namespace", buildConfig: "web", strategy: "Docker", day: "2026-10-18", seconds: 30, memoryByteSeconds: 1024},
+	} {
+		if err := bc.addToUsageSummary(usage); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	cm, err := kubeClient.CoreV1().ConfigMaps("namespace").Get(context.TODO(), BuildUsageConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Labels[BuildUsageLabel] != "true" {
+		t.Errorf("expected the usage summary to be labelled")
+	}
+	if _, ok := cm.Data["2026-10-16"]; ok || len(cm.Data) != 2 {
+		t.Errorf("expected the two most recent summaries to be kept, got %v", cm.Data)
+	}
+	summary := &DailyUsageSummary{}
+	if err := json.Unmarshal([]byte(cm.Data["2026-10-18"]), summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Builds != 2 || summary.BuildSeconds != 50 || summary.CPUCoreSeconds != 10 || summary.MemoryByteSeconds != 1024 {
+		t.Errorf("unexpected daily totals %#v", summary.UsageTotals)
+	}
+	if app := summary.ByBuildConfig["app"]; app == nil || app.Builds != 1 || app.BuildSeconds != 20 {
+		t.Errorf("unexpected totals of BuildConfig app %v", app)
+	}
+	if docker := summary.ByStrategy["Docker"]; docker == nil || docker.Builds != 1 || docker.BuildSeconds != 30 {
+		t.Errorf("unexpected totals of the Docker strategy %v", docker)
+	}
+}
+
+func TestUpdateBuildRecordsUsage(t *testing.T) {
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseRunning, buildv1.BuildOutput{}))
+	build.Status.StartTimestamp = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+	bc := newFakeBuildController(fakeBuildClient(build), nil, kubeClient, nil, nil)
+	defer bc.stop()
+	bc.usageConfig = UsageAccountingConfig{Enabled: true}
+
+	pod := mockBuildPod(build)
+	pod.Status.Phase = corev1.PodSucceeded
+	if err := bc.updateBuild(build, transitionToPhase(buildv1.BuildPhaseComplete, "", ""), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cm, err := kubeClient.CoreV1().ConfigMaps(build.Namespace).Get(context.TODO(), BuildUsageConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the usage summary to be created: %v", err)
+	}
+	if len(cm.Data) != 1 {
+		t.Errorf("expected one daily summary, got %v", cm.Data)
+	}
+	for day, data := range cm.Data {
+		summary := &DailyUsageSummary{}
+		if err := json.Unmarshal([]byte(data), summary); err != nil {
+			t.Fatal(err)
+		}
+		if summary.Builds != 1 || summary.BuildSeconds < 59 {
+			t.Errorf("%s: unexpected totals %#v", day, summary.UsageTotals)
+		}
+	}
+}
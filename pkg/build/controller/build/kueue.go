@@ -0,0 +1,131 @@
+package build
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	// KueueQueueNameLabel names the Kueue LocalQueue a build pod is submitted to. When set
+	// on a build it overrides the default queue of the controller configuration.
+	KueueQueueNameLabel = "kueue.x-k8s.io/queue-name"
+
+	// KueueAdmissionGate is the scheduling gate Kueue removes once it admits a pod.
+	KueueAdmissionGate = "kueue.x-k8s.io/admission"
+
+	// kueueManagedFinalizer is added by Kueue to the pods it manages.
+	kueueManagedFinalizer = "kueue.x-k8s.io/managed"
+
+	// StatusReasonWaitingForAdmission is the reason of pending builds whose build pod
+	// has not been admitted by Kueue yet.
+	StatusReasonWaitingForAdmission buildv1.StatusReason = "WaitingForAdmission"
+	// statusMessageWaitingForAdmission is the message of pending builds whose build pod
+	// has not been admitted by Kueue yet.
+	statusMessageWaitingForAdmission = "Waiting for the build pod to be admitted by Kueue."
+)
+
+// KueueConfig controls the submission of build pods to Kueue.
+type KueueConfig struct {
+	// Enabled creates build pods with the Kueue admission scheduling gate and queue name
+	// label, so they are only scheduled once Kueue admits them.
+	Enabled bool `json:"enabled"`
+	// QueueName is the LocalQueue build pods are submitted to unless the build carries
+	// the kueue.x-k8s.io/queue-name label. Builds without a queue name are not gated.
+	QueueName string `json:"queueName,omitempty"`
+}
+
+// kueueQueueName returns the Kueue queue the pod of the build is submitted to, or an
+// empty string if the build pod is not managed by Kueue.
+func (bc *BuildController) kueueQueueName(build *buildv1.Build) string {
+	if !bc.kueueConfig.Enabled {
+		return ""
+	}
+	if queue := build.Labels[KueueQueueNameLabel]; len(queue) > 0 {
+		return queue
+	}
+	return bc.kueueConfig.QueueName
+}
+
+// applyKueue submits the build pod to the Kueue queue of the build by labelling it with
+// the queue name and holding its scheduling until Kueue admits it.
+func (bc *BuildController) applyKueue(build *buildv1.Build, pod *corev1.Pod) {
+	queue := bc.kueueQueueName(build)
+	if len(queue) == 0 {
+		return
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[KueueQueueNameLabel] = queue
+	if !hasAdmissionGate(pod) {
+		pod.Spec.SchedulingGates = append(pod.Spec.SchedulingGates, corev1.PodSchedulingGate{Name: KueueAdmissionGate})
+	}
+}
+
+// hasAdmissionGate returns true if the pod has not been admitted by Kueue yet.
+func hasAdmissionGate(pod *corev1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+	for _, gate := range pod.Spec.SchedulingGates {
+		if gate.Name == KueueAdmissionGate {
+			return true
+		}
+	}
+	return false
+}
+
+// admissionUpdate returns the update reporting whether the pending build waits for the
+// admission of its pod, or nil if the reported state is current.
+func admissionUpdate(build *buildv1.Build, pod *corev1.Pod) *buildUpdate {
+	gated := hasAdmissionGate(pod)
+	switch {
+	case gated && build.Status.Reason != StatusReasonWaitingForAdmission:
+		return transitionToPhase(buildv1.BuildPhasePending, StatusReasonWaitingForAdmission, statusMessageWaitingForAdmission)
+	case !gated && build.Status.Reason == StatusReasonWaitingForAdmission:
+		return transitionToPhase(buildv1.BuildPhasePending, "", "")
+	}
+	return nil
+}
+
+// releaseGatedPod removes the Kueue finalizer from a build pod that was never admitted,
+// so deleting the pod does not depend on Kueue to finish the deletion.
+func (bc *BuildController) releaseGatedPod(build *buildv1.Build, podName string) {
+	if !bc.kueueConfig.Enabled {
+		return
+	}
+	pod, err := bc.podStore.Pods(build.Namespace).Get(podName)
+	if err != nil || !hasAdmissionGate(pod) {
+		return
+	}
+	pod, err = bc.podClient.Pods(build.Namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			utilruntime.HandleError(fmt.Errorf("could not get gated build pod %s/%s of build %s: %v", build.Namespace, podName, buildDesc(build), err))
+		}
+		return
+	}
+	finalizers := make([]string, 0, len(pod.Finalizers))
+	for _, f := range pod.Finalizers {
+		if f != kueueManagedFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(pod.Finalizers) {
+		return
+	}
+	pod.Finalizers = finalizers
+	if _, err := bc.podClient.Pods(build.Namespace).Update(context.TODO(), pod, metav1.UpdateOptions{}); err != nil && !errors.IsNotFound(err) {
+		utilruntime.HandleError(fmt.Errorf("could not remove the Kueue finalizer from build pod %s/%s of build %s: %v", build.Namespace, podName, buildDesc(build), err))
+		return
+	}
+	klog.V(4).Infof("Removed the Kueue finalizer from gated build pod %s/%s of build %s", build.Namespace, podName, buildDesc(build))
+}
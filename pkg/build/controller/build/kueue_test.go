@@ -0,0 +1,121 @@
+package build
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgotesting "k8s.io/client-go/testing"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+func TestCreateBuildPodKueue(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        KueueConfig
+		buildQueue    string
+		expectedQueue string
+	}{
+		{name: "disabled", config: KueueConfig{QueueName: "builds"}},
+		{name: "default queue", config: KueueConfig{Enabled: true, QueueName: "builds"}, expectedQueue: "builds"},
+		{name: "build queue", config: KueueConfig{Enabled: true, QueueName: "builds"}, buildQueue: "urgent", expectedQueue: "urgent"},
+		{name: "no queue", config: KueueConfig{Enabled: true}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeClient := fakeKubeExternalClientSet(registryCAConfigMap)
+			bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+			defer bc.stop()
+			bc.kueueConfig = tc.config
+
+			build := dockerStrategy(mockBuild(buildv1.BuildPhaseNew, buildv1.BuildOutput{}))
+			if len(tc.buildQueue) > 0 {
+				build.Labels[KueueQueueNameLabel] = tc.buildQueue
+			}
+			if _, err := bc.createBuildPod(build); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pod, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), buildutil.GetBuildPodName(build), metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pod.Labels[KueueQueueNameLabel] != tc.expectedQueue {
+				t.Errorf("expected queue %q, got %q", tc.expectedQueue, pod.Labels[KueueQueueNameLabel])
+			}
+			if hasAdmissionGate(pod) != (len(tc.expectedQueue) > 0) {
+				t.Errorf("unexpected scheduling gates %v", pod.Spec.SchedulingGates)
+			}
+		})
+	}
+}
+
+func TestHandleActiveBuildWaitingForAdmission(t *testing.T) {
+	bc := newFakeBuildController(nil, nil, nil, nil, nil)
+	defer bc.stop()
+
+	build := dockerStrategy(mockBuild(buildv1.BuildPhasePending, buildv1.BuildOutput{}))
+	pod := mockBuildPod(build)
+	pod.Status.Phase = corev1.PodPending
+	pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: KueueAdmissionGate}}
+
+	update, err := bc.handleActiveBuild(build, pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := transitionToPhase(buildv1.BuildPhasePending, StatusReasonWaitingForAdmission, statusMessageWaitingForAdmission)
+	validateUpdate(t, "gated", expected, update)
+
+	// Once admitted, the waiting reason is cleared.
+	build.Status.Reason = StatusReasonWaitingForAdmission
+	build.Status.Message = statusMessageWaitingForAdmission
+	pod.Spec.SchedulingGates = nil
+	update, err = bc.handleActiveBuild(build, pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	validateUpdate(t, "admitted", transitionToPhase(buildv1.BuildPhasePending, "", ""), update)
+}
+
+func TestCancelGatedBuild(t *testing.T) {
+	build := dockerStrategy(mockBuild(buildv1.BuildPhasePending, buildv1.BuildOutput{}))
+	build.Status.Cancelled = true
+	pod := mockBuildPod(build)
+	pod.Finalizers = []string{kueueManagedFinalizer}
+	pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: KueueAdmissionGate}}
+
+	kubeClient := fakeKubeExternalClientSet(registryCAConfigMap, pod)
+	bc := newFakeBuildController(nil, nil, kubeClient, nil, nil)
+	defer bc.stop()
+	bc.kueueConfig = KueueConfig{Enabled: true}
+	if err := bc.podInformer.GetIndexer().Add(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := bc.cancelBuild(build)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update.phase == nil || *update.phase != buildv1.BuildPhaseCancelled {
+		t.Errorf("expected the build to be cancelled, got %v", update)
+	}
+
+	var removedFinalizer bool
+	for _, action := range kubeClient.(*fake.Clientset).Actions() {
+		if u, ok := action.(clientgotesting.UpdateAction); ok {
+			if p, ok := u.GetObject().(*corev1.Pod); ok && len(p.Finalizers) == 0 {
+				removedFinalizer = true
+			}
+		}
+	}
+	if !removedFinalizer {
+		t.Errorf("expected the Kueue finalizer to be removed from the gated pod")
+	}
+	if _, err := kubeClient.CoreV1().Pods(build.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the gated pod to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package logarchive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypedclient "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/library-go/pkg/build/naming"
+	"github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+const (
+	// defaultConfigMapMaxBytes keeps the archive safely below the 1MiB object size limit.
+	defaultConfigMapMaxBytes = 900 * 1024
+
+	configMapSuffix = "logs"
+	truncatedNotice = "[log truncated, showing the last %d bytes]\n"
+)
+
+// ConfigMapConfig configures archiving of build logs to a ConfigMap in the namespace
+// of the build, with one <pod>.log entry per build pod. The ConfigMap is owned by the
+// build and removed together with it.
+type ConfigMapConfig struct {
+	// MaxBytes is the maximum size of the archived logs, shared evenly by the entries.
+	// Longer logs are truncated, keeping their end. Defaults to 900KiB.
+	MaxBytes int `json:"maxBytes,omitempty"`
+}
+
+// configMapSink writes build logs to a ConfigMap owned by the build.
+type configMapSink struct {
+	maxBytes int
+	client   ktypedclient.ConfigMapsGetter
+}
+
+func newConfigMapSink(config ConfigMapConfig, client ktypedclient.ConfigMapsGetter) *configMapSink {
+	maxBytes := config.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultConfigMapMaxBytes
+	}
+	return &configMapSink{maxBytes: maxBytes, client: client}
+}
+
+func (s *configMapSink) Archive(ctx context.Context, build *buildv1.Build, entries []Entry) (string, error) {
+	data := map[string]string{}
+	for _, entry := range entries {
+		data[entryName(entry)] = truncate(entry.Logs, s.maxBytes/len(entries))
+	}
+	t := true
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: naming.GetConfigMapName(build.Name, configMapSuffix),
+			Labels: map[string]string{
+				buildv1.BuildLabel: buildutil.LabelValue(build.Name),
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: buildv1.GroupVersion.String(),
+					Kind:       "Build",
+					Name:       build.Name,
+					UID:        build.UID,
+					Controller: &t,
+				},
+			},
+		},
+		Data: data,
+	}
+
+	configMaps := s.client.ConfigMaps(build.Namespace)
+	_, err := configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		var existing *corev1.ConfigMap
+		existing, err = configMaps.Get(ctx, cm.Name, metav1.GetOptions{})
+		if err == nil {
+			existing.Data = cm.Data
+			_, err = configMaps.Update(ctx, existing, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("configmap://%s/%s", build.Namespace, cm.Name), nil
+}
+
+// truncate returns the end of the log if it exceeds maxBytes.
+func truncate(logs []byte, maxBytes int) string {
+	if len(logs) <= maxBytes {
+		return strings.ToValidUTF8(string(logs), "")
+	}
+	notice := fmt.Sprintf(truncatedNotice, maxBytes)
+	keep := maxBytes - len(notice)
+	if keep < 0 {
+		keep = 0
+	}
+	// The cut may split a multi-byte character, which ConfigMap data cannot hold.
+	return notice + strings.ToValidUTF8(string(logs[len(logs)-keep:]), "")
+}
@@ -0,0 +1,55 @@
+package logarchive
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+// DirectoryConfig configures archiving of build logs to a local directory.
+type DirectoryConfig struct {
+	// Path is the directory logs are written to, usually the mount point of a
+	// persistent volume. Logs are stored as <path>/<namespace>/<build>/<pod>.log.
+	Path string `json:"path"`
+}
+
+// directorySink writes build logs to files below a directory.
+type directorySink struct {
+	path string
+}
+
+func (s *directorySink) Archive(ctx context.Context, build *buildv1.Build, entries []Entry) (string, error) {
+	dir := filepath.Join(s.path, filepath.FromSlash(archiveName(build)))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if err := writeFile(dir, entryName(entry), entry.Logs); err != nil {
+			return "", err
+		}
+	}
+	return (&url.URL{Scheme: "file", Path: dir + string(filepath.Separator)}).String(), nil
+}
+
+// writeFile writes to a temporary file first so a partially written entry is never visible.
+func writeFile(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".build-log-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
@@ -0,0 +1,40 @@
+/*
+Package logarchive stores the logs of finished builds in durable storage so they
+remain available after the build pod has been garbage collected.
+
+Logs can be written to a directory, typically backed by a persistent volume
+mounted into the controller manager, to a bucket of an S3 compatible object
+store, or to a ConfigMap owned by the build for small logs. The logs of every
+pod of the build, such as the per architecture and manifest list pods of multi
+architecture builds, are stored as a separate <pod>.log entry. The location of
+the archive is recorded in the openshift.io/build.log-archive annotation of the
+build.
+
+# Configuration
+
+Configuration is done via the build section of the controller manager's
+extended configuration. Exactly one sink may be configured:
+
+	extendedConfig:
+	  build:
+	    logArchive:
+	      s3:
+	        endpoint: https://minio.example.com:9000
+	        bucket: build-logs
+	        region: us-east-1
+	        prefix: cluster-a
+	        credentialsSecret:
+	          namespace: openshift-controller-manager
+	          name: build-log-archive-credentials
+
+The credentials secret holds the accessKeyID and secretAccessKey entries. A
+directory sink is configured with a path, and a ConfigMap sink with an optional
+maximum size in bytes:
+
+	extendedConfig:
+	  build:
+	    logArchive:
+	      directory:
+	        path: /var/lib/build-logs
+*/
+package logarchive
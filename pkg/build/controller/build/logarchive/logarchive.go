@@ -0,0 +1,83 @@
+package logarchive
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	ktypedclient "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+// LocationAnnotation is the build annotation holding the location of the archived logs.
+// It points to the directory, object prefix or ConfigMap holding one entry per build pod.
+const LocationAnnotation = "openshift.io/build.log-archive"
+
+// Config selects the sink build logs are archived to. At most one sink may be set;
+// when none is set build logs are not archived.
+type Config struct {
+	// Directory archives logs to files below a local directory.
+	Directory *DirectoryConfig `json:"directory,omitempty"`
+	// S3 archives logs to a bucket of an S3 compatible object store.
+	S3 *S3Config `json:"s3,omitempty"`
+	// ConfigMap archives logs to a ConfigMap owned by the build.
+	ConfigMap *ConfigMapConfig `json:"configMap,omitempty"`
+}
+
+// Entry is a single log stored in the archive of a build, usually the logs of one
+// build pod.
+type Entry struct {
+	// Name identifies the entry within the archive of the build, e.g. the pod name.
+	Name string
+	// Logs is the content of the entry.
+	Logs []byte
+}
+
+// Sink stores the logs of a build.
+type Sink interface {
+	// Archive stores the entries of the build and returns the location of the archive.
+	Archive(ctx context.Context, build *buildv1.Build, entries []Entry) (string, error)
+}
+
+// NewSink returns the sink selected by the config, or nil if archiving is disabled.
+// Secrets are read from the given lister and ConfigMaps created through the given client.
+func NewSink(config Config, secrets corev1lister.SecretLister, configMaps ktypedclient.ConfigMapsGetter) (Sink, error) {
+	var sinks []Sink
+	if config.Directory != nil {
+		if len(config.Directory.Path) == 0 {
+			return nil, fmt.Errorf("log archive directory path must be set")
+		}
+		sinks = append(sinks, &directorySink{path: config.Directory.Path})
+	}
+	if config.S3 != nil {
+		sink, err := newS3Sink(*config.S3, secrets)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.ConfigMap != nil {
+		sinks = append(sinks, newConfigMapSink(*config.ConfigMap, configMaps))
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	default:
+		return nil, fmt.Errorf("only one log archive sink may be configured")
+	}
+}
+
+// archiveName returns the name of the archive of the build, relative to the sink root.
+func archiveName(build *buildv1.Build) string {
+	return path.Join(build.Namespace, build.Name)
+}
+
+// entryName returns the name of the entry within the archive of the build.
+func entryName(entry Entry) string {
+	return entry.Name + ".log"
+}
@@ -0,0 +1,233 @@
+package logarchive
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+func mockBuild() *buildv1.Build {
+	return &buildv1.Build{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "ns", UID: "uid-1"},
+	}
+}
+
+func secretLister(t *testing.T, secrets ...*corev1.Secret) corev1lister.SecretLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, s := range secrets {
+		if err := indexer.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return corev1lister.NewSecretLister(indexer)
+}
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		expectNil bool
+		expectErr bool
+	}{
+		{name: "disabled", expectNil: true},
+		{name: "directory", config: Config{Directory: &DirectoryConfig{Path: "/logs"}}},
+		{name: "directory without path", config: Config{Directory: &DirectoryConfig{}}, expectErr: true},
+		{name: "configmap", config: Config{ConfigMap: &ConfigMapConfig{}}},
+		{
+			name: "s3",
+			config: Config{S3: &S3Config{
+				Endpoint:          "http://minio:9000",
+				Bucket:            "logs",
+				CredentialsSecret: corev1.SecretReference{Namespace: "ns", Name: "creds"},
+			}},
+		},
+		{name: "s3 with invalid endpoint", config: Config{S3: &S3Config{Endpoint: "minio", Bucket: "logs"}}, expectErr: true},
+		{
+			name: "multiple sinks",
+			config: Config{
+				Directory: &DirectoryConfig{Path: "/logs"},
+				ConfigMap: &ConfigMapConfig{},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := NewSink(tc.config, secretLister(t), fake.NewSimpleClientset().CoreV1())
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && tc.expectNil != (sink == nil) {
+				t.Errorf("expected nil sink %v, got %v", tc.expectNil, sink)
+			}
+		})
+	}
+}
+
+func TestDirectorySink(t *testing.T) {
+	dir := t.TempDir()
+	sink := &directorySink{path: dir}
+	entries := []Entry{
+		{Name: "app-1-build", Logs: []byte("build output\n")},
+		{Name: "app-1-manifest-list", Logs: []byte("manifest list output\n")},
+	}
+	location, err := sink.Archive(context.TODO(), mockBuild(), entries)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive := filepath.Join(dir, "ns", "app-1")
+	if location != "file://"+archive+"/" {
+		t.Errorf("unexpected location %q", location)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(archive, entry.Name+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(entry.Logs) {
+			t.Errorf("unexpected content %q of entry %s", data, entry.Name)
+		}
+	}
+}
+
+func TestConfigMapSink(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	sink := newConfigMapSink(ConfigMapConfig{MaxBytes: 128}, client.CoreV1())
+	build := mockBuild()
+
+	location, err := sink.Archive(context.TODO(), build, []Entry{{Name: "app-1-build", Logs: []byte("short log")}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if location != "configmap://ns/app-1-logs" {
+		t.Errorf("unexpected location %q", location)
+	}
+
+	// Archiving again replaces the content, sharing the size limit between the entries
+	// and keeping the end of long logs.
+	long := strings.Repeat("x", 100) + "the end"
+	entries := []Entry{
+		{Name: "app-1-build-amd64", Logs: []byte(long)},
+		{Name: "app-1-build-arm64", Logs: []byte("short log")},
+	}
+	if _, err := sink.Archive(context.TODO(), build, entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("ns").Get(context.TODO(), "app-1-logs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 2 || cm.Data["app-1-build-arm64.log"] != "short log" {
+		t.Errorf("unexpected entries %v", cm.Data)
+	}
+	data := cm.Data["app-1-build-amd64.log"]
+	if len(data) != 64 || !strings.HasPrefix(data, "[log truncated") || !strings.HasSuffix(data, "the end") {
+		t.Errorf("unexpected truncated log %q", data)
+	}
+	if len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].UID != build.UID {
+		t.Errorf("expected the build to own the ConfigMap, got %#v", cm.OwnerReferences)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS signature version 4 documentation.
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	expected := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if hex.EncodeToString(key) != expected {
+		t.Errorf("expected signing key %s, got %x", expected, key)
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	var (
+		gotPath string
+		gotAuth string
+		gotBody string
+	)
+	// A minimal stand-in for an S3 compatible object store such as MinIO.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotAuth, gotBody = r.URL.EscapedPath(), r.Header.Get("Authorization"), string(body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	secrets := secretLister(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-controller-manager", Name: "creds"},
+		Data: map[string][]byte{
+			S3AccessKeyIDKey:     []byte("minioadmin"),
+			S3SecretAccessKeyKey: []byte("minioadmin-secret"),
+		},
+	})
+	sink, err := newS3Sink(S3Config{
+		Endpoint:          server.URL,
+		Bucket:            "build-logs",
+		Prefix:            "cluster-a",
+		CredentialsSecret: corev1.SecretReference{Namespace: "openshift-controller-manager", Name: "creds"},
+	}, secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	location, err := sink.Archive(context.TODO(), mockBuild(), []Entry{{Name: "app-1-build", Logs: []byte("build output")}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if location != "s3://build-logs/cluster-a/ns/app-1/" {
+		t.Errorf("unexpected location %q", location)
+	}
+	if gotPath != "/build-logs/cluster-a/ns/app-1/app-1-build.log" {
+		t.Errorf("unexpected object path %q", gotPath)
+	}
+	if gotBody != "build output" {
+		t.Errorf("unexpected object content %q", gotBody)
+	}
+	expectedAuth := "AWS4-HMAC-SHA256 Credential=minioadmin/20240102/us-east-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(gotAuth, expectedAuth) {
+		t.Errorf("expected authorization %q..., got %q", expectedAuth, gotAuth)
+	}
+}
+
+func TestS3SinkMissingCredentials(t *testing.T) {
+	sink, err := newS3Sink(S3Config{
+		Endpoint:          "http://minio:9000",
+		Bucket:            "build-logs",
+		CredentialsSecret: corev1.SecretReference{Namespace: "ns", Name: "missing"},
+	}, secretLister(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink.Archive(context.TODO(), mockBuild(), []Entry{{Name: "app-1-build", Logs: []byte("build output")}}); err == nil {
+		t.Errorf("expected an error for missing credentials")
+	}
+}
+
+func TestURIEncodePath(t *testing.T) {
+	if got := uriEncodePath("/bucket/a b+c/d~e.log"); got != "/bucket/a%20b%2Bc/d~e.log" {
+		t.Errorf("unexpected encoding %q", got)
+	}
+}
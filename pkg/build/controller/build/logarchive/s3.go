@@ -0,0 +1,208 @@
+package logarchive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	// S3AccessKeyIDKey is the credentials secret entry holding the access key id.
+	S3AccessKeyIDKey = "accessKeyID"
+	// S3SecretAccessKeyKey is the credentials secret entry holding the secret access key.
+	S3SecretAccessKeyKey = "secretAccessKey"
+
+	defaultS3Region = "us-east-1"
+	s3Service       = "s3"
+
+	amzDateFormat   = "20060102T150405Z"
+	amzDayFormat    = "20060102"
+	signatureScheme = "AWS4-HMAC-SHA256"
+)
+
+// S3Config configures archiving of build logs to an S3 compatible object store.
+// Objects are addressed path-style, which is supported by AWS S3 as well as by
+// stand-ins such as MinIO.
+type S3Config struct {
+	// Endpoint is the URL of the object store, e.g. https://s3.us-east-1.amazonaws.com.
+	Endpoint string `json:"endpoint"`
+	// Bucket is the bucket logs are written to.
+	Bucket string `json:"bucket"`
+	// Region is the region of the bucket used to sign requests. Defaults to us-east-1.
+	Region string `json:"region,omitempty"`
+	// Prefix is prepended to the object names, which are <prefix>/<namespace>/<build>/<pod>.log.
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecret references the secret holding the accessKeyID and
+	// secretAccessKey used to authenticate with the object store.
+	CredentialsSecret corev1.SecretReference `json:"credentialsSecret"`
+}
+
+// s3Sink uploads build logs with AWS signature version 4 signed PUT requests.
+type s3Sink struct {
+	endpoint *url.URL
+	config   S3Config
+	secrets  corev1lister.SecretLister
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newS3Sink(config S3Config, secrets corev1lister.SecretLister) (*s3Sink, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || len(endpoint.Host) == 0 || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid log archive S3 endpoint %q", config.Endpoint)
+	}
+	if len(config.Bucket) == 0 {
+		return nil, fmt.Errorf("log archive S3 bucket must be set")
+	}
+	if len(config.CredentialsSecret.Namespace) == 0 || len(config.CredentialsSecret.Name) == 0 {
+		return nil, fmt.Errorf("log archive S3 credentials secret must be set")
+	}
+	if len(config.Region) == 0 {
+		config.Region = defaultS3Region
+	}
+	return &s3Sink{
+		endpoint: endpoint,
+		config:   config,
+		secrets:  secrets,
+		client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *s3Sink) Archive(ctx context.Context, build *buildv1.Build, entries []Entry) (string, error) {
+	// The credentials are read for every upload so rotated keys are picked up.
+	ref := s.config.CredentialsSecret
+	secret, err := s.secrets.Secrets(ref.Namespace).Get(ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("unable to read log archive credentials %s/%s: %v", ref.Namespace, ref.Name, err)
+	}
+	accessKeyID := strings.TrimSpace(string(secret.Data[S3AccessKeyIDKey]))
+	secretAccessKey := strings.TrimSpace(string(secret.Data[S3SecretAccessKeyKey]))
+	if len(accessKeyID) == 0 || len(secretAccessKey) == 0 {
+		return "", fmt.Errorf("log archive credentials %s/%s must contain %s and %s", ref.Namespace, ref.Name, S3AccessKeyIDKey, S3SecretAccessKeyKey)
+	}
+
+	prefix := path.Join(s.config.Prefix, archiveName(build))
+	for _, entry := range entries {
+		if err := s.put(ctx, path.Join(prefix, entryName(entry)), entry.Logs, accessKeyID, secretAccessKey); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("s3://%s/%s/", s.config.Bucket, prefix), nil
+}
+
+// put uploads a single object to the bucket.
+func (s *s3Sink) put(ctx context.Context, key string, data []byte, accessKeyID, secretAccessKey string) error {
+	u := *s.endpoint
+	u.Path = path.Join("/", s.endpoint.Path, s.config.Bucket, key)
+	// Send the path exactly as it is encoded in the signed canonical request.
+	u.RawPath = uriEncodePath(u.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	s.sign(req, data, accessKeyID, secretAccessKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uploading %s to bucket %s failed: %s: %s", key, s.config.Bucket, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the AWS signature version 4 authorization headers to the request.
+func (s *s3Sink) sign(req *http.Request, payload []byte, accessKeyID, secretAccessKey string) {
+	now := s.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	day := now.Format(amzDayFormat)
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncodePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{day, s.config.Region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{signatureScheme, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(secretAccessKey, day, s.config.Region, s3Service), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signatureScheme, accessKeyID, scope, signedHeaders, signature))
+}
+
+// signingKey derives the signature version 4 signing key for the given day, region and service.
+func signingKey(secretAccessKey, day, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// uriEncodePath encodes every byte of the path except the unreserved characters and
+// the path separators, as required for the canonical request.
+func uriEncodePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
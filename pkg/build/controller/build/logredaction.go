@@ -0,0 +1,231 @@
+package build
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
+)
+
+const (
+	// redactedText replaces secret values and pattern matches in log snippets.
+	redactedText = "[REDACTED]"
+
+	// minRedactedValueLength is the length below which secret values are not redacted,
+	// as short values such as "true" or "1" would mangle unrelated log output.
+	minRedactedValueLength = 4
+)
+
+// LogRedactionConfig controls the redaction of build log snippets.
+type LogRedactionConfig struct {
+	// Patterns is a list of regular expressions whose matches are replaced in the
+	// log snippet of failed builds, in addition to the values of the secrets used
+	// by the build.
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// CompileLogRedactionPatterns compiles the configured redaction patterns.
+func CompileLogRedactionPatterns(config LogRedactionConfig) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(config.Patterns))
+	for _, p := range config.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log redaction pattern %q: %v", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// logRedactor removes secret values and configured patterns from log output.
+type logRedactor struct {
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// redact returns msg with all known secret values and pattern matches replaced.
+func (r *logRedactor) redact(msg string) string {
+	for _, value := range r.values {
+		msg = strings.ReplaceAll(msg, value, redactedText)
+	}
+	for _, re := range r.patterns {
+		msg = re.ReplaceAllString(msg, redactedText)
+	}
+	return msg
+}
+
+// logSnippetRedactor returns a function that redacts the log snippet of the given build.
+// The secrets used by the build are only looked up when the function is invoked.
+func (bc *BuildController) logSnippetRedactor(build *buildv1.Build, pod *corev1.Pod) func(string) string {
+	return func(msg string) string {
+		r := &logRedactor{
+			values:   bc.buildSecretValues(build, pod),
+			patterns: bc.logRedactionPatterns,
+		}
+		return r.redact(msg)
+	}
+}
+
+// buildSecretValues returns the values of all secrets mounted into the build pod or
+// referenced by the build, longest first so overlapping values are fully replaced.
+func (bc *BuildController) buildSecretValues(build *buildv1.Build, pod *corev1.Pod) []string {
+	names := buildSecretNames(build)
+	if pod != nil {
+		names = names.Union(podSecretNames(pod))
+		// The build stored in the pod carries the push and pull secrets resolved from
+		// the service account when the pod was created.
+		if podBuild, err := common.GetBuildFromPod(pod); err == nil {
+			names = names.Union(buildSecretNames(podBuild))
+		}
+	}
+
+	values := sets.New[string]()
+	for _, name := range sets.List(names) {
+		secret, err := bc.secretStore.Secrets(build.Namespace).Get(name)
+		if err != nil {
+			klog.V(4).Infof("Unable to read secret %s/%s to redact the log snippet of build %s: %v", build.Namespace, name, buildDesc(build), err)
+			continue
+		}
+		for _, value := range secretValues(secret) {
+			if len(value) >= minRedactedValueLength {
+				values.Insert(value)
+			}
+		}
+	}
+
+	result := values.UnsortedList()
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i]) != len(result[j]) {
+			return len(result[i]) > len(result[j])
+		}
+		return result[i] < result[j]
+	})
+	return result
+}
+
+// secretValues returns the data values of a secret. For docker config secrets the
+// embedded credentials are returned as well, since the full config is unlikely to
+// appear in a log.
+func secretValues(secret *corev1.Secret) []string {
+	var values []string
+	for key, data := range secret.Data {
+		value := strings.TrimSpace(string(data))
+		values = append(values, value)
+		// Multi-line values such as keys and certificates are matched line by line.
+		if strings.Contains(value, "\n") {
+			for _, line := range strings.Split(value, "\n") {
+				values = append(values, strings.TrimSpace(line))
+			}
+		}
+
+		var auths credentialprovider.DockerConfig
+		switch key {
+		case corev1.DockerConfigJsonKey:
+			config := credentialprovider.DockerConfigJSON{}
+			if err := json.Unmarshal(data, &config); err != nil {
+				continue
+			}
+			auths = config.Auths
+		case corev1.DockerConfigKey:
+			if err := json.Unmarshal(data, &auths); err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		for _, entry := range auths {
+			values = append(values, entry.Password)
+			if len(entry.Username) > 0 || len(entry.Password) > 0 {
+				values = append(values, base64.StdEncoding.EncodeToString([]byte(entry.Username+":"+entry.Password)))
+			}
+		}
+	}
+	return values
+}
+
+// buildSecretNames returns the names of all secrets referenced by the build.
+func buildSecretNames(build *buildv1.Build) sets.Set[string] {
+	names := sets.New[string]()
+	addRef := func(ref *corev1.LocalObjectReference) {
+		if ref != nil && len(ref.Name) > 0 {
+			names.Insert(ref.Name)
+		}
+	}
+	addEnv := func(env []corev1.EnvVar) {
+		for _, e := range env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				names.Insert(e.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+	addVolumes := func(volumes []buildv1.BuildVolume) {
+		for _, v := range volumes {
+			if v.Source.Secret != nil {
+				names.Insert(v.Source.Secret.SecretName)
+			}
+		}
+	}
+
+	addRef(build.Spec.Source.SourceSecret)
+	addRef(build.Spec.Output.PushSecret)
+	for _, image := range build.Spec.Source.Images {
+		addRef(image.PullSecret)
+	}
+	for _, s := range build.Spec.Source.Secrets {
+		names.Insert(s.Secret.Name)
+	}
+	switch s := build.Spec.Strategy; {
+	case s.DockerStrategy != nil:
+		addRef(s.DockerStrategy.PullSecret)
+		addEnv(s.DockerStrategy.Env)
+		addEnv(s.DockerStrategy.BuildArgs)
+		addVolumes(s.DockerStrategy.Volumes)
+	case s.SourceStrategy != nil:
+		addRef(s.SourceStrategy.PullSecret)
+		addEnv(s.SourceStrategy.Env)
+		addVolumes(s.SourceStrategy.Volumes)
+	case s.CustomStrategy != nil:
+		addRef(s.CustomStrategy.PullSecret)
+		addEnv(s.CustomStrategy.Env)
+		for _, secret := range s.CustomStrategy.Secrets {
+			names.Insert(secret.SecretSource.Name)
+		}
+	}
+	names.Delete("")
+	return names
+}
+
+// podSecretNames returns the names of all secrets mounted into or consumed by the pod.
+func podSecretNames(pod *corev1.Pod) sets.Set[string] {
+	names := sets.New[string]()
+	for _, v := range pod.Spec.Volumes {
+		if v.Secret != nil {
+			names.Insert(v.Secret.SecretName)
+		}
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.Env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				names.Insert(e.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+		for _, from := range c.EnvFrom {
+			if from.SecretRef != nil {
+				names.Insert(from.SecretRef.Name)
+			}
+		}
+	}
+	names.Delete("")
+	return names
+}
@@ -0,0 +1,103 @@
+package build
+
+import (
+	"encoding/base64"
+	"regexp"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestCompileLogRedactionPatterns(t *testing.T) {
+	patterns, err := CompileLogRedactionPatterns(LogRedactionConfig{Patterns: []string{`ghp_[A-Za-z0-9]+`}})
+	if err != nil || len(patterns) != 1 {
+		t.Fatalf("unexpected result %v, %v", patterns, err)
+	}
+	if _, err := CompileLogRedactionPatterns(LogRedactionConfig{Patterns: []string{`(`}}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestSecretValues(t *testing.T) {
+	secret := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"quay.io":{"username":"robot","password":"hunter2hunter2"}}}`),
+		},
+	}
+	values := secretValues(secret)
+	expected := map[string]bool{
+		"hunter2hunter2": false,
+		base64.StdEncoding.EncodeToString([]byte("robot:hunter2hunter2")): false,
+	}
+	for _, v := range values {
+		if _, ok := expected[v]; ok {
+			expected[v] = true
+		}
+	}
+	for v, found := range expected {
+		if !found {
+			t.Errorf("expected %q in secret values %v", v, values)
+		}
+	}
+}
+
+func TestBuildSecretNames(t *testing.T) {
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseFailed, buildv1.BuildOutput{
+		PushSecret: &corev1.LocalObjectReference{Name: "push"},
+	}))
+	build.Spec.Source.SourceSecret = &corev1.LocalObjectReference{Name: "source"}
+	build.Spec.Source.Secrets = []buildv1.SecretBuildSource{{Secret: corev1.LocalObjectReference{Name: "input"}}}
+	build.Spec.Strategy.DockerStrategy.PullSecret = &corev1.LocalObjectReference{Name: "pull"}
+	build.Spec.Strategy.DockerStrategy.Env = []corev1.EnvVar{
+		{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "env"}, Key: "token",
+		}}},
+	}
+	names := buildSecretNames(build)
+	for _, name := range []string{"push", "source", "input", "pull", "env"} {
+		if !names.Has(name) {
+			t.Errorf("expected secret %q in %v", name, names)
+		}
+	}
+}
+
+func TestRedactLogSnippet(t *testing.T) {
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "namespace"},
+		Data: map[string][]byte{
+			"token": []byte("s3cr3t-t0k3n"),
+			"short": []byte("no"),
+		},
+	}
+	bc := newFakeBuildController(nil, nil, fakeKubeExternalClientSet(registryCAConfigMap, tokenSecret), nil, nil)
+	defer bc.stop()
+	bc.logRedactionPatterns = []*regexp.Regexp{regexp.MustCompile(`ghp_[A-Za-z0-9]+`)}
+
+	build := dockerStrategy(mockBuild(buildv1.BuildPhaseRunning, buildv1.BuildOutput{}))
+	build.Spec.Source.SourceSecret = &corev1.LocalObjectReference{Name: "token"}
+	pod := mockBuildPod(build)
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					Message: "cloning with s3cr3t-t0k3n\nusing ghp_abcDEF123\nno luck",
+				},
+			},
+		},
+	}
+
+	update := transitionToPhase(buildv1.BuildPhaseFailed, buildv1.StatusReasonGenericBuildFailed, "")
+	setBuildCompletionData(build, pod, update, bc.logSnippetRedactor(build, pod))
+	if update.logSnippet == nil {
+		t.Fatalf("expected a log snippet to be set")
+	}
+	expected := "cloning with [REDACTED]\nusing [REDACTED]\nno luck"
+	if *update.logSnippet != expected {
+		t.Errorf("expected log snippet %q, got %q", expected, *update.logSnippet)
+	}
+}
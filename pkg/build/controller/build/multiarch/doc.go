@@ -0,0 +1,28 @@
+/*
+Package multiarch supports builds that produce an image for several CPU
+architectures.
+
+A build requests the architectures to build for with the
+build.openshift.io/architectures annotation:
+
+	metadata:
+	  annotations:
+	    build.openshift.io/architectures: amd64,arm64
+
+The build controller then creates one build pod per architecture, pinned to
+nodes of that architecture through the kubernetes.io/arch node selector. Each
+pod pushes the output image tagged with its architecture, e.g. app:latest-arm64.
+The phase of each architecture is recorded in the
+build.openshift.io/architecture-status annotation of the build. Once all
+architectures have been built, the controller creates a final manifest list
+pod from the build pod of the first architecture. It runs buildah in the
+builder image with the push secret, registries.conf and certificate
+authorities of the build, and pushes a manifest list referencing the image of
+every architecture to the output image. The build completes once the manifest
+list is pushed, and fails as soon as one architecture or the manifest list pod
+fails.
+
+Multi-architecture builds require an output image and are not supported by the
+custom build strategy.
+*/
+package multiarch
@@ -0,0 +1,83 @@
+package multiarch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	corev1 "k8s.io/api/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/library-go/pkg/build/naming"
+)
+
+const (
+	// ManifestListContainer is the name of the container of the manifest list pod.
+	ManifestListContainer = "manifest-list"
+
+	// ManifestListLabel is set on the manifest list pod of a build.
+	ManifestListLabel = "build.openshift.io/manifest-list"
+
+	// ArchitectureImagesEnv lists the images built for each architecture, separated by
+	// spaces, in the environment of the manifest list pod.
+	ArchitectureImagesEnv = "ARCHITECTURE_IMAGES"
+	// ManifestListImageEnv is the image the manifest list is pushed to, in the environment
+	// of the manifest list pod.
+	ManifestListImageEnv = "MANIFEST_LIST_IMAGE"
+	// CertsDirEnv is the directory of the per registry certificate authorities mounted
+	// into the manifest list pod.
+	CertsDirEnv = "BUILD_CERTS_DIR"
+	// GlobalCADirEnv is the directory of the cluster-wide trust bundle mounted into the
+	// manifest list pod.
+	GlobalCADirEnv = "BUILD_GLOBAL_CA_DIR"
+)
+
+// ManifestListScript assembles the images of every architecture into a manifest list with
+// buildah and pushes it, trusting the registries and certificate authorities of the build
+// and authenticating with its push secret. The digest of the manifest list is written to
+// the termination message of the container.
+const ManifestListScript = `set -eu
+if [ -d "${BUILD_CERTS_DIR}/certs.d" ]; then
+  mkdir -p /etc/containers/certs.d
+  cp -rL "${BUILD_CERTS_DIR}/certs.d/." /etc/containers/certs.d/
+fi
+if [ -f "${BUILD_GLOBAL_CA_DIR}/tls-ca-bundle.pem" ]; then
+  export SSL_CERT_FILE="${BUILD_GLOBAL_CA_DIR}/tls-ca-bundle.pem"
+fi
+if [ -f "${BUILD_REGISTRIES_CONF_PATH:-}" ]; then
+  export CONTAINERS_REGISTRIES_CONF="${BUILD_REGISTRIES_CONF_PATH}"
+fi
+authfile=/tmp/auth.json
+echo '{"auths":{}}' > "${authfile}"
+if [ -f "${PUSH_DOCKERCFG_PATH:-}/.dockerconfigjson" ]; then
+  cp "${PUSH_DOCKERCFG_PATH}/.dockerconfigjson" "${authfile}"
+elif [ -f "${PUSH_DOCKERCFG_PATH:-}/.dockercfg" ]; then
+  printf '{"auths":%s}' "$(cat "${PUSH_DOCKERCFG_PATH}/.dockercfg")" > "${authfile}"
+fi
+buildah manifest create manifest-list
+for image in ${ARCHITECTURE_IMAGES}; do
+  buildah manifest add --authfile "${authfile}" manifest-list "docker://${image}"
+done
+buildah manifest push --authfile "${authfile}" --digestfile /dev/termination-log manifest-list "docker://${MANIFEST_LIST_IMAGE}"
+`
+
+// ManifestListPodName returns the name of the pod assembling the manifest list of the build.
+func ManifestListPodName(build *buildv1.Build) string {
+	return naming.GetPodName(build.Name, "manifest-list")
+}
+
+// ManifestListDigest returns the digest of the manifest list pushed by the succeeded
+// manifest list pod, from the termination message of its container.
+func ManifestListDigest(pod *corev1.Pod) (string, error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != ManifestListContainer || status.State.Terminated == nil {
+			continue
+		}
+		d, err := digest.Parse(strings.TrimSpace(status.State.Terminated.Message))
+		if err != nil {
+			return "", fmt.Errorf("invalid manifest list digest reported by pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		return d.String(), nil
+	}
+	return "", fmt.Errorf("pod %s/%s did not report the manifest list digest", pod.Namespace, pod.Name)
+}
@@ -0,0 +1,121 @@
+package multiarch
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/library-go/pkg/build/naming"
+	"github.com/openshift/library-go/pkg/image/reference"
+)
+
+const (
+	// ArchitecturesAnnotation requests a multi-architecture build. Its value is a comma
+	// separated list of CPU architectures, e.g. "amd64,arm64".
+	ArchitecturesAnnotation = "build.openshift.io/architectures"
+
+	// ArchitectureStatusAnnotation holds the JSON encoded status of the build of each
+	// requested architecture.
+	ArchitectureStatusAnnotation = "build.openshift.io/architecture-status"
+
+	// ArchitectureLabel is set on the build pod of each architecture.
+	ArchitectureLabel = "build.openshift.io/architecture"
+
+	// StatusReasonInvalidArchitectures is the reason of builds whose requested
+	// architectures cannot be built.
+	StatusReasonInvalidArchitectures buildv1.StatusReason = "InvalidArchitectures"
+
+	// StatusReasonManifestListPushFailed is the reason of builds whose manifest list
+	// could not be pushed after all architectures have been built.
+	StatusReasonManifestListPushFailed buildv1.StatusReason = "ManifestListPushFailed"
+)
+
+var architectureRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ArchitectureStatus is the status of the build of a single architecture.
+type ArchitectureStatus struct {
+	// Phase is the phase of the build of this architecture.
+	Phase buildv1.BuildPhase `json:"phase"`
+	// PodName is the name of the build pod of this architecture.
+	PodName string `json:"podName"`
+	// Message describes why the build of this architecture failed.
+	Message string `json:"message,omitempty"`
+}
+
+// Architectures returns the architectures requested for the build, in the order they
+// were requested, or nil if the build is not a multi-architecture build.
+func Architectures(build *buildv1.Build) ([]string, error) {
+	value, ok := build.Annotations[ArchitecturesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var architectures []string
+	seen := map[string]bool{}
+	for _, arch := range strings.Split(value, ",") {
+		arch = strings.TrimSpace(arch)
+		if len(arch) == 0 || seen[arch] {
+			continue
+		}
+		if !architectureRegexp.MatchString(arch) {
+			return nil, fmt.Errorf("invalid architecture %q in annotation %s", arch, ArchitecturesAnnotation)
+		}
+		seen[arch] = true
+		architectures = append(architectures, arch)
+	}
+	if len(architectures) == 0 {
+		return nil, fmt.Errorf("annotation %s does not list any architecture", ArchitecturesAnnotation)
+	}
+	return architectures, nil
+}
+
+// IsMultiArch returns true if the build requests a multi-architecture build.
+func IsMultiArch(build *buildv1.Build) bool {
+	_, ok := build.Annotations[ArchitecturesAnnotation]
+	return ok
+}
+
+// PodName returns the name of the build pod of the given architecture.
+func PodName(build *buildv1.Build, arch string) string {
+	return naming.GetPodName(build.Name, "build-"+arch)
+}
+
+// ArchitectureImage returns the image the build of the given architecture pushes to,
+// which is the output image with the architecture appended to its tag.
+func ArchitectureImage(output, arch string) (string, error) {
+	ref, err := reference.Parse(output)
+	if err != nil {
+		return "", err
+	}
+	if len(ref.ID) > 0 {
+		return "", fmt.Errorf("output image %s of a multi-architecture build must not be a digest reference", output)
+	}
+	if len(ref.Tag) == 0 {
+		ref.Tag = "latest"
+	}
+	ref.Tag = ref.Tag + "-" + arch
+	return ref.Exact(), nil
+}
+
+// ParseStatus returns the per architecture status recorded on the build.
+func ParseStatus(build *buildv1.Build) (map[string]ArchitectureStatus, error) {
+	status := map[string]ArchitectureStatus{}
+	value, ok := build.Annotations[ArchitectureStatusAnnotation]
+	if !ok {
+		return status, nil
+	}
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", ArchitectureStatusAnnotation, err)
+	}
+	return status, nil
+}
+
+// FormatStatus encodes the per architecture status for the status annotation.
+func FormatStatus(status map[string]ArchitectureStatus) (string, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
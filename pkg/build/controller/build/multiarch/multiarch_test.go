@@ -0,0 +1,109 @@
+package multiarch
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestArchitectures(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation *string
+		expected   []string
+		expectErr  bool
+	}{
+		{name: "not requested"},
+		{name: "single", annotation: strPtr("arm64"), expected: []string{"arm64"}},
+		{name: "list", annotation: strPtr(" amd64, arm64,amd64 "), expected: []string{"amd64", "arm64"}},
+		{name: "empty", annotation: strPtr(" , "), expectErr: true},
+		{name: "invalid", annotation: strPtr("amd64,ARM/64"), expectErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			build := &buildv1.Build{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tc.annotation != nil {
+				build.Annotations[ArchitecturesAnnotation] = *tc.annotation
+			}
+			architectures, err := Architectures(build)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(architectures, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, architectures)
+			}
+			if IsMultiArch(build) != (tc.annotation != nil) {
+				t.Errorf("unexpected IsMultiArch result")
+			}
+		})
+	}
+}
+
+func TestArchitectureImage(t *testing.T) {
+	tests := []struct {
+		output    string
+		expected  string
+		expectErr bool
+	}{
+		{output: "image-registry:5000/ns/app:v1", expected: "image-registry:5000/ns/app:v1-arm64"},
+		{output: "quay.io/ns/app", expected: "quay.io/ns/app:latest-arm64"},
+		{output: "quay.io/ns/app@sha256:1111111111111111111111111111111111111111111111111111111111111111", expectErr: true},
+	}
+	for _, tc := range tests {
+		image, err := ArchitectureImage(tc.output, "arm64")
+		if tc.expectErr != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tc.output, tc.expectErr, err)
+			continue
+		}
+		if image != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.output, tc.expected, image)
+		}
+	}
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	status := map[string]ArchitectureStatus{
+		"amd64": {Phase: buildv1.BuildPhaseComplete, PodName: "app-1-build-amd64"},
+		"arm64": {Phase: buildv1.BuildPhaseFailed, PodName: "app-1-build-arm64", Message: "failed"},
+	}
+	value, err := FormatStatus(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := &buildv1.Build{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{ArchitectureStatusAnnotation: value}}}
+	parsed, err := ParseStatus(build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, status) {
+		t.Errorf("expected %v, got %v", status, parsed)
+	}
+}
+
+func TestManifestListDigest(t *testing.T) {
+	pod := func(message string) *corev1.Pod {
+		return &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  ManifestListContainer,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+		}}}}
+	}
+	const listDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	if d, err := ManifestListDigest(pod(listDigest + "\n")); err != nil || d != listDigest {
+		t.Errorf("expected digest %s, got %s, %v", listDigest, d, err)
+	}
+	if _, err := ManifestListDigest(pod("Error: unauthorized")); err == nil {
+		t.Errorf("expected an error for an invalid digest")
+	}
+	if _, err := ManifestListDigest(&corev1.Pod{}); err == nil {
+		t.Errorf("expected an error for a pod without a terminated container")
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -6,6 +6,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
 )
 
 // buildPodCreationStrategy is used by the build controller to
@@ -18,6 +19,9 @@ type typeBasedFactoryStrategy struct {
 	dockerBuildStrategy buildPodCreationStrategy
 	sourceBuildStrategy buildPodCreationStrategy
 	customBuildStrategy buildPodCreationStrategy
+	// buildpacksBuildStrategy creates the pods of Source strategy builds which are
+	// annotated for the Cloud Native Buildpacks mode.
+	buildpacksBuildStrategy buildPodCreationStrategy
 }
 
 func (f *typeBasedFactoryStrategy) CreateBuildPod(build *buildv1.Build, additionalCAs map[string]string, internalRegistryHost string) (*corev1.Pod, error) {
@@ -26,6 +30,8 @@ func (f *typeBasedFactoryStrategy) CreateBuildPod(build *buildv1.Build, addition
 	switch {
 	case build.Spec.Strategy.DockerStrategy != nil:
 		pod, err = f.dockerBuildStrategy.CreateBuildPod(build, additionalCAs, internalRegistryHost)
+	case strategy.IsBuildpacksBuild(build):
+		pod, err = f.buildpacksBuildStrategy.CreateBuildPod(build, additionalCAs, internalRegistryHost)
 	case build.Spec.Strategy.SourceStrategy != nil:
 		pod, err = f.sourceBuildStrategy.CreateBuildPod(build, additionalCAs, internalRegistryHost)
 	case build.Spec.Strategy.CustomStrategy != nil:
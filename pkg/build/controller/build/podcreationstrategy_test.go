@@ -22,6 +22,7 @@ func TestStrategyCreateBuildPod(t *testing.T) {
 	dockerBuildPod := &v1.Pod{}
 	sourceBuildPod := &v1.Pod{}
 	customBuildPod := &v1.Pod{}
+	buildpacksBuildPod := &v1.Pod{}
 
 	dockerBuild := &buildv1.Build{}
 	dockerBuild.Spec.Strategy.DockerStrategy = &buildv1.DockerBuildStrategy{}
@@ -29,6 +30,10 @@ func TestStrategyCreateBuildPod(t *testing.T) {
 	sourceBuild := &buildv1.Build{}
 	sourceBuild.Spec.Strategy.SourceStrategy = &buildv1.SourceBuildStrategy{}
 
+	buildpacksBuild := &buildv1.Build{}
+	buildpacksBuild.Annotations = map[string]string{"build.openshift.io/source-mode": "buildpacks"}
+	buildpacksBuild.Spec.Strategy.SourceStrategy = &buildv1.SourceBuildStrategy{}
+
 	customBuild := &buildv1.Build{}
 	customBuild.Spec.Strategy.CustomStrategy = &buildv1.CustomBuildStrategy{}
 
@@ -36,15 +41,17 @@ func TestStrategyCreateBuildPod(t *testing.T) {
 	pipelineBuild.Spec.Strategy.JenkinsPipelineStrategy = &buildv1.JenkinsPipelineBuildStrategy{}
 
 	strategy := &typeBasedFactoryStrategy{
-		dockerBuildStrategy: &testPodCreationStrategy{pod: dockerBuildPod},
-		sourceBuildStrategy: &testPodCreationStrategy{pod: sourceBuildPod},
-		customBuildStrategy: &testPodCreationStrategy{pod: customBuildPod},
+		dockerBuildStrategy:     &testPodCreationStrategy{pod: dockerBuildPod},
+		sourceBuildStrategy:     &testPodCreationStrategy{pod: sourceBuildPod},
+		customBuildStrategy:     &testPodCreationStrategy{pod: customBuildPod},
+		buildpacksBuildStrategy: &testPodCreationStrategy{pod: buildpacksBuildPod},
 	}
 	strategyErr := fmt.Errorf("error")
 	errorStrategy := &typeBasedFactoryStrategy{
-		dockerBuildStrategy: &testPodCreationStrategy{err: strategyErr},
-		sourceBuildStrategy: &testPodCreationStrategy{err: strategyErr},
-		customBuildStrategy: &testPodCreationStrategy{err: strategyErr},
+		dockerBuildStrategy:     &testPodCreationStrategy{err: strategyErr},
+		sourceBuildStrategy:     &testPodCreationStrategy{err: strategyErr},
+		customBuildStrategy:     &testPodCreationStrategy{err: strategyErr},
+		buildpacksBuildStrategy: &testPodCreationStrategy{err: strategyErr},
 	}
 
 	const internalRegistryHost = "registry.svc.localhost:5000"
@@ -65,6 +72,11 @@ func TestStrategyCreateBuildPod(t *testing.T) {
 			build:       sourceBuild,
 			expectedPod: sourceBuildPod,
 		},
+		{
+			strategy:    strategy,
+			build:       buildpacksBuild,
+			expectedPod: buildpacksBuildPod,
+		},
 		{
 			strategy:    strategy,
 			build:       customBuild,
@@ -90,6 +102,11 @@ func TestStrategyCreateBuildPod(t *testing.T) {
 			build:       sourceBuild,
 			expectError: true,
 		},
+		{
+			strategy:    errorStrategy,
+			build:       buildpacksBuild,
+			expectError: true,
+		},
 		{
 			strategy:    errorStrategy,
 			build:       customBuild,
@@ -0,0 +1,23 @@
+/*
+Package provenance generates in-toto statements carrying SLSA provenance for
+completed image builds.
+
+The statement records the source repository and commit, the builder and input
+images, the build arguments, the trigger causes and the build timestamps, with
+the pushed output image as its subject. When a signing key is configured the
+statement is additionally wrapped in a signed DSSE envelope.
+
+# Configuration
+
+Configuration is done via the build section of the controller manager's
+extended configuration:
+
+	extendedConfig:
+	  build:
+	    provenance:
+	      enabled: true
+	      signingKeySecret:
+	        namespace: openshift-controller-manager
+	        name: build-provenance-signing-key
+*/
+package provenance
@@ -0,0 +1,314 @@
+package provenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	sharedbuildutil "github.com/openshift/library-go/pkg/build/buildutil"
+	"github.com/openshift/library-go/pkg/image/reference"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
+)
+
+const (
+	// StatementType is the in-toto statement type of generated documents.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType is the SLSA provenance predicate type of generated documents.
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// BuildTypePrefix prefixes the strategy name to form the SLSA build type.
+	BuildTypePrefix = "https://openshift.io/build/v1/"
+	// BuilderID identifies the build controller as the SLSA builder.
+	BuilderID = "https://openshift.io/openshift-controller-manager/build-controller"
+)
+
+// Config controls the generation of provenance for completed builds.
+type Config struct {
+	// Enabled turns on provenance generation for builds that complete successfully.
+	Enabled bool `json:"enabled"`
+	// SigningKeySecret optionally references a secret that holds a PEM encoded
+	// private key under the SigningKeySecretKey entry. When set, the provenance
+	// statement is also stored as a signed DSSE envelope.
+	SigningKeySecret *corev1.SecretReference `json:"signingKeySecret,omitempty"`
+}
+
+// Statement is an in-toto statement with a SLSA provenance predicate.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Subject identifies an artifact produced by the build.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate is the SLSA provenance v1 predicate.
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of the build.
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   ExternalParameters   `json:"externalParameters"`
+	InternalParameters   InternalParameters   `json:"internalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// ExternalParameters are the parameters of the build under the control of the user.
+type ExternalParameters struct {
+	Source    *SourceParameters `json:"source,omitempty"`
+	Strategy  string            `json:"strategy"`
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+	Output    string            `json:"output,omitempty"`
+}
+
+// SourceParameters describes the requested build source.
+type SourceParameters struct {
+	URI        string `json:"uri,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	ContextDir string `json:"contextDir,omitempty"`
+}
+
+// InternalParameters are the parameters of the build set by the platform.
+type InternalParameters struct {
+	Namespace   string         `json:"namespace"`
+	BuildConfig string         `json:"buildConfig,omitempty"`
+	TriggeredBy []TriggerCause `json:"triggeredBy,omitempty"`
+}
+
+// TriggerCause describes why a build was started.
+type TriggerCause struct {
+	Message  string `json:"message,omitempty"`
+	ImageID  string `json:"imageID,omitempty"`
+	FromKind string `json:"fromKind,omitempty"`
+	FromName string `json:"fromName,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// ResourceDescriptor identifies an artifact consumed by the build.
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// RunDetails describes the execution of the build.
+type RunDetails struct {
+	Builder  Builder  `json:"builder"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// Builder identifies the entity that executed the build.
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// Metadata holds the timing of the build.
+type Metadata struct {
+	InvocationID string     `json:"invocationID"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// ShouldGenerate returns true if a provenance statement can be produced for
+// the build, which is the case for completed builds that pushed an image.
+func ShouldGenerate(build *buildv1.Build) bool {
+	return build.Status.Phase == buildv1.BuildPhaseComplete &&
+		build.Status.Output.To != nil &&
+		len(build.Status.Output.To.ImageDigest) > 0 &&
+		len(build.Status.OutputDockerImageReference) > 0
+}
+
+// Generate creates the provenance statement for a completed build. The build pod
+// is optional; when present the image references resolved by the build
+// controller at pod creation time are read from it.
+func Generate(build *buildv1.Build, pod *corev1.Pod) (*Statement, error) {
+	if !ShouldGenerate(build) {
+		return nil, fmt.Errorf("build %s/%s did not push an image", build.Namespace, build.Name)
+	}
+
+	// The build stored in the pod carries the image references as they were
+	// resolved when the pod was created, rather than the image stream tags.
+	resolved := build
+	var builderImage string
+	if pod != nil {
+		if podBuild, err := common.GetBuildFromPod(pod); err == nil {
+			resolved = podBuild
+		} else {
+			klog.V(4).Infof("Unable to read resolved build from pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		if len(pod.Spec.Containers) > 0 {
+			builderImage = pod.Spec.Containers[0].Image
+		}
+	}
+
+	subjectName := build.Status.OutputDockerImageReference
+	if ref, err := reference.Parse(subjectName); err == nil {
+		ref.Tag = ""
+		ref.ID = ""
+		subjectName = ref.Exact()
+	}
+
+	statement := &Statement{
+		Type: StatementType,
+		Subject: []Subject{
+			{Name: subjectName, Digest: digestMap(build.Status.Output.To.ImageDigest)},
+		},
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			BuildDefinition: BuildDefinition{
+				BuildType: BuildTypePrefix + strategyName(build),
+				ExternalParameters: ExternalParameters{
+					Source:    sourceParameters(build),
+					Strategy:  strategyName(build),
+					BuildArgs: buildArgs(build),
+					Output:    build.Status.OutputDockerImageReference,
+				},
+				InternalParameters: InternalParameters{
+					Namespace:   build.Namespace,
+					BuildConfig: sharedbuildutil.ConfigNameForBuild(build),
+					TriggeredBy: triggerCauses(build),
+				},
+				ResolvedDependencies: resolvedDependencies(build, resolved),
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{ID: BuilderID},
+				Metadata: Metadata{
+					InvocationID: string(build.UID),
+				},
+			},
+		},
+	}
+	if len(builderImage) > 0 {
+		statement.Predicate.RunDetails.Builder.Version = map[string]string{"image": builderImage}
+	}
+	if build.Status.StartTimestamp != nil {
+		t := build.Status.StartTimestamp.UTC()
+		statement.Predicate.RunDetails.Metadata.StartedOn = &t
+	}
+	if build.Status.CompletionTimestamp != nil {
+		t := build.Status.CompletionTimestamp.UTC()
+		statement.Predicate.RunDetails.Metadata.FinishedOn = &t
+	}
+	return statement, nil
+}
+
+func strategyName(build *buildv1.Build) string {
+	switch {
+	case build.Spec.Strategy.DockerStrategy != nil:
+		return string(buildv1.DockerBuildStrategyType)
+	case build.Spec.Strategy.SourceStrategy != nil:
+		return string(buildv1.SourceBuildStrategyType)
+	case build.Spec.Strategy.CustomStrategy != nil:
+		return string(buildv1.CustomBuildStrategyType)
+	case build.Spec.Strategy.JenkinsPipelineStrategy != nil:
+		return string(buildv1.JenkinsPipelineBuildStrategyType)
+	}
+	return string(build.Spec.Strategy.Type)
+}
+
+func sourceParameters(build *buildv1.Build) *SourceParameters {
+	source := build.Spec.Source
+	if source.Git == nil && len(source.ContextDir) == 0 {
+		return nil
+	}
+	params := &SourceParameters{ContextDir: source.ContextDir}
+	if source.Git != nil {
+		params.URI = source.Git.URI
+		params.Ref = source.Git.Ref
+	}
+	return params
+}
+
+func buildArgs(build *buildv1.Build) map[string]string {
+	if build.Spec.Strategy.DockerStrategy == nil || len(build.Spec.Strategy.DockerStrategy.BuildArgs) == 0 {
+		return nil
+	}
+	args := map[string]string{}
+	for _, arg := range build.Spec.Strategy.DockerStrategy.BuildArgs {
+		// Values sourced from secrets and config maps are not recorded.
+		args[arg.Name] = arg.Value
+	}
+	return args
+}
+
+func triggerCauses(build *buildv1.Build) []TriggerCause {
+	var causes []TriggerCause
+	for _, trigger := range build.Spec.TriggeredBy {
+		cause := TriggerCause{Message: trigger.Message}
+		switch {
+		case trigger.ImageChangeBuild != nil:
+			cause.ImageID = trigger.ImageChangeBuild.ImageID
+			if from := trigger.ImageChangeBuild.FromRef; from != nil {
+				cause.FromKind = from.Kind
+				cause.FromName = from.Name
+			}
+		case trigger.GitHubWebHook != nil && trigger.GitHubWebHook.Revision != nil && trigger.GitHubWebHook.Revision.Git != nil:
+			cause.Revision = trigger.GitHubWebHook.Revision.Git.Commit
+		case trigger.GitLabWebHook != nil && trigger.GitLabWebHook.Revision != nil && trigger.GitLabWebHook.Revision.Git != nil:
+			cause.Revision = trigger.GitLabWebHook.Revision.Git.Commit
+		case trigger.BitbucketWebHook != nil && trigger.BitbucketWebHook.Revision != nil && trigger.BitbucketWebHook.Revision.Git != nil:
+			cause.Revision = trigger.BitbucketWebHook.Revision.Git.Commit
+		case trigger.GenericWebHook != nil && trigger.GenericWebHook.Revision != nil && trigger.GenericWebHook.Revision.Git != nil:
+			cause.Revision = trigger.GenericWebHook.Revision.Git.Commit
+		}
+		causes = append(causes, cause)
+	}
+	return causes
+}
+
+// resolvedDependencies lists the source commit, the strategy image and the
+// input images of the build. Image digests are taken from the resolved build
+// where the reference was pinned by digest.
+func resolvedDependencies(build, resolved *buildv1.Build) []ResourceDescriptor {
+	var deps []ResourceDescriptor
+	if git := build.Spec.Source.Git; git != nil {
+		dep := ResourceDescriptor{Name: "source", URI: "git+" + git.URI}
+		if len(git.Ref) > 0 {
+			dep.URI += "@" + git.Ref
+		}
+		if build.Spec.Revision != nil && build.Spec.Revision.Git != nil && len(build.Spec.Revision.Git.Commit) > 0 {
+			dep.Digest = map[string]string{"gitCommit": build.Spec.Revision.Git.Commit}
+		}
+		deps = append(deps, dep)
+	}
+	if from := sharedbuildutil.GetInputReference(resolved.Spec.Strategy); from != nil && len(from.Name) > 0 {
+		deps = append(deps, imageDependency("builder", from))
+	}
+	for i := range resolved.Spec.Source.Images {
+		deps = append(deps, imageDependency("input", &resolved.Spec.Source.Images[i].From))
+	}
+	return deps
+}
+
+func imageDependency(name string, from *corev1.ObjectReference) ResourceDescriptor {
+	dep := ResourceDescriptor{Name: name, URI: from.Name}
+	if from.Kind != "DockerImage" {
+		dep.URI = strings.ToLower(from.Kind) + ":" + from.Name
+		return dep
+	}
+	dep.URI = "docker://" + from.Name
+	if ref, err := reference.Parse(from.Name); err == nil && len(ref.ID) > 0 {
+		dep.Digest = digestMap(ref.ID)
+	}
+	return dep
+}
+
+// digestMap converts an "algorithm:hex" digest into the in-toto digest set form.
+func digestMap(digest string) map[string]string {
+	algorithm, value, ok := strings.Cut(digest, ":")
+	if !ok {
+		return map[string]string{"sha256": digest}
+	}
+	return map[string]string{algorithm: value}
+}
@@ -0,0 +1,218 @@
+package provenance
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/common"
+)
+
+const (
+	baseDigest  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	inputDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func mockCompletedBuild() *buildv1.Build {
+	start := metav1.NewTime(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC))
+	return &buildv1.Build{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-1",
+			Namespace: "ns",
+			UID:       "uid-1",
+			Annotations: map[string]string{
+				buildv1.BuildConfigAnnotation: "app",
+			},
+		},
+		Spec: buildv1.BuildSpec{
+			CommonSpec: buildv1.CommonSpec{
+				Source: buildv1.BuildSource{
+					Git: &buildv1.GitBuildSource{URI: "https://github.com/openshift/ruby-hello-world", Ref: "main"},
+					Images: []buildv1.ImageSource{
+						{From: corev1.ObjectReference{Kind: "ImageStreamTag", Name: "input:latest"}},
+					},
+				},
+				Strategy: buildv1.BuildStrategy{
+					DockerStrategy: &buildv1.DockerBuildStrategy{
+						From:      &corev1.ObjectReference{Kind: "ImageStreamTag", Name: "base:latest"},
+						BuildArgs: []corev1.EnvVar{{Name: "VERSION", Value: "1.0"}},
+					},
+				},
+				Revision: &buildv1.SourceRevision{
+					Git: &buildv1.GitSourceRevision{Commit: "0123456789abcdef"},
+				},
+			},
+			TriggeredBy: []buildv1.BuildTriggerCause{
+				{
+					Message: "Image change",
+					ImageChangeBuild: &buildv1.ImageChangeCause{
+						ImageID: "registry/ns/base@sha256:aaa",
+						FromRef: &corev1.ObjectReference{Kind: "ImageStreamTag", Name: "base:latest"},
+					},
+				},
+			},
+		},
+		Status: buildv1.BuildStatus{
+			Phase:                      buildv1.BuildPhaseComplete,
+			StartTimestamp:             &start,
+			CompletionTimestamp:        &end,
+			OutputDockerImageReference: "image-registry:5000/ns/app:latest",
+			Output: buildv1.BuildStatusOutput{
+				To: &buildv1.BuildStatusOutputTo{ImageDigest: "sha256:bbb"},
+			},
+		},
+	}
+}
+
+func mockBuildPod(t *testing.T, build *buildv1.Build) *corev1.Pod {
+	resolved := build.DeepCopy()
+	resolved.Spec.Strategy.DockerStrategy.From = &corev1.ObjectReference{Kind: "DockerImage", Name: "image-registry:5000/ns/base@" + baseDigest}
+	resolved.Spec.Source.Images[0].From = corev1.ObjectReference{Kind: "DockerImage", Name: "image-registry:5000/ns/input@" + inputDigest}
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "docker-build", Image: "quay.io/openshift/origin-docker-builder@sha256:eee"}},
+		},
+	}
+	if err := common.SetBuildInPod(pod, resolved); err != nil {
+		t.Fatal(err)
+	}
+	return pod
+}
+
+func TestShouldGenerate(t *testing.T) {
+	build := mockCompletedBuild()
+	if !ShouldGenerate(build) {
+		t.Errorf("expected provenance for a completed build with an output digest")
+	}
+	build.Status.Phase = buildv1.BuildPhaseFailed
+	if ShouldGenerate(build) {
+		t.Errorf("expected no provenance for a failed build")
+	}
+	build = mockCompletedBuild()
+	build.Status.Output.To = nil
+	if ShouldGenerate(build) {
+		t.Errorf("expected no provenance for a build without an output digest")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	build := mockCompletedBuild()
+	statement, err := Generate(build, mockBuildPod(t, build))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedSubject := []Subject{{Name: "image-registry:5000/ns/app", Digest: map[string]string{"sha256": "bbb"}}}
+	if !reflect.DeepEqual(statement.Subject, expectedSubject) {
+		t.Errorf("expected subject %#v, got %#v", expectedSubject, statement.Subject)
+	}
+	definition := statement.Predicate.BuildDefinition
+	if definition.BuildType != BuildTypePrefix+"Docker" {
+		t.Errorf("unexpected build type %q", definition.BuildType)
+	}
+	if definition.ExternalParameters.BuildArgs["VERSION"] != "1.0" {
+		t.Errorf("expected build args to be recorded, got %v", definition.ExternalParameters.BuildArgs)
+	}
+	if definition.InternalParameters.BuildConfig != "app" {
+		t.Errorf("expected build config app, got %q", definition.InternalParameters.BuildConfig)
+	}
+	if len(definition.InternalParameters.TriggeredBy) != 1 || definition.InternalParameters.TriggeredBy[0].ImageID != "registry/ns/base@sha256:aaa" {
+		t.Errorf("unexpected trigger causes %#v", definition.InternalParameters.TriggeredBy)
+	}
+	expectedDeps := []ResourceDescriptor{
+		{Name: "source", URI: "git+https://github.com/openshift/ruby-hello-world@main", Digest: map[string]string{"gitCommit": "0123456789abcdef"}},
+		{Name: "builder", URI: "docker://image-registry:5000/ns/base@" + baseDigest, Digest: map[string]string{"sha256": baseDigest[7:]}},
+		{Name: "input", URI: "docker://image-registry:5000/ns/input@" + inputDigest, Digest: map[string]string{"sha256": inputDigest[7:]}},
+	}
+	if !reflect.DeepEqual(definition.ResolvedDependencies, expectedDeps) {
+		t.Errorf("expected dependencies %#v, got %#v", expectedDeps, definition.ResolvedDependencies)
+	}
+	run := statement.Predicate.RunDetails
+	if run.Builder.Version["image"] != "quay.io/openshift/origin-docker-builder@sha256:eee" {
+		t.Errorf("unexpected builder version %v", run.Builder.Version)
+	}
+	if run.Metadata.InvocationID != "uid-1" || run.Metadata.StartedOn == nil || run.Metadata.FinishedOn == nil {
+		t.Errorf("unexpected run metadata %#v", run.Metadata)
+	}
+}
+
+func TestGenerateWithoutPod(t *testing.T) {
+	build := mockCompletedBuild()
+	statement, err := Generate(build, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deps := statement.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 3 || deps[1].URI != "imagestreamtag:base:latest" || deps[1].Digest != nil {
+		t.Errorf("expected unresolved builder dependency, got %#v", deps)
+	}
+}
+
+func TestSign(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1"}`)
+	for name, der := range map[string][]byte{"ecdsa": ecDER, "ed25519": edDER} {
+		signer, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		envelope, err := Sign(payload, signer)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if envelope.PayloadType != PayloadType || envelope.Payload != base64.StdEncoding.EncodeToString(payload) {
+			t.Errorf("%s: unexpected envelope %#v", name, envelope)
+		}
+		sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := PreAuthEncoding(PayloadType, payload)
+		var valid bool
+		switch pub := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			digest := sha256.Sum256(message)
+			valid = ecdsa.VerifyASN1(pub, digest[:], sig)
+		case ed25519.PublicKey:
+			valid = ed25519.Verify(pub, message, sig)
+		}
+		if !valid {
+			t.Errorf("%s: signature did not verify", name)
+		}
+	}
+}
+
+func TestParsePrivateKeyInvalid(t *testing.T) {
+	if _, err := ParsePrivateKey([]byte("not a key")); err == nil {
+		t.Errorf("expected an error for non-PEM data")
+	}
+}
@@ -0,0 +1,102 @@
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+const (
+	// SigningKeySecretKey is the secret entry holding the PEM encoded signing key.
+	SigningKeySecretKey = "signing.key"
+	// PayloadType is the DSSE payload type of signed statements.
+	PayloadType = "application/vnd.in-toto+json"
+)
+
+// Envelope is a DSSE envelope wrapping a signed statement.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a single signature of a DSSE envelope.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// ParsePrivateKey decodes a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in signing key")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported signing key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unable to parse signing key of PEM type %q", block.Type)
+}
+
+// KeyID returns the hex encoded SHA-256 fingerprint of the signer's public key.
+func KeyID(signer crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
+
+// Sign wraps the payload in a DSSE envelope signed with the given key.
+func Sign(payload []byte, signer crypto.Signer) (*Envelope, error) {
+	keyID, err := KeyID(signer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute signing key id: %v", err)
+	}
+	sig, err := signMessage(signer, PreAuthEncoding(PayloadType, payload))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []Signature{
+			{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}, nil
+}
+
+func signMessage(signer crypto.Signer, message []byte) ([]byte, error) {
+	switch signer.(type) {
+	case ed25519.PrivateKey:
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", signer)
+	}
+}
+
+// PreAuthEncoding implements the DSSE v1 pre-authentication encoding, the message that is
+// signed for an envelope with the given payload type and payload.
+func PreAuthEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
@@ -118,10 +118,55 @@ func (e ErrEnvVarResolver) Error() string {
 	return fmt.Sprintf("%v", e.message)
 }
 
+// Names of the build metadata variables which may be referenced as $(NAME) in
+// build environment variables, build args and output image labels.
+const (
+	BuildNameVar        = "BUILD_NAME"
+	BuildNamespaceVar   = "BUILD_NAMESPACE"
+	BuildNumberVar      = "BUILD_NUMBER"
+	BuildConfigNameVar  = "BUILDCONFIG_NAME"
+	SourceCommitVar     = "SOURCE_COMMIT"
+	TriggeredByImageVar = "TRIGGERED_BY_IMAGE"
+	OutputImageVar      = "OUTPUT_IMAGE"
+)
+
+// buildMetadataVars returns the build metadata variables known when the build
+// pod is created. Variables without a value, such as the source commit of a
+// build which was not started for a specific revision, are left out so that
+// references to them are kept as they are.
+func buildMetadataVars(build *buildv1.Build) map[string]string {
+	vars := map[string]string{
+		BuildNameVar:      build.Name,
+		BuildNamespaceVar: build.Namespace,
+	}
+	if number, ok := build.Annotations[buildv1.BuildNumberAnnotation]; ok {
+		vars[BuildNumberVar] = number
+	}
+	if name := sharedbuildutil.ConfigNameForBuild(build); len(name) > 0 {
+		vars[BuildConfigNameVar] = name
+	}
+	if build.Spec.Revision != nil && build.Spec.Revision.Git != nil && len(build.Spec.Revision.Git.Commit) > 0 {
+		vars[SourceCommitVar] = build.Spec.Revision.Git.Commit
+	}
+	for _, cause := range build.Spec.TriggeredBy {
+		if cause.ImageChangeBuild != nil && len(cause.ImageChangeBuild.ImageID) > 0 {
+			vars[TriggeredByImageVar] = cause.ImageChangeBuild.ImageID
+			break
+		}
+	}
+	if build.Spec.Output.To != nil && len(build.Spec.Output.To.Name) > 0 {
+		vars[OutputImageVar] = build.Spec.Output.To.Name
+	}
+	return vars
+}
+
 // ResolveValueFrom resolves valueFrom references in build environment variables
 // including references to existing environment variables, jsonpath references to
 // the build object, secrets, and configmaps.
 // The build.Strategy.BuildStrategy.Env is replaced with the resolved references.
+// References to earlier environment variables and to the build metadata variables
+// are also expanded in build args and output image labels; environment variables
+// take precedence over build metadata variables of the same name.
 func ResolveValueFrom(pod *corev1.Pod, client kubernetes.Interface) error {
 	var outputEnv []corev1.EnvVar
 	var allErrs []error
@@ -132,7 +177,7 @@ func ResolveValueFrom(pod *corev1.Pod, client kubernetes.Interface) error {
 	}
 
 	mapEnvs := map[string]string{}
-	mapping := expansion.MappingFuncFor(mapEnvs)
+	mapping := expansion.MappingFuncFor(mapEnvs, buildMetadataVars(build))
 	inputEnv := sharedbuildutil.GetBuildEnv(build)
 	store := envresolve.NewResourceStore()
 
@@ -159,5 +204,15 @@ func ResolveValueFrom(pod *corev1.Pod, client kubernetes.Interface) error {
 	}
 
 	sharedbuildutil.SetBuildEnv(build, outputEnv)
+	if strategy := build.Spec.Strategy.DockerStrategy; strategy != nil {
+		for i, arg := range strategy.BuildArgs {
+			if arg.Value != "" {
+				strategy.BuildArgs[i].Value = expansion.Expand(arg.Value, mapping)
+			}
+		}
+	}
+	for i, label := range build.Spec.Output.ImageLabels {
+		build.Spec.Output.ImageLabels[i].Value = expansion.Expand(label.Value, mapping)
+	}
 	return SetBuildInPod(pod, build)
 }
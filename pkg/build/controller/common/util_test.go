@@ -14,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
 
 	buildv1 "github.com/openshift/api/build/v1"
 	buildfake "github.com/openshift/client-go/build/clientset/versioned/fake"
@@ -21,6 +22,7 @@ import (
 	buildlisterv1 "github.com/openshift/client-go/build/listers/build/v1"
 	sharedbuildutil "github.com/openshift/library-go/pkg/build/buildutil"
 	buildutil "github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+	u "github.com/openshift/openshift-controller-manager/pkg/build/controller/common/testutil"
 )
 
 func mockBuildConfig(name string) buildv1.BuildConfig {
@@ -199,3 +201,65 @@ func TestHandleBuildPruning(t *testing.T) {
 	}
 
 }
+
+func TestResolveValueFromBuildMetadata(t *testing.T) {
+	b := u.Build().WithDockerStrategy().WithImageLabels([]buildv1.ImageLabel{
+		{Name: "io.openshift.build.name", Value: "$(BUILD_NAME)"},
+		{Name: "vcs-ref", Value: "$(SOURCE_COMMIT)"},
+		{Name: "unknown", Value: "$(UNKNOWN)"},
+	})
+	build := b.AsBuild()
+	build.Name = "app-3"
+	build.Namespace = "ns"
+	build.Labels = map[string]string{buildv1.BuildConfigLabel: "app"}
+	build.Annotations = map[string]string{
+		buildv1.BuildConfigAnnotation: "app",
+		buildv1.BuildNumberAnnotation: "3",
+	}
+	build.Spec.Revision = &buildv1.SourceRevision{Git: &buildv1.GitSourceRevision{Commit: "abc123"}}
+	build.Spec.TriggeredBy = []buildv1.BuildTriggerCause{
+		{ImageChangeBuild: &buildv1.ImageChangeCause{ImageID: "registry/base@sha256:0123"}},
+	}
+	build.Spec.Output.To = &corev1.ObjectReference{Kind: "DockerImage", Name: "registry/ns/app:latest"}
+	build.Spec.Strategy.DockerStrategy.Env = []corev1.EnvVar{
+		{Name: "VERSION", Value: "$(BUILDCONFIG_NAME)-$(BUILD_NUMBER)"},
+		{Name: "BASE", Value: "$(TRIGGERED_BY_IMAGE)"},
+		{Name: "BUILD_NAME", Value: "override"},
+		{Name: "NAME", Value: "$(BUILD_NAME)"},
+	}
+	build.Spec.Strategy.DockerStrategy.BuildArgs = []corev1.EnvVar{
+		{Name: "VERSION", Value: "$(VERSION)"},
+		{Name: "OUTPUT", Value: "$(OUTPUT_IMAGE)"},
+	}
+	pod := u.Pod().WithBuild(t, build)
+
+	if err := ResolveValueFrom((*corev1.Pod)(pod), fake.NewSimpleClientset()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resolved := pod.GetBuild(t)
+
+	expectedEnv := []corev1.EnvVar{
+		{Name: "VERSION", Value: "app-3"},
+		{Name: "BASE", Value: "registry/base@sha256:0123"},
+		{Name: "BUILD_NAME", Value: "override"},
+		{Name: "NAME", Value: "override"},
+	}
+	if env := resolved.Spec.Strategy.DockerStrategy.Env; !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("expected env %v, got %v", expectedEnv, env)
+	}
+	expectedArgs := []corev1.EnvVar{
+		{Name: "VERSION", Value: "app-3"},
+		{Name: "OUTPUT", Value: "registry/ns/app:latest"},
+	}
+	if args := resolved.Spec.Strategy.DockerStrategy.BuildArgs; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected build args %v, got %v", expectedArgs, args)
+	}
+	expectedLabels := []buildv1.ImageLabel{
+		{Name: "io.openshift.build.name", Value: "override"},
+		{Name: "vcs-ref", Value: "abc123"},
+		{Name: "unknown", Value: "$(UNKNOWN)"},
+	}
+	if labels := resolved.Spec.Output.ImageLabels; !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("expected image labels %v, got %v", expectedLabels, labels)
+	}
+}
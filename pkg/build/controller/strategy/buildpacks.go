@@ -0,0 +1,272 @@
+package strategy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	buildutil "github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+const (
+	// SourceModeAnnotation selects how a Source strategy build is carried out. It is
+	// set on the BuildConfig and applies to all of its builds.
+	SourceModeAnnotation = "build.openshift.io/source-mode"
+	// SourceModeBuildpacks runs the Cloud Native Buildpacks lifecycle of the builder
+	// image instead of source-to-image.
+	SourceModeBuildpacks = "buildpacks"
+
+	// BuildpacksPlatformAPI is the CNB platform API version the build pod is written against.
+	BuildpacksPlatformAPI = "0.10"
+
+	// Names of the containers running the CNB lifecycle phases.
+	BuildpacksPrepare      = "prepare-platform"
+	BuildpacksAnalyze      = "analyze"
+	BuildpacksDetect       = "detect"
+	BuildpacksRestore      = "restore"
+	BuildpacksBuild        = "build"
+	BuildpacksExport       = "export"
+	buildpacksLifecycleDir = "/cnb/lifecycle"
+
+	// buildpacksSourceDir is where the git-clone container leaves the build source.
+	buildpacksSourceDir   = buildutil.BuildWorkDirMount + "/inputs"
+	buildpacksLayersDir   = "/layers"
+	buildpacksPlatformDir = "/platform"
+	// buildpacksConfigDir holds the registry credentials and certificate authorities
+	// prepared for the lifecycle.
+	buildpacksConfigDir = "/var/run/openshift.io/cnb"
+)
+
+// IsBuildpacksBuild returns true if the build is a Source strategy build which
+// should be carried out by the Cloud Native Buildpacks lifecycle.
+func IsBuildpacksBuild(build *buildv1.Build) bool {
+	return build.Spec.Strategy.SourceStrategy != nil && build.Annotations[SourceModeAnnotation] == SourceModeBuildpacks
+}
+
+// BuildpacksBuildStrategy creates Source strategy builds which run the Cloud Native
+// Buildpacks lifecycle phases of the builder image.
+type BuildpacksBuildStrategy struct {
+	// Image is the builder helper image used to clone the source and prepare the
+	// platform directory for the lifecycle.
+	Image string
+}
+
+// CreateBuildPod creates a pod which clones the build source and then runs the
+// analyze, detect, restore, build and export phases of the CNB lifecycle, each
+// in its own container.
+func (bs *BuildpacksBuildStrategy) CreateBuildPod(build *buildv1.Build, additionalCAs map[string]string, internalRegistryHost string) (*corev1.Pod, error) {
+	strategy := build.Spec.Strategy.SourceStrategy
+	if build.Spec.Output.To == nil || len(build.Spec.Output.To.Name) == 0 {
+		return nil, &FatalError{Reason: "buildpacks builds require an output image"}
+	}
+	if len(build.Spec.Source.Images) > 0 {
+		return nil, &FatalError{Reason: "buildpacks builds do not support image sources"}
+	}
+
+	data, err := runtime.Encode(buildJSONCodec, build)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the Build %s/%s: %v", build.Namespace, build.Name, err)
+	}
+
+	containerEnv := []corev1.EnvVar{
+		{Name: "BUILD", Value: string(data)},
+		{Name: "LANG", Value: "C.utf8"},
+	}
+	addSourceEnvVars(build.Spec.Source, &containerEnv)
+	addTrustedCAMountEnvVar(build.Spec.MountTrustedCA, &containerEnv)
+
+	serviceAccount := build.Spec.ServiceAccount
+	if len(serviceAccount) == 0 {
+		serviceAccount = buildutil.BuilderServiceAccountName
+	}
+
+	image := build.Spec.Output.To.Name
+	appDir := filepath.Join(buildpacksSourceDir, build.Spec.Source.ContextDir)
+	lifecycleEnv := []corev1.EnvVar{
+		{Name: "CNB_PLATFORM_API", Value: BuildpacksPlatformAPI},
+		{Name: "DOCKER_CONFIG", Value: filepath.Join(buildpacksConfigDir, "docker")},
+		// Go reads every certificate in these directories in addition to the system roots.
+		{Name: "SSL_CERT_DIR", Value: strings.Join([]string{"/etc/ssl/certs", filepath.Join(buildpacksConfigDir, "certs"), ConfigMapBuildGlobalCAMountPath}, ":")},
+	}
+	lifecycleMounts := []corev1.VolumeMount{
+		{Name: "buildworkdir", MountPath: buildutil.BuildWorkDirMount},
+		{Name: "cnb-layers", MountPath: buildpacksLayersDir},
+		{Name: "cnb-platform", MountPath: buildpacksPlatformDir},
+		{Name: "cnb-config", MountPath: buildpacksConfigDir, ReadOnly: true},
+	}
+	lifecycleContainer := func(name, phase string, args ...string) corev1.Container {
+		return corev1.Container{
+			Name:                     name,
+			Image:                    strategy.From.Name,
+			Command:                  []string{filepath.Join(buildpacksLifecycleDir, phase)},
+			Args:                     args,
+			Env:                      copyEnvVarSlice(lifecycleEnv),
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+			VolumeMounts:             append([]corev1.VolumeMount(nil), lifecycleMounts...),
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			Resources:                build.Spec.Resources,
+		}
+	}
+
+	initSecurityContext := builderMinSecurityContext()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      buildutil.GetBuildPodName(build),
+			Namespace: build.Namespace,
+			Labels:    getPodLabels(build),
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: serviceAccount,
+			Containers: []corev1.Container{
+				lifecycleContainer(BuildpacksExport, "exporter", "-app="+appDir, "-layers="+buildpacksLayersDir, image),
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name:         "buildworkdir",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+				{
+					Name:         "cnb-layers",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+				{
+					Name:         "cnb-platform",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+				{
+					Name:         "cnb-config",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector:  build.Spec.NodeSelector,
+		},
+	}
+	// The builder image is pulled by the kubelet rather than by the build itself.
+	if strategy.PullSecret != nil {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, *strategy.PullSecret)
+	}
+
+	if build.Spec.Source.Git != nil || build.Spec.Source.Binary != nil {
+		gitCloneContainer := corev1.Container{
+			Name:                     GitCloneContainer,
+			Image:                    bs.Image,
+			Args:                     []string{"openshift-git-clone"},
+			Env:                      copyEnvVarSlice(containerEnv),
+			SecurityContext:          initSecurityContext,
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "buildworkdir",
+					MountPath: buildutil.BuildWorkDirMount,
+				},
+			},
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Resources:       build.Spec.Resources,
+		}
+		if build.Spec.Source.Binary != nil {
+			gitCloneContainer.Stdin = true
+			gitCloneContainer.StdinOnce = true
+		}
+		setupSourceSecrets(pod, &gitCloneContainer, build.Spec.Source.SourceSecret)
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, gitCloneContainer)
+	}
+
+	prepareContainer := corev1.Container{
+		Name:                     BuildpacksPrepare,
+		Image:                    bs.Image,
+		Command:                  []string{"/bin/sh", "-c"},
+		Args:                     []string{buildpacksPlatformScript(strategy.Env, build.Spec.Source, appDir)},
+		Env:                      append(copyEnvVarSlice(containerEnv), copyEnvVarSlice(strategy.Env)...),
+		SecurityContext:          initSecurityContext,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "buildworkdir", MountPath: buildutil.BuildWorkDirMount},
+			{Name: "cnb-platform", MountPath: buildpacksPlatformDir},
+			{Name: "cnb-config", MountPath: buildpacksConfigDir},
+		},
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Resources:       build.Spec.Resources,
+	}
+	setupDockerSecrets(pod, &prepareContainer, build.Spec.Output.PushSecret, nil, nil)
+	setupInputSecrets(pod, &prepareContainer, build.Spec.Source.Secrets)
+	setupInputConfigMaps(pod, &prepareContainer, build.Spec.Source.ConfigMaps)
+
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers,
+		prepareContainer,
+		lifecycleContainer(BuildpacksAnalyze, "analyzer", "-layers="+buildpacksLayersDir, image),
+		lifecycleContainer(BuildpacksDetect, "detector", "-app="+appDir, "-layers="+buildpacksLayersDir, "-platform="+buildpacksPlatformDir),
+		lifecycleContainer(BuildpacksRestore, "restorer", "-layers="+buildpacksLayersDir),
+		lifecycleContainer(BuildpacksBuild, "builder", "-app="+appDir, "-layers="+buildpacksLayersDir, "-platform="+buildpacksPlatformDir),
+	)
+
+	pod = setupActiveDeadline(pod, build)
+
+	setOwnerReference(pod, build)
+	setupContainersConfigs(build, pod)
+	setupBuildCAs(build, pod, additionalCAs, internalRegistryHost)
+	if err := setupBuildVolumes(pod, strategy.Volumes); err != nil {
+		return pod, err
+	}
+	// Build volumes are consumed by the buildpacks, which run in the build phase
+	// rather than in the export phase.
+	for _, mount := range pod.Spec.Containers[0].VolumeMounts {
+		if strings.HasPrefix(mount.MountPath, buildVolumeMountPath) {
+			for i := range pod.Spec.InitContainers {
+				if pod.Spec.InitContainers[i].Name == BuildpacksBuild {
+					pod.Spec.InitContainers[i].VolumeMounts = append(pod.Spec.InitContainers[i].VolumeMounts, mount)
+				}
+			}
+		}
+	}
+	return pod, nil
+}
+
+// buildpacksPlatformScript returns the shell script which prepares the lifecycle
+// inputs: the build environment as platform env files, the push secret as a
+// docker config, the registry certificate authorities as a flat directory, and
+// the input secrets and config maps copied into the application source.
+func buildpacksPlatformScript(env []corev1.EnvVar, source buildv1.BuildSource, appDir string) string {
+	envDir := filepath.Join(buildpacksPlatformDir, "env")
+	dockerDir := filepath.Join(buildpacksConfigDir, "docker")
+	certsDir := filepath.Join(buildpacksConfigDir, "certs")
+	lines := []string{
+		"set -e",
+		fmt.Sprintf("mkdir -p %s %s %s %s", envDir, dockerDir, certsDir, appDir),
+	}
+	// Environment variable names are restricted to [-._a-zA-Z0-9], so quoting
+	// them is sufficient.
+	for _, e := range env {
+		lines = append(lines, fmt.Sprintf("printenv '%s' > '%s/%s' || rm -f '%s/%s'", e.Name, envDir, e.Name, envDir, e.Name))
+	}
+	lines = append(lines,
+		`if [ -n "${PUSH_DOCKERCFG_PATH}" ]; then`,
+		fmt.Sprintf(`  if [ -f "${PUSH_DOCKERCFG_PATH}/.dockerconfigjson" ]; then cp "${PUSH_DOCKERCFG_PATH}/.dockerconfigjson" %s/config.json;`, dockerDir),
+		fmt.Sprintf(`  elif [ -f "${PUSH_DOCKERCFG_PATH}/.dockercfg" ]; then printf '{"auths":%%s}' "$(cat "${PUSH_DOCKERCFG_PATH}/.dockercfg")" > %s/config.json; fi`, dockerDir),
+		`fi`,
+		fmt.Sprintf(`for ca in %s/certs.d/*/ca.crt; do`, ConfigMapCertsMountPath),
+		fmt.Sprintf(`  if [ -f "${ca}" ]; then cp "${ca}" "%s/$(basename "$(dirname "${ca}")").crt"; fi`, certsDir),
+		`done`,
+	)
+	// Object names and destination directories are validated by the API server
+	// and may not contain quotes.
+	copyInput := func(from, destinationDir string) {
+		to := filepath.Join(appDir, destinationDir)
+		lines = append(lines, fmt.Sprintf("mkdir -p '%s' && cp -rL '%s/.' '%s/'", to, from, to))
+	}
+	for _, s := range source.Secrets {
+		copyInput(filepath.Join(SecretBuildSourceBaseMountPath, s.Secret.Name), s.DestinationDir)
+	}
+	for _, c := range source.ConfigMaps {
+		copyInput(filepath.Join(ConfigMapBuildSourceBaseMountPath, c.ConfigMap.Name), c.DestinationDir)
+	}
+	// The lifecycle runs as the unprivileged user of the builder image, which
+	// has to be able to write to the application source.
+	lines = append(lines, fmt.Sprintf("chmod -R a+rwX %s %s", buildpacksSourceDir, buildpacksPlatformDir))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,153 @@
+package strategy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	buildutil "github.com/openshift/openshift-controller-manager/pkg/build/buildutil"
+)
+
+func mockBuildpacksBuild() *buildv1.Build {
+	build := mockSTIBuild()
+	build.Annotations = map[string]string{SourceModeAnnotation: SourceModeBuildpacks}
+	return build
+}
+
+func TestIsBuildpacksBuild(t *testing.T) {
+	if !IsBuildpacksBuild(mockBuildpacksBuild()) {
+		t.Errorf("expected an annotated source build to be a buildpacks build")
+	}
+	if IsBuildpacksBuild(mockSTIBuild()) {
+		t.Errorf("expected a source build without the annotation not to be a buildpacks build")
+	}
+	docker := mockDockerBuild()
+	docker.Annotations = map[string]string{SourceModeAnnotation: SourceModeBuildpacks}
+	if IsBuildpacksBuild(docker) {
+		t.Errorf("expected a docker build not to be a buildpacks build")
+	}
+}
+
+func TestBuildpacksCreateBuildPod(t *testing.T) {
+	strategy := &BuildpacksBuildStrategy{Image: "builder-helper-image"}
+	build := mockBuildpacksBuild()
+
+	pod, err := strategy.CreateBuildPod(build, nil, testInternalRegistryHost)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := buildutil.GetBuildPodName(build); pod.Name != expected {
+		t.Errorf("expected pod name %s, got %s", expected, pod.Name)
+	}
+	if !reflect.DeepEqual(nodeSelector, pod.Spec.NodeSelector) {
+		t.Errorf("expected node selector %v, got %v", nodeSelector, pod.Spec.NodeSelector)
+	}
+	if *pod.Spec.ActiveDeadlineSeconds != 60 {
+		t.Errorf("expected an active deadline of 60s, got %d", *pod.Spec.ActiveDeadlineSeconds)
+	}
+	if len(pod.OwnerReferences) != 1 || pod.OwnerReferences[0].Name != build.Name {
+		t.Errorf("expected the pod to be owned by the build, got %v", pod.OwnerReferences)
+	}
+	if !reflect.DeepEqual(pod.Spec.ImagePullSecrets, []corev1.LocalObjectReference{{Name: "bar"}}) {
+		t.Errorf("expected the builder image pull secret, got %v", pod.Spec.ImagePullSecrets)
+	}
+
+	var names []string
+	for _, c := range pod.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	expectedNames := []string{GitCloneContainer, BuildpacksPrepare, BuildpacksAnalyze, BuildpacksDetect, BuildpacksRestore, BuildpacksBuild}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("expected init containers %v, got %v", expectedNames, names)
+	}
+	if len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Name != BuildpacksExport {
+		t.Fatalf("expected a single %s container, got %v", BuildpacksExport, pod.Spec.Containers)
+	}
+
+	appDir := buildpacksSourceDir + "/foo"
+	lifecycle := map[string][]string{
+		BuildpacksAnalyze: {"/cnb/lifecycle/analyzer", "-layers=/layers", "docker-registry/repository/stiBuild"},
+		BuildpacksDetect:  {"/cnb/lifecycle/detector", "-app=" + appDir, "-layers=/layers", "-platform=/platform"},
+		BuildpacksRestore: {"/cnb/lifecycle/restorer", "-layers=/layers"},
+		BuildpacksBuild:   {"/cnb/lifecycle/builder", "-app=" + appDir, "-layers=/layers", "-platform=/platform"},
+		BuildpacksExport:  {"/cnb/lifecycle/exporter", "-app=" + appDir, "-layers=/layers", "docker-registry/repository/stiBuild"},
+	}
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		expected, ok := lifecycle[c.Name]
+		if !ok {
+			if c.Image != strategy.Image {
+				t.Errorf("expected container %s to run the helper image, got %s", c.Name, c.Image)
+			}
+			continue
+		}
+		if c.Image != "repository/sti-builder" {
+			t.Errorf("expected container %s to run the builder image, got %s", c.Name, c.Image)
+		}
+		if actual := append(append([]string{}, c.Command...), c.Args...); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected container %s to run %v, got %v", c.Name, expected, actual)
+		}
+		if !hasEnv(c.Env, "CNB_PLATFORM_API", BuildpacksPlatformAPI) {
+			t.Errorf("expected container %s to set the platform API, got %v", c.Name, c.Env)
+		}
+		mounts := map[string]string{}
+		for _, m := range c.VolumeMounts {
+			mounts[m.Name] = m.MountPath
+		}
+		for name, path := range map[string]string{
+			"buildworkdir":     buildutil.BuildWorkDirMount,
+			"cnb-layers":       "/layers",
+			"cnb-platform":     "/platform",
+			"build-ca-bundles": ConfigMapCertsMountPath,
+		} {
+			if mounts[name] != path {
+				t.Errorf("expected container %s to mount %s at %s, got %v", c.Name, name, path, mounts)
+			}
+		}
+	}
+
+	prepare := pod.Spec.InitContainers[1]
+	if !hasEnv(prepare.Env, "PUSH_DOCKERCFG_PATH", DockerPushSecretMountPath) {
+		t.Errorf("expected the push secret to be mounted into %s, got %v", prepare.Name, prepare.Env)
+	}
+	if !hasEnv(prepare.Env, "BUILD_LOGLEVEL", "bar") {
+		t.Errorf("expected the strategy environment in %s, got %v", prepare.Name, prepare.Env)
+	}
+	script := prepare.Args[0]
+	for _, expected := range []string{
+		"printenv 'BUILD_LOGLEVEL' > '/platform/env/BUILD_LOGLEVEL'",
+		"cp -rL '" + SecretBuildSourceBaseMountPath + "/secret/.' '" + appDir + "/tmp/'",
+		"cp -rL '" + ConfigMapBuildSourceBaseMountPath + "/configmap/.' '" + appDir + "/relpath/'",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected the platform script to contain %q, got:\n%s", expected, script)
+		}
+	}
+}
+
+func TestBuildpacksCreateBuildPodErrors(t *testing.T) {
+	strategy := &BuildpacksBuildStrategy{Image: "builder-helper-image"}
+
+	noOutput := mockBuildpacksBuild()
+	noOutput.Spec.Output.To = nil
+	if _, err := strategy.CreateBuildPod(noOutput, nil, testInternalRegistryHost); !IsFatal(err) {
+		t.Errorf("expected a fatal error for a build without output, got %v", err)
+	}
+
+	imageSource := mockBuildpacksBuild()
+	imageSource.Spec.Source.Images = []buildv1.ImageSource{{From: corev1.ObjectReference{Kind: "DockerImage", Name: "image"}}}
+	if _, err := strategy.CreateBuildPod(imageSource, nil, testInternalRegistryHost); !IsFatal(err) {
+		t.Errorf("expected a fatal error for a build with image sources, got %v", err)
+	}
+}
+
+func hasEnv(env []corev1.EnvVar, name, value string) bool {
+	for _, e := range env {
+		if e.Name == name && e.Value == value {
+			return true
+		}
+	}
+	return false
+}
@@ -85,6 +85,8 @@ func (bc *buildCollector) IsCreated() bool {
 func (bc *buildCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- buildCountDesc
 	ch <- activeBuildDesc
+	describeBuildUsage(ch)
+	describeBuildPhaseDurations(ch)
 }
 
 type collectKey struct {
@@ -113,6 +115,9 @@ func (bc *buildCollector) Collect(ch chan<- prometheus.Metric) {
 	for key, count := range counts {
 		addCountGauge(ch, buildCountDesc, key.phase, key.reason, key.strategy, float64(count))
 	}
+
+	collectBuildUsage(ch)
+	collectBuildPhaseDurations(ch)
 }
 
 func (bc *buildCollector) ClearState() {
@@ -140,7 +145,7 @@ func addTimeGauge(ch chan<- prometheus.Metric, b *buildv1.Build, time *metav1.Ti
 func (bc *buildCollector) collectBuild(ch chan<- prometheus.Metric, b *buildv1.Build) (key collectKey) {
 
 	r := string(b.Status.Reason)
-	s := strategyType(b.Spec.Strategy)
+	s := StrategyType(b.Spec.Strategy)
 	key = collectKey{reason: r, strategy: s}
 	switch b.Status.Phase {
 	// remember, new and pending builds don't have a start time
@@ -165,7 +170,8 @@ func (bc *buildCollector) collectBuild(ch chan<- prometheus.Metric, b *buildv1.B
 	return key
 }
 
-func strategyType(strategy buildv1.BuildStrategy) string {
+// StrategyType returns the name of the strategy of a build.
+func StrategyType(strategy buildv1.BuildStrategy) string {
 	switch {
 	case strategy.DockerStrategy != nil:
 		return "Docker"
@@ -56,6 +56,16 @@ func TestBuildMetrics(t *testing.T) {
 		"openshift_build_active_time_seconds{name=\"testname1\",namespace=\"testnamespace\",phase=\"New\",reason=\"\",strategy=\"\"} 123",
 		"openshift_build_active_time_seconds{name=\"testname2\",namespace=\"testnamespace\",phase=\"Pending\",reason=\"\",strategy=\"\"} 123",
 		"openshift_build_active_time_seconds{name=\"testname3\",namespace=\"testnamespace\",phase=\"Running\",reason=\"\",strategy=\"\"} 123",
+		"# TYPE openshift_build_usage_build_seconds_total counter",
+		"openshift_build_usage_build_seconds_total{namespace=\"testnamespace\"} 150",
+		"openshift_build_usage_cpu_core_seconds_total{namespace=\"testnamespace\"} 75",
+		"openshift_build_usage_memory_byte_seconds_total{namespace=\"testnamespace\"} 3072",
+		"# TYPE openshift_build_new_duration_seconds histogram",
+		"openshift_build_new_duration_seconds_count{phase=\"Pending\",reason=\"\",strategy=\"Docker\"} 1",
+		"openshift_build_pending_duration_seconds_bucket{phase=\"Running\",reason=\"\",strategy=\"Docker\",le=\"8\"} 0",
+		"openshift_build_pending_duration_seconds_bucket{phase=\"Running\",reason=\"\",strategy=\"Docker\",le=\"16\"} 1",
+		"openshift_build_running_duration_seconds_sum{phase=\"Failed\",reason=\"GenericBuildFailed\",strategy=\"Source\"} 60",
+		"openshift_build_duration_seconds_sum{phase=\"Failed\",reason=\"GenericBuildFailed\",strategy=\"Source\"} 90",
 	}
 
 	buildLister := &fakeLister{
@@ -128,6 +138,13 @@ func TestBuildMetrics(t *testing.T) {
 		lister: buildLister,
 	}
 
+	RecordBuildUsage("testnamespace", 100, 50, 1024)
+	RecordBuildUsage("testnamespace", 50, 25, 2048)
+	newDuration, pendingDuration, runningDuration, totalDuration := 3*time.Second, 10*time.Second, time.Minute, 90*time.Second
+	ObserveBuildPhaseDurations("Docker", "Pending", "", BuildPhaseDurations{New: &newDuration})
+	ObserveBuildPhaseDurations("Docker", "Running", "", BuildPhaseDurations{Pending: &pendingDuration})
+	ObserveBuildPhaseDurations("Source", "Failed", "GenericBuildFailed", BuildPhaseDurations{Running: &runningDuration, Total: &totalDuration})
+
 	legacyregistry.MustRegister(&bc)
 
 	h := promhttp.HandlerFor(legacyregistry.DefaultGatherer, promhttp.HandlerOpts{ErrorHandling: promhttp.PanicOnError})
@@ -0,0 +1,110 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	buildNewDuration          = "new_duration_seconds"
+	buildNewDurationQuery     = buildSubsystem + separator + buildNewDuration
+	buildPendingDuration      = "pending_duration_seconds"
+	buildPendingDurationQuery = buildSubsystem + separator + buildPendingDuration
+	buildRunningDuration      = "running_duration_seconds"
+	buildRunningDurationQuery = buildSubsystem + separator + buildRunningDuration
+	buildDuration             = "duration_seconds"
+	buildDurationQuery        = buildSubsystem + separator + buildDuration
+)
+
+var (
+	// buildWaitBuckets range from half a second to about an hour.
+	buildWaitBuckets = prometheus.ExponentialBuckets(0.5, 2, 14)
+	// buildDurationBuckets range from five seconds to about six hours.
+	buildDurationBuckets = prometheus.ExponentialBuckets(5, 2, 13)
+
+	buildPhaseLabels = []string{"strategy", "phase", "reason"}
+
+	buildNewDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    buildNewDurationQuery,
+			Help:    "Observes the seconds builds spent in the New phase by strategy, and the phase and reason they transitioned to",
+			Buckets: buildWaitBuckets,
+		},
+		buildPhaseLabels,
+	)
+	buildPendingDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    buildPendingDurationQuery,
+			Help:    "Observes the seconds builds spent in the Pending phase by strategy, and the phase and reason they transitioned to",
+			Buckets: buildWaitBuckets,
+		},
+		buildPhaseLabels,
+	)
+	buildRunningDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    buildRunningDurationQuery,
+			Help:    "Observes the seconds terminal builds ran by strategy, terminal phase, and reason",
+			Buckets: buildDurationBuckets,
+		},
+		buildPhaseLabels,
+	)
+	buildDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    buildDurationQuery,
+			Help:    "Observes the seconds from creation to completion of terminal builds by strategy, terminal phase, and reason",
+			Buckets: buildDurationBuckets,
+		},
+		buildPhaseLabels,
+	)
+)
+
+// BuildPhaseDurations are the durations observed when a build transitions to a phase. A nil
+// duration is not observed.
+type BuildPhaseDurations struct {
+	// New is the time the build spent in the New phase, observed when it leaves it.
+	New *time.Duration
+	// Pending is the time the build spent in the Pending phase, observed when it leaves it.
+	Pending *time.Duration
+	// Running is the time a terminal build ran.
+	Running *time.Duration
+	// Total is the time from the creation to the completion of a terminal build.
+	Total *time.Duration
+}
+
+// ObserveBuildPhaseDurations observes the durations of a build transitioning to the given
+// phase for the given reason.
+func ObserveBuildPhaseDurations(strategy, phase, reason string, d BuildPhaseDurations) {
+	for _, o := range []struct {
+		histogram *prometheus.HistogramVec
+		duration  *time.Duration
+	}{
+		{buildNewDurationHistogram, d.New},
+		{buildPendingDurationHistogram, d.Pending},
+		{buildRunningDurationHistogram, d.Running},
+		{buildDurationHistogram, d.Total},
+	} {
+		if o.duration == nil {
+			continue
+		}
+		seconds := o.duration.Seconds()
+		if seconds < 0 {
+			seconds = 0
+		}
+		o.histogram.WithLabelValues(strategy, phase, reason).Observe(seconds)
+	}
+}
+
+func describeBuildPhaseDurations(ch chan<- *prometheus.Desc) {
+	buildNewDurationHistogram.Describe(ch)
+	buildPendingDurationHistogram.Describe(ch)
+	buildRunningDurationHistogram.Describe(ch)
+	buildDurationHistogram.Describe(ch)
+}
+
+func collectBuildPhaseDurations(ch chan<- prometheus.Metric) {
+	buildNewDurationHistogram.Collect(ch)
+	buildPendingDurationHistogram.Collect(ch)
+	buildRunningDurationHistogram.Collect(ch)
+	buildDurationHistogram.Collect(ch)
+}
@@ -0,0 +1,58 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	buildUsageSeconds                = "usage_build_seconds_total"
+	buildUsageSecondsQuery           = buildSubsystem + separator + buildUsageSeconds
+	buildUsageCPUCoreSeconds         = "usage_cpu_core_seconds_total"
+	buildUsageCPUCoreSecondsQuery    = buildSubsystem + separator + buildUsageCPUCoreSeconds
+	buildUsageMemoryByteSeconds      = "usage_memory_byte_seconds_total"
+	buildUsageMemoryByteSecondsQuery = buildSubsystem + separator + buildUsageMemoryByteSeconds
+)
+
+var (
+	buildUsageSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: buildUsageSecondsQuery,
+			Help: "Counts the seconds terminal builds ran by namespace",
+		},
+		[]string{"namespace"},
+	)
+	buildUsageCPUCoreSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: buildUsageCPUCoreSecondsQuery,
+			Help: "Counts the CPU cores requested by terminal builds times their duration by namespace",
+		},
+		[]string{"namespace"},
+	)
+	buildUsageMemoryByteSecondsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: buildUsageMemoryByteSecondsQuery,
+			Help: "Counts the memory bytes requested by terminal builds times their duration by namespace",
+		},
+		[]string{"namespace"},
+	)
+)
+
+// RecordBuildUsage adds the duration and the requested resources times the duration of a
+// terminal build to the usage counters of its namespace.
+func RecordBuildUsage(namespace string, buildSeconds, cpuCoreSeconds, memoryByteSeconds float64) {
+	buildUsageSecondsCounter.WithLabelValues(namespace).Add(buildSeconds)
+	buildUsageCPUCoreSecondsCounter.WithLabelValues(namespace).Add(cpuCoreSeconds)
+	buildUsageMemoryByteSecondsCounter.WithLabelValues(namespace).Add(memoryByteSeconds)
+}
+
+func describeBuildUsage(ch chan<- *prometheus.Desc) {
+	buildUsageSecondsCounter.Describe(ch)
+	buildUsageCPUCoreSecondsCounter.Describe(ch)
+	buildUsageMemoryByteSecondsCounter.Describe(ch)
+}
+
+func collectBuildUsage(ch chan<- prometheus.Metric) {
+	buildUsageSecondsCounter.Collect(ch)
+	buildUsageCPUCoreSecondsCounter.Collect(ch)
+	buildUsageMemoryByteSecondsCounter.Collect(ch)
+}
@@ -25,7 +25,7 @@ func RunDeployerController(ctx *ControllerContext) (bool, error) {
 
 	go deployercontroller.NewDeployerController(
 		ctx.KubernetesInformers.Core().V1().ReplicationControllers(),
-		ctx.KubernetesInformers.Core().V1().Pods(),
+		ctx.DeployerPodKubeInformers.Core().V1().Pods(),
 		kubeClient,
 		deployerServiceAccountName,
 		imageTemplate.ExpandOrDie("deployer"),
@@ -1,12 +1,17 @@
 package controller
 
 import (
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 
 	buildclient "github.com/openshift/client-go/build/clientset/versioned"
 	buildcontroller "github.com/openshift/openshift-controller-manager/pkg/build/controller/build"
 	builddefaults "github.com/openshift/openshift-controller-manager/pkg/build/controller/build/defaults"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
 	buildoverrides "github.com/openshift/openshift-controller-manager/pkg/build/controller/build/overrides"
 	buildconfigcontroller "github.com/openshift/openshift-controller-manager/pkg/build/controller/buildconfig"
 	buildstrategy "github.com/openshift/openshift-controller-manager/pkg/build/controller/strategy"
@@ -35,10 +40,25 @@ func RunBuildController(ctx *ControllerContext) (bool, error) {
 	}
 	securityClient := ctx.ClientBuilder.OpenshiftSecurityClientOrDie(infraBuildControllerServiceAccountName)
 
+	logRedactionPatterns, err := buildcontroller.CompileLogRedactionPatterns(ctx.ExtendedConfig.Build.LogRedaction)
+	if err != nil {
+		return false, err
+	}
+
+	if err := buildcontroller.ValidateExecutionConfig(ctx.ExtendedConfig.Build.Execution); err != nil {
+		return false, err
+	}
+	if err := buildcontroller.ValidateMemoryRightSizingConfig(ctx.ExtendedConfig.Build.MemoryRightSizing); err != nil {
+		return false, err
+	}
+	if err := buildcontroller.ValidatePipelineConfig(ctx.ExtendedConfig.Build.Pipeline); err != nil {
+		return false, err
+	}
+
 	buildInformer := ctx.BuildInformers.Build().V1().Builds()
 	buildConfigInformer := ctx.BuildInformers.Build().V1().BuildConfigs()
 	imageStreamInformer := ctx.ImageInformers.Image().V1().ImageStreams()
-	podInformer := ctx.KubernetesInformers.Core().V1().Pods()
+	podInformer := ctx.BuildPodKubeInformers.Core().V1().Pods()
 	secretInformer := ctx.KubernetesInformers.Core().V1().Secrets()
 	configMapInformer := ctx.KubernetesInformers.Core().V1().ConfigMaps()
 	serviceAccountInformer := ctx.KubernetesInformers.Core().V1().ServiceAccounts()
@@ -51,6 +71,11 @@ func RunBuildController(ctx *ControllerContext) (bool, error) {
 	imageDigestMirrorSetInformer := ctx.ConfigInformers.Config().V1().ImageDigestMirrorSets()
 	imageTagMirrorSetInformer := ctx.ConfigInformers.Config().V1().ImageTagMirrorSets()
 
+	logArchiveSink, err := logarchive.NewSink(ctx.ExtendedConfig.Build.LogArchive, secretInformer.Lister(), externalKubeClient.CoreV1())
+	if err != nil {
+		return false, err
+	}
+
 	buildControllerParams := &buildcontroller.BuildControllerParams{
 		BuildInformer:                      buildInformer,
 		BuildConfigInformer:                buildConfigInformer,
@@ -76,13 +101,56 @@ func RunBuildController(ctx *ControllerContext) (bool, error) {
 			Image:          imageTemplate.ExpandOrDie("docker-builder"),
 			SecurityClient: securityClient.SecurityV1(),
 		},
-		CustomBuildStrategy:      &buildstrategy.CustomBuildStrategy{},
+		CustomBuildStrategy: &buildstrategy.CustomBuildStrategy{},
+		BuildpacksBuildStrategy: &buildstrategy.BuildpacksBuildStrategy{
+			Image: imageTemplate.ExpandOrDie("docker-builder"),
+		},
 		BuildDefaults:            builddefaults.BuildDefaults{Config: ctx.OpenshiftControllerConfig.Build.BuildDefaults},
 		BuildOverrides:           buildoverrides.BuildOverrides{Config: ctx.OpenshiftControllerConfig.Build.BuildOverrides},
 		InternalRegistryHostname: ctx.OpenshiftControllerConfig.DockerPullSecret.InternalRegistryHostname,
+		Provenance:               ctx.ExtendedConfig.Build.Provenance,
+		LogRedactionPatterns:     logRedactionPatterns,
+		LogArchiveSink:           logArchiveSink,
+		Kueue:                    ctx.ExtendedConfig.Build.Kueue,
+		Execution:                ctx.ExtendedConfig.Build.Execution,
+		SharedConfigMaps:         ctx.ExtendedConfig.Build.SharedConfigMaps,
+		Usage:                    ctx.ExtendedConfig.Build.Usage,
+		MemoryRightSizing:        ctx.ExtendedConfig.Build.MemoryRightSizing,
+		Pipeline:                 ctx.ExtendedConfig.Build.Pipeline,
+	}
+	// Only watch Jobs when builds run as Jobs.
+	if ctx.ExtendedConfig.Build.Execution.Backend == buildcontroller.ExecutionBackendJob {
+		buildControllerParams.JobInformer = ctx.KubernetesInformers.Batch().V1().Jobs()
+	}
+
+	// Only watch PipelineRuns when JenkinsPipeline builds run on Tekton, and Tekton is
+	// installed. Otherwise the informer would never sync and block the build controller.
+	if buildControllerParams.Pipeline.Enabled {
+		served, err := ctx.IsResourceServed(buildcontroller.PipelineRunResource)
+		if err != nil {
+			return false, err
+		}
+		if !served {
+			gvr := buildcontroller.PipelineRunResource
+			klog.Warningf("Not running JenkinsPipeline builds on Tekton: %s/%s %s are not served, is Tekton installed?", gvr.Group, gvr.Version, gvr.Resource)
+			buildControllerParams.Pipeline.Enabled = false
+		}
+	}
+	var pipelineRunInformers dynamicinformer.DynamicSharedInformerFactory
+	if buildControllerParams.Pipeline.Enabled {
+		dynamicClient, err := dynamic.NewForConfig(cfg)
+		if err != nil {
+			return false, err
+		}
+		pipelineRunInformers = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 10*time.Minute)
+		buildControllerParams.DynamicClient = dynamicClient
+		buildControllerParams.PipelineRunInformer = pipelineRunInformers.ForResource(buildcontroller.PipelineRunResource)
 	}
 
 	go buildcontroller.NewBuildController(buildControllerParams).Run(5, ctx.Stop)
+	if pipelineRunInformers != nil {
+		pipelineRunInformers.Start(ctx.Stop)
+	}
 	return true, nil
 }
 
@@ -1,9 +1,21 @@
 package controller
 
 import (
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
 )
 
+// OpenShiftImageTagRetentionController prunes the tag history of image streams according to
+// their retention policy. It is disabled by default, as it watches every pod in the cluster.
+const OpenShiftImageTagRetentionController openshiftcontrolplanev1.OpenShiftControllerName = "openshift.io/image-tag-retention"
+
+// ControllersDisabledByDefault are the controllers which "*" does not enable. They run only
+// when named in the controllers setting.
+var ControllersDisabledByDefault = sets.NewString(
+	string(OpenShiftImageTagRetentionController),
+)
+
 var ControllerInitializers = map[openshiftcontrolplanev1.OpenShiftControllerName]InitFunc{
 	openshiftcontrolplanev1.OpenShiftServiceAccountController: RunServiceAccountController,
 
@@ -26,6 +38,7 @@ var ControllerInitializers = map[openshiftcontrolplanev1.OpenShiftControllerName
 	openshiftcontrolplanev1.OpenShiftImageImportController:             RunImageImportController,
 	openshiftcontrolplanev1.OpenShiftImageSignatureImportController:    RunImageSignatureImportController,
 	openshiftcontrolplanev1.OpenShiftImagePullerRoleBindingsController: RunImagePullerRoleBindingController,
+	OpenShiftImageTagRetentionController:                               RunImageTagRetentionController,
 
 	openshiftcontrolplanev1.OpenShiftTemplateInstanceController:          RunTemplateInstanceController,
 	openshiftcontrolplanev1.OpenShiftTemplateInstanceFinalizerController: RunTemplateInstanceFinalizerController,
@@ -33,6 +46,61 @@ var ControllerInitializers = map[openshiftcontrolplanev1.OpenShiftControllerName
 	openshiftcontrolplanev1.OpenShiftUnidlingController: RunUnidlingController,
 }
 
+// ControllerInformerFields declares, per controller, the fields of cached objects
+// which the informer transforms would otherwise drop. Fields are declared when a
+// controller reads them, or writes cached objects back with Update.
+var ControllerInformerFields = map[openshiftcontrolplanev1.OpenShiftControllerName]InformerFields{
+	openshiftcontrolplanev1.OpenShiftServiceAccountPullSecretsController: {
+		"ServiceAccount": {ManagedFields, LastAppliedConfiguration},
+		"Secret":         {ManagedFields},
+	},
+
+	openshiftcontrolplanev1.OpenShiftBuildController: {
+		// ImageStreamImage references are resolved against the whole tag history.
+		"ImageStream": {ImageStreamTagHistory},
+		"Build":       {LastAppliedConfiguration},
+		"Pod":         {LastAppliedConfiguration},
+		"ConfigMap":   {LastAppliedConfiguration},
+	},
+
+	openshiftcontrolplanev1.OpenShiftDeployerController: {
+		"ReplicationController": {LastAppliedConfiguration},
+	},
+	openshiftcontrolplanev1.OpenShiftDeploymentConfigController: {
+		"DeploymentConfig":      {LastAppliedConfiguration},
+		"ReplicationController": {LastAppliedConfiguration},
+	},
+
+	openshiftcontrolplanev1.OpenShiftImageTriggerController: {
+		"DeploymentConfig": {LastAppliedConfiguration},
+		"Deployment":       {LastAppliedConfiguration},
+		"DaemonSet":        {LastAppliedConfiguration},
+		"StatefulSet":      {LastAppliedConfiguration},
+		"ReplicaSet":       {LastAppliedConfiguration},
+		"Job":              {LastAppliedConfiguration},
+		"CronJob":          {LastAppliedConfiguration},
+		"Pod":              {LastAppliedConfiguration},
+	},
+	openshiftcontrolplanev1.OpenShiftImageSignatureImportController: {
+		"Image": {LastAppliedConfiguration},
+	},
+	OpenShiftImageTagRetentionController: {
+		"ImageStream": {ImageStreamTagHistory, LastAppliedConfiguration},
+	},
+
+	openshiftcontrolplanev1.OpenShiftTemplateInstanceController: {
+		"TemplateInstance": {LastAppliedConfiguration},
+	},
+	openshiftcontrolplanev1.OpenShiftTemplateInstanceFinalizerController: {
+		"TemplateInstance": {LastAppliedConfiguration},
+	},
+
+	openshiftcontrolplanev1.OpenShiftUnidlingController: {
+		"Service":   {LastAppliedConfiguration},
+		"Endpoints": {LastAppliedConfiguration},
+	},
+}
+
 const (
 	infraOriginNamespaceServiceAccountName                      = "origin-namespace-controller"
 	infraServiceAccountControllerServiceAccountName             = "serviceaccount-controller"
@@ -43,6 +111,7 @@ const (
 	infraDeployerControllerServiceAccountName                   = "deployer-controller"
 	infraImageTriggerControllerServiceAccountName               = "image-trigger-controller"
 	infraImageImportControllerServiceAccountName                = "image-import-controller"
+	infraImageTagRetentionControllerServiceAccountName          = "image-tag-retention-controller"
 	infraUnidlingControllerServiceAccountName                   = "unidling-controller"
 	infraDefaultRoleBindingsControllerServiceAccountName        = "default-rolebindings-controller"
 
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	buildcontroller "github.com/openshift/openshift-controller-manager/pkg/build/controller/build"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/logarchive"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/provenance"
+	imagecontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller"
+	imagetagretention "github.com/openshift/openshift-controller-manager/pkg/image/controller/retention"
+	imagesignaturecontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller/signature"
+	imagetriggercontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller/trigger"
+	imagewebhook "github.com/openshift/openshift-controller-manager/pkg/image/controller/webhook"
+)
+
+// ExtendedControllerConfig holds the settings of controller features that are not part
+// of openshiftcontrolplanev1.OpenShiftControllerManagerConfig. It is read from the
+// "extendedConfig" stanza of the controller manager configuration file.
+type ExtendedControllerConfig struct {
+	// Build holds the extended settings of the build controller.
+	Build BuildExtendedConfig `json:"build"`
+	// ImageImport holds the extended settings of the image import controllers.
+	ImageImport ImageImportExtendedConfig `json:"imageImport"`
+	// ImageTrigger selects the resources updated by the image trigger controller.
+	ImageTrigger imagetriggercontroller.Config `json:"imageTrigger"`
+	// ImageTagRetention controls the default retention of the tag history of image streams. It
+	// applies once openshift.io/image-tag-retention is named in the enabled controllers.
+	ImageTagRetention imagetagretention.Config `json:"imageTagRetention"`
+}
+
+// ImageImportExtendedConfig holds the extended settings of the image import controllers.
+type ImageImportExtendedConfig struct {
+	// RegistryLimits controls the rate limits and circuit breakers of scheduled imports
+	// per registry.
+	RegistryLimits imagecontroller.RegistryLimitsConfig `json:"registryLimits"`
+	// TriggerPriority controls how much more often scheduled imports check the tags
+	// referenced by image triggers.
+	TriggerPriority imagecontroller.TriggerPriorityConfig `json:"triggerPriority"`
+	// PushWebhook controls the receiver of registry push notifications.
+	PushWebhook imagewebhook.Config `json:"pushWebhook"`
+	// SignatureImport controls the download of image signatures.
+	SignatureImport imagesignaturecontroller.Config `json:"signatureImport"`
+}
+
+// BuildExtendedConfig holds the extended settings of the build controller.
+type BuildExtendedConfig struct {
+	// Provenance controls the generation of provenance for completed builds.
+	Provenance provenance.Config `json:"provenance"`
+	// LogRedaction controls the redaction of the log snippets of failed builds.
+	LogRedaction buildcontroller.LogRedactionConfig `json:"logRedaction"`
+	// LogArchive selects the storage the logs of finished builds are archived to.
+	LogArchive logarchive.Config `json:"logArchive"`
+	// Kueue controls the submission of build pods to Kueue.
+	Kueue buildcontroller.KueueConfig `json:"kueue"`
+	// Execution selects whether builds run as bare pods or as Jobs.
+	Execution buildcontroller.ExecutionConfig `json:"execution"`
+	// SharedConfigMaps controls the sharing of build ConfigMaps within a namespace.
+	SharedConfigMaps buildcontroller.SharedConfigMapsConfig `json:"sharedConfigMaps"`
+	// Usage controls the accounting of the capacity used by builds.
+	Usage buildcontroller.UsageAccountingConfig `json:"usage"`
+	// MemoryRightSizing controls the retry of OOM-killed builds with larger memory limits.
+	MemoryRightSizing buildcontroller.MemoryRightSizingConfig `json:"memoryRightSizing"`
+	// Pipeline controls the Tekton backend of builds with the JenkinsPipeline strategy.
+	Pipeline buildcontroller.PipelineConfig `json:"pipeline"`
+}
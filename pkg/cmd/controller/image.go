@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	kappsv1 "k8s.io/api/apps/v1"
@@ -14,19 +15,30 @@ import (
 	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	kclientsetexternal "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
 
 	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
 	triggerutil "github.com/openshift/library-go/pkg/image/trigger"
 	imagecontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller"
+	imagetagretention "github.com/openshift/openshift-controller-manager/pkg/image/controller/retention"
 	imagesignaturecontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller/signature"
 	imagetriggercontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller/trigger"
+	imagewebhook "github.com/openshift/openshift-controller-manager/pkg/image/controller/webhook"
 	triggerannotations "github.com/openshift/openshift-controller-manager/pkg/image/trigger/annotations"
 	triggerbuildconfigs "github.com/openshift/openshift-controller-manager/pkg/image/trigger/buildconfigs"
 	triggerdeploymentconfigs "github.com/openshift/openshift-controller-manager/pkg/image/trigger/deploymentconfigs"
 )
 
 func RunImageTriggerController(ctx *ControllerContext) (bool, error) {
+	config := ctx.ExtendedConfig.ImageTrigger
+	if err := imagetriggercontroller.ValidateConfig(config); err != nil {
+		return true, err
+	}
 	informer := ctx.ImageInformers.Image().V1().ImageStreams()
 	kclient := ctx.ClientBuilder.ClientOrDie(infraImageTriggerControllerServiceAccountName)
 
@@ -60,45 +72,118 @@ func RunImageTriggerController(ctx *ControllerContext) (bool, error) {
 			Reactor:   triggerbuildconfigs.NewBuildConfigReactor(buildClient.BuildV1(), kclient.CoreV1().RESTClient()),
 		})
 	}
-	sources = append(sources, imagetriggercontroller.TriggerSource{
-		Resource:  schema.GroupResource{Group: "apps", Resource: "deployments"},
-		Informer:  ctx.KubernetesInformers.Apps().V1().Deployments().Informer(),
-		Store:     ctx.KubernetesInformers.Apps().V1().Deployments().Informer().GetIndexer(),
-		TriggerFn: triggerannotations.NewAnnotationTriggerIndexer,
-		Reactor:   &triggerutil.AnnotationReactor{Updater: updater},
-	})
-	sources = append(sources, imagetriggercontroller.TriggerSource{
-		Resource:  schema.GroupResource{Group: "apps", Resource: "daemonsets"},
-		Informer:  ctx.KubernetesInformers.Apps().V1().DaemonSets().Informer(),
-		Store:     ctx.KubernetesInformers.Apps().V1().DaemonSets().Informer().GetIndexer(),
-		TriggerFn: triggerannotations.NewAnnotationTriggerIndexer,
-		Reactor:   &triggerutil.AnnotationReactor{Updater: updater},
-	})
-	sources = append(sources, imagetriggercontroller.TriggerSource{
-		Resource:  schema.GroupResource{Group: "apps", Resource: "statefulsets"},
-		Informer:  ctx.KubernetesInformers.Apps().V1().StatefulSets().Informer(),
-		Store:     ctx.KubernetesInformers.Apps().V1().StatefulSets().Informer().GetIndexer(),
-		TriggerFn: triggerannotations.NewAnnotationTriggerIndexer,
-		Reactor:   &triggerutil.AnnotationReactor{Updater: updater},
-	})
-	sources = append(sources, imagetriggercontroller.TriggerSource{
-		Resource:  schema.GroupResource{Group: "batch", Resource: "cronjobs"},
-		Informer:  ctx.KubernetesInformers.Batch().V1().CronJobs().Informer(),
-		Store:     ctx.KubernetesInformers.Batch().V1().CronJobs().Informer().GetIndexer(),
-		TriggerFn: triggerannotations.NewAnnotationTriggerIndexer,
-		Reactor:   &triggerutil.AnnotationReactor{Updater: updater},
-	})
-
-	go imagetriggercontroller.NewTriggerController(
+	annotationSources, err := servedAnnotationSources(ctx, config.Sources())
+	if err != nil {
+		return true, err
+	}
+	var dynamicClient dynamic.Interface
+	var dynamicInformers dynamicinformer.DynamicSharedInformerFactory
+	for _, source := range annotationSources {
+		if source.IsBuiltIn() {
+			informer, skipControlled, err := builtInAnnotationTriggerInformer(ctx, source.GroupResource())
+			if err != nil {
+				return true, err
+			}
+			triggerFn := triggerannotations.NewAnnotationTriggerIndexer
+			if skipControlled {
+				triggerFn = triggerannotations.NewUncontrolledAnnotationTriggerIndexer
+			}
+			sources = append(sources, imagetriggercontroller.TriggerSource{
+				Resource:  source.GroupResource(),
+				Informer:  informer,
+				Store:     informer.GetIndexer(),
+				TriggerFn: triggerFn,
+				Reactor:   &triggerutil.AnnotationReactor{Updater: updater},
+			})
+			continue
+		}
+
+		// resources that are not compiled in are watched and updated with the dynamic client, whose
+		// informers keep all fields since the objects are written back whole
+		if dynamicClient == nil {
+			restConfig, err := ctx.ClientBuilder.Config(infraImageTriggerControllerServiceAccountName)
+			if err != nil {
+				return true, err
+			}
+			if dynamicClient, err = dynamic.NewForConfig(restConfig); err != nil {
+				return true, err
+			}
+			dynamicInformers = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 10*time.Minute)
+		}
+		informer := dynamicInformers.ForResource(source.GroupVersionResource()).Informer()
+		sources = append(sources, imagetriggercontroller.TriggerSource{
+			Resource:  source.GroupResource(),
+			Informer:  informer,
+			Store:     informer.GetIndexer(),
+			TriggerFn: triggerannotations.NewPodSpecPathAnnotationTriggerIndexer(source.PodSpecFields()),
+			Reactor: &triggerannotations.UnstructuredReactor{
+				Client:      dynamicClient.Resource(source.GroupVersionResource()),
+				PodSpecPath: source.PodSpecFields(),
+			},
+		})
+	}
+
+	controller := imagetriggercontroller.NewTriggerController(
 		ctx.OpenshiftControllerConfig.DockerPullSecret.InternalRegistryHostname,
 		broadcaster,
 		informer,
 		sources...,
-	).Run(5, ctx.Stop)
+	)
+	ctx.imageTagReferences.set(controller)
+	go controller.Run(5, ctx.Stop)
+	if dynamicInformers != nil {
+		dynamicInformers.Start(ctx.Stop)
+	}
 
 	return true, nil
 }
 
+// servedAnnotationSources returns the annotation trigger sources, without the custom resources
+// that are not served, for example because their CustomResourceDefinition is not installed.
+// Their informers would never sync, and keep the trigger controller from starting.
+func servedAnnotationSources(ctx *ControllerContext, sources []imagetriggercontroller.AnnotationSource) ([]imagetriggercontroller.AnnotationSource, error) {
+	var served []imagetriggercontroller.AnnotationSource
+	for _, source := range sources {
+		if !source.IsBuiltIn() {
+			ok, err := ctx.IsResourceServed(source.GroupVersionResource())
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				gvr := source.GroupVersionResource()
+				klog.Warningf("Not triggering %s/%s %s by annotation: the resource is not served", gvr.Group, gvr.Version, gvr.Resource)
+				continue
+			}
+		}
+		served = append(served, source)
+	}
+	return served, nil
+}
+
+// builtInAnnotationTriggerInformer returns the informer of a built in annotation trigger source,
+// and whether objects controlled by another object, such as the ReplicaSets of Deployments, are
+// skipped. An error is returned if the resource is not a built in source.
+func builtInAnnotationTriggerInformer(ctx *ControllerContext, resource schema.GroupResource) (cache.SharedIndexInformer, bool, error) {
+	switch resource {
+	case schema.GroupResource{Group: "apps", Resource: "deployments"}:
+		return ctx.KubernetesInformers.Apps().V1().Deployments().Informer(), false, nil
+	case schema.GroupResource{Group: "apps", Resource: "daemonsets"}:
+		return ctx.KubernetesInformers.Apps().V1().DaemonSets().Informer(), false, nil
+	case schema.GroupResource{Group: "apps", Resource: "statefulsets"}:
+		return ctx.KubernetesInformers.Apps().V1().StatefulSets().Informer(), false, nil
+	case schema.GroupResource{Group: "apps", Resource: "replicasets"}:
+		return ctx.KubernetesInformers.Apps().V1().ReplicaSets().Informer(), true, nil
+	case schema.GroupResource{Group: "batch", Resource: "cronjobs"}:
+		return ctx.KubernetesInformers.Batch().V1().CronJobs().Informer(), false, nil
+	case schema.GroupResource{Group: "batch", Resource: "jobs"}:
+		return ctx.KubernetesInformers.Batch().V1().Jobs().Informer(), true, nil
+	case schema.GroupResource{Group: "", Resource: "pods"}:
+		return ctx.KubernetesInformers.Core().V1().Pods().Informer(), true, nil
+	default:
+		return nil, false, fmt.Errorf("%s is not a built in annotation trigger source", resource)
+	}
+}
+
 type podSpecUpdater struct {
 	kclient kclientsetexternal.Interface
 }
@@ -117,6 +202,9 @@ func (u podSpecUpdater) Update(obj runtime.Object) error {
 	case *kappsv1beta2.Deployment:
 		_, err := u.kclient.AppsV1beta2().Deployments(t.Namespace).Update(context.TODO(), t, kmetav1.UpdateOptions{})
 		return err
+	case *kappsv1.ReplicaSet:
+		_, err := u.kclient.AppsV1().ReplicaSets(t.Namespace).Update(context.TODO(), t, kmetav1.UpdateOptions{})
+		return err
 	case *kappsv1.StatefulSet:
 		_, err := u.kclient.AppsV1().StatefulSets(t.Namespace).Update(context.TODO(), t, kmetav1.UpdateOptions{})
 		return err
@@ -144,18 +232,37 @@ func (u podSpecUpdater) Update(obj runtime.Object) error {
 }
 
 func RunImageSignatureImportController(ctx *ControllerContext) (bool, error) {
-	// TODO these should really be configurable
-	resyncPeriod := 1 * time.Hour
-	signatureFetchTimeout := 1 * time.Minute
-	signatureImportLimit := 10
+	config := ctx.ExtendedConfig.ImageImport.SignatureImport
+	if err := imagesignaturecontroller.ValidateConfig(config); err != nil {
+		return true, err
+	}
+	var verifier *imagesignaturecontroller.Verifier
+	if len(config.TrustPolicies) > 0 {
+		var err error
+		if verifier, err = imagesignaturecontroller.NewVerifier(config.TrustPolicies); err != nil {
+			return true, err
+		}
+	}
+	registryAccess, err := imagesignaturecontroller.NewRegistryAccess(
+		ctx.ConfigInformers.Config().V1().Images(),
+		ctx.OperatorInformers.Operator().V1alpha1().ImageContentSourcePolicies(),
+		ctx.ConfigInformers.Config().V1().ImageDigestMirrorSets(),
+		ctx.ConfigInformers.Config().V1().ImageTagMirrorSets(),
+		ctx.OpenshiftConfigKubernetesInformers.Core().V1().Secrets(),
+	)
+	if err != nil {
+		return true, err
+	}
 
 	controller := imagesignaturecontroller.NewSignatureImportController(
 		context.Background(),
 		ctx.ClientBuilder.OpenshiftImageClientOrDie(infraImageImportControllerServiceAccountName),
 		ctx.ImageInformers.Image().V1().Images(),
-		resyncPeriod,
-		signatureFetchTimeout,
-		signatureImportLimit,
+		registryAccess,
+		verifier,
+		config.ResyncPeriod(),
+		config.FetchTimeout(),
+		config.Limit(),
 	)
 	go controller.Run(5, ctx.Stop)
 	return true, nil
@@ -169,20 +276,40 @@ func RunImageImportController(ctx *ControllerContext) (bool, error) {
 	)
 	go controller.Run(50, ctx.Stop)
 
+	// Controllers are only started on the leader, so only the leader receives push
+	// notifications.
+	if webhookConfig := ctx.ExtendedConfig.ImageImport.PushWebhook; len(webhookConfig.BindAddress) > 0 {
+		receiver, err := imagewebhook.NewReceiver(webhookConfig, controller)
+		if err != nil {
+			return true, err
+		}
+		go receiver.Run(ctx.Stop)
+	}
+
 	// TODO control this using enabled and disabled controllers
 	if ctx.OpenshiftControllerConfig.ImageImport.DisableScheduledImport {
 		return true, nil
 	}
 
+	if err := imagecontroller.ValidateRegistryLimitsConfig(ctx.ExtendedConfig.ImageImport.RegistryLimits); err != nil {
+		return true, err
+	}
+	if err := imagecontroller.ValidateTriggerPriorityConfig(ctx.ExtendedConfig.ImageImport.TriggerPriority); err != nil {
+		return true, err
+	}
+	kclient := ctx.ClientBuilder.ClientOrDie(infraImageImportControllerServiceAccountName)
 	scheduledController := imagecontroller.NewScheduledImageStreamController(
 		ctx.ClientBuilder.OpenshiftImageClientOrDie(infraImageImportControllerServiceAccountName),
 		informer,
+		imagetriggercontroller.NewTriggerEventBroadcaster(kclient.CoreV1()),
 		imagecontroller.ScheduledImageStreamControllerOptions{
 			Resync: time.Duration(ctx.OpenshiftControllerConfig.ImageImport.ScheduledImageImportMinimumIntervalSeconds) * time.Second,
 
 			Enabled:                  !ctx.OpenshiftControllerConfig.ImageImport.DisableScheduledImport,
-			DefaultBucketSize:        4,
 			MaxImageImportsPerMinute: ctx.OpenshiftControllerConfig.ImageImport.MaxScheduledImageImportsPerMinute,
+			RegistryLimits:           ctx.ExtendedConfig.ImageImport.RegistryLimits,
+			TagReferences:            ctx.imageTagReferences,
+			TriggerPriority:          ctx.ExtendedConfig.ImageImport.TriggerPriority,
 		},
 	)
 
@@ -191,3 +318,69 @@ func RunImageImportController(ctx *ControllerContext) (bool, error) {
 
 	return true, nil
 }
+
+func RunImageTagRetentionController(ctx *ControllerContext) (bool, error) {
+	config := ctx.ExtendedConfig.ImageTagRetention
+	if err := imagetagretention.ValidateConfig(config); err != nil {
+		return true, err
+	}
+
+	// the history items referenced by builds are only known when builds are watched
+	references := []cache.SharedIndexInformer{
+		ctx.KubernetesInformers.Core().V1().Pods().Informer(),
+		ctx.KubernetesInformers.Core().V1().ReplicationControllers().Informer(),
+		ctx.KubernetesInformers.Apps().V1().Deployments().Informer(),
+		ctx.KubernetesInformers.Apps().V1().ReplicaSets().Informer(),
+	}
+	if ctx.IsControllerEnabled(string(openshiftcontrolplanev1.OpenShiftBuildController)) {
+		references = append(references, ctx.BuildInformers.Build().V1().Builds().Informer())
+	}
+
+	kclient := ctx.ClientBuilder.ClientOrDie(infraImageTagRetentionControllerServiceAccountName)
+	controller, err := imagetagretention.NewTagRetentionController(
+		ctx.ClientBuilder.OpenshiftImageClientOrDie(infraImageTagRetentionControllerServiceAccountName).ImageV1(),
+		ctx.ImageInformers.Image().V1().ImageStreams(),
+		references,
+		imagetriggercontroller.NewTriggerEventBroadcaster(kclient.CoreV1()),
+		config,
+	)
+	if err != nil {
+		return true, err
+	}
+	go controller.Run(5, ctx.Stop)
+	return true, nil
+}
+
+// deferredTagReferences hands the tags referenced by the image trigger controller to the
+// scheduled import controller, which may be started before it. No tags are known until the
+// trigger controller is set, so every scheduled tag is imported alike.
+type deferredTagReferences struct {
+	lock       sync.RWMutex
+	references imagecontroller.TagReferences
+}
+
+var _ imagecontroller.TagReferences = &deferredTagReferences{}
+
+func (d *deferredTagReferences) set(references imagecontroller.TagReferences) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.references = references
+}
+
+func (d *deferredTagReferences) get() imagecontroller.TagReferences {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.references
+}
+
+func (d *deferredTagReferences) ReferencedTags(namespace, name string) sets.String {
+	if references := d.get(); references != nil {
+		return references.ReferencedTags(namespace, name)
+	}
+	return sets.NewString()
+}
+
+func (d *deferredTagReferences) HasSynced() bool {
+	references := d.get()
+	return references != nil && references.HasSynced()
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	imagetriggercontroller "github.com/openshift/openshift-controller-manager/pkg/image/controller/trigger"
+)
+
+func TestServedAnnotationSources(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+	ctx := &ControllerContext{RestMapper: mapper}
+
+	deployments := imagetriggercontroller.AnnotationSource{Group: "apps", Resource: "deployments"}
+	rollouts := imagetriggercontroller.AnnotationSource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts", PodSpecPath: "spec.template.spec"}
+	services := imagetriggercontroller.AnnotationSource{Group: "serving.knative.dev", Version: "v1", Resource: "services", PodSpecPath: "spec.template.spec"}
+
+	// The Knative Services are skipped, since their CustomResourceDefinition is missing.
+	served, err := servedAnnotationSources(ctx, []imagetriggercontroller.AnnotationSource{deployments, rollouts, services})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []imagetriggercontroller.AnnotationSource{deployments, rollouts}
+	if !reflect.DeepEqual(served, expected) {
+		t.Errorf("expected sources %v, got %v", expected, served)
+	}
+}
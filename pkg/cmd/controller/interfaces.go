@@ -8,16 +8,20 @@ import (
 	"k8s.io/klog/v2"
 
 	"k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/util/sets"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
 	cacheddiscovery "k8s.io/client-go/discovery/cached"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/controller-manager/app"
 	"k8s.io/controller-manager/pkg/clientbuilder"
 
+	appsv1 "github.com/openshift/api/apps/v1"
+	buildv1 "github.com/openshift/api/build/v1"
 	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
 	appsclient "github.com/openshift/client-go/apps/clientset/versioned"
 	appsinformer "github.com/openshift/client-go/apps/informers/externalversions"
@@ -37,6 +41,7 @@ import (
 func NewControllerContext(
 	ctx context.Context,
 	config openshiftcontrolplanev1.OpenShiftControllerManagerConfig,
+	extendedConfig ExtendedControllerConfig,
 	inClientConfig *rest.Config,
 ) (*ControllerContext, error) {
 
@@ -97,8 +102,12 @@ func NewControllerContext(
 		highRateLimitClientConfig.Burst = 200
 	}
 
+	// Drop the fields of cached objects which none of the enabled controllers need.
+	transform := newInformerTransform(informerFieldsFor(config))
+
 	openshiftControllerContext := &ControllerContext{
 		OpenshiftControllerConfig: config,
+		ExtendedConfig:            extendedConfig,
 
 		// k8s 1.21 rebase - SAControllerClientBuilder replaced with NewDynamicClientBuilder
 		// See https://github.com/kubernetes/kubernetes/pull/99291
@@ -114,19 +123,22 @@ func NewControllerContext(
 				kubeClient.CoreV1(),
 				defaultOpenShiftInfraNamespace),
 		},
-		KubernetesInformers:                informers.NewSharedInformerFactory(kubeClient, defaultInformerResyncPeriod),
-		OpenshiftConfigKubernetesInformers: informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultInformerResyncPeriod, informers.WithNamespace("openshift-config")),
-		ControllerManagerKubeInformers:     informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultInformerResyncPeriod, informers.WithNamespace("openshift-controller-manager")),
-		AppsInformers:                      appsinformer.NewSharedInformerFactory(appsClient, defaultInformerResyncPeriod),
-		BuildInformers:                     buildinformer.NewSharedInformerFactory(buildClient, defaultInformerResyncPeriod),
-		ConfigInformers:                    configinformer.NewSharedInformerFactory(configClient, defaultInformerResyncPeriod),
-		ImageInformers:                     imageinformer.NewSharedInformerFactory(imageClient, defaultInformerResyncPeriod),
-		OperatorInformers:                  operatorinformer.NewSharedInformerFactory(operatorClient, defaultInformerResyncPeriod),
-		TemplateInformers:                  templateinformer.NewSharedInformerFactory(templateClient, defaultInformerResyncPeriod),
+		KubernetesInformers:                informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultInformerResyncPeriod, informers.WithTransform(transform)),
+		OpenshiftConfigKubernetesInformers: informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultInformerResyncPeriod, informers.WithNamespace("openshift-config"), informers.WithTransform(transform)),
+		ControllerManagerKubeInformers:     informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultInformerResyncPeriod, informers.WithNamespace("openshift-controller-manager"), informers.WithTransform(transform)),
+		BuildPodKubeInformers:              newLabelFilteredKubeInformers(kubeClient, defaultInformerResyncPeriod, buildv1.BuildLabel, transform),
+		DeployerPodKubeInformers:           newLabelFilteredKubeInformers(kubeClient, defaultInformerResyncPeriod, appsv1.DeployerPodForDeploymentLabel, transform),
+		AppsInformers:                      appsinformer.NewSharedInformerFactoryWithOptions(appsClient, defaultInformerResyncPeriod, appsinformer.WithTransform(transform)),
+		BuildInformers:                     buildinformer.NewSharedInformerFactoryWithOptions(buildClient, defaultInformerResyncPeriod, buildinformer.WithTransform(transform)),
+		ConfigInformers:                    configinformer.NewSharedInformerFactoryWithOptions(configClient, defaultInformerResyncPeriod, configinformer.WithTransform(transform)),
+		ImageInformers:                     imageinformer.NewSharedInformerFactoryWithOptions(imageClient, defaultInformerResyncPeriod, imageinformer.WithTransform(transform)),
+		OperatorInformers:                  operatorinformer.NewSharedInformerFactoryWithOptions(operatorClient, defaultInformerResyncPeriod, operatorinformer.WithTransform(transform)),
+		TemplateInformers:                  templateinformer.NewSharedInformerFactoryWithOptions(templateClient, defaultInformerResyncPeriod, templateinformer.WithTransform(transform)),
 		Stop:                               ctx.Done(),
 		Context:                            ctx,
 		InformersStarted:                   make(chan struct{}),
 		RestMapper:                         dynamicRestMapper,
+		imageTagReferences:                 &deferredTagReferences{},
 	}
 
 	return openshiftControllerContext, nil
@@ -134,6 +146,8 @@ func NewControllerContext(
 
 type ControllerContext struct {
 	OpenshiftControllerConfig openshiftcontrolplanev1.OpenShiftControllerManagerConfig
+	// ExtendedConfig holds the settings of controller features not covered by OpenshiftControllerConfig
+	ExtendedConfig ExtendedControllerConfig
 
 	// ClientBuilder will provide a client for this controller to use
 	ClientBuilder ControllerClientBuilder
@@ -144,6 +158,12 @@ type ControllerContext struct {
 	KubernetesInformers                informers.SharedInformerFactory
 	OpenshiftConfigKubernetesInformers informers.SharedInformerFactory
 	ControllerManagerKubeInformers     informers.SharedInformerFactory
+	// BuildPodKubeInformers and DeployerPodKubeInformers only cache objects carrying
+	// the build and deployer pod labels respectively. Controllers which only care
+	// about their own pods should use these rather than KubernetesInformers, which
+	// caches every pod of the cluster.
+	BuildPodKubeInformers    informers.SharedInformerFactory
+	DeployerPodKubeInformers informers.SharedInformerFactory
 
 	TemplateInformers templateinformer.SharedInformerFactory
 
@@ -155,6 +175,10 @@ type ControllerContext struct {
 
 	RestMapper meta.RESTMapper
 
+	// imageTagReferences reports the image stream tags referenced by the image trigger
+	// controller to the scheduled image import controller.
+	imageTagReferences *deferredTagReferences
+
 	// Stop is the stop channel
 	Stop    <-chan struct{}
 	Context context.Context
@@ -174,8 +198,12 @@ func (c *ControllerContext) StartInformers(stopCh <-chan struct{}) {
 	if c.IsControllerEnabled(string(openshiftcontrolplanev1.OpenShiftDeploymentConfigController)) {
 		c.AppsInformers.Start(stopCh)
 	}
+	if c.IsControllerEnabled(string(openshiftcontrolplanev1.OpenShiftDeployerController)) {
+		c.DeployerPodKubeInformers.Start(stopCh)
+	}
 	if c.IsControllerEnabled(string(openshiftcontrolplanev1.OpenShiftBuildController)) {
 		c.BuildInformers.Start(stopCh)
+		c.BuildPodKubeInformers.Start(stopCh)
 	}
 	c.ConfigInformers.Start(stopCh)
 	c.ImageInformers.Start(stopCh)
@@ -191,8 +219,29 @@ func (c *ControllerContext) StartInformers(stopCh <-chan struct{}) {
 	}
 }
 
+// newLabelFilteredKubeInformers returns an informer factory whose informers only
+// list and watch objects which carry the given label.
+func newLabelFilteredKubeInformers(client kubernetes.Interface, resync time.Duration, label string, transform cache.TransformFunc) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(client, resync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = label
+	}), informers.WithTransform(transform))
+}
+
 func (c *ControllerContext) IsControllerEnabled(name string) bool {
-	return app.IsControllerEnabled(name, sets.String{}, c.OpenshiftControllerConfig.Controllers)
+	return app.IsControllerEnabled(name, ControllersDisabledByDefault, c.OpenshiftControllerConfig.Controllers)
+}
+
+// IsResourceServed returns true if the API server serves the given resource. Informers of
+// resources defined by optional CustomResourceDefinitions must only be created once the
+// resource is served, since they would otherwise never sync.
+func (c *ControllerContext) IsResourceServed(gvr schema.GroupVersionResource) (bool, error) {
+	if _, err := c.RestMapper.KindFor(gvr); err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
 }
 
 type ControllerClientBuilder interface {
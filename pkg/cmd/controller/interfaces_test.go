@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	appsv1 "github.com/openshift/api/apps/v1"
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	testClusterPods  = 5000
+	testBuildPods    = 20
+	testDeployerPods = 10
+)
+
+func testClusterPodObjects() []kruntime.Object {
+	pad := make([]byte, 1024)
+	for i := range pad {
+		pad[i] = 'x'
+	}
+	var objects []kruntime.Object
+	newPod := func(name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   fmt.Sprintf("ns-%d", len(objects)%50),
+				Labels:      labels,
+				Annotations: map[string]string{"padding": string(pad)},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "image"}}},
+		}
+	}
+	for i := 0; i < testClusterPods; i++ {
+		objects = append(objects, newPod(fmt.Sprintf("app-%d", i), map[string]string{"app": "app"}))
+	}
+	for i := 0; i < testBuildPods; i++ {
+		objects = append(objects, newPod(fmt.Sprintf("build-%d-build", i), map[string]string{buildv1.BuildLabel: fmt.Sprintf("build-%d", i)}))
+	}
+	for i := 0; i < testDeployerPods; i++ {
+		objects = append(objects, newPod(fmt.Sprintf("dc-%d-deploy", i), map[string]string{appsv1.DeployerPodForDeploymentLabel: fmt.Sprintf("dc-%d", i)}))
+	}
+	return objects
+}
+
+// syncedPodStore starts the pod informer of the factory and returns its store once synced.
+func syncedPodStore(t *testing.T, factory informers.SharedInformerFactory, stopCh chan struct{}) cache.Store {
+	informer := factory.Core().V1().Pods().Informer()
+	factory.Start(stopCh)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		t.Fatalf("timed out waiting for the pod informer to sync")
+	}
+	return informer.GetStore()
+}
+
+func TestLabelFilteredKubeInformers(t *testing.T) {
+	client := fake.NewSimpleClientset(testClusterPodObjects()...)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	for label, expected := range map[string]int{
+		buildv1.BuildLabel:                   testBuildPods,
+		appsv1.DeployerPodForDeploymentLabel: testDeployerPods,
+	} {
+		store := syncedPodStore(t, newLabelFilteredKubeInformers(client, 0, label, nil), stopCh)
+		if actual := len(store.List()); actual != expected {
+			t.Errorf("expected %d pods labelled %s to be cached, got %d", expected, label, actual)
+		}
+	}
+}
+
+// TestLabelFilteredKubeInformersMemory guards against build pod informers caching
+// the pods of the whole cluster again: the heap retained by the filtered informer
+// has to stay a small fraction of the heap retained by a cluster-wide informer.
+func TestLabelFilteredKubeInformersMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the memory regression test in short mode")
+	}
+	client := fake.NewSimpleClientset(testClusterPodObjects()...)
+
+	retainedHeap := func(factory informers.SharedInformerFactory) (uint64, int) {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		before := heapInUse()
+		store := syncedPodStore(t, factory, stopCh)
+		after := heapInUse()
+		cached := len(store.List())
+		runtime.KeepAlive(store)
+		if after < before {
+			return 0, cached
+		}
+		return after - before, cached
+	}
+
+	filtered, filteredPods := retainedHeap(newLabelFilteredKubeInformers(client, 0, buildv1.BuildLabel, nil))
+	unfiltered, unfilteredPods := retainedHeap(informers.NewSharedInformerFactory(client, 0))
+	if filteredPods != testBuildPods || unfilteredPods != testClusterPods+testBuildPods+testDeployerPods {
+		t.Fatalf("unexpected cache contents: %d filtered and %d unfiltered pods", filteredPods, unfilteredPods)
+	}
+	t.Logf("filtered informer retained %d bytes, cluster-wide informer retained %d bytes", filtered, unfiltered)
+	if filtered*10 > unfiltered {
+		t.Errorf("expected the filtered informer to retain less than a tenth of the heap of a cluster-wide informer, got %d and %d bytes", filtered, unfiltered)
+	}
+}
+
+func TestIsResourceServed(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "tekton.dev", Version: "v1", Kind: "PipelineRun"}, meta.RESTScopeNamespace)
+	ctx := &ControllerContext{RestMapper: mapper}
+
+	tests := []struct {
+		gvr    schema.GroupVersionResource
+		served bool
+	}{
+		{gvr: schema.GroupVersionResource{Group: "tekton.dev", Version: "v1", Resource: "pipelineruns"}, served: true},
+		{gvr: schema.GroupVersionResource{Group: "tekton.dev", Version: "v1beta1", Resource: "pipelineruns"}},
+		{gvr: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}},
+	}
+	for _, tc := range tests {
+		served, err := ctx.IsResourceServed(tc.gvr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.gvr, err)
+		}
+		if served != tc.served {
+			t.Errorf("%s: expected served %v, got %v", tc.gvr, tc.served, served)
+		}
+	}
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/controller-manager/app"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
+)
+
+// InformerField is a field of cached objects which the informer transforms drop
+// unless a running controller declares that it needs it.
+type InformerField string
+
+const (
+	// ManagedFields is metadata.managedFields. Controllers extracting apply
+	// configurations from cached objects need it.
+	ManagedFields InformerField = "metadata.managedFields"
+	// LastAppliedConfiguration is the kubectl last-applied-configuration annotation.
+	// Controllers writing cached objects back with Update need it, as the update
+	// would otherwise remove the annotation.
+	LastAppliedConfiguration InformerField = "metadata.annotations[" + corev1.LastAppliedConfigAnnotation + "]"
+	// ImageStreamTagHistory are the tag events of ImageStream status tags other
+	// than the latest one.
+	ImageStreamTagHistory InformerField = "status.tags[*].items[1:]"
+)
+
+// InformerFields lists the stripped fields needed from cached objects, by the
+// kind of the object.
+type InformerFields map[string][]InformerField
+
+// Has returns true if the field of objects of the kind is needed.
+func (f InformerFields) Has(kind string, field InformerField) bool {
+	for _, needed := range f[kind] {
+		if needed == field {
+			return true
+		}
+	}
+	return false
+}
+
+// informerFieldsFor returns the fields needed by the controllers enabled in the config.
+func informerFieldsFor(config openshiftcontrolplanev1.OpenShiftControllerManagerConfig) InformerFields {
+	fields := InformerFields{}
+	for name, controllerFields := range ControllerInformerFields {
+		if !app.IsControllerEnabled(string(name), ControllersDisabledByDefault, config.Controllers) {
+			continue
+		}
+		for kind, kindFields := range controllerFields {
+			for _, field := range kindFields {
+				if !fields.Has(kind, field) {
+					fields[kind] = append(fields[kind], field)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// newInformerTransform returns an informer transform which drops the fields of
+// cached objects that no controller needs.
+func newInformerTransform(needed InformerFields) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			// e.g. tombstones of deleted objects, which hold an already transformed object
+			return obj, nil
+		}
+		kind := reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+
+		if !needed.Has(kind, ManagedFields) {
+			accessor.SetManagedFields(nil)
+		}
+		if !needed.Has(kind, LastAppliedConfiguration) {
+			if annotations := accessor.GetAnnotations(); annotations != nil {
+				if _, ok := annotations[corev1.LastAppliedConfigAnnotation]; ok {
+					delete(annotations, corev1.LastAppliedConfigAnnotation)
+					accessor.SetAnnotations(annotations)
+				}
+			}
+		}
+		if stream, ok := obj.(*imagev1.ImageStream); ok && !needed.Has(kind, ImageStreamTagHistory) {
+			for i := range stream.Status.Tags {
+				if items := stream.Status.Tags[i].Items; len(items) > 1 {
+					// copy rather than reslice, so that the history can be released
+					stream.Status.Tags[i].Items = []imagev1.TagEvent{items[0]}
+				}
+			}
+		}
+		return obj, nil
+	}
+}
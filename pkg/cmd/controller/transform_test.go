@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
+)
+
+func TestInformerTransform(t *testing.T) {
+	newStream := func() *imagev1.ImageStream {
+		return &imagev1.ImageStream{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:          "stream",
+				Annotations:   map[string]string{corev1.LastAppliedConfigAnnotation: "{}", "other": "value"},
+				ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+			},
+			Status: imagev1.ImageStreamStatus{
+				Tags: []imagev1.NamedTagEventList{
+					{Tag: "latest", Items: []imagev1.TagEvent{{Image: "sha256:2"}, {Image: "sha256:1"}}},
+					{Tag: "empty"},
+				},
+			},
+		}
+	}
+
+	obj, err := newInformerTransform(InformerFields{})(newStream())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stripped := obj.(*imagev1.ImageStream)
+	if stripped.ManagedFields != nil {
+		t.Errorf("expected managed fields to be dropped, got %v", stripped.ManagedFields)
+	}
+	if _, ok := stripped.Annotations[corev1.LastAppliedConfigAnnotation]; ok || stripped.Annotations["other"] != "value" {
+		t.Errorf("expected only the last applied configuration to be dropped, got %v", stripped.Annotations)
+	}
+	if items := stripped.Status.Tags[0].Items; len(items) != 1 || items[0].Image != "sha256:2" {
+		t.Errorf("expected only the latest tag event to be kept, got %v", items)
+	}
+
+	obj, err = newInformerTransform(InformerFields{
+		"ImageStream": {ManagedFields, LastAppliedConfiguration, ImageStreamTagHistory},
+	})(newStream())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kept := obj.(*imagev1.ImageStream)
+	if len(kept.ManagedFields) != 1 || len(kept.Annotations) != 2 || len(kept.Status.Tags[0].Items) != 2 {
+		t.Errorf("expected the declared fields to be kept, got %#v", kept)
+	}
+
+	tombstone := cache.DeletedFinalStateUnknown{Key: "ns/stream", Obj: newStream()}
+	if obj, err := newInformerTransform(InformerFields{})(tombstone); err != nil || obj != tombstone {
+		t.Errorf("expected tombstones to be passed through, got %v, %v", obj, err)
+	}
+}
+
+func TestInformerFieldsFor(t *testing.T) {
+	config := openshiftcontrolplanev1.OpenShiftControllerManagerConfig{
+		Controllers: []string{"*", "-" + string(openshiftcontrolplanev1.OpenShiftBuildController), "-" + string(OpenShiftImageTagRetentionController)},
+	}
+	fields := informerFieldsFor(config)
+	if fields.Has("ImageStream", ImageStreamTagHistory) {
+		t.Errorf("expected the tag history of disabled controllers not to be kept")
+	}
+	if fields := informerFieldsFor(openshiftcontrolplanev1.OpenShiftControllerManagerConfig{Controllers: []string{"*"}}); !fields.Has("ImageStream", ImageStreamTagHistory) {
+		t.Errorf("expected the tag history of enabled controllers to be kept")
+	}
+	config = openshiftcontrolplanev1.OpenShiftControllerManagerConfig{
+		Controllers: []string{"*", "-" + string(openshiftcontrolplanev1.OpenShiftBuildController)},
+	}
+	if fields := informerFieldsFor(config); fields.Has("ImageStream", ImageStreamTagHistory) {
+		t.Errorf("expected the tag history of controllers disabled by default not to be kept")
+	}
+	config.Controllers = append(config.Controllers, string(OpenShiftImageTagRetentionController))
+	if fields := informerFieldsFor(config); !fields.Has("ImageStream", ImageStreamTagHistory) {
+		t.Errorf("expected the tag history of controllers enabled by name to be kept")
+	}
+	if !fields.Has("Deployment", LastAppliedConfiguration) {
+		t.Errorf("expected the fields of enabled controllers to be kept")
+	}
+}
+
+// controllerSources lists the sources of each controller, relative to the
+// repository root. Directories are not walked recursively.
+var controllerSources = map[openshiftcontrolplanev1.OpenShiftControllerName][]string{
+	openshiftcontrolplanev1.OpenShiftServiceAccountController:            {"vendor/k8s.io/kubernetes/pkg/controller/serviceaccount"},
+	openshiftcontrolplanev1.OpenShiftDefaultRoleBindingsController:       {"pkg/authorization/defaultrolebindings"},
+	openshiftcontrolplanev1.OpenShiftServiceAccountPullSecretsController: {"pkg/internalregistry/controllers", "pkg/internalregistry/controllers/rollback"},
+	openshiftcontrolplanev1.OpenShiftOriginNamespaceController:           {"pkg/project/controller"},
+	openshiftcontrolplanev1.OpenShiftBuilderServiceAccountController:     {"vendor/k8s.io/kubernetes/pkg/controller/serviceaccount"},
+	openshiftcontrolplanev1.OpenShiftBuildController: {
+		"pkg/build/controller/build",
+		"pkg/build/controller/build/defaults",
+		"pkg/build/controller/build/logarchive",
+		"pkg/build/controller/build/multiarch",
+		"pkg/build/controller/build/overrides",
+		"pkg/build/controller/build/provenance",
+		"pkg/build/controller/common",
+		"pkg/build/controller/policy",
+		"pkg/build/controller/strategy",
+		"pkg/image/registryconf",
+	},
+	openshiftcontrolplanev1.OpenShiftBuildConfigChangeController:         {"pkg/build/controller/buildconfig", "pkg/build/controller/common"},
+	openshiftcontrolplanev1.OpenShiftBuilderRoleBindingsController:       {"pkg/authorization/defaultrolebindings"},
+	openshiftcontrolplanev1.OpenShiftDeployerServiceAccountController:    {"vendor/k8s.io/kubernetes/pkg/controller/serviceaccount"},
+	openshiftcontrolplanev1.OpenShiftDeployerController:                  {"pkg/apps/deployer"},
+	openshiftcontrolplanev1.OpenShiftDeploymentConfigController:          {"pkg/apps/deploymentconfig"},
+	openshiftcontrolplanev1.OpenShiftDeployerRoleBindingsController:      {"pkg/authorization/defaultrolebindings"},
+	openshiftcontrolplanev1.OpenShiftImageTriggerController:              {"pkg/cmd/controller/image.go", "pkg/image/controller/trigger", "pkg/image/trigger", "pkg/image/trigger/annotations", "pkg/image/trigger/buildconfigs", "pkg/image/trigger/deploymentconfigs"},
+	openshiftcontrolplanev1.OpenShiftImageImportController:               {"pkg/image/controller"},
+	openshiftcontrolplanev1.OpenShiftImageSignatureImportController:      {"pkg/image/controller/signature", "pkg/image/registryconf"},
+	openshiftcontrolplanev1.OpenShiftImagePullerRoleBindingsController:   {"pkg/authorization/defaultrolebindings"},
+	OpenShiftImageTagRetentionController:                                 {"pkg/image/controller/retention"},
+	openshiftcontrolplanev1.OpenShiftTemplateInstanceController:          {"pkg/template/controller"},
+	openshiftcontrolplanev1.OpenShiftTemplateInstanceFinalizerController: {"pkg/template/controller"},
+	openshiftcontrolplanev1.OpenShiftUnidlingController:                  {"pkg/unidling/controller"},
+}
+
+// anyKind marks field reads whose object kind cannot be told from the source.
+const anyKind = "*"
+
+// fieldRead is a stripped field which the source of a controller needs.
+type fieldRead struct {
+	kind     string
+	field    InformerField
+	position token.Position
+}
+
+// TestControllersDeclareStrippedFields checks that no controller reads a field
+// dropped by the informer transforms without declaring it. Reads are found in
+// the controller sources by their syntax:
+//   - managed fields are read through ManagedFields, GetManagedFields and the
+//     Extract functions of apply configurations,
+//   - the last applied configuration is read through its annotation key, and is
+//     written back by Update and UpdateStatus calls on typed clients,
+//   - the tag history is read by any use of the items of a status tag other than
+//     its latest event or their count.
+func TestControllersDeclareStrippedFields(t *testing.T) {
+	for name := range ControllerInitializers {
+		if _, ok := controllerSources[name]; !ok {
+			t.Errorf("the sources of controller %s are not listed", name)
+		}
+	}
+
+	root := filepath.Join("..", "..", "..")
+	for name, sources := range controllerSources {
+		declared := ControllerInformerFields[name]
+		for _, source := range sources {
+			for _, read := range fieldReads(t, filepath.Join(root, source)) {
+				if read.kind == anyKind {
+					found := false
+					for kind := range declared {
+						found = found || declared.Has(kind, read.field)
+					}
+					if !found {
+						t.Errorf("%s: controller %s needs %s without declaring it", read.position, name, read.field)
+					}
+					continue
+				}
+				if !declared.Has(read.kind, read.field) {
+					t.Errorf("%s: controller %s needs %s of %s without declaring it", read.position, name, read.field, read.kind)
+				}
+			}
+		}
+	}
+}
+
+func fieldReads(t *testing.T, path string) []fieldRead {
+	var files []string
+	if strings.HasSuffix(path, ".go") {
+		files = []string{path}
+	} else {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			t.Fatalf("unable to read the controller sources: %v", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") && !strings.HasSuffix(entry.Name(), "_test.go") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	var reads []fieldRead
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("unable to parse %s: %v", file, err)
+		}
+		add := func(node ast.Node, kind string, field InformerField) {
+			reads = append(reads, fieldRead{kind: kind, field: field, position: fset.Position(node.Pos())})
+		}
+		// names bound to the status tags of image streams
+		tagLists := map[string]bool{}
+		ast.Inspect(f, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.RangeStmt:
+				if isStatusTags(n.X) {
+					if value, ok := n.Value.(*ast.Ident); ok {
+						tagLists[value.Name] = true
+					}
+				}
+			case *ast.BasicLit:
+				if n.Kind == token.STRING && strings.Contains(n.Value, corev1.LastAppliedConfigAnnotation) {
+					add(n, anyKind, LastAppliedConfiguration)
+				}
+			case *ast.SelectorExpr:
+				switch name := n.Sel.Name; {
+				case name == "LastAppliedConfigAnnotation":
+					add(n, anyKind, LastAppliedConfiguration)
+				case name == "ManagedFields" || name == "GetManagedFields":
+					add(n, anyKind, ManagedFields)
+				}
+			case *ast.CallExpr:
+				fun, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok {
+					break
+				}
+				if pkg, ok := fun.X.(*ast.Ident); ok && strings.Contains(pkg.Name, "apply") && strings.HasPrefix(fun.Sel.Name, "Extract") {
+					add(n, strings.TrimSuffix(strings.TrimPrefix(fun.Sel.Name, "Extract"), "Status"), ManagedFields)
+				}
+				if fun.Sel.Name == "Update" || fun.Sel.Name == "UpdateStatus" {
+					if client, ok := fun.X.(*ast.CallExpr); ok {
+						// dynamic clients are scoped by Namespace, and their informers are not transformed
+						if resource, ok := client.Fun.(*ast.SelectorExpr); ok && resource.Sel.Name != "Namespace" {
+							add(n, kindForClient(resource.Sel.Name), LastAppliedConfiguration)
+						}
+					}
+				}
+				// len(tags.Items) only counts the events
+				if ident, ok := n.Fun.(*ast.Ident); ok && ident.Name == "len" {
+					return false
+				}
+			}
+			return true
+		})
+		ast.Inspect(f, func(node ast.Node) bool {
+			if index, ok := node.(*ast.IndexExpr); ok {
+				if lit, ok := index.Index.(*ast.BasicLit); ok && lit.Value == "0" && isTagItems(index.X, tagLists) {
+					// the latest event is kept
+					return false
+				}
+			}
+			if call, ok := node.(*ast.CallExpr); ok {
+				if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "len" {
+					return false
+				}
+			}
+			if expr, ok := node.(ast.Expr); ok && isTagItems(expr, tagLists) {
+				add(node, "ImageStream", ImageStreamTagHistory)
+				return false
+			}
+			return true
+		})
+	}
+	return reads
+}
+
+// isStatusTags returns true for expressions of the form x.Status.Tags.
+func isStatusTags(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Tags" {
+		return false
+	}
+	status, ok := sel.X.(*ast.SelectorExpr)
+	return ok && status.Sel.Name == "Status"
+}
+
+// isTagItems returns true for the items of a status tag, either bound by ranging
+// over x.Status.Tags or indexed as x.Status.Tags[i].
+func isTagItems(expr ast.Expr, tagLists map[string]bool) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Items" {
+		return false
+	}
+	switch x := sel.X.(type) {
+	case *ast.Ident:
+		return tagLists[x.Name]
+	case *ast.IndexExpr:
+		return isStatusTags(x.X)
+	}
+	return false
+}
+
+// kindForClient returns the kind of the objects of a typed client, named after
+// its resource.
+func kindForClient(resource string) string {
+	if resource == "Endpoints" {
+		return resource
+	}
+	return strings.TrimSuffix(resource, "s")
+}
@@ -22,6 +22,10 @@ func RunOpenShiftControllerManager(ctx context.Context, controllerContext *contr
 	if err != nil {
 		return err
 	}
+	extendedConfig, err := asExtendedControllerConfig(controllerContext.ComponentConfig)
+	if err != nil {
+		return err
+	}
 
 	kubeClient, err := kubernetes.NewForConfig(controllerContext.KubeConfig)
 	if err != nil {
@@ -45,7 +49,7 @@ func RunOpenShiftControllerManager(ctx context.Context, controllerContext *contr
 		return err
 	}
 
-	ocmControllerContext, err := origincontrollers.NewControllerContext(ctx, *config, controllerContext.KubeConfig)
+	ocmControllerContext, err := origincontrollers.NewControllerContext(ctx, *config, *extendedConfig, controllerContext.KubeConfig)
 	if err != nil {
 		return err
 	}
@@ -8,6 +8,7 @@ import (
 
 	openshiftcontrolplanev1 "github.com/openshift/api/openshiftcontrolplane/v1"
 	"github.com/openshift/library-go/pkg/config/configdefaults"
+	origincontrollers "github.com/openshift/openshift-controller-manager/pkg/cmd/controller"
 )
 
 func asOpenshiftControllerManagerConfig(config *unstructured.Unstructured) (*openshiftcontrolplanev1.OpenShiftControllerManagerConfig, error) {
@@ -27,6 +28,26 @@ func asOpenshiftControllerManagerConfig(config *unstructured.Unstructured) (*ope
 	return result, nil
 }
 
+// asExtendedControllerConfig reads the "extendedConfig" stanza of the controller manager
+// configuration, which is ignored when decoding OpenShiftControllerManagerConfig.
+func asExtendedControllerConfig(config *unstructured.Unstructured) (*origincontrollers.ExtendedControllerConfig, error) {
+	result := &origincontrollers.ExtendedControllerConfig{}
+	if config == nil {
+		return result, nil
+	}
+	extended, found, err := unstructured.NestedMap(config.Object, "extendedConfig")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return result, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(extended, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func setRecommendedOpenShiftControllerConfigDefaults(config *openshiftcontrolplanev1.OpenShiftControllerManagerConfig) {
 	configdefaults.DefaultStringSlice(&config.Controllers, []string{"*"})
 
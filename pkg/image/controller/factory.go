@@ -1,11 +1,18 @@
 package controller
 
 import (
+	"fmt"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	"k8s.io/utils/clock"
 
 	imagev1client "github.com/openshift/client-go/image/clientset/versioned"
 	imagev1informer "github.com/openshift/client-go/image/informers/externalversions/image/v1"
@@ -14,38 +21,25 @@ import (
 // ImageStreamControllerOptions represents a configuration for the scheduled image stream
 // import controller.
 type ScheduledImageStreamControllerOptions struct {
+	// Resync is the minimum interval between scheduled imports of an image stream. Streams
+	// may ask for a longer interval with the ScheduledImportIntervalAnnotation.
 	Resync time.Duration
 
 	// Enabled indicates that the scheduled imports for images are allowed.
 	Enabled bool
 
-	// DefaultBucketSize is the default bucket size used by QPS.
-	DefaultBucketSize int
-
 	// MaxImageImportsPerMinute sets the maximum number of simultaneous image imports per
 	// minute.
 	MaxImageImportsPerMinute int
-}
 
-// Buckets returns the bucket size calculated based on the resync interval of the
-// scheduled image import controller. For resync interval bigger than our the bucket size
-// is doubled, for resync lower then 10 minutes bucket size is set to a half of the
-// default size.
-func (opts ScheduledImageStreamControllerOptions) Buckets() int {
-	buckets := opts.DefaultBucketSize // 4
-	switch {
-	case opts.Resync > time.Hour:
-		return buckets * 2
-	case opts.Resync < 10*time.Minute:
-		return buckets / 2
-	}
-	return buckets
-}
+	// RegistryLimits sets the rate limits and circuit breakers of imports per registry.
+	RegistryLimits RegistryLimitsConfig
 
-// BucketsToQPS converts the bucket size to QPS
-func (opts ScheduledImageStreamControllerOptions) BucketsToQPS() float32 {
-	seconds := float32(opts.Resync / time.Second)
-	return 1.0 / seconds * float32(opts.Buckets())
+	// TagReferences reports the tags referenced by image triggers, which are imported more
+	// often than unreferenced tags. If nil, all scheduled tags are imported alike.
+	TagReferences TagReferences
+	// TriggerPriority sets how much less often unreferenced tags are imported.
+	TriggerPriority TriggerPriorityConfig
 }
 
 // GetRateLimiter returns a flowcontrol rate limiter based on the maximum number of
@@ -68,11 +62,18 @@ func NewImageStreamController(client imagev1client.Interface, informer imagev1in
 		client:       client.ImageV1(),
 		lister:       informer.Lister(),
 		listerSynced: informer.Informer().HasSynced,
+		indexer:      informer.Informer().GetIndexer(),
+
+		pushed: make(map[string]sets.String),
 
 		importCounter: NewImportMetricCounter(),
 	}
 	controller.syncHandler = controller.syncImageStream
 
+	if err := informer.Informer().AddIndexers(cache.Indexers{pushedTagIndex: pushedTagIndexFunc}); err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to index image streams by their tags, imports on push are disabled: %v", err))
+	}
+
 	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    controller.addImageStream,
 		UpdateFunc: controller.updateImageStream,
@@ -83,19 +84,26 @@ func NewImageStreamController(client imagev1client.Interface, informer imagev1in
 
 // NewScheduledImageStreamController returns a new scheduled image stream import
 // controller.
-func NewScheduledImageStreamController(client imagev1client.Interface, informer imagev1informer.ImageStreamInformer, opts ScheduledImageStreamControllerOptions) *ScheduledImageStreamController {
-	bucketLimiter := flowcontrol.NewTokenBucketRateLimiter(opts.BucketsToQPS(), 1)
-
+func NewScheduledImageStreamController(client imagev1client.Interface, informer imagev1informer.ImageStreamInformer, eventBroadcaster record.EventBroadcaster, opts ScheduledImageStreamControllerOptions) *ScheduledImageStreamController {
 	controller := &ScheduledImageStreamController{
-		enabled:       opts.Enabled,
-		rateLimiter:   opts.GetRateLimiter(),
-		client:        client.ImageV1().RESTClient(),
-		lister:        informer.Lister(),
-		listerSynced:  informer.Informer().HasSynced,
-		importCounter: NewImportMetricCounter(),
+		enabled:         opts.Enabled,
+		minimumInterval: opts.Resync,
+		client:          client.ImageV1().RESTClient(),
+		lister:          informer.Lister(),
+		listerSynced:    informer.Informer().HasSynced,
+		registries:      newRegistryLimiter(opts.RegistryLimits, clock.RealClock{}),
+		recorder:        eventBroadcaster.NewRecorder(legacyscheme.Scheme, corev1.EventSource{Component: "image-import-controller"}),
+		references:      opts.TagReferences,
+		fullImports:     make(map[string]time.Time),
+		attempts:        make(map[string]scheduledImportAttempt),
+		importCounter:   NewImportMetricCounter(),
+	}
+	controller.unreferencedFactor = opts.TriggerPriority.UnreferencedIntervalFactor
+	if controller.unreferencedFactor == 0 {
+		controller.unreferencedFactor = defaultUnreferencedIntervalFactor
 	}
 
-	controller.scheduler = newScheduler(opts.Buckets(), bucketLimiter, controller.syncTimed)
+	controller.scheduler = newScheduler(opts.GetRateLimiter(), clock.RealClock{}, scheduledImportJitter, controller.syncTimed)
 
 	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    controller.addImageStream,
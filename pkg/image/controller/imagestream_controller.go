@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"k8s.io/klog/v2"
@@ -12,6 +13,7 @@ import (
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
@@ -22,6 +24,7 @@ import (
 	imagev1typedclient "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
 	imagev1lister "github.com/openshift/client-go/image/listers/image/v1"
 	"github.com/openshift/library-go/pkg/image/imageutil"
+	imageref "github.com/openshift/library-go/pkg/image/reference"
 	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
 )
 
@@ -46,6 +49,13 @@ type ImageStreamController struct {
 	lister imagev1lister.ImageStreamLister
 	// listerSynced makes sure the is store is synced before reconciling streams
 	listerSynced cache.InformerSynced
+	// indexer finds the streams tracking a pushed image
+	indexer cache.Indexer
+
+	// pushed holds the tags of queued streams which were pushed to their registries, and
+	// are imported on the next sync of the stream
+	pushedLock sync.Mutex
+	pushed     map[string]sets.String
 
 	// notifier informs other controllers that an import is being performed
 	notifier Notifier
@@ -158,9 +168,19 @@ func (c *ImageStreamController) syncImageStream(key string) error {
 		return err
 	}
 
+	pushed := c.takePushedTags(key)
+	if pushed.Len() > 0 {
+		stream = stream.DeepCopy()
+		resetPushedTags(stream, pushed)
+	}
+
 	klog.V(3).Infof("Queued import of stream %s/%s...", stream.Namespace, stream.Name)
-	result, err := handleImageStream(stream, c.client.RESTClient(), c.notifier)
+	result, err := handleImageStream(stream, c.client.RESTClient(), c.notifier, false)
 	c.importCounter.Increment(result, err)
+	if err != nil && pushed.Len() > 0 {
+		// retry the pushed tags with the stream
+		c.addPushedTags(key, pushed.UnsortedList()...)
+	}
 	return err
 }
 
@@ -258,6 +278,7 @@ func handleImageStream(
 	stream *imagev1.ImageStream,
 	client rest.Interface,
 	notifier Notifier,
+	scheduled bool,
 ) (*imagev1.ImageStreamImport, error) {
 	ok, partial := needsImport(stream)
 	if !ok {
@@ -302,6 +323,13 @@ func handleImageStream(
 	}
 	// use RESTClient directly here to be able to extend request timeout
 	result := &imagev1.ImageStreamImport{}
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		for _, registry := range importRegistries(isi).List() {
+			metrics.ObserveImportDuration(scheduled, registry, d)
+		}
+	}()
 	err := client.Post().
 		Namespace(stream.Namespace).
 		Resource(imagev1.Resource("imagestreamimports").Resource).
@@ -322,6 +350,27 @@ func handleImageStream(
 	return result, nil
 }
 
+// importRegistries returns the registries the images and repository of an import are imported
+// from.
+func importRegistries(isi *imagev1.ImageStreamImport) sets.String {
+	registries := sets.NewString()
+	add := func(ref corev1.ObjectReference) {
+		if ref.Kind != "DockerImage" {
+			return
+		}
+		if imgRef, err := imageref.Parse(ref.Name); err == nil {
+			registries.Insert(imgRef.DockerClientDefaults().Registry)
+		}
+	}
+	for _, image := range isi.Spec.Images {
+		add(image.From)
+	}
+	if isi.Spec.Repository != nil {
+		add(isi.Spec.Repository.From)
+	}
+	return registries
+}
+
 // isStatusErrorKind returns true if this error describes the provided kind.
 func isStatusErrorKind(err error, kind string) bool {
 	if s, ok := err.(apierrs.APIStatus); ok {
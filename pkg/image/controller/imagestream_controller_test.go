@@ -410,7 +410,7 @@ func TestHandleImageStream(t *testing.T) {
 			}
 			other := test.stream.DeepCopy()
 
-			if _, err := handleImageStream(test.stream, fakeREST, nil); err != nil {
+			if _, err := handleImageStream(test.stream, fakeREST, nil, false); err != nil {
 				t.Errorf("unexpected error: %#v", err)
 			}
 			if test.expected != nil {
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	kcontroller "k8s.io/kubernetes/pkg/controller"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageref "github.com/openshift/library-go/pkg/image/reference"
+)
+
+// pushedTagIndex indexes image streams by the normalized pull specs their importable
+// tags track.
+const pushedTagIndex = "pushedTag"
+
+// normalizedPullSpec returns the pull spec of a tagged image with the Docker client
+// defaults applied, so that different spellings of the same repository:tag compare
+// equal. Digest references are rejected, as pushing to a registry never changes them.
+func normalizedPullSpec(pullSpec string) (string, error) {
+	ref, err := imageref.Parse(pullSpec)
+	if err != nil {
+		return "", err
+	}
+	if len(ref.ID) > 0 {
+		return "", fmt.Errorf("%q references an image by digest", pullSpec)
+	}
+	ref.Registry = strings.ToLower(ref.Registry)
+	if imageref.IsRegistryDockerHub(ref.Registry) {
+		ref.Registry = imageref.DockerDefaultRegistry
+	}
+	return ref.DockerClientDefaults().Exact(), nil
+}
+
+// pushedTagIndexFunc returns the normalized pull specs tracked by the importable tags of
+// an image stream.
+func pushedTagIndexFunc(obj interface{}) ([]string, error) {
+	stream, ok := obj.(*imagev1.ImageStream)
+	if !ok {
+		return nil, nil
+	}
+	var keys []string
+	for _, tagRef := range stream.Spec.Tags {
+		if !tagImportable(tagRef) {
+			continue
+		}
+		if key, err := normalizedPullSpec(tagRef.From.Name); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Pushed is invoked when an image was pushed to pullSpec, a repository:tag of an external
+// registry. It queues an import of the tags tracking pullSpec for every image stream, and
+// returns the number of image streams queued.
+func (c *ImageStreamController) Pushed(pullSpec string) (int, error) {
+	key, err := normalizedPullSpec(pullSpec)
+	if err != nil {
+		return 0, err
+	}
+	objs, err := c.indexer.ByIndex(pushedTagIndex, key)
+	if err != nil {
+		return 0, err
+	}
+	for _, obj := range objs {
+		stream := obj.(*imagev1.ImageStream)
+		streamKey, err := kcontroller.KeyFunc(stream)
+		if err != nil {
+			return 0, err
+		}
+		var tags []string
+		for _, tagRef := range stream.Spec.Tags {
+			if !tagImportable(tagRef) {
+				continue
+			}
+			if tagKey, err := normalizedPullSpec(tagRef.From.Name); err == nil && tagKey == key {
+				tags = append(tags, tagRef.Name)
+			}
+		}
+		klog.V(3).Infof("Queueing import of tags %v of stream %s after a push to %s", tags, streamKey, key)
+		c.addPushedTags(streamKey, tags...)
+		c.queue.Add(streamKey)
+	}
+	return len(objs), nil
+}
+
+// addPushedTags records tags of the stream which need to be imported on its next sync.
+func (c *ImageStreamController) addPushedTags(key string, tags ...string) {
+	c.pushedLock.Lock()
+	defer c.pushedLock.Unlock()
+
+	if c.pushed[key] == nil {
+		c.pushed[key] = sets.NewString()
+	}
+	c.pushed[key].Insert(tags...)
+}
+
+// takePushedTags returns and forgets the pushed tags of the stream.
+func (c *ImageStreamController) takePushedTags(key string) sets.String {
+	c.pushedLock.Lock()
+	defer c.pushedLock.Unlock()
+
+	tags := c.pushed[key]
+	delete(c.pushed, key)
+	return tags
+}
+
+// resetPushedTags artificially increments the generation on the pushed tags, so that they
+// are imported even though their last import is current.
+func resetPushedTags(stream *imagev1.ImageStream, tags sets.String) {
+	next := stream.Generation + 1
+	for i, tagRef := range stream.Spec.Tags {
+		if tags.Has(tagRef.Name) && tagImportable(tagRef) {
+			stream.Spec.Tags[i].Generation = &next
+		}
+	}
+}
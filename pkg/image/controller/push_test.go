@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apitesting "k8s.io/apimachinery/pkg/api/apitesting"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	restfake "k8s.io/client-go/rest/fake"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	fakeimagev1client "github.com/openshift/client-go/image/clientset/versioned/fake"
+	imagev1typedclient "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+	imagev1informer "github.com/openshift/client-go/image/informers/externalversions"
+)
+
+// restImageClient serves the image client from a fake clientset, except for the REST
+// client used to import streams.
+type restImageClient struct {
+	imagev1typedclient.ImageV1Interface
+	rest rest.Interface
+}
+
+func (c *restImageClient) RESTClient() rest.Interface { return c.rest }
+
+func TestNormalizedPullSpec(t *testing.T) {
+	for pullSpec, expected := range map[string]string{
+		"mysql":                                "docker.io/library/mysql:latest",
+		"index.docker.io/library/mysql:8":      "docker.io/library/mysql:8",
+		"Quay.io/ns/image:tag":                 "quay.io/ns/image:tag",
+		"registry.example.com:5000/a/b/c:v1.2": "registry.example.com:5000/a/b/c:v1.2",
+	} {
+		actual, err := normalizedPullSpec(pullSpec)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", pullSpec, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("expected %s to be normalized to %s, got %s", pullSpec, expected, actual)
+		}
+	}
+	for _, pullSpec := range []string{"quay.io/ns/image@sha256:3c87c572822935df60f0f5d3665bd376841a7fcfeb806b5f212de6a00e9a7b25", "Invalid:://"} {
+		if _, err := normalizedPullSpec(pullSpec); err == nil {
+			t.Errorf("expected %s to be rejected", pullSpec)
+		}
+	}
+}
+
+func TestPushed(t *testing.T) {
+	one := int64(1)
+	tag := func(name, kind, from string) imagev1.TagReference {
+		return imagev1.TagReference{Name: name, From: &corev1.ObjectReference{Kind: kind, Name: from}, Generation: &one}
+	}
+	tracking := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tracking", Namespace: "ns", Generation: 1,
+			Annotations: map[string]string{imagev1.DockerImageRepositoryCheckAnnotation: "done"},
+		},
+		Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{
+			tag("latest", "DockerImage", "quay.io/org/app"),
+			tag("also-latest", "DockerImage", "quay.io/org/app:latest"),
+			tag("other", "DockerImage", "quay.io/org/app:other"),
+			tag("local", "ImageStreamTag", "tracking:latest"),
+		}},
+		Status: imagev1.ImageStreamStatus{Tags: []imagev1.NamedTagEventList{
+			{Tag: "latest", Items: []imagev1.TagEvent{{Generation: 1}}},
+			{Tag: "also-latest", Items: []imagev1.TagEvent{{Generation: 1}}},
+			{Tag: "other", Items: []imagev1.TagEvent{{Generation: 1}}},
+		}},
+	}
+	unrelated := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "ns"},
+		Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{
+			tag("latest", "DockerImage", "quay.io/org/other:latest"),
+		}},
+	}
+
+	clientset := fakeimagev1client.NewSimpleClientset()
+	informer := imagev1informer.NewSharedInformerFactory(clientset, 0).Image().V1().ImageStreams()
+	isc := NewImageStreamController(clientset, informer)
+	for _, stream := range []*imagev1.ImageStream{tracking, unrelated} {
+		informer.Informer().GetIndexer().Add(stream)
+	}
+
+	queued, err := isc.Pushed("quay.io/org/app:latest")
+	if err != nil || queued != 1 {
+		t.Fatalf("expected a single stream to be queued, got %d: %v", queued, err)
+	}
+	if isc.queue.Len() != 1 {
+		t.Fatalf("expected the stream to be queued, got %d items", isc.queue.Len())
+	}
+	if queued, err := isc.Pushed("quay.io/org/unknown:latest"); err != nil || queued != 0 {
+		t.Fatalf("expected no streams to be queued, got %d: %v", queued, err)
+	}
+
+	_, codecs := apitesting.SchemeForOrDie(imagev1.Install)
+	var imported []string
+	isc.client = &restImageClient{
+		ImageV1Interface: clientset.ImageV1(),
+		rest: &restfake.RESTClient{
+			NegotiatedSerializer: codecs,
+			GroupVersion:         imagev1.SchemeGroupVersion,
+			Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				isi := &imagev1.ImageStreamImport{}
+				if err := json.Unmarshal(body, isi); err != nil {
+					t.Fatal(err)
+				}
+				for _, image := range isi.Spec.Images {
+					imported = append(imported, image.To.Name)
+				}
+				return &http.Response{StatusCode: http.StatusOK, Header: header(), Body: objBody(&imagev1.ImageStreamImport{})}, nil
+			}),
+		},
+	}
+	if !isc.processNextWorkItem() {
+		t.Fatalf("expected to process the queued stream")
+	}
+	sort.Strings(imported)
+	if !reflect.DeepEqual(imported, []string{"also-latest", "latest"}) {
+		t.Errorf("expected the tags tracking the pushed image to be imported, got %v", imported)
+	}
+	if len(isc.pushed) != 0 {
+		t.Errorf("expected the pushed tags to be forgotten after the import, got %v", isc.pushed)
+	}
+}
+
+func TestResetPushedTags(t *testing.T) {
+	one := int64(1)
+	stream := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{Generation: 3},
+		Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{
+			{Name: "pushed", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app"}, Generation: &one},
+			{Name: "other", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app:other"}, Generation: &one},
+		}},
+	}
+	resetPushedTags(stream, sets.NewString("pushed"))
+	if *stream.Spec.Tags[0].Generation != 4 || *stream.Spec.Tags[1].Generation != 1 {
+		t.Errorf("expected only the pushed tag generation to be bumped, got %d and %d", *stream.Spec.Tags[0].Generation, *stream.Spec.Tags[1].Generation)
+	}
+}
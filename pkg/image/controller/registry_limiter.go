@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imageref "github.com/openshift/library-go/pkg/image/reference"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
+)
+
+const (
+	defaultRegistryFailureThreshold    = 5
+	defaultRegistryOpenDurationSeconds = 300
+)
+
+// RegistryLimitsConfig controls the per-registry rate limits and circuit breakers of
+// scheduled image imports.
+type RegistryLimitsConfig struct {
+	// MaxImportsPerMinute caps the number of scheduled imports from each registry per
+	// minute, on top of the global limit. Zero means no per-registry limit.
+	MaxImportsPerMinute int `json:"maxImportsPerMinute,omitempty"`
+	// FailureThreshold is the number of consecutive failed imports from a registry after
+	// which its circuit breaker opens, and scheduled imports from it are skipped. Defaults
+	// to 5. A negative value disables the circuit breakers.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenDurationSeconds is the time an open circuit breaker waits before letting a
+	// single trial import through. Defaults to 300.
+	OpenDurationSeconds int `json:"openDurationSeconds,omitempty"`
+}
+
+// ValidateRegistryLimitsConfig returns an error if the registry limits configuration is
+// invalid.
+func ValidateRegistryLimitsConfig(config RegistryLimitsConfig) error {
+	if config.MaxImportsPerMinute < 0 {
+		return fmt.Errorf("the registry maxImportsPerMinute must not be negative, got %d", config.MaxImportsPerMinute)
+	}
+	if config.OpenDurationSeconds < 0 {
+		return fmt.Errorf("the registry openDurationSeconds must not be negative, got %d", config.OpenDurationSeconds)
+	}
+	return nil
+}
+
+// registryState is the rate limiter and circuit breaker of a single registry.
+type registryState struct {
+	limiter flowcontrol.RateLimiter
+	// failures counts the consecutive failed imports from the registry.
+	failures int
+	// openUntil is the time the next trial import may go through while the breaker is open.
+	openUntil time.Time
+}
+
+// registryLimiter rate limits scheduled imports per registry, and stops importing from
+// registries that keep failing until they recover.
+type registryLimiter struct {
+	maxImportsPerMinute int
+	failureThreshold    int
+	openDuration        time.Duration
+	clock               flowcontrol.Clock
+
+	mu         sync.Mutex
+	registries map[string]*registryState
+}
+
+func newRegistryLimiter(config RegistryLimitsConfig, clock flowcontrol.Clock) *registryLimiter {
+	l := &registryLimiter{
+		maxImportsPerMinute: config.MaxImportsPerMinute,
+		failureThreshold:    config.FailureThreshold,
+		openDuration:        time.Duration(config.OpenDurationSeconds) * time.Second,
+		clock:               clock,
+		registries:          make(map[string]*registryState),
+	}
+	if l.failureThreshold == 0 {
+		l.failureThreshold = defaultRegistryFailureThreshold
+	}
+	if l.openDuration == 0 {
+		l.openDuration = defaultRegistryOpenDurationSeconds * time.Second
+	}
+	return l
+}
+
+// state returns the state of the registry, creating it if needed. Must be called with
+// the lock held.
+func (l *registryLimiter) state(registry string) *registryState {
+	state, ok := l.registries[registry]
+	if !ok {
+		state = &registryState{limiter: flowcontrol.NewFakeAlwaysRateLimiter()}
+		if l.maxImportsPerMinute > 0 {
+			importRate := float32(l.maxImportsPerMinute) / float32(time.Minute/time.Second)
+			state.limiter = flowcontrol.NewTokenBucketRateLimiterWithClock(importRate, l.maxImportsPerMinute, l.clock)
+		}
+		l.registries[registry] = state
+	}
+	return state
+}
+
+// isOpen returns true if the circuit breaker of the registry is open. Must be called
+// with the lock held.
+func (l *registryLimiter) isOpen(state *registryState) bool {
+	return l.failureThreshold > 0 && state.failures >= l.failureThreshold
+}
+
+// Allow returns nil if an import from the registry may go through now. Otherwise it
+// returns an error describing why the import has to be skipped: errRegistryUnavailable
+// if the circuit breaker of the registry is open, or errRegistryRateLimited.
+func (l *registryLimiter) Allow(registry string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state(registry)
+	if l.isOpen(state) {
+		now := l.clock.Now()
+		if now.Before(state.openUntil) {
+			return &errRegistryUnavailable{registry: registry, failures: state.failures, until: state.openUntil}
+		}
+		// let a single trial import through, and hold back the others until the
+		// trial succeeds or the breaker waits out another open duration
+		klog.V(4).Infof("Letting a trial import from registry %s through its open circuit breaker", registry)
+		state.openUntil = now.Add(l.openDuration)
+	}
+	if !state.limiter.TryAccept() {
+		return errRegistryRateLimited
+	}
+	return nil
+}
+
+// Record updates the circuit breakers of the registries imported from by the image stream
+// import.
+func (l *registryLimiter) Record(isi *imagev1.ImageStreamImport) {
+	if isi == nil {
+		return
+	}
+	failed := map[string]bool{}
+	enumerateIsImportStatuses(isi, func(info *metrics.ImportErrorInfo) {
+		if len(info.Registry) == 0 || info.Reason == reasonInvalidImageReference {
+			return
+		}
+		// a registry failed the import if any of its images failed
+		failed[info.Registry] = failed[info.Registry] || registryFailure(info.Reason)
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for registry, failure := range failed {
+		state := l.state(registry)
+		if !failure {
+			if l.isOpen(state) {
+				klog.V(2).Infof("Closing the circuit breaker of registry %s", registry)
+			}
+			state.failures = 0
+			continue
+		}
+		state.failures++
+		if l.isOpen(state) {
+			if state.failures == l.failureThreshold {
+				klog.V(2).Infof("Opening the circuit breaker of registry %s after %d consecutive failed imports", registry, state.failures)
+			}
+			state.openUntil = l.clock.Now().Add(l.openDuration)
+		}
+	}
+}
+
+// Collect returns the state of the circuit breakers, for metrics collection.
+func (l *registryLimiter) Collect() metrics.RegistryBreakerStates {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	states := metrics.RegistryBreakerStates{}
+	for registry, state := range l.registries {
+		states[registry] = l.isOpen(state)
+	}
+	return states
+}
+
+// registryFailure returns true if an image import failed for the given reason because
+// the registry is unavailable, rather than because of the image or the credentials.
+func registryFailure(reason string) bool {
+	switch metav1.StatusReason(reason) {
+	case "", metav1.StatusReasonNotFound, metav1.StatusReasonUnauthorized, metav1.StatusReasonForbidden,
+		metav1.StatusReasonInvalid, metav1.StatusReasonBadRequest:
+		return false
+	}
+	return true
+}
+
+// tagRegistry returns the registry a tag is imported from, or an empty string if the
+// tag does not reference a valid image.
+func tagRegistry(tagRef imagev1.TagReference) string {
+	if tagRef.From == nil {
+		return ""
+	}
+	ref, err := imageref.Parse(tagRef.From.Name)
+	if err != nil {
+		return ""
+	}
+	return ref.DockerClientDefaults().Registry
+}
+
+// errRegistryUnavailable is returned for imports from a registry whose circuit breaker
+// is open.
+type errRegistryUnavailable struct {
+	registry string
+	failures int
+	until    time.Time
+}
+
+func (e *errRegistryUnavailable) Error() string {
+	return fmt.Sprintf("registry %s is unavailable after %d consecutive failed imports, the next import is attempted after %s",
+		e.registry, e.failures, e.until.UTC().Format(time.RFC3339))
+}
+
+var errRegistryRateLimited = errors.New("registry rate limit exceeded")
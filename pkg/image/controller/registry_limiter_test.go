@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
+)
+
+// importResult returns an image stream import of the given images with the given status
+// reasons, where an empty reason is a successful import.
+func importResult(images map[string]metav1.StatusReason) *imagev1.ImageStreamImport {
+	isi := &imagev1.ImageStreamImport{}
+	for name, reason := range images {
+		isi.Spec.Images = append(isi.Spec.Images, imagev1.ImageImportSpec{
+			From: corev1.ObjectReference{Kind: "DockerImage", Name: name},
+		})
+		status := metav1.Status{Status: metav1.StatusSuccess}
+		if len(reason) > 0 {
+			status = metav1.Status{Status: metav1.StatusFailure, Reason: reason}
+		}
+		isi.Status.Images = append(isi.Status.Images, imagev1.ImageImportStatus{Status: status})
+	}
+	return isi
+}
+
+func TestRegistryLimiterCircuitBreaker(t *testing.T) {
+	clock, setTime := setClock()
+	l := newRegistryLimiter(RegistryLimitsConfig{FailureThreshold: 3, OpenDurationSeconds: 60}, clock)
+	failed := importResult(map[string]metav1.StatusReason{"quay.io/down/image:latest": metav1.StatusReasonInternalError})
+
+	for i := 0; i < 2; i++ {
+		l.Record(failed)
+		if err := l.Allow("quay.io"); err != nil {
+			t.Fatalf("expected imports to go through below the failure threshold, got %v", err)
+		}
+	}
+	l.Record(failed)
+	err := l.Allow("quay.io")
+	if unavailable, ok := err.(*errRegistryUnavailable); !ok || !unavailable.until.Equal(time.Unix(60, 0)) {
+		t.Fatalf("expected the breaker to open for a minute, got %v", err)
+	}
+	if err := l.Allow("docker.io"); err != nil {
+		t.Fatalf("expected imports from other registries to go through, got %v", err)
+	}
+	if !reflect.DeepEqual(l.Collect(), metrics.RegistryBreakerStates{"quay.io": true, "docker.io": false}) {
+		t.Fatalf("unexpected breaker states: %v", l.Collect())
+	}
+
+	// a single trial import goes through once the breaker waited out the open duration
+	setTime(time.Minute)
+	if err := l.Allow("quay.io"); err != nil {
+		t.Fatalf("expected a trial import to go through, got %v", err)
+	}
+	if err := l.Allow("quay.io"); err == nil {
+		t.Fatalf("expected a single trial import to go through")
+	}
+	// a failed trial keeps the breaker open for another open duration
+	setTime(90 * time.Second)
+	l.Record(failed)
+	if err, ok := l.Allow("quay.io").(*errRegistryUnavailable); !ok || !err.until.Equal(time.Unix(150, 0)) {
+		t.Fatalf("expected the breaker to stay open after a failed trial, got %v", err)
+	}
+
+	// a successful trial closes the breaker
+	setTime(150 * time.Second)
+	if err := l.Allow("quay.io"); err != nil {
+		t.Fatalf("expected a trial import to go through, got %v", err)
+	}
+	l.Record(importResult(map[string]metav1.StatusReason{"quay.io/down/image:latest": ""}))
+	if err := l.Allow("quay.io"); err != nil {
+		t.Fatalf("expected the breaker to close after a successful import, got %v", err)
+	}
+	if l.Collect()["quay.io"] {
+		t.Fatalf("expected the breaker to be reported closed")
+	}
+}
+
+func TestRegistryLimiterRecord(t *testing.T) {
+	clock, _ := setClock()
+	l := newRegistryLimiter(RegistryLimitsConfig{FailureThreshold: 1}, clock)
+
+	// failures of the images themselves do not open the breaker
+	l.Record(importResult(map[string]metav1.StatusReason{
+		"quay.io/missing/image:latest":  metav1.StatusReasonNotFound,
+		"quay.io/private/image:latest":  metav1.StatusReasonUnauthorized,
+		"registry.redhat.io/image:tag":  metav1.StatusReasonTimeout,
+		"registry.example.com/ok:tag":   "",
+		"registry.example.com/fail:tag": metav1.StatusReasonServiceUnavailable,
+		"image:latest":                  metav1.StatusReasonTooManyRequests,
+	}))
+	expected := metrics.RegistryBreakerStates{
+		"quay.io":              false,
+		"registry.redhat.io":   true,
+		"registry.example.com": true,
+		"docker.io":            true,
+	}
+	if actual := l.Collect(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected breaker states %v, got %v", expected, actual)
+	}
+
+	// an import error without a result does not change the breakers
+	l.Record(nil)
+	if actual := l.Collect(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected breaker states %v, got %v", expected, actual)
+	}
+}
+
+func TestRegistryLimiterDisabledBreaker(t *testing.T) {
+	clock, _ := setClock()
+	l := newRegistryLimiter(RegistryLimitsConfig{FailureThreshold: -1}, clock)
+	failed := importResult(map[string]metav1.StatusReason{"quay.io/down/image:latest": metav1.StatusReasonInternalError})
+	for i := 0; i < 2*defaultRegistryFailureThreshold; i++ {
+		l.Record(failed)
+	}
+	if err := l.Allow("quay.io"); err != nil {
+		t.Fatalf("expected disabled breakers never to open, got %v", err)
+	}
+}
+
+func TestRegistryLimiterRateLimit(t *testing.T) {
+	clock, setTime := setClock()
+	l := newRegistryLimiter(RegistryLimitsConfig{MaxImportsPerMinute: 2}, clock)
+	for i := 0; i < 2; i++ {
+		if err := l.Allow("quay.io"); err != nil {
+			t.Fatalf("expected import %d to go through, got %v", i, err)
+		}
+	}
+	if err := l.Allow("quay.io"); err != errRegistryRateLimited {
+		t.Fatalf("expected the registry rate limit to be exceeded, got %v", err)
+	}
+	if err := l.Allow("docker.io"); err != nil {
+		t.Fatalf("expected other registries to have their own limit, got %v", err)
+	}
+	setTime(30 * time.Second)
+	if err := l.Allow("quay.io"); err != nil {
+		t.Fatalf("expected the limit to refill, got %v", err)
+	}
+}
+
+func TestValidateRegistryLimitsConfig(t *testing.T) {
+	for _, config := range []RegistryLimitsConfig{{MaxImportsPerMinute: -1}, {OpenDurationSeconds: -1}} {
+		if err := ValidateRegistryLimitsConfig(config); err == nil {
+			t.Errorf("expected %#v to be invalid", config)
+		}
+	}
+	if err := ValidateRegistryLimitsConfig(RegistryLimitsConfig{MaxImportsPerMinute: 10, FailureThreshold: -1}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package retention
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	imagev1 "github.com/openshift/api/image/v1"
+	"github.com/openshift/library-go/pkg/build/buildutil"
+)
+
+// imageDigestIndex indexes the objects referencing images by the digests of the images.
+const imageDigestIndex = "imageDigest"
+
+// imageDigestIndexFunc returns the digests of the images referenced by a pod, replication
+// controller, deployment, replica set or build.
+func imageDigestIndexFunc(obj interface{}) ([]string, error) {
+	var pullSpecs []string
+	switch t := obj.(type) {
+	case *corev1.Pod:
+		pullSpecs = podSpecPullSpecs(&t.Spec)
+		for _, statuses := range [][]corev1.ContainerStatus{t.Status.InitContainerStatuses, t.Status.ContainerStatuses} {
+			for _, status := range statuses {
+				pullSpecs = append(pullSpecs, status.ImageID)
+			}
+		}
+	case *corev1.ReplicationController:
+		if t.Spec.Template != nil {
+			pullSpecs = podSpecPullSpecs(&t.Spec.Template.Spec)
+		}
+	case *appsv1.Deployment:
+		pullSpecs = podSpecPullSpecs(&t.Spec.Template.Spec)
+	case *appsv1.ReplicaSet:
+		pullSpecs = podSpecPullSpecs(&t.Spec.Template.Spec)
+	case *buildv1.Build:
+		if from := buildutil.GetInputReference(t.Spec.Strategy); from != nil {
+			pullSpecs = append(pullSpecs, from.Name)
+		}
+		for _, image := range t.Spec.Source.Images {
+			pullSpecs = append(pullSpecs, image.From.Name)
+		}
+	}
+
+	var digests []string
+	for _, pullSpec := range pullSpecs {
+		if digest, ok := pullSpecDigest(pullSpec); ok {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
+
+// podSpecPullSpecs returns the images of the containers of a pod spec.
+func podSpecPullSpecs(spec *corev1.PodSpec) []string {
+	var pullSpecs []string
+	for _, container := range spec.InitContainers {
+		pullSpecs = append(pullSpecs, container.Image)
+	}
+	for _, container := range spec.Containers {
+		pullSpecs = append(pullSpecs, container.Image)
+	}
+	return pullSpecs
+}
+
+// pullSpecDigest returns the digest of an image referenced by digest, such as
+// "registry/ns/name@sha256:...", "docker-pullable://registry/ns/name@sha256:..." or the
+// ImageStreamImage name "name@sha256:...".
+func pullSpecDigest(pullSpec string) (string, bool) {
+	i := strings.LastIndex(pullSpec, "@")
+	if i < 0 {
+		return "", false
+	}
+	digest := pullSpec[i+1:]
+	if !strings.Contains(digest, ":") {
+		return "", false
+	}
+	return digest, true
+}
+
+// tagEventDigest returns the digest of the image of a tag event.
+func tagEventDigest(event imagev1.TagEvent) (string, bool) {
+	if len(event.Image) > 0 {
+		return event.Image, true
+	}
+	return pullSpecDigest(event.DockerImageReference)
+}
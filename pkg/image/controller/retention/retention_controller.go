@@ -0,0 +1,289 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	kcontroller "k8s.io/kubernetes/pkg/controller"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imagev1client "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+	imagev1informer "github.com/openshift/client-go/image/informers/externalversions/image/v1"
+	imagev1lister "github.com/openshift/client-go/image/listers/image/v1"
+)
+
+const (
+	// HistoryLimitAnnotation may be set on an image stream to the number of the newest events
+	// kept in the history of each of its tags. It overrides the cluster default.
+	HistoryLimitAnnotation = "image.openshift.io/tag-history-limit"
+	// HistoryMaxAgeAnnotation may be set on an image stream to the age (a Go duration such as
+	// "720h") after which the events in the history of its tags are dropped. It overrides the
+	// cluster default.
+	HistoryMaxAgeAnnotation = "image.openshift.io/tag-history-max-age"
+
+	// reasonTagHistoryPruned is the reason of events about pruned tag histories.
+	reasonTagHistoryPruned = "TagHistoryPruned"
+
+	defaultResyncPeriodSeconds = 600
+)
+
+// Config controls the retention of the tag history of image streams.
+type Config struct {
+	// DefaultHistoryLimit is the number of the newest events kept in the history of each tag
+	// of image streams without the tag-history-limit annotation. Zero keeps every event.
+	DefaultHistoryLimit int `json:"defaultHistoryLimit,omitempty"`
+	// DefaultMaxAgeSeconds is the age after which events are dropped from the history of the
+	// tags of image streams without the tag-history-max-age annotation. Zero keeps events of
+	// any age.
+	DefaultMaxAgeSeconds int `json:"defaultMaxAgeSeconds,omitempty"`
+	// ResyncPeriodSeconds is how often every image stream is checked for events that aged
+	// out, or that are no longer referenced. Defaults to 600.
+	ResyncPeriodSeconds int `json:"resyncPeriodSeconds,omitempty"`
+}
+
+// ValidateConfig returns an error if the tag history retention configuration is invalid.
+func ValidateConfig(config Config) error {
+	if config.DefaultHistoryLimit < 0 {
+		return fmt.Errorf("the tag history defaultHistoryLimit must not be negative, got %d", config.DefaultHistoryLimit)
+	}
+	if config.DefaultMaxAgeSeconds < 0 {
+		return fmt.Errorf("the tag history defaultMaxAgeSeconds must not be negative, got %d", config.DefaultMaxAgeSeconds)
+	}
+	if config.ResyncPeriodSeconds < 0 {
+		return fmt.Errorf("the tag history resyncPeriodSeconds must not be negative, got %d", config.ResyncPeriodSeconds)
+	}
+	return nil
+}
+
+// policy is the retention policy of the tag history of an image stream. An event is kept if
+// it is the latest of its tag, one of the limit newest, younger than maxAge, or if its image
+// is still referenced. A zero limit or maxAge does not keep any event.
+type policy struct {
+	limit  int
+	maxAge time.Duration
+}
+
+// TagRetentionController drops the events of the tag history of image streams which their
+// retention policy no longer keeps. Events whose images are still referenced by a pod,
+// replication controller, deployment, replica set or build are never dropped.
+type TagRetentionController struct {
+	client imagev1client.ImageStreamsGetter
+	lister imagev1lister.ImageStreamLister
+
+	// references are the indexers of the objects referencing images, by imageDigestIndex
+	references []cache.Indexer
+
+	syncs []cache.InformerSynced
+	queue workqueue.RateLimitingInterface
+
+	recorder record.EventRecorder
+
+	defaultPolicy policy
+
+	// clock is the source of the current time, for testing
+	clock func() time.Time
+}
+
+// NewTagRetentionController returns a controller enforcing the tag history retention policy of
+// image streams. The informers of objects referencing images are indexed by the digests of
+// their images.
+func NewTagRetentionController(
+	client imagev1client.ImageStreamsGetter,
+	informer imagev1informer.ImageStreamInformer,
+	references []cache.SharedIndexInformer,
+	eventBroadcaster record.EventBroadcaster,
+	config Config,
+) (*TagRetentionController, error) {
+	c := &TagRetentionController{
+		client:   client,
+		lister:   informer.Lister(),
+		syncs:    []cache.InformerSynced{informer.Informer().HasSynced},
+		queue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "image-tag-retention"),
+		recorder: eventBroadcaster.NewRecorder(legacyscheme.Scheme, corev1.EventSource{Component: "image-tag-retention-controller"}),
+		defaultPolicy: policy{
+			limit:  config.DefaultHistoryLimit,
+			maxAge: time.Duration(config.DefaultMaxAgeSeconds) * time.Second,
+		},
+		clock: time.Now,
+	}
+	for _, reference := range references {
+		if err := reference.AddIndexers(cache.Indexers{imageDigestIndex: imageDigestIndexFunc}); err != nil {
+			return nil, fmt.Errorf("unable to index objects by the images they reference: %v", err)
+		}
+		c.references = append(c.references, reference.GetIndexer())
+		c.syncs = append(c.syncs, reference.HasSynced)
+	}
+
+	resyncPeriod := config.ResyncPeriodSeconds
+	if resyncPeriod == 0 {
+		resyncPeriod = defaultResyncPeriodSeconds
+	}
+	// every stream is queued on resync as well, as events age out and images stop being
+	// referenced without the stream changing
+	informer.Informer().AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueImageStream,
+		UpdateFunc: func(old, cur interface{}) { c.enqueueImageStream(cur) },
+	}, time.Duration(resyncPeriod)*time.Second)
+
+	return c, nil
+}
+
+// Run begins watching and syncing.
+func (c *TagRetentionController) Run(workers int, stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting image tag retention controller")
+
+	// the references must be known before any event may be dropped
+	if !cache.WaitForCacheSync(stopCh, c.syncs...) {
+		utilruntime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.worker, time.Second, stopCh)
+	}
+
+	<-stopCh
+	klog.Infof("Shutting down image tag retention controller")
+}
+
+func (c *TagRetentionController) enqueueImageStream(obj interface{}) {
+	key, err := kcontroller.KeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for object %+v: %v", obj, err))
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *TagRetentionController) worker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *TagRetentionController) processNextWorkItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncImageStream(key.(string)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error pruning the tag history of image stream %s: %v", key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// syncImageStream drops the events of the tag history of the stream which its policy does not
+// keep.
+func (c *TagRetentionController) syncImageStream(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	stream, err := c.lister.ImageStreams(namespace).Get(name)
+	if apierrs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p := c.policyFor(stream)
+	if p.limit == 0 && p.maxAge == 0 {
+		return nil
+	}
+
+	var pruned *imagev1.ImageStream
+	dropped := 0
+	now := c.clock()
+	for i, tag := range stream.Status.Tags {
+		items := c.retainedItems(tag.Items, p, now)
+		if len(items) == len(tag.Items) {
+			continue
+		}
+		if pruned == nil {
+			pruned = stream.DeepCopy()
+		}
+		dropped += len(tag.Items) - len(items)
+		pruned.Status.Tags[i].Items = items
+	}
+	if pruned == nil {
+		return nil
+	}
+
+	klog.V(2).Infof("Dropping %d events from the tag history of image stream %s", dropped, key)
+	if _, err := c.client.ImageStreams(namespace).UpdateStatus(context.TODO(), pruned, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	c.recorder.Eventf(stream, corev1.EventTypeNormal, reasonTagHistoryPruned, "Dropped %d events from the tag history according to the retention policy", dropped)
+	return nil
+}
+
+// policyFor returns the retention policy of the stream, the cluster default overridden by the
+// annotations of the stream.
+func (c *TagRetentionController) policyFor(stream *imagev1.ImageStream) policy {
+	p := c.defaultPolicy
+	if value, ok := stream.Annotations[HistoryLimitAnnotation]; ok {
+		if limit, err := strconv.Atoi(value); err == nil && limit >= 0 {
+			p.limit = limit
+		} else {
+			klog.V(2).Infof("ignoring invalid tag history limit %q of image stream %s/%s", value, stream.Namespace, stream.Name)
+		}
+	}
+	if value, ok := stream.Annotations[HistoryMaxAgeAnnotation]; ok {
+		if maxAge, err := time.ParseDuration(value); err == nil && maxAge >= 0 {
+			p.maxAge = maxAge
+		} else {
+			klog.V(2).Infof("ignoring invalid tag history max age %q of image stream %s/%s", value, stream.Namespace, stream.Name)
+		}
+	}
+	return p
+}
+
+// retainedItems returns the events of a tag history which the policy keeps, newest first.
+func (c *TagRetentionController) retainedItems(items []imagev1.TagEvent, p policy, now time.Time) []imagev1.TagEvent {
+	var retained []imagev1.TagEvent
+	for i, item := range items {
+		switch {
+		case i == 0,
+			i < p.limit,
+			p.maxAge > 0 && now.Sub(item.Created.Time) < p.maxAge,
+			c.referenced(item):
+			retained = append(retained, item)
+		}
+	}
+	return retained
+}
+
+// referenced returns true if the image of the event is referenced by any object. Events whose
+// image digest is unknown are treated as referenced.
+func (c *TagRetentionController) referenced(event imagev1.TagEvent) bool {
+	digest, ok := tagEventDigest(event)
+	if !ok {
+		return true
+	}
+	for _, indexer := range c.references {
+		objs, err := indexer.ByIndex(imageDigestIndex, digest)
+		if err != nil || len(objs) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	imagev1 "github.com/openshift/api/image/v1"
+	fakeimagev1client "github.com/openshift/client-go/image/clientset/versioned/fake"
+	imagev1informer "github.com/openshift/client-go/image/informers/externalversions"
+)
+
+func tagEvent(digest string, age time.Duration, now time.Time) imagev1.TagEvent {
+	return imagev1.TagEvent{
+		Created:              metav1.NewTime(now.Add(-age)),
+		DockerImageReference: "registry.io/ns/app@" + digest,
+		Image:                digest,
+	}
+}
+
+func TestImageDigestIndexFunc(t *testing.T) {
+	testCases := []struct {
+		name   string
+		obj    interface{}
+		expect []string
+	}{
+		{
+			name: "pod",
+			obj: &corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Image: "registry.io/ns/init@sha256:1111"}},
+					Containers:     []corev1.Container{{Image: "registry.io/ns/app:latest"}},
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{ImageID: "docker-pullable://registry.io/ns/app@sha256:2222"}},
+				},
+			},
+			expect: []string{"sha256:1111", "sha256:2222"},
+		},
+		{
+			name: "replication controller without template",
+			obj:  &corev1.ReplicationController{},
+		},
+		{
+			name: "deployment",
+			obj: &appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "registry.io/ns/app@sha256:3333"}}}},
+				},
+			},
+			expect: []string{"sha256:3333"},
+		},
+		{
+			name: "build",
+			obj: &buildv1.Build{
+				Spec: buildv1.BuildSpec{
+					CommonSpec: buildv1.CommonSpec{
+						Strategy: buildv1.BuildStrategy{
+							SourceStrategy: &buildv1.SourceBuildStrategy{From: corev1.ObjectReference{Kind: "DockerImage", Name: "registry.io/ns/builder@sha256:4444"}},
+						},
+						Source: buildv1.BuildSource{
+							Images: []buildv1.ImageSource{{From: corev1.ObjectReference{Kind: "ImageStreamImage", Name: "app@sha256:5555"}}},
+						},
+					},
+				},
+			},
+			expect: []string{"sha256:4444", "sha256:5555"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			digests, err := imageDigestIndexFunc(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(digests) != len(tc.expect) {
+				t.Fatalf("expected digests %v, got %v", tc.expect, digests)
+			}
+			for i := range digests {
+				if digests[i] != tc.expect[i] {
+					t.Fatalf("expected digests %v, got %v", tc.expect, digests)
+				}
+			}
+		})
+	}
+}
+
+func TestTagRetention(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := []imagev1.TagEvent{
+		tagEvent("sha256:0000", 0, now),
+		tagEvent("sha256:1111", time.Hour, now),
+		tagEvent("sha256:2222", 2*time.Hour, now),
+		tagEvent("sha256:3333", 3*time.Hour, now),
+	}
+	testCases := []struct {
+		name        string
+		config      Config
+		annotations map[string]string
+		pods        []*corev1.Pod
+		expect      []string
+	}{
+		{
+			name:   "no policy",
+			expect: []string{"sha256:0000", "sha256:1111", "sha256:2222", "sha256:3333"},
+		},
+		{
+			name:   "default limit",
+			config: Config{DefaultHistoryLimit: 2},
+			expect: []string{"sha256:0000", "sha256:1111"},
+		},
+		{
+			name:        "annotated limit overrides default",
+			config:      Config{DefaultHistoryLimit: 2},
+			annotations: map[string]string{HistoryLimitAnnotation: "3"},
+			expect:      []string{"sha256:0000", "sha256:1111", "sha256:2222"},
+		},
+		{
+			name:        "latest event is always kept",
+			annotations: map[string]string{HistoryLimitAnnotation: "0", HistoryMaxAgeAnnotation: "1m"},
+			expect:      []string{"sha256:0000"},
+		},
+		{
+			name:        "max age",
+			annotations: map[string]string{HistoryMaxAgeAnnotation: "150m"},
+			expect:      []string{"sha256:0000", "sha256:1111", "sha256:2222"},
+		},
+		{
+			name:        "invalid annotation falls back to default",
+			config:      Config{DefaultMaxAgeSeconds: 5400},
+			annotations: map[string]string{HistoryMaxAgeAnnotation: "a while"},
+			expect:      []string{"sha256:0000", "sha256:1111"},
+		},
+		{
+			name:   "referenced events are kept",
+			config: Config{DefaultHistoryLimit: 1},
+			pods: []*corev1.Pod{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "pod"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Image: "registry.io/ns/app@sha256:2222"}}},
+			}},
+			expect: []string{"sha256:0000", "sha256:2222"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stream := &imagev1.ImageStream{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "app", Annotations: tc.annotations},
+				Status: imagev1.ImageStreamStatus{
+					Tags: []imagev1.NamedTagEventList{{Tag: "latest", Items: history}},
+				},
+			}
+			client := fakeimagev1client.NewSimpleClientset(stream)
+			informer := imagev1informer.NewSharedInformerFactory(client, 0).Image().V1().ImageStreams()
+			informer.Informer().GetStore().Add(stream)
+			pods := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0).Core().V1().Pods().Informer()
+
+			c, err := NewTagRetentionController(client.ImageV1(), informer, []cache.SharedIndexInformer{pods}, record.NewBroadcaster(), tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.clock = func() time.Time { return now }
+			for _, pod := range tc.pods {
+				pods.GetStore().Add(pod)
+			}
+
+			if err := c.syncImageStream("test/app"); err != nil {
+				t.Fatal(err)
+			}
+
+			var updated *imagev1.ImageStream
+			for _, action := range client.Actions() {
+				if action.Matches("update", "imagestreams") && action.GetSubresource() == "status" {
+					updated = action.(ktesting.UpdateAction).GetObject().(*imagev1.ImageStream)
+				}
+			}
+			items := history
+			if updated != nil {
+				items = updated.Status.Tags[0].Items
+				if len(items) == len(history) {
+					t.Fatalf("unexpected update without pruned events")
+				}
+			}
+			if len(items) != len(tc.expect) {
+				t.Fatalf("expected %v, got %#v", tc.expect, items)
+			}
+			for i := range items {
+				if items[i].Image != tc.expect[i] {
+					t.Fatalf("expected %v, got %#v", tc.expect, items)
+				}
+			}
+		})
+	}
+}
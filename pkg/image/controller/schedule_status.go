@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
+)
+
+const (
+	// importResultSuccess is the result of scheduled imports which imported every image.
+	importResultSuccess = "Success"
+	// importResultSkipped is the result of scheduled imports which had no tags to import,
+	// because they were deferred or their registries were unavailable.
+	importResultSkipped = "Skipped"
+	// importResultFailed prefixes the result of scheduled imports which failed in part or
+	// in full.
+	importResultFailed = "Failed: "
+)
+
+// scheduledImportAttempt is the outcome of the last scheduled import of a stream.
+type scheduledImportAttempt struct {
+	time      time.Time
+	succeeded bool
+}
+
+// describeImportResult returns whether all images of a scheduled import were imported, and a
+// summary of its result for the LastScheduledImportResultAnnotation.
+func describeImportResult(isi *imagev1.ImageStreamImport, err error) (bool, string) {
+	if err != nil {
+		return false, importResultFailed + err.Error()
+	}
+	if isi == nil {
+		return true, importResultSkipped
+	}
+	total := 0
+	reasons := map[string]int{}
+	count := func(info *metrics.ImportErrorInfo) {
+		total++
+		if len(info.Reason) > 0 {
+			reasons[info.Reason]++
+		}
+	}
+	if info := getIsImportRepositoryInfo(isi); info != nil {
+		count(info)
+	}
+	enumerateIsImportStatuses(isi, count)
+	if len(reasons) == 0 {
+		return true, importResultSuccess
+	}
+
+	failed := 0
+	var counts []string
+	for reason, n := range reasons {
+		failed += n
+		counts = append(counts, fmt.Sprintf("%s: %d", reason, n))
+	}
+	sort.Strings(counts)
+	return false, fmt.Sprintf("%s%d of %d images were not imported (%s)", importResultFailed, failed, total, strings.Join(counts, ", "))
+}
+
+// observeScheduleLag observes the lag of a scheduled import for every registry the tags due for
+// import are imported from.
+func observeScheduleLag(stream, original *imagev1.ImageStream, lag time.Duration) {
+	registries := sets.NewString()
+	for _, tagRef := range stream.Spec.Tags {
+		if _, ok := scheduledForImport(original, tagRef); !ok {
+			continue
+		}
+		if registry := tagRegistry(tagRef); len(registry) > 0 {
+			registries.Insert(registry)
+		}
+	}
+	for _, registry := range registries.List() {
+		metrics.ObserveScheduleLag(registry, lag)
+	}
+}
+
+// recordAttempt remembers the outcome of the last scheduled import of the stream.
+func (s *ScheduledImageStreamController) recordAttempt(key string, attempt scheduledImportAttempt) {
+	s.attemptsLock.Lock()
+	defer s.attemptsLock.Unlock()
+
+	s.attempts[key] = attempt
+}
+
+// forgetStream drops what is remembered about the scheduled imports of a stream.
+func (s *ScheduledImageStreamController) forgetStream(key string) {
+	s.attemptsLock.Lock()
+	delete(s.attempts, key)
+	s.attemptsLock.Unlock()
+
+	s.fullImportsLock.Lock()
+	delete(s.fullImports, key)
+	s.fullImportsLock.Unlock()
+}
+
+// collectSchedule returns the last and next scheduled import of every scheduled stream, for
+// metric collection.
+func (s *ScheduledImageStreamController) collectSchedule() []metrics.ScheduledImportState {
+	var states []metrics.ScheduledImportState
+	for key := range s.scheduler.Map() {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key.(string))
+		if err != nil {
+			continue
+		}
+		state := metrics.ScheduledImportState{Namespace: namespace, Name: name}
+		state.Next, _ = s.scheduler.Next(key)
+		s.attemptsLock.Lock()
+		if attempt, ok := s.attempts[key.(string)]; ok {
+			state.LastAttempt = attempt.time
+			state.Succeeded = attempt.succeeded
+		}
+		s.attemptsLock.Unlock()
+		states = append(states, state)
+	}
+	return states
+}
+
+// reportImport sets the annotations of the stream to the time and result of its last scheduled
+// import, the time of the next one, and the reasons its tags from unavailable registries were
+// skipped. Unless the result or the registries skipped change, the stream is patched at most
+// every scheduledImportReportInterval. An event is recorded when the registries skipped
+// change, and the skipped annotation is removed when there are none.
+func (s *ScheduledImageStreamController) reportImport(stream *imagev1.ImageStream, attempt time.Time, result string, next time.Time, unavailable []string) error {
+	annotations := map[string]interface{}{}
+	reported, err := time.Parse(time.RFC3339, stream.Annotations[LastScheduledImportAnnotation])
+	if err != nil || attempt.Sub(reported) >= scheduledImportReportInterval || stream.Annotations[LastScheduledImportResultAnnotation] != result {
+		annotations[LastScheduledImportAnnotation] = attempt.UTC().Format(time.RFC3339)
+		annotations[LastScheduledImportResultAnnotation] = result
+		if !next.IsZero() {
+			annotations[NextScheduledImportAnnotation] = next.UTC().Format(time.RFC3339)
+		}
+	}
+
+	current, annotated := stream.Annotations[ScheduledImportSkippedAnnotation]
+	switch {
+	case len(unavailable) > 0:
+		message := "skipped scheduled import: " + strings.Join(unavailable, "; ")
+		if !annotated || current != message {
+			s.recorder.Event(stream, corev1.EventTypeWarning, reasonRegistryUnavailable, message)
+			annotations[ScheduledImportSkippedAnnotation] = message
+		}
+	case annotated:
+		// a nil value removes the annotation
+		annotations[ScheduledImportSkippedAnnotation] = nil
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = s.client.Patch(types.MergePatchType).
+		Namespace(stream.Namespace).
+		Resource(imagev1.Resource("imagestreams").Resource).
+		Name(stream.Name).
+		Body(patch).
+		Do(context.TODO()).
+		Error()
+	if err != nil {
+		return fmt.Errorf("failed to update the scheduled import annotations of stream %s/%s: %v", stream.Namespace, stream.Name, err)
+	}
+	return nil
+}
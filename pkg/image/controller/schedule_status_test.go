@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
+)
+
+func TestDescribeImportResult(t *testing.T) {
+	tests := map[string]struct {
+		isi       *imagev1.ImageStreamImport
+		err       error
+		succeeded bool
+		result    string
+	}{
+		"nothing to import": {
+			succeeded: true,
+			result:    "Skipped",
+		},
+		"success": {
+			isi:       importResult(map[string]metav1.StatusReason{"quay.io/org/app:latest": "", "mysql:latest": ""}),
+			succeeded: true,
+			result:    "Success",
+		},
+		"partial failure": {
+			isi: importResult(map[string]metav1.StatusReason{
+				"quay.io/org/app:latest":  "",
+				"quay.io/org/app:missing": metav1.StatusReasonNotFound,
+				"quay.io/org/app:gone":    metav1.StatusReasonNotFound,
+				"quay.io/private/app:v1":  metav1.StatusReasonUnauthorized,
+			}),
+			result: "Failed: 3 of 4 images were not imported (NotFound: 2, Unauthorized: 1)",
+		},
+		"request failure": {
+			err:    fmt.Errorf("connection refused"),
+			result: "Failed: connection refused",
+		},
+	}
+	for name, test := range tests {
+		succeeded, result := describeImportResult(test.isi, test.err)
+		if succeeded != test.succeeded || result != test.result {
+			t.Errorf("%s: expected %t %q, got %t %q", name, test.succeeded, test.result, succeeded, result)
+		}
+	}
+}
+
+func TestCollectSchedule(t *testing.T) {
+	clock, setTime := setClock()
+	sched := &ScheduledImageStreamController{
+		attempts:  make(map[string]scheduledImportAttempt),
+		scheduler: newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0, func(key, value interface{}, due time.Time) {}),
+	}
+	sched.scheduler.Add("ns/imported", nil, time.Hour)
+	sched.scheduler.Add("ns/new", nil, time.Hour)
+	setTime(time.Minute)
+	sched.scheduler.Delay("ns/imported")
+	sched.recordAttempt("ns/imported", scheduledImportAttempt{time: time.Unix(60, 0), succeeded: true})
+	newNext, _ := sched.scheduler.Next("ns/new")
+
+	states := map[string]metrics.ScheduledImportState{}
+	for _, state := range sched.collectSchedule() {
+		states[state.Name] = state
+	}
+	expected := map[string]metrics.ScheduledImportState{
+		"imported": {Namespace: "ns", Name: "imported", LastAttempt: time.Unix(60, 0), Succeeded: true, Next: time.Unix(0, int64(61*time.Minute))},
+		"new":      {Namespace: "ns", Name: "new", Next: newNext},
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("expected %#v, got %#v", expected, states)
+	}
+
+	sched.forgetStream("ns/imported")
+	if len(sched.attempts) != 0 {
+		t.Errorf("expected the attempt to be forgotten, got %v", sched.attempts)
+	}
+}
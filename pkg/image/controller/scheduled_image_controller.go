@@ -2,14 +2,18 @@ package controller
 
 import (
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"k8s.io/klog/v2"
 
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/tools/record"
 
 	imagev1 "github.com/openshift/api/image/v1"
 	imagev1lister "github.com/openshift/client-go/image/listers/image/v1"
@@ -18,6 +22,42 @@ import (
 	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
 )
 
+const (
+	// ScheduledImportIntervalAnnotation may be set on an image stream to the interval (a Go
+	// duration such as "6h") between scheduled imports of its tags. Intervals shorter than the
+	// cluster minimum are raised to it.
+	ScheduledImportIntervalAnnotation = "image.openshift.io/scheduled-import-interval"
+
+	// ScheduledImportSkippedAnnotation is set on image streams whose scheduled imports are
+	// skipped because the circuit breaker of a registry their tags are imported from is open.
+	// It is removed once imports from all registries of the stream go through again.
+	ScheduledImportSkippedAnnotation = "image.openshift.io/scheduled-import-skipped"
+
+	// LastScheduledImportAnnotation is set on scheduled image streams to the time of their last
+	// scheduled import, in RFC 3339 format. Unless the result changes, it is refreshed at most
+	// every scheduledImportReportInterval.
+	LastScheduledImportAnnotation = "image.openshift.io/last-scheduled-import"
+	// LastScheduledImportResultAnnotation is set on scheduled image streams to the result of
+	// their last scheduled import: "Success", "Skipped" if no tag was due, or "Failed: " and
+	// the reasons some or all images were not imported.
+	LastScheduledImportResultAnnotation = "image.openshift.io/last-scheduled-import-result"
+	// NextScheduledImportAnnotation is set on scheduled image streams to the time their next
+	// scheduled import was due at the time of the last one, in RFC 3339 format.
+	NextScheduledImportAnnotation = "image.openshift.io/next-scheduled-import"
+
+	// reasonRegistryUnavailable is the reason of events about skipped scheduled imports.
+	reasonRegistryUnavailable = "RegistryUnavailable"
+
+	// scheduledImportReportInterval is the minimum interval between patches of the scheduled
+	// import annotations of a stream whose result did not change, as the informers of every
+	// image controller are notified of each patch.
+	scheduledImportReportInterval = time.Hour
+
+	// scheduledImportJitter is the maximum factor of the interval added to the time of each
+	// scheduled import, so that streams with the same interval spread out over time.
+	scheduledImportJitter = 0.1
+)
+
 type uniqueItem struct {
 	uid             string
 	resourceVersion string
@@ -35,12 +75,32 @@ type ScheduledImageStreamController struct {
 	// listerSynced makes sure the is store is synced before reconciling streams
 	listerSynced cache.InformerSynced
 
-	// rateLimiter to be used when re-importing images
-	rateLimiter flowcontrol.RateLimiter
+	// minimumInterval is the shortest interval between scheduled imports of a stream
+	minimumInterval time.Duration
 
-	// scheduler for timely image re-imports
+	// scheduler for timely image re-imports, rate limited to the maximum number of imports
 	scheduler *scheduler
 
+	// registries rate limits imports per registry, and skips registries that keep failing
+	registries *registryLimiter
+
+	// recorder records events about skipped imports
+	recorder record.EventRecorder
+
+	// references reports the tags referenced by image triggers. Streams without referenced
+	// tags, and the unreferenced tags of other streams, are imported unreferencedFactor times
+	// less often.
+	references         TagReferences
+	unreferencedFactor int
+
+	fullImportsLock sync.Mutex
+	// fullImports holds the time all scheduled tags of a stream were last imported, by key
+	fullImports map[string]time.Time
+
+	attemptsLock sync.Mutex
+	// attempts holds the outcome of the last scheduled import of a stream, by key
+	attempts map[string]scheduledImportAttempt
+
 	// importCounter counts successful and failed imports for metric collection
 	importCounter *ImportMetricCounter
 }
@@ -74,8 +134,13 @@ func (s *ScheduledImageStreamController) Run(stopCh <-chan struct{}) {
 	}
 
 	go s.scheduler.RunUntil(stopCh)
+	if s.references != nil {
+		go wait.Until(s.refreshIntervals, scheduledIntervalRefreshPeriod, stopCh)
+	}
 
 	metrics.InitializeImportCollector(true, s.importCounter.Collect)
+	metrics.InitializeRegistryBreakerCollector(s.registries.Collect)
+	metrics.InitializeScheduledImportCollector(s.collectSchedule)
 
 	<-stopCh
 	klog.Infof("Shutting down image stream controller")
@@ -110,6 +175,7 @@ func (s *ScheduledImageStreamController) deleteImageStream(obj interface{}) {
 		return
 	}
 	s.scheduler.Remove(key, nil)
+	s.forgetStream(key)
 }
 
 // enqueueImageStream ensures an image stream is checked for scheduling
@@ -123,31 +189,29 @@ func (s *ScheduledImageStreamController) enqueueImageStream(stream *imagev1.Imag
 			klog.V(2).Infof("unable to get namespace key function for stream %s/%s: %v", stream.Namespace, stream.Name, err)
 			return
 		}
-		s.scheduler.Add(key, uniqueItem{uid: string(stream.UID), resourceVersion: stream.ResourceVersion})
+		s.scheduler.Add(key, uniqueItem{uid: string(stream.UID), resourceVersion: stream.ResourceVersion}, s.importInterval(stream))
 	}
 }
 
-// syncTimed is invoked when a key is ready to be processed.
-func (s *ScheduledImageStreamController) syncTimed(key, value interface{}) {
+// syncTimed is invoked when a key is ready to be processed, after it was due.
+func (s *ScheduledImageStreamController) syncTimed(key, value interface{}, due time.Time) {
 	if !s.enabled {
 		s.scheduler.Remove(key, value)
 		return
 	}
-	if s.rateLimiter != nil && !s.rateLimiter.TryAccept() {
-		klog.V(5).Infof("DEBUG: check of %s exceeded rate limit, will retry later", key)
-		return
-	}
 	namespace, name, err := cache.SplitMetaNamespaceKey(key.(string))
 	if err != nil {
 		klog.V(2).Infof("unable to split namespace key for key %q: %v", key, err)
 		return
 	}
-	if err := s.syncTimedByName(namespace, name); err != nil {
+	if err := s.syncTimedByName(namespace, name, due); err != nil {
 		// the stream cannot be imported
 		if err == ErrNotImportable {
 			// value must match to be removed, so we avoid races against creation by ensuring that we only
 			// remove the stream if the uid and resource version in the scheduler are exactly the same.
-			s.scheduler.Remove(key, value)
+			if s.scheduler.Remove(key, value) {
+				s.forgetStream(key.(string))
+			}
 			return
 		}
 		utilruntime.HandleError(err)
@@ -155,7 +219,43 @@ func (s *ScheduledImageStreamController) syncTimed(key, value interface{}) {
 	}
 }
 
-func (s *ScheduledImageStreamController) syncTimedByName(namespace, name string) error {
+// importInterval returns the interval between scheduled imports of the stream, which is
+// never less than the minimum interval. Streams whose scheduled tags are not referenced by
+// any image trigger are imported unreferencedFactor times less often.
+func (s *ScheduledImageStreamController) importInterval(stream *imagev1.ImageStream) time.Duration {
+	interval := s.baseInterval(stream)
+	if referenced, ok := s.referencedTags(stream); ok && len(referenced) == 0 {
+		return interval * time.Duration(s.unreferencedFactor)
+	}
+	return interval
+}
+
+// baseInterval returns the interval between scheduled imports of the referenced tags of the
+// stream, which is never less than the minimum interval.
+func (s *ScheduledImageStreamController) baseInterval(stream *imagev1.ImageStream) time.Duration {
+	interval, ok := parseImportInterval(stream)
+	if !ok || interval < s.minimumInterval {
+		return s.minimumInterval
+	}
+	return interval
+}
+
+// parseImportInterval returns the interval of the ScheduledImportIntervalAnnotation of the
+// stream, if it is set to a valid duration.
+func parseImportInterval(stream *imagev1.ImageStream) (time.Duration, bool) {
+	value, ok := stream.Annotations[ScheduledImportIntervalAnnotation]
+	if !ok {
+		return 0, false
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		klog.V(2).Infof("ignoring invalid scheduled import interval %q of stream %s/%s", value, stream.Namespace, stream.Name)
+		return 0, false
+	}
+	return interval, true
+}
+
+func (s *ScheduledImageStreamController) syncTimedByName(namespace, name string, due time.Time) error {
 	sharedStream, err := s.lister.ImageStreams(namespace).Get(name)
 	if err != nil {
 		if apierrs.IsNotFound(err) {
@@ -167,34 +267,84 @@ func (s *ScheduledImageStreamController) syncTimedByName(namespace, name string)
 		return ErrNotImportable
 	}
 
+	key := namespace + "/" + name
 	stream := sharedStream.DeepCopy()
 	resetScheduledTags(stream)
+	s.deferUnreferencedTags(key, stream, sharedStream)
+	unavailable := s.limitRegistries(stream, sharedStream)
+	now := s.scheduler.clock.Now()
+	observeScheduleLag(stream, sharedStream, now.Sub(due))
 
 	klog.V(3).Infof("Scheduled import of stream %s/%s...", stream.Namespace, stream.Name)
-	result, err := handleImageStream(stream, s.client, nil)
+	result, err := handleImageStream(stream, s.client, nil, true)
 	s.importCounter.Increment(result, err)
+	s.registries.Record(result)
+	if err == ErrNotImportable {
+		return err
+	}
+
+	succeeded, message := describeImportResult(result, err)
+	s.recordAttempt(key, scheduledImportAttempt{time: now, succeeded: succeeded})
+	next, _ := s.scheduler.Next(key)
+	if reportErr := s.reportImport(sharedStream, now, message, next, unavailable); reportErr != nil {
+		utilruntime.HandleError(reportErr)
+	}
 	return err
 }
 
+// limitRegistries reverts the generation bump of the scheduled tags imported from registries
+// which are rate limited or whose circuit breaker is open, so that they are not imported. It
+// returns the reasons the tags from unavailable registries are skipped.
+func (s *ScheduledImageStreamController) limitRegistries(stream, original *imagev1.ImageStream) []string {
+	allowed := map[string]error{}
+	var unavailable []string
+	for i, tagRef := range stream.Spec.Tags {
+		originalRef, ok := scheduledForImport(original, tagRef)
+		if !ok {
+			continue
+		}
+		registry := tagRegistry(tagRef)
+		if len(registry) == 0 {
+			continue
+		}
+		err, ok := allowed[registry]
+		if !ok {
+			err = s.registries.Allow(registry)
+			allowed[registry] = err
+			if unavailableErr, ok := err.(*errRegistryUnavailable); ok {
+				unavailable = append(unavailable, unavailableErr.Error())
+			}
+		}
+		if err != nil {
+			klog.V(4).Infof("Skipping scheduled import of tag %s of stream %s/%s: %v", tagRef.Name, stream.Namespace, stream.Name, err)
+			stream.Spec.Tags[i].Generation = originalRef.Generation
+		}
+	}
+	sort.Strings(unavailable)
+	return unavailable
+}
+
 // resetScheduledTags artificially increments the generation on the tags that should be imported.
 func resetScheduledTags(stream *imagev1.ImageStream) {
 	next := stream.Generation + 1
 	for tag, tagRef := range stream.Spec.Tags {
-		if tagImportable(tagRef) && tagRef.ImportPolicy.Scheduled {
-			if ref, err := imageref.Parse(tagRef.From.Name); err != nil && len(tagRef.From.Name) > 0 {
-				continue
-			} else if len(ref.ID) > 0 && tagImported(stream, tagRef) {
-				// ref.ID is set if this is a canonical, sha/digest ref;
-				// we allow scheduled import of those, but only until it succeeds
-				// at least once.
-				continue
-			}
+		if tagScheduled(stream, tagRef) {
 			tagRef.Generation = &next
 			stream.Spec.Tags[tag] = tagRef
 		}
 	}
 }
 
+// scheduledForImport returns the original of a tag and true if the generation of the tag was
+// bumped so that it is imported.
+func scheduledForImport(original *imagev1.ImageStream, tagRef imagev1.TagReference) (imagev1.TagReference, bool) {
+	originalRef, ok := imageutil.SpecHasTag(original, tagRef.Name)
+	if !ok || tagRef.Generation == nil || (originalRef.Generation != nil && *originalRef.Generation == *tagRef.Generation) {
+		return originalRef, false
+	}
+	return originalRef, true
+}
+
 // tagImported returns if a tag has been imported and is on the last generation.
 func tagImported(stream *imagev1.ImageStream, tag imagev1.TagReference) bool {
 	tagEvents, hasTag := imageutil.StatusHasTag(stream, tag.Name)
@@ -207,17 +357,25 @@ func tagImported(stream *imagev1.ImageStream, tag imagev1.TagReference) bool {
 // needsScheduling returns true if this image stream has any scheduled tags
 func needsScheduling(stream *imagev1.ImageStream) bool {
 	for _, tagRef := range stream.Spec.Tags {
-		if tagImportable(tagRef) && tagRef.ImportPolicy.Scheduled {
-			if ref, err := imageref.Parse(tagRef.From.Name); err != nil && len(tagRef.From.Name) > 0 {
-				continue
-			} else if len(ref.ID) > 0 && tagImported(stream, tagRef) {
-				// ref.ID is set if this is a canonical, sha/digest ref;
-				// we allow scheduled import of those, but only until it succeeds
-				// at least once.
-				continue
-			}
+		if tagScheduled(stream, tagRef) {
 			return true
 		}
 	}
 	return false
 }
+
+// tagScheduled returns true if the tag should be imported on schedule.
+func tagScheduled(stream *imagev1.ImageStream, tagRef imagev1.TagReference) bool {
+	if !tagImportable(tagRef) || !tagRef.ImportPolicy.Scheduled {
+		return false
+	}
+	if ref, err := imageref.Parse(tagRef.From.Name); err != nil && len(tagRef.From.Name) > 0 {
+		return false
+	} else if len(ref.ID) > 0 && tagImported(stream, tagRef) {
+		// ref.ID is set if this is a canonical, sha/digest ref;
+		// we allow scheduled import of those, but only until it succeeds
+		// at least once.
+		return false
+	}
+	return true
+}
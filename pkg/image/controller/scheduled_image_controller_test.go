@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -10,6 +13,7 @@ import (
 	apitesting "k8s.io/apimachinery/pkg/api/apitesting"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	restfake "k8s.io/client-go/rest/fake"
+	"k8s.io/client-go/tools/record"
 
 	imagev1 "github.com/openshift/api/image/v1"
 	fakeimagev1client "github.com/openshift/client-go/image/clientset/versioned/fake"
@@ -47,18 +51,19 @@ func TestScheduledImport(t *testing.T) {
 	imageInformers := imagev1informer.NewSharedInformerFactory(fakeimagev1client.NewSimpleClientset(), 0)
 	isInformer := imageInformers.Image().V1().ImageStreams()
 	fake := fakeimagev1client.NewSimpleClientset()
-	sched := NewScheduledImageStreamController(fake, isInformer, ScheduledImageStreamControllerOptions{
-		Enabled:           true,
-		Resync:            1 * time.Second,
-		DefaultBucketSize: 4,
+	sched := NewScheduledImageStreamController(fake, isInformer, record.NewBroadcaster(), ScheduledImageStreamControllerOptions{
+		Enabled: true,
+		Resync:  1 * time.Second,
 	})
-	actions := 0
+	// the clock advances to the next deadline whenever the scheduler waits
+	sched.scheduler.clock = newFakeClock(1)
+	var actions []string
 	_, codecs := apitesting.SchemeForOrDie(imagev1.Install)
 	fakeREST := &restfake.RESTClient{
 		NegotiatedSerializer: codecs,
 		GroupVersion:         imagev1.SchemeGroupVersion,
-		Client: restfake.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
-			actions++
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			actions = append(actions, req.Method+" "+req.URL.Path)
 			return &http.Response{
 				StatusCode: http.StatusOK,
 				Header:     header(),
@@ -78,7 +83,7 @@ func TestScheduledImport(t *testing.T) {
 	}
 
 	// encountering a not found error for image streams should drop the stream
-	for i := 0; i < 3; i++ { // loop all the buckets (2 + the additional internal one)
+	for i := 0; i < 3; i++ { // wait for the deadline, handle the stream, and wait again
 		sched.scheduler.RunOnce()
 	}
 	if sched.scheduler.Len() != 0 {
@@ -94,21 +99,22 @@ func TestScheduledImport(t *testing.T) {
 	isInformer.Informer().GetIndexer().Add(stream)
 
 	// run a background import
-	for i := 0; i < 3; i++ { // loop all the buckets (2 + the additional internal one)
+	for i := 0; i < 3; i++ { // wait for the deadline, handle the stream, and wait again
 		sched.scheduler.RunOnce()
 	}
 	if sched.scheduler.Len() != 1 {
 		t.Fatalf("should have left item in scheduler: %#v", sched.scheduler)
 	}
-	if actions != 1 || (fakeREST.Req.Method != "POST" && !strings.Contains(fakeREST.Req.URL.String(), "imagestreamimports")) {
-		t.Fatalf("invalid actions: %v %v", fakeREST.Req.Method, fakeREST.Req.URL)
+	// the stream is imported, and annotated with the result
+	if !reflect.DeepEqual(actions, []string{"POST /namespaces/other/imagestreamimports", "PATCH /namespaces/other/imagestreams/test"}) {
+		t.Fatalf("invalid actions: %v", actions)
 	}
 
 	// disabling the scheduled import should drop the stream
 	sched.enabled = false
 	fake.ClearActions()
 
-	for i := 0; i < 3; i++ { // loop all the buckets (2 + the additional internal one)
+	for i := 0; i < 3; i++ { // wait for the deadline, handle the stream, and wait again
 		sched.scheduler.RunOnce()
 	}
 	if sched.scheduler.Len() != 0 {
@@ -125,6 +131,160 @@ func TestScheduledImport(t *testing.T) {
 	}
 }
 
+func TestScheduledImportSkipsUnavailableRegistries(t *testing.T) {
+	one := int64(1)
+	scheduledTag := func(name, from string) imagev1.TagReference {
+		return imagev1.TagReference{
+			Name:         name,
+			From:         &corev1.ObjectReference{Kind: "DockerImage", Name: from},
+			Generation:   &one,
+			ImportPolicy: imagev1.TagImportPolicy{Scheduled: true},
+		}
+	}
+	stream := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test", Namespace: "other", UID: "1", ResourceVersion: "1",
+			Annotations: map[string]string{imagev1.DockerImageRepositoryCheckAnnotation: "done"},
+			Generation:  1,
+		},
+		Spec: imagev1.ImageStreamSpec{
+			Tags: []imagev1.TagReference{
+				scheduledTag("down", "quay.io/down/image:latest"),
+				scheduledTag("up", "mysql:latest"),
+			},
+		},
+		Status: imagev1.ImageStreamStatus{
+			Tags: []imagev1.NamedTagEventList{
+				{Tag: "down", Items: []imagev1.TagEvent{{Generation: 1}}},
+				{Tag: "up", Items: []imagev1.TagEvent{{Generation: 1}}},
+			},
+		},
+	}
+
+	imageInformers := imagev1informer.NewSharedInformerFactory(fakeimagev1client.NewSimpleClientset(), 0)
+	isInformer := imageInformers.Image().V1().ImageStreams()
+	isInformer.Informer().GetIndexer().Add(stream)
+	sched := NewScheduledImageStreamController(fakeimagev1client.NewSimpleClientset(), isInformer, record.NewBroadcaster(), ScheduledImageStreamControllerOptions{
+		Enabled:        true,
+		Resync:         time.Minute,
+		RegistryLimits: RegistryLimitsConfig{FailureThreshold: 1},
+	})
+	recorder := record.NewFakeRecorder(10)
+	sched.recorder = recorder
+	sched.registries.Record(importResult(map[string]metav1.StatusReason{"quay.io/down/image:latest": metav1.StatusReasonServiceUnavailable}))
+
+	_, codecs := apitesting.SchemeForOrDie(imagev1.Install)
+	var imported []string
+	var patches []string
+	fakeREST := &restfake.RESTClient{
+		NegotiatedSerializer: codecs,
+		GroupVersion:         imagev1.SchemeGroupVersion,
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/imagestreamimports"):
+				isi := &imagev1.ImageStreamImport{}
+				if err := json.Unmarshal(body, isi); err != nil {
+					t.Fatal(err)
+				}
+				for _, image := range isi.Spec.Images {
+					imported = append(imported, image.To.Name)
+				}
+				return &http.Response{StatusCode: http.StatusOK, Header: header(), Body: objBody(&imagev1.ImageStreamImport{})}, nil
+			case req.Method == "PATCH" && strings.HasSuffix(req.URL.Path, "/imagestreams/test"):
+				patches = append(patches, string(body))
+				return &http.Response{StatusCode: http.StatusOK, Header: header(), Body: objBody(stream)}, nil
+			}
+			t.Fatalf("unexpected request: %s %s", req.Method, req.URL)
+			return nil, nil
+		}),
+	}
+	sched.client = fakeREST
+	sched.enqueueImageStream(stream)
+
+	if err := sched.syncTimedByName("other", "test", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(imported, []string{"up"}) {
+		t.Errorf("expected only the tag from the available registry to be imported, got %v", imported)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0], ScheduledImportSkippedAnnotation) || !strings.Contains(patches[0], "registry quay.io is unavailable") {
+		t.Errorf("expected the stream to be annotated with the skipped registry, got %v", patches)
+	}
+	if len(patches) == 1 {
+		patch := struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}{}
+		if err := json.Unmarshal([]byte(patches[0]), &patch); err != nil {
+			t.Fatal(err)
+		}
+		annotations := patch.Metadata.Annotations
+		if annotations[LastScheduledImportResultAnnotation] != "Success" {
+			t.Errorf("expected the import result to be recorded, got %v", annotations)
+		}
+		for _, name := range []string{LastScheduledImportAnnotation, NextScheduledImportAnnotation} {
+			if _, err := time.Parse(time.RFC3339, annotations[name]); err != nil {
+				t.Errorf("expected %s to be set to a time, got %v", name, annotations)
+			}
+		}
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, reasonRegistryUnavailable) || !strings.Contains(event, "quay.io") {
+			t.Errorf("unexpected event: %s", event)
+		}
+	default:
+		t.Errorf("expected an event about the skipped registry")
+	}
+
+	// the annotation is removed once the registry is available again
+	sched.registries.Record(importResult(map[string]metav1.StatusReason{"quay.io/down/image:latest": ""}))
+	annotated := stream.DeepCopy()
+	annotated.Annotations[ScheduledImportSkippedAnnotation] = "skipped"
+	isInformer.Informer().GetIndexer().Update(annotated)
+	imported, patches = nil, nil
+	if err := sched.syncTimedByName("other", "test", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported) != 2 {
+		t.Errorf("expected both tags to be imported, got %v", imported)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0], `"`+ScheduledImportSkippedAnnotation+`":null`) {
+		t.Errorf("expected the annotation to be removed, got %v", patches)
+	}
+
+	// the stream is not patched while the result stays the same, until the annotations are
+	// older than the report interval
+	reported := stream.DeepCopy()
+	reported.Annotations[LastScheduledImportResultAnnotation] = "Success"
+	reported.Annotations[LastScheduledImportAnnotation] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	isInformer.Informer().GetIndexer().Update(reported)
+	imported, patches = nil, nil
+	if err := sched.syncTimedByName("other", "test", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported) != 2 {
+		t.Errorf("expected both tags to be imported, got %v", imported)
+	}
+	if len(patches) != 0 {
+		t.Errorf("expected the unchanged result not to be patched, got %v", patches)
+	}
+
+	reported = reported.DeepCopy()
+	reported.Annotations[LastScheduledImportAnnotation] = time.Now().Add(-scheduledImportReportInterval).UTC().Format(time.RFC3339)
+	isInformer.Informer().GetIndexer().Update(reported)
+	patches = nil
+	if err := sched.syncTimedByName("other", "test", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0], LastScheduledImportAnnotation) || !strings.Contains(patches[0], NextScheduledImportAnnotation) {
+		t.Errorf("expected the annotations to be refreshed after the report interval, got %v", patches)
+	}
+}
+
 func TestSchedulingChecks(t *testing.T) {
 	one := int64(1)
 	tests := map[string]struct {
@@ -302,3 +462,37 @@ func TestSchedulingChecks(t *testing.T) {
 		}
 	}
 }
+
+func TestScheduledImportInterval(t *testing.T) {
+	sched := &ScheduledImageStreamController{minimumInterval: 15 * time.Minute}
+	tests := map[string]struct {
+		annotations map[string]string
+		expected    time.Duration
+	}{
+		"no annotation uses the minimum": {
+			expected: 15 * time.Minute,
+		},
+		"longer interval": {
+			annotations: map[string]string{ScheduledImportIntervalAnnotation: "6h"},
+			expected:    6 * time.Hour,
+		},
+		"shorter interval is raised to the minimum": {
+			annotations: map[string]string{ScheduledImportIntervalAnnotation: "1m"},
+			expected:    15 * time.Minute,
+		},
+		"invalid interval uses the minimum": {
+			annotations: map[string]string{ScheduledImportIntervalAnnotation: "daily"},
+			expected:    15 * time.Minute,
+		},
+		"negative interval uses the minimum": {
+			annotations: map[string]string{ScheduledImportIntervalAnnotation: "-6h"},
+			expected:    15 * time.Minute,
+		},
+	}
+	for name, test := range tests {
+		stream := &imagev1.ImageStream{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "other", Annotations: test.annotations}}
+		if actual := sched.importInterval(stream); actual != test.expected {
+			t.Errorf("%s: expected interval %s, got %s", name, test.expected, actual)
+		}
+	}
+}
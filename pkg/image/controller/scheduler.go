@@ -1,50 +1,82 @@
 package controller
 
 import (
+	"container/heap"
+	"math/rand"
 	"sync"
+	"time"
 
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
 )
 
-// NOTE: scheduler's semantics do not lend it for reuse elsewhere and its use in
-// this package quite probably has some odd corner cases/race conditions.  If
-// these cause problems in the future, this implementation should be replaced
-// with a new and simpler one based on container/heap.  End users looking for a
-// component like this: see if k8s.io/client-go/util/workqueue.NewDelayingQueue
-// suits your needs.
+// schedulerIdlePeriod is the longest the scheduler sleeps before checking the queue again,
+// so that items added with an earlier deadline than the current head are not missed.
+const schedulerIdlePeriod = time.Second
 
-// scheduler is a self-balancing, rate-limited, bucketed queue that can periodically invoke
-// an action on all items in a bucket before moving to the next bucket. A ratelimiter sets
-// an upper bound on the number of buckets processed per unit time. The queue has a key and a
+// scheduler is a rate-limited, deadline-ordered queue that periodically invokes an action on
+// each of its items. Every item has its own interval, and is handled once its next deadline
+// has passed, after which it is scheduled again one (jittered) interval later. A rate limiter
+// sets an upper bound on the number of items handled per unit time. The queue has a key and a
 // value, so both uniqueness and equality can be tested (key must be unique, value can carry
 // info for the next processing). Items remain in the queue until removed by a call to Remove().
 type scheduler struct {
-	handle   func(key, value interface{})
-	position int
-	limiter  flowcontrol.RateLimiter
+	handle  func(key, value interface{}, due time.Time)
+	limiter flowcontrol.RateLimiter
+	clock   flowcontrol.Clock
+	// jitter is the maximum factor of the interval added to each deadline.
+	jitter float64
+
+	mu    sync.Mutex
+	queue scheduledItems
+	items map[interface{}]*scheduledItem
+}
 
-	mu      sync.Mutex
-	buckets []bucket
+// scheduledItem is a queued key, with the time it has to be handled next.
+type scheduledItem struct {
+	key      interface{}
+	value    interface{}
+	interval time.Duration
+	next     time.Time
+	index    int
 }
 
-type bucket map[interface{}]interface{}
+// scheduledItems is a heap of items ordered by their deadlines.
+type scheduledItems []*scheduledItem
 
-// newScheduler creates a scheduler with bucketCount buckets, a rate limiter for restricting
-// the rate at which buckets are processed, and a function to invoke when items are scanned in
-// a bucket.
-func newScheduler(bucketCount int, bucketLimiter flowcontrol.RateLimiter, fn func(key, value interface{})) *scheduler {
-	// Add one more bucket to serve as the "current" bucket
-	bucketCount++
-	buckets := make([]bucket, bucketCount)
-	for i := range buckets {
-		buckets[i] = make(bucket)
-	}
+var _ heap.Interface = &scheduledItems{}
+
+func (q scheduledItems) Len() int           { return len(q) }
+func (q scheduledItems) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q scheduledItems) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *scheduledItems) Push(x interface{}) {
+	item := x.(*scheduledItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+func (q *scheduledItems) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// newScheduler creates a scheduler with a rate limiter restricting the rate at which items are
+// handled, a jitter factor for the deadlines, and a function to invoke when items are due. The
+// function is passed the deadline the item was due at.
+func newScheduler(limiter flowcontrol.RateLimiter, clock flowcontrol.Clock, jitter float64, fn func(key, value interface{}, due time.Time)) *scheduler {
 	return &scheduler{
 		handle:  fn,
-		buckets: buckets,
-		limiter: bucketLimiter,
+		limiter: limiter,
+		clock:   clock,
+		jitter:  jitter,
+		items:   make(map[interface{}]*scheduledItem),
 	}
 }
 
@@ -53,112 +85,151 @@ func (s *scheduler) RunUntil(ch <-chan struct{}) {
 	go utilwait.Until(s.RunOnce, 0, ch)
 }
 
-// RunOnce takes a single item out of the current bucket and processes it. If
-// the bucket is empty, we wait for the rate limiter before returning.
+// RunOnce handles the item with the earliest deadline if it is due. If no item is due, we
+// sleep until the next deadline, or at most schedulerIdlePeriod, before returning.
 func (s *scheduler) RunOnce() {
-	key, value, last := s.next()
-	if last {
-		klog.V(5).Infof("Image controller scheduler: waiting for limit")
-		s.limiter.Accept()
+	key, value, due, wait := s.next()
+	if wait > 0 {
+		klog.V(5).Infof("Image controller scheduler: nothing due, waiting %s", wait)
+		s.clock.Sleep(wait)
 		return
 	}
+	s.limiter.Accept()
 	klog.V(5).Infof("Image controller scheduler: handle %s", key)
-	s.handle(key, value)
+	s.handle(key, value, due)
+}
+
+// next schedules the next run of the item with the earliest deadline and returns it with the
+// deadline it was due at, if it is due. Otherwise it returns how long to wait before checking
+// again.
+func (s *scheduler) next() (interface{}, interface{}, time.Time, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return nil, nil, time.Time{}, schedulerIdlePeriod
+	}
+	now := s.clock.Now()
+	item := s.queue[0]
+	if wait := item.next.Sub(now); wait > 0 {
+		if wait > schedulerIdlePeriod {
+			wait = schedulerIdlePeriod
+		}
+		return nil, nil, time.Time{}, wait
+	}
+	due := item.next
+	item.next = now.Add(s.jittered(item.interval))
+	heap.Fix(&s.queue, item.index)
+	return item.key, item.value, due, 0
 }
 
-// at returns the bucket index relative to the current bucket.
-func (s *scheduler) at(inc int) int {
-	return (s.position + inc + len(s.buckets)) % len(s.buckets)
+// jittered returns the interval with up to s.jitter of it added.
+func (s *scheduler) jittered(interval time.Duration) time.Duration {
+	if s.jitter <= 0 {
+		return interval
+	}
+	return utilwait.Jitter(interval, s.jitter)
 }
 
-// next takes a key from the current bucket and places it in the last bucket, returns the
-// removed key. Returns true if the current bucket is empty and no key and value were returned.
-func (s *scheduler) next() (interface{}, interface{}, bool) {
+// Add queues the key to be handled every interval. The key is used to determine uniqueness,
+// while value can be used to associate additional data for later retrieval. An Add replaces the
+// previous value and interval of the key. This allows callers to ensure that Add'ing a new item
+// to the queue purges old versions of the item, while Remove can be conditional on removing only
+// the known old version. New keys are first handled at a random point within their interval, so
+// that keys added together do not all come due at once; existing keys keep their deadline unless
+// the new interval makes it earlier.
+func (s *scheduler) Add(key, value interface{}, interval time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	klog.V(5).Infof("Image controller scheduler: queue (%d):\n %#v", s.position, s.buckets)
-
-	last := s.buckets[s.position]
-	// Grab the first item in the bucket, move it to the end and return it.
-	for k, v := range last {
-		delete(last, k)
-		s.buckets[s.at(-1)][k] = v
-		return k, v, false
+
+	now := s.clock.Now()
+	if item, ok := s.items[key]; ok {
+		item.value = value
+		s.setInterval(item, interval, now)
+		klog.V(5).Infof("Image controller scheduler: update %s, next at %s", key, item.next)
+		return
+	}
+
+	item := &scheduledItem{
+		key:      key,
+		value:    value,
+		interval: interval,
+		next:     now,
 	}
-	// The bucket was empty.  Advance to the next bucket.
-	s.position = s.at(1)
-	klog.V(5).Infof("Image controller scheduler: bucket was empty, advance to %d of %d buckets", s.position, len(s.buckets))
-	return nil, nil, true
-}
-
-// Add places the key in the bucket with the least entries (except the current bucket). The key is used to
-// determine uniqueness, while value can be used to associate additional data for later retrieval. An Add
-// removes the previous key and value and will place the item in a new bucket. This allows callers to ensure
-// that Add'ing a new item to the queue purges old versions of the item, while Remove can be conditional on
-// removing only the known old version.
-func (s *scheduler) Add(key, value interface{}) {
+	if interval > 0 {
+		item.next = now.Add(time.Duration(rand.Int63n(int64(interval))))
+	}
+	heap.Push(&s.queue, item)
+	s.items[key] = item
+	klog.V(5).Infof("Image controller scheduler: add %s, next at %s", key, item.next)
+}
+
+// SetInterval changes the interval of the key, if it exists. As with Add, the deadline of the
+// key only moves if the new interval makes it earlier.
+func (s *scheduler) SetInterval(key interface{}, interval time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, bucket := range s.buckets {
-		delete(bucket, key)
+	item, ok := s.items[key]
+	if !ok || item.interval == interval {
+		return
 	}
+	s.setInterval(item, interval, s.clock.Now())
+	klog.V(5).Infof("Image controller scheduler: interval of %s is now %s, next at %s", key, interval, item.next)
+}
 
-	// Pick the bucket with the least entries that is furthest from the current position
-	n := len(s.buckets)
-	base := s.position + n
-	target, least := 0, 0
-	for i := n - 1; i > 0; i-- {
-		position := (base + i) % n
-		size := len(s.buckets[position])
-		if size == 0 {
-			target = position
-			break
-		}
-		if size < least || least == 0 {
-			target = position
-			least = size
-		}
+// setInterval changes the interval of the item, and brings its deadline forward if the new
+// interval ends earlier. The caller must hold s.mu.
+func (s *scheduler) setInterval(item *scheduledItem, interval time.Duration, now time.Time) {
+	item.interval = interval
+	if next := now.Add(s.jittered(interval)); next.Before(item.next) {
+		item.next = next
+		heap.Fix(&s.queue, item.index)
 	}
-	klog.V(5).Infof("Image controller scheduler: add %s to bucket %d", key, target)
-	s.buckets[target][key] = value
 }
 
-// Remove takes the key out of all buckets. If value is non-nil, the key will only be removed if it has
-// the same value. Returns true if the key was removed.
+// Remove takes the key out of the queue. If value is non-nil, the key will only be removed if it
+// has the same value. Returns true if the key was removed.
 func (s *scheduler) Remove(key, value interface{}) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	match := true
-	for i, bucket := range s.buckets {
-		if value != nil {
-			if old, ok := bucket[key]; ok && old != value {
-				match = false
-				continue
-			}
-		}
-		klog.V(5).Infof("Image controller scheduler: remove %s from bucket %d", key, i)
-		delete(bucket, key)
+	item, ok := s.items[key]
+	if !ok {
+		return true
 	}
-	return match
+	if value != nil && item.value != value {
+		return false
+	}
+	klog.V(5).Infof("Image controller scheduler: remove %s", key)
+	heap.Remove(&s.queue, item.index)
+	delete(s.items, key)
+	return true
 }
 
-// Delay moves the key to the end of the chain if it exists.
+// Delay pushes the next deadline of the key one interval from now, if it exists.
 func (s *scheduler) Delay(key interface{}) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	last := s.at(-1)
-	for i, bucket := range s.buckets {
-		if i == last {
-			continue
-		}
-		if value, ok := bucket[key]; ok {
-			delete(bucket, key)
-			s.buckets[last][key] = value
-		}
+	item, ok := s.items[key]
+	if !ok {
+		return
+	}
+	item.next = s.clock.Now().Add(s.jittered(item.interval))
+	heap.Fix(&s.queue, item.index)
+}
+
+// Next returns the next deadline of the key, if it exists.
+func (s *scheduler) Next(key interface{}) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return time.Time{}, false
 	}
+	return item.next, true
 }
 
 // Len returns the number of scheduled items.
@@ -166,11 +237,7 @@ func (s *scheduler) Len() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	count := 0
-	for _, bucket := range s.buckets {
-		count += len(bucket)
-	}
-	return count
+	return len(s.queue)
 }
 
 // Map returns a copy of the scheduler contents, but does not copy the keys or values themselves.
@@ -180,10 +247,8 @@ func (s *scheduler) Map() map[interface{}]interface{} {
 	defer s.mu.Unlock()
 
 	out := make(map[interface{}]interface{})
-	for _, bucket := range s.buckets {
-		for k, v := range bucket {
-			out[k] = v
-		}
+	for k, item := range s.items {
+		out[k] = item.value
 	}
 	return out
 }
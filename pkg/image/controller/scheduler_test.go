@@ -11,101 +11,175 @@ import (
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
 )
 
+// setClock returns a fake clock, which only advances when set, and a function to set it.
+func setClock() (flowcontrol.Clock, func(time.Duration)) {
+	clock := &fakeClock{threads: -1, c: sync.Cond{L: &sync.Mutex{}}}
+	return clock, func(d time.Duration) {
+		clock.c.L.Lock()
+		defer clock.c.L.Unlock()
+		clock.now = int64(d)
+	}
+}
+
 func TestScheduler(t *testing.T) {
+	clock, setTime := setClock()
 	keys := []string{}
-	s := newScheduler(2, flowcontrol.NewFakeAlwaysRateLimiter(), func(key, value interface{}) {
+	var dues []time.Time
+	s := newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0, func(key, value interface{}, due time.Time) {
 		keys = append(keys, key.(string))
+		dues = append(dues, due)
 	})
 
-	for i := 0; i < 6; i++ {
-		s.RunOnce()
-		if len(keys) > 0 {
-			t.Fatal(keys)
-		}
-		if s.position != (i+1)%3 {
-			t.Fatal(s.position)
-		}
+	if _, _, _, wait := s.next(); wait != schedulerIdlePeriod {
+		t.Fatalf("expected an empty scheduler to wait %s, got %s", schedulerIdlePeriod, wait)
 	}
 
-	s.Add("first", "test")
-	found := false
-	for i, buckets := range s.buckets {
-		if _, ok := buckets["first"]; ok {
-			found = true
-		} else {
-			continue
-		}
-		if i == s.position {
-			t.Fatal("should not insert into current bucket")
-		}
+	s.Add("first", "test", time.Minute)
+	item := s.items["first"]
+	if item.next.After(time.Unix(0, int64(time.Minute))) {
+		t.Fatalf("expected the first run within the interval, got %s", item.next)
 	}
-	if !found {
-		t.Fatal("expected to find key in a bucket")
-	}
-
+	setTime(time.Minute)
 	s.Delay("first")
+	if !item.next.Equal(time.Unix(0, int64(2*time.Minute))) {
+		t.Fatalf("expected delay to push the deadline one interval from now, got %s", item.next)
+	}
 
-	for i := 0; i < 2; i++ { // Delay shouldn't have put the item in the current bucket
-		s.RunOnce()
+	setTime(2*time.Minute - time.Nanosecond)
+	if _, _, _, wait := s.next(); wait != time.Nanosecond {
+		t.Fatalf("expected to wait until the deadline, got %s", wait)
 	}
 	if len(keys) != 0 {
 		t.Fatal(keys)
 	}
+	setTime(2*time.Minute + time.Second)
 	s.RunOnce()
 	if !reflect.DeepEqual(keys, []string{"first"}) {
 		t.Fatal(keys)
 	}
+	if !dues[0].Equal(time.Unix(0, int64(2*time.Minute))) {
+		t.Fatalf("expected the item to be handled with the deadline it was due at, got %s", dues[0])
+	}
+	if next, ok := s.Next("first"); s.Len() != 1 || !ok || !next.Equal(time.Unix(0, int64(3*time.Minute+time.Second))) {
+		t.Fatalf("expected the handled item to be scheduled again one interval later, got %s", item.next)
+	}
+	if _, ok := s.Next("second"); ok {
+		t.Fatalf("expected no deadline for a key that is not in the queue")
+	}
+}
+
+func TestSchedulerIntervals(t *testing.T) {
+	clock, setTime := setClock()
+	intervals := map[string]time.Duration{"minutely": time.Minute, "hourly": time.Hour, "daily": 24 * time.Hour}
+	handled := map[string][]time.Time{}
+	s := newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0, func(key, value interface{}, due time.Time) {
+		handled[key.(string)] = append(handled[key.(string)], clock.Now())
+	})
+	for key, interval := range intervals {
+		s.Add(key, nil, interval)
+	}
+
+	// advance the clock exactly as far as the scheduler waits, for two days
+	var now time.Duration
+	for now < 48*time.Hour {
+		key, value, due, wait := s.next()
+		if wait > 0 {
+			now += wait
+			setTime(now)
+			continue
+		}
+		s.handle(key, value, due)
+	}
+
+	for key, interval := range intervals {
+		times := handled[key]
+		if expected := int(48 * time.Hour / interval); len(times) < expected {
+			t.Errorf("expected %s to be handled at least %d times, got %d", key, expected, len(times))
+			continue
+		}
+		if first := times[0].Sub(time.Unix(0, 0)); first > interval {
+			t.Errorf("expected %s to be handled first within its interval, got %s", key, first)
+		}
+		for i := 1; i < len(times); i++ {
+			if d := times[i].Sub(times[i-1]); d != interval {
+				t.Errorf("expected %s to be handled every %s, got %s", key, interval, d)
+				break
+			}
+		}
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	clock, _ := setClock()
+	s := newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0.1, func(key, value interface{}, due time.Time) {})
+	s.Add("test", nil, time.Hour)
+	for i := 0; i < 100; i++ {
+		s.Delay("test")
+		next := s.items["test"].next.Sub(time.Unix(0, 0))
+		if next < time.Hour || next > time.Hour+6*time.Minute {
+			t.Fatalf("expected the jittered deadline within 10%% above the interval, got %s", next)
+		}
+	}
 }
 
 func TestSchedulerAddAndDelay(t *testing.T) {
-	s := newScheduler(3, flowcontrol.NewFakeAlwaysRateLimiter(), func(key, value interface{}) {})
-	// 3 is the last bucket, 0 is the current bucket
-	s.Add("first", "other")
-	if s.buckets[3]["first"] != "other" {
-		t.Fatalf("placed key in wrong bucket: %#v", s.buckets)
+	clock, setTime := setClock()
+	s := newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0, func(key, value interface{}, due time.Time) {})
+	s.Add("first", "other", time.Hour)
+	s.Add("second", "other", time.Hour)
+	s.Delay("first")
+	s.Delay("second")
+	first := s.items["first"]
+	if !first.next.Equal(time.Unix(0, int64(time.Hour))) {
+		t.Fatalf("expected deadline after one interval, got %s", first.next)
 	}
-	s.Add("second", "other")
-	if s.buckets[2]["second"] != "other" {
-		t.Fatalf("placed key in wrong bucket: %#v", s.buckets)
+
+	// adding an existing key replaces its value but keeps its deadline
+	setTime(time.Minute)
+	s.Add("first", "new", time.Hour)
+	if s.Len() != 2 || first.value != "new" || !first.next.Equal(time.Unix(0, int64(time.Hour))) {
+		t.Fatalf("unexpected item after add: %#v", first)
 	}
-	s.Add("third", "other")
-	if s.buckets[1]["third"] != "other" {
-		t.Fatalf("placed key in wrong bucket: %#v", s.buckets)
+	// unless the new interval makes it earlier
+	s.Add("first", "new", 10*time.Minute)
+	if !first.next.Equal(time.Unix(0, int64(11*time.Minute))) || s.queue[0] != first {
+		t.Fatalf("expected a shorter interval to move the deadline forward, got %s", first.next)
 	}
-	s.Add("fourth", "other")
-	if s.buckets[3]["fourth"] != "other" {
-		t.Fatalf("placed key in wrong bucket: %#v", s.buckets)
+	// delaying an item uses its new interval
+	setTime(5 * time.Minute)
+	s.Delay("first")
+	if !first.next.Equal(time.Unix(0, int64(15*time.Minute))) {
+		t.Fatalf("expected delay to use the new interval, got %s", first.next)
 	}
-	s.Add("fifth", "other")
-	if s.buckets[2]["fifth"] != "other" {
-		t.Fatalf("placed key in wrong bucket: %#v", s.buckets)
+	// delaying an item that is not in the queue does nothing
+	s.Delay("third")
+	if s.Len() != 2 {
+		t.Fatalf("delay added an item: %#v", s.Map())
 	}
-	s.Remove("third", "other")
-	s.Add("sixth", "other")
-	if s.buckets[1]["sixth"] != "other" {
-		t.Fatalf("placed key in wrong bucket: %#v", s.buckets)
+	if !reflect.DeepEqual(s.Map(), map[interface{}]interface{}{"first": "new", "second": "other"}) {
+		t.Fatalf("unexpected contents: %#v", s.Map())
 	}
 
-	// delaying an item moves it to the last bucket
-	s.Delay("second")
-	if s.buckets[3]["second"] != "other" {
-		t.Fatalf("delay placed key in wrong bucket: %#v", s.buckets)
+	// setting a longer interval keeps the deadline, a shorter one moves it forward
+	second := s.items["second"]
+	s.SetInterval("second", 2*time.Hour)
+	if second.interval != 2*time.Hour || !second.next.Equal(time.Unix(0, int64(time.Hour))) {
+		t.Fatalf("unexpected item after setting a longer interval: %#v", second)
 	}
-	// delaying an item that is not in the map does nothing
-	s.Delay("third")
-	if _, ok := s.buckets[3]["third"]; ok {
-		t.Fatalf("delay placed key in wrong bucket: %#v", s.buckets)
+	s.SetInterval("second", time.Minute)
+	if second.interval != time.Minute || !second.next.Equal(time.Unix(0, int64(6*time.Minute))) || s.queue[0] != second {
+		t.Fatalf("expected a shorter interval to move the deadline forward, got %s", second.next)
 	}
-	// delaying an item that is already in the latest bucket does nothing
-	s.Delay("fourth")
-	if s.buckets[3]["fourth"] != "other" {
-		t.Fatalf("delay placed key in wrong bucket: %#v", s.buckets)
+	// setting the interval of an item that is not in the queue does nothing
+	s.SetInterval("third", time.Minute)
+	if s.Len() != 2 {
+		t.Fatalf("setting an interval added an item: %#v", s.Map())
 	}
 }
 
 func TestSchedulerRemove(t *testing.T) {
-	s := newScheduler(2, flowcontrol.NewFakeAlwaysRateLimiter(), func(key, value interface{}) {})
-	s.Add("test", "other")
+	s := newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), &wallClock{}, 0, func(key, value interface{}, due time.Time) {})
+	s.Add("test", "other", time.Hour)
 	if s.Remove("test", "value") {
 		t.Fatal(s)
 	}
@@ -115,8 +189,8 @@ func TestSchedulerRemove(t *testing.T) {
 	if s.Len() != 0 {
 		t.Fatal(s)
 	}
-	s.Add("test", "other")
-	s.Add("test", "new")
+	s.Add("test", "other", time.Hour)
+	s.Add("test", "new", time.Hour)
 	if s.Len() != 1 {
 		t.Fatal(s)
 	}
@@ -126,6 +200,18 @@ func TestSchedulerRemove(t *testing.T) {
 	if !s.Remove("test", "new") {
 		t.Fatal(s)
 	}
+	for i := 0; i < 10; i++ {
+		s.Add(i, nil, time.Duration(i+1)*time.Hour)
+	}
+	s.Remove(5, nil)
+	for i, item := range s.queue {
+		if item.index != i || s.items[item.key] != item {
+			t.Fatalf("queue and index out of sync after remove: %#v", s.queue)
+		}
+	}
+	if _, ok := s.items[5]; ok || s.Len() != 9 {
+		t.Fatalf("expected item to be removed: %#v", s.Map())
+	}
 }
 
 type int64Heap []int64
@@ -198,33 +284,27 @@ func (c *fakeClock) Sleep(d time.Duration) {
 }
 
 func TestSchedulerSanity(t *testing.T) {
-	const (
-		buckets = 4
-		items   = 10
-	)
+	const items = 10
 
 	// if needed for testing, you can revert to using the wall clock via
 	// clock := &wallClock{}
 	clock := newFakeClock(2) // 2 threads: us and the scheduler.
 
-	// 1 token per second => one bucket's worth of items should get scheduled
-	// per second.
-	limiter := flowcontrol.NewTokenBucketRateLimiterWithClock(1, 1, clock)
-
 	m := map[int]int{}
-	s := newScheduler(buckets, limiter, func(key, value interface{}) {
+	s := newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0, func(key, value interface{}, due time.Time) {
 		fmt.Printf("%v: %v\n", clock.Now().UTC(), key)
 		m[key.(int)]++
 	})
 	for i := 0; i < items; i++ {
-		s.Add(i, nil)
+		s.Add(i, nil, 4*time.Second)
 	}
 
 	go s.RunUntil(make(chan struct{}))
 
 	// run the clock just long enough to expect to have scheduled each item
-	// exactly twice.
-	clock.Sleep((2*buckets-1)*time.Second + 1)
+	// exactly twice: the first run is within one interval, the second one
+	// interval later.
+	clock.Sleep(8*time.Second - 1)
 
 	expected := map[int]int{}
 	for i := 0; i < items; i++ {
@@ -235,3 +315,34 @@ func TestSchedulerSanity(t *testing.T) {
 		t.Errorf("m did not match expected: %#v\n", m)
 	}
 }
+
+func TestSchedulerRateLimit(t *testing.T) {
+	const items = 10
+
+	clock := newFakeClock(2) // 2 threads: us and the scheduler.
+
+	// 1 token per second => at most one item per second gets handled, even
+	// though all of them are due every millisecond.
+	limiter := flowcontrol.NewTokenBucketRateLimiterWithClock(1, 1, clock)
+
+	var mu sync.Mutex
+	handled := 0
+	s := newScheduler(limiter, clock, 0, func(key, value interface{}, due time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+	})
+	for i := 0; i < items; i++ {
+		s.Add(i, nil, time.Millisecond)
+	}
+
+	go s.RunUntil(make(chan struct{}))
+
+	clock.Sleep(5*time.Second + 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled < 5 || handled > 6 {
+		t.Errorf("expected the rate limiter to allow 5 or 6 imports in 5 seconds, got %d", handled)
+	}
+}
@@ -2,28 +2,29 @@ package signature
 
 import (
 	"context"
-	"crypto/sha256"
-	"fmt"
 	"time"
 
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 
 	imagev1 "github.com/openshift/api/image/v1"
-	"github.com/openshift/library-go/pkg/image/imageutil"
 )
 
 type containerImageSignatureDownloader struct {
 	ctx     context.Context
 	timeout time.Duration
+
+	// systemContexts configures the access to registries, nil for the defaults
+	systemContexts SystemContextSource
 }
 
-func NewContainerImageSignatureDownloader(ctx context.Context, timeout time.Duration) SignatureDownloader {
+func NewContainerImageSignatureDownloader(ctx context.Context, timeout time.Duration, systemContexts SystemContextSource) SignatureDownloader {
 	return &containerImageSignatureDownloader{
-		ctx:     ctx,
-		timeout: timeout,
+		ctx:            ctx,
+		timeout:        timeout,
+		systemContexts: systemContexts,
 	}
 }
 
@@ -40,7 +41,14 @@ func (s *containerImageSignatureDownloader) DownloadImageSignatures(image *image
 	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
 	defer cancel()
 
-	source, err := reference.NewImageSource(ctx, nil)
+	var sys *types.SystemContext
+	if s.systemContexts != nil {
+		if sys, err = s.systemContexts.SystemContext(); err != nil {
+			return nil, err
+		}
+	}
+
+	source, err := reference.NewImageSource(ctx, sys)
 	if err != nil {
 		// In case we fail to talk to registry to get the image metadata (private
 		// registry, internal registry, etc...), do not fail with error to avoid
@@ -58,14 +66,13 @@ func (s *containerImageSignatureDownloader) DownloadImageSignatures(image *image
 
 	ret := []imagev1.ImageSignature{}
 	for _, blob := range signatures {
-		sig := imagev1.ImageSignature{Type: imagev1.ImageSignatureTypeAtomicImageV1}
-		// This will use the name of the image (sha256:xxxx) and the SHA256 of the
-		// signature itself as the signature name has to be unique for each
-		// signature.
-		sig.Name = imageutil.JoinImageStreamImage(image.Name, fmt.Sprintf("%x", sha256.Sum256(blob)))
-		sig.Content = blob
-		sig.CreationTimestamp = metav1.Now()
-		ret = append(ret, sig)
+		ret = append(ret, newImageSignature(image, imagev1.ImageSignatureTypeAtomicImageV1, blob))
+	}
+
+	sigstore, err := downloadSigstoreSignatures(ctx, sys, image)
+	if err != nil {
+		klog.V(4).Infof("Failed to get sigstore signatures for %v due to: %v", source.Reference(), err)
+		return []imagev1.ImageSignature{}, GetSignaturesError{err}
 	}
-	return ret, nil
+	return append(ret, sigstore...), nil
 }
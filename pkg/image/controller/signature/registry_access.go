@@ -0,0 +1,195 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeinformers "k8s.io/client-go/informers/core/v1"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1informer "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configv1lister "github.com/openshift/client-go/config/listers/config/v1"
+	operatorv1alpha1informer "github.com/openshift/client-go/operator/informers/externalversions/operator/v1alpha1"
+	operatorv1alpha1lister "github.com/openshift/client-go/operator/listers/operator/v1alpha1"
+	"github.com/openshift/openshift-controller-manager/pkg/image/registryconf"
+)
+
+const (
+	// pullSecretName is the name of the global pull secret in the openshift-config namespace.
+	pullSecretName = "pull-secret"
+
+	// keptConfigFiles is the number of the generations of each configuration file kept, so
+	// that downloads still using the previous ones do not fail when the configuration changes.
+	keptConfigFiles = 2
+)
+
+// SystemContextSource returns the configuration of the access of signature downloads to
+// registries.
+type SystemContextSource interface {
+	// SystemContext returns the current configuration.
+	SystemContext() (*types.SystemContext, error)
+	// HasSynced returns true once the configuration is known.
+	HasSynced() bool
+}
+
+// RegistryAccess configures signature downloads with the global pull secret, and with the
+// same registries.conf as build pods: the insecure and blocked registries of the cluster
+// image config, and the mirrors of image content source policies, image digest mirror sets
+// and image tag mirror sets.
+type RegistryAccess struct {
+	imageConfigLister              configv1lister.ImageLister
+	imageContentSourcePolicyLister operatorv1alpha1lister.ImageContentSourcePolicyLister
+	imageDigestMirrorSetLister     configv1lister.ImageDigestMirrorSetLister
+	imageTagMirrorSetLister        configv1lister.ImageTagMirrorSetLister
+	secretLister                   v1lister.SecretNamespaceLister
+
+	syncs []cache.InformerSynced
+
+	// dir holds the generated configuration files
+	dir string
+
+	lock sync.Mutex
+	// files are the paths of the generated configuration files by kind, newest last
+	files map[string][]string
+}
+
+var _ SystemContextSource = &RegistryAccess{}
+
+// NewRegistryAccess returns the registry access of signature downloads. The secret informer
+// must watch the openshift-config namespace. The configuration files are written to a new
+// temporary directory.
+func NewRegistryAccess(
+	imageConfigInformer configv1informer.ImageInformer,
+	imageContentSourcePolicyInformer operatorv1alpha1informer.ImageContentSourcePolicyInformer,
+	imageDigestMirrorSetInformer configv1informer.ImageDigestMirrorSetInformer,
+	imageTagMirrorSetInformer configv1informer.ImageTagMirrorSetInformer,
+	openshiftConfigSecretInformer kubeinformers.SecretInformer,
+) (*RegistryAccess, error) {
+	dir, err := os.MkdirTemp("", "image-signature-import")
+	if err != nil {
+		return nil, err
+	}
+	return &RegistryAccess{
+		imageConfigLister:              imageConfigInformer.Lister(),
+		imageContentSourcePolicyLister: imageContentSourcePolicyInformer.Lister(),
+		imageDigestMirrorSetLister:     imageDigestMirrorSetInformer.Lister(),
+		imageTagMirrorSetLister:        imageTagMirrorSetInformer.Lister(),
+		secretLister:                   openshiftConfigSecretInformer.Lister().Secrets("openshift-config"),
+		syncs: []cache.InformerSynced{
+			imageConfigInformer.Informer().HasSynced,
+			imageContentSourcePolicyInformer.Informer().HasSynced,
+			imageDigestMirrorSetInformer.Informer().HasSynced,
+			imageTagMirrorSetInformer.Informer().HasSynced,
+			openshiftConfigSecretInformer.Informer().HasSynced,
+		},
+		dir:   dir,
+		files: map[string][]string{},
+	}, nil
+}
+
+// HasSynced returns true once the informers of the configuration have synced.
+func (r *RegistryAccess) HasSynced() bool {
+	for _, synced := range r.syncs {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// SystemContext returns the configuration of registry access. The defaults of the controller
+// manager apply when there is no pull secret, or no registry settings.
+func (r *RegistryAccess) SystemContext() (*types.SystemContext, error) {
+	registriesTOML, err := r.registriesTOML()
+	if err != nil {
+		return nil, err
+	}
+	sys := &types.SystemContext{}
+	if len(registriesTOML) > 0 {
+		// files are named after their contents, as registries.conf files are cached by path
+		sys.SystemRegistriesConfPath, err = r.writeFile("registries", ".conf", []byte(registriesTOML))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := r.secretLister.Get(pullSecretName)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if secret != nil && len(secret.Data[corev1.DockerConfigJsonKey]) > 0 {
+		sys.AuthFilePath, err = r.writeFile("auth", ".json", secret.Data[corev1.DockerConfigJsonKey])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
+
+// registriesTOML returns the contents of the registries.conf file of build pods.
+func (r *RegistryAccess) registriesTOML() (string, error) {
+	imageConfig, err := r.imageConfigLister.Get("cluster")
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+		imageConfig = nil
+	}
+	policies, err := r.imageContentSourcePolicyLister.List(labels.Everything())
+	if err != nil {
+		return "", err
+	}
+	idmsRules, err := r.imageDigestMirrorSetLister.List(labels.Everything())
+	if err != nil {
+		return "", err
+	}
+	itmsRules, err := r.imageTagMirrorSetLister.List(labels.Everything())
+	if err != nil {
+		return "", err
+	}
+	return registryconf.TOML(imageConfig, policies, idmsRules, itmsRules)
+}
+
+// writeFile writes the content to a file of the kind named after the content, unless it
+// exists, and returns its path. Only the newest files of each kind are kept.
+func (r *RegistryAccess) writeFile(kind, extension string, content []byte) (string, error) {
+	path := filepath.Join(r.dir, fmt.Sprintf("%s-%x%s", kind, sha256.Sum256(content), extension))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	files := r.files[kind]
+	if len(files) > 0 && files[len(files)-1] == path {
+		return path, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+
+	var kept []string
+	for _, file := range files {
+		if file != path {
+			kept = append(kept, file)
+		}
+	}
+	kept = append(kept, path)
+	for len(kept) > keptConfigFiles {
+		os.Remove(kept[0])
+		kept = kept[1:]
+	}
+	r.files[kind] = kept
+	return path, nil
+}
@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+
+	configv1 "github.com/openshift/api/config/v1"
+	fakeconfigv1client "github.com/openshift/client-go/config/clientset/versioned/fake"
+	configv1informer "github.com/openshift/client-go/config/informers/externalversions"
+	fakeoperatorv1alphaclient "github.com/openshift/client-go/operator/clientset/versioned/fake"
+	operatorv1alpha1informer "github.com/openshift/client-go/operator/informers/externalversions"
+)
+
+func TestRegistryAccess(t *testing.T) {
+	configInformers := configv1informer.NewSharedInformerFactory(fakeconfigv1client.NewSimpleClientset(), 0)
+	operatorInformers := operatorv1alpha1informer.NewSharedInformerFactory(fakeoperatorv1alphaclient.NewSimpleClientset(), 0)
+	kubeInformers := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+
+	access, err := NewRegistryAccess(
+		configInformers.Config().V1().Images(),
+		operatorInformers.Operator().V1alpha1().ImageContentSourcePolicies(),
+		configInformers.Config().V1().ImageDigestMirrorSets(),
+		configInformers.Config().V1().ImageTagMirrorSets(),
+		kubeInformers.Core().V1().Secrets(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(access.dir)
+
+	sys, err := access.SystemContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sys.SystemRegistriesConfPath) > 0 || len(sys.AuthFilePath) > 0 {
+		t.Fatalf("expected the default registry access, got %#v", sys)
+	}
+
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config", Name: pullSecretName},
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry.io":{"auth":"dXNlcjpwYXNz"}}}`)},
+	}
+	kubeInformers.Core().V1().Secrets().Informer().GetStore().Add(pullSecret)
+	idms := &configv1.ImageDigestMirrorSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "mirrors"},
+		Spec: configv1.ImageDigestMirrorSetSpec{
+			ImageDigestMirrors: []configv1.ImageDigestMirrors{{Source: "registry.io/ns", Mirrors: []configv1.ImageMirror{"mirror.io/ns"}}},
+		},
+	}
+	configInformers.Config().V1().ImageDigestMirrorSets().Informer().GetStore().Add(idms)
+
+	sys, err = access.SystemContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := os.ReadFile(sys.AuthFilePath)
+	if err != nil || string(auth) != string(pullSecret.Data[corev1.DockerConfigJsonKey]) {
+		t.Errorf("expected the pull secret to be written to the auth file, got %q, %v", auth, err)
+	}
+	registries, err := os.ReadFile(sys.SystemRegistriesConfPath)
+	if err != nil || !strings.Contains(string(registries), "mirror.io/ns") {
+		t.Errorf("expected the mirrors to be written to the registries configuration, got %q, %v", registries, err)
+	}
+
+	first := sys.SystemRegistriesConfPath
+	for _, mirror := range []configv1.ImageMirror{"second.io/ns", "third.io/ns"} {
+		idms = idms.DeepCopy()
+		idms.Spec.ImageDigestMirrors[0].Mirrors = []configv1.ImageMirror{mirror}
+		configInformers.Config().V1().ImageDigestMirrorSets().Informer().GetStore().Update(idms)
+		if sys, err = access.SystemContext(); err != nil {
+			t.Fatal(err)
+		}
+		if sys.SystemRegistriesConfPath == first {
+			t.Fatalf("expected a changed registries configuration to be written to a new file")
+		}
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("expected the registries configuration of two changes ago to be removed, got %v", err)
+	}
+}
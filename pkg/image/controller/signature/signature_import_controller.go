@@ -8,6 +8,7 @@ import (
 	"k8s.io/klog/v2"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
@@ -18,17 +19,78 @@ import (
 	imagev1client "github.com/openshift/client-go/image/clientset/versioned"
 	imagev1informer "github.com/openshift/client-go/image/informers/externalversions/image/v1"
 	imagev1lister "github.com/openshift/client-go/image/listers/image/v1"
+	metrics "github.com/openshift/openshift-controller-manager/pkg/image/metrics/prometheus"
 )
 
 type SignatureDownloader interface {
 	DownloadImageSignatures(*imagev1.Image) ([]imagev1.ImageSignature, error)
 }
 
+// Config controls the import of image signatures.
+type Config struct {
+	// ResyncPeriodSeconds is how often the signatures of every image are downloaded again.
+	// Defaults to 3600.
+	ResyncPeriodSeconds int `json:"resyncPeriodSeconds,omitempty"`
+	// FetchTimeoutSeconds limits the time the download of the signatures of an image takes.
+	// Defaults to 60.
+	FetchTimeoutSeconds int `json:"fetchTimeoutSeconds,omitempty"`
+	// MaxSignaturesPerImage is the number of signatures above which no more are imported
+	// for an image. Defaults to 10.
+	MaxSignaturesPerImage int `json:"maxSignaturesPerImage,omitempty"`
+	// TrustPolicies are the keys and identities signatures are verified against, per registry
+	// or repository. The signatures of images no policy applies to are not verified.
+	TrustPolicies []TrustPolicy `json:"trustPolicies,omitempty"`
+}
+
+// ValidateConfig returns an error if the signature import configuration is invalid.
+func ValidateConfig(config Config) error {
+	if config.ResyncPeriodSeconds < 0 {
+		return fmt.Errorf("the signature import resyncPeriodSeconds must not be negative, got %d", config.ResyncPeriodSeconds)
+	}
+	if config.FetchTimeoutSeconds < 0 {
+		return fmt.Errorf("the signature import fetchTimeoutSeconds must not be negative, got %d", config.FetchTimeoutSeconds)
+	}
+	if config.MaxSignaturesPerImage < 0 {
+		return fmt.Errorf("the signature import maxSignaturesPerImage must not be negative, got %d", config.MaxSignaturesPerImage)
+	}
+	if _, err := NewVerifier(config.TrustPolicies); err != nil {
+		return fmt.Errorf("invalid signature import trustPolicies: %v", err)
+	}
+	return nil
+}
+
+// ResyncPeriod returns the configured resync period, or its default.
+func (c Config) ResyncPeriod() time.Duration {
+	if c.ResyncPeriodSeconds == 0 {
+		return time.Hour
+	}
+	return time.Duration(c.ResyncPeriodSeconds) * time.Second
+}
+
+// FetchTimeout returns the configured fetch timeout, or its default.
+func (c Config) FetchTimeout() time.Duration {
+	if c.FetchTimeoutSeconds == 0 {
+		return time.Minute
+	}
+	return time.Duration(c.FetchTimeoutSeconds) * time.Second
+}
+
+// Limit returns the configured maximum number of signatures per image, or its default.
+func (c Config) Limit() int {
+	if c.MaxSignaturesPerImage == 0 {
+		return 10
+	}
+	return c.MaxSignaturesPerImage
+}
+
 type SignatureImportController struct {
 	imageClient imagev1client.Interface
 	imageLister imagev1lister.ImageLister
 
 	imageHasSynced cache.InformerSynced
+	// systemContextHasSynced is nil when signatures are downloaded with the default
+	// registry access
+	systemContextHasSynced cache.InformerSynced
 
 	queue workqueue.RateLimitingInterface
 
@@ -37,17 +99,28 @@ type SignatureImportController struct {
 	signatureImportLimit int
 
 	fetcher SignatureDownloader
+
+	// verifier records whether signatures are trusted, nil when no trust policies are
+	// configured
+	verifier *Verifier
 }
 
-func NewSignatureImportController(ctx context.Context, imageClient imagev1client.Interface, imageInformer imagev1informer.ImageInformer, resyncInterval, fetchTimeout time.Duration, limit int) *SignatureImportController {
+// NewSignatureImportController returns a controller downloading the signatures of images. A
+// nil systemContexts downloads them with the default registry access of the process. A nil
+// verifier does not verify them.
+func NewSignatureImportController(ctx context.Context, imageClient imagev1client.Interface, imageInformer imagev1informer.ImageInformer, systemContexts SystemContextSource, verifier *Verifier, resyncInterval, fetchTimeout time.Duration, limit int) *SignatureImportController {
 	controller := &SignatureImportController{
 		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "image-signature-import"),
 		imageClient:          imageClient,
 		imageLister:          imageInformer.Lister(),
 		imageHasSynced:       imageInformer.Informer().HasSynced,
 		signatureImportLimit: limit,
+		verifier:             verifier,
+	}
+	controller.fetcher = NewContainerImageSignatureDownloader(ctx, fetchTimeout, systemContexts)
+	if systemContexts != nil {
+		controller.systemContextHasSynced = systemContexts.HasSynced
 	}
-	controller.fetcher = NewContainerImageSignatureDownloader(ctx, fetchTimeout)
 
 	imageInformer.Informer().AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -69,10 +142,18 @@ func (s *SignatureImportController) Run(workers int, stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
 	defer s.queue.ShutDown()
 
-	if !cache.WaitForCacheSync(stopCh, s.imageHasSynced) {
+	syncs := []cache.InformerSynced{s.imageHasSynced}
+	if s.systemContextHasSynced != nil {
+		syncs = append(syncs, s.systemContextHasSynced)
+	}
+	if !cache.WaitForCacheSync(stopCh, syncs...) {
 		return
 	}
 
+	if s.verifier != nil {
+		metrics.InitializeSignatureCollector(s.collectUnverifiedImages)
+	}
+
 	klog.V(5).Infof("Starting workers")
 	for i := 0; i < workers; i++ {
 		go wait.Until(s.worker, time.Second, stopCh)
@@ -146,18 +227,13 @@ func (s *SignatureImportController) syncImageSignatures(key string) error {
 		return err
 	}
 
-	// Having no signatures means no-op (we don't remove stored signatures when
-	// the sig-store no longer have them).
-	if len(currentSignatures) == 0 {
-		klog.V(4).Infof("No signatures downloaded for %s", image.Name)
-		return nil
-	}
-
 	newImage := image.DeepCopy()
 	shouldUpdate := false
 
 	// Only add new signatures, do not override existing stored signatures as that
-	// can void their verification status.
+	// can void their verification status. Having no signatures means no additions
+	// (we don't remove stored signatures when the sig-store no longer have them).
+	var added []imagev1.ImageSignature
 	for _, c := range currentSignatures {
 		found := false
 		for _, s := range newImage.Signatures {
@@ -167,14 +243,24 @@ func (s *SignatureImportController) syncImageSignatures(key string) error {
 			}
 		}
 		if !found {
-			newImage.Signatures = append(newImage.Signatures, c)
+			added = append(added, c)
+		}
+	}
+
+	if len(added) > 0 {
+		if len(newImage.Signatures)+len(added) > s.signatureImportLimit {
+			klog.V(2).Infof("Image %s reached signature limit (max:%d, want:%d)", newImage.Name, s.signatureImportLimit, len(newImage.Signatures)+len(added))
+		} else {
+			newImage.Signatures = append(newImage.Signatures, added...)
 			shouldUpdate = true
 		}
+	} else if len(currentSignatures) == 0 {
+		klog.V(4).Infof("No signatures downloaded for %s", image.Name)
 	}
 
-	if len(newImage.Signatures) > s.signatureImportLimit {
-		klog.V(2).Infof("Image %s reached signature limit (max:%d, want:%d)", newImage.Name, s.signatureImportLimit, len(newImage.Signatures))
-		return nil
+	// Stored signatures are verified again, as the trust policies may have changed.
+	if s.verifier.VerifyImage(newImage) {
+		shouldUpdate = true
 	}
 
 	// Avoid unnecessary updates to images.
@@ -186,3 +272,28 @@ func (s *SignatureImportController) syncImageSignatures(key string) error {
 	_, err = s.imageClient.ImageV1().Images().Update(context.TODO(), newImage, metav1.UpdateOptions{})
 	return err
 }
+
+// collectUnverifiedImages counts the images trust policies apply to that have no signature
+// trusted for them, per scope.
+func (s *SignatureImportController) collectUnverifiedImages() (metrics.UnverifiedImageCounts, error) {
+	images, err := s.imageLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	counts := metrics.UnverifiedImageCounts{}
+	for _, image := range images {
+		if image.Annotations[imagev1.ManagedByOpenShiftAnnotation] == "true" {
+			continue
+		}
+		scope, ok := s.verifier.Scope(image)
+		if !ok || HasValidSignature(image) {
+			continue
+		}
+		reason := "Untrusted"
+		if len(image.Signatures) == 0 {
+			reason = "Unsigned"
+		}
+		counts[metrics.UnverifiedImageInfo{Scope: scope, Reason: reason}]++
+	}
+	return counts, nil
+}
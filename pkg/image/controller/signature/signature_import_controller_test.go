@@ -156,6 +156,8 @@ func controllerSetup(startingImages []runtime.Object, t *testing.T, limit int, s
 		context.Background(),
 		imageclient,
 		informerFactory.Image().V1().Images(),
+		nil,
+		nil,
 		30*time.Second,
 		10*time.Second,
 		limit,
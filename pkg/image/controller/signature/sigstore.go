@@ -0,0 +1,228 @@
+package signature
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	"github.com/openshift/library-go/pkg/image/imageutil"
+)
+
+const (
+	// ImageSignatureTypeSigstoreV1 is the type of image signatures holding a cosign signature,
+	// stored as a SigstoreSignature.
+	ImageSignatureTypeSigstoreV1 = "SigstoreV1"
+	// ImageSignatureTypeSigstoreBundleV1 is the type of image signatures holding a sigstore
+	// bundle, stored as is.
+	ImageSignatureTypeSigstoreBundleV1 = "SigstoreBundleV1"
+
+	// sigstoreSignatureMediaType is the media type of the layers of cosign signature
+	// manifests, which hold the signed payload.
+	sigstoreSignatureMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// sigstoreBundleMediaTypePrefix prefixes the artifact type of referrers holding sigstore
+	// bundles, and the media type of their layers.
+	sigstoreBundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+	// maxSigstoreBlobSize limits the size of the signature payloads and bundles downloaded.
+	maxSigstoreBlobSize = 4 * 1024 * 1024
+)
+
+// SigstoreSignature is the content of ImageSignatureTypeSigstoreV1 signatures: the payload
+// cosign signed, and the annotations of its layer holding the signature, certificate and
+// transparency log bundle.
+type SigstoreSignature struct {
+	MIMEType    string            `json:"mimeType"`
+	Payload     []byte            `json:"payload"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// downloadSigstoreSignatures returns the cosign signatures attached to the image with the
+// "sha256-<digest>.sig" tag, and the sigstore bundles referring to it through the
+// "sha256-<digest>" referrers tag. Images without either have no sigstore signatures.
+func downloadSigstoreSignatures(ctx context.Context, sys *types.SystemContext, image *imagev1.Image) ([]imagev1.ImageSignature, error) {
+	named, err := reference.ParseNormalizedNamed(image.DockerImageReference)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := digest.Parse(image.Name)
+	if err != nil {
+		klog.V(4).Infof("Not downloading sigstore signatures of image %s without a digest name: %v", image.Name, err)
+		return nil, nil
+	}
+	tag := strings.Replace(manifestDigest.String(), ":", "-", 1)
+	repository := reference.TrimNamed(named)
+
+	ret := []imagev1.ImageSignature{}
+	signatures, err := downloadTag(ctx, sys, repository, tag+".sig", func(ctx context.Context, source types.ImageSource, manifest []byte) ([]imagev1.ImageSignature, error) {
+		return sigstoreSignatures(ctx, source, image, manifest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, signatures...)
+
+	bundles, err := downloadTag(ctx, sys, repository, tag, func(ctx context.Context, source types.ImageSource, index []byte) ([]imagev1.ImageSignature, error) {
+		return sigstoreBundles(ctx, source, image, index)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, bundles...), nil
+}
+
+// downloadTag passes the manifest of the tag of the repository to download, and returns the
+// signatures it found. Missing tags have no signatures.
+func downloadTag(
+	ctx context.Context,
+	sys *types.SystemContext,
+	repository reference.Named,
+	tag string,
+	download func(context.Context, types.ImageSource, []byte) ([]imagev1.ImageSignature, error),
+) ([]imagev1.ImageSignature, error) {
+	tagged, err := reference.WithTag(repository, tag)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := docker.NewReference(tagged)
+	if err != nil {
+		return nil, err
+	}
+	// the manifest of the tag is fetched when the source is created
+	source, err := ref.NewImageSource(ctx, sys)
+	if manifestUnknown(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	manifest, _, err := source.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return download(ctx, source, manifest)
+}
+
+// sigstoreSignatures returns the signatures of a cosign signature manifest, one per layer.
+func sigstoreSignatures(ctx context.Context, source types.ImageSource, image *imagev1.Image, manifestBlob []byte) ([]imagev1.ImageSignature, error) {
+	var manifest imgspecv1.Manifest
+	if err := json.Unmarshal(manifestBlob, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid cosign signature manifest of %s: %v", source.Reference().StringWithinTransport(), err)
+	}
+	var ret []imagev1.ImageSignature
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != sigstoreSignatureMediaType {
+			continue
+		}
+		payload, err := getBlob(ctx, source, layer)
+		if err != nil {
+			return nil, err
+		}
+		content, err := json.Marshal(SigstoreSignature{
+			MIMEType:    layer.MediaType,
+			Payload:     payload,
+			Annotations: layer.Annotations,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, newImageSignature(image, ImageSignatureTypeSigstoreV1, content))
+	}
+	return ret, nil
+}
+
+// sigstoreBundles returns the sigstore bundles among the referrers listed by an OCI index.
+func sigstoreBundles(ctx context.Context, source types.ImageSource, image *imagev1.Image, indexBlob []byte) ([]imagev1.ImageSignature, error) {
+	var index imgspecv1.Index
+	if err := json.Unmarshal(indexBlob, &index); err != nil {
+		return nil, fmt.Errorf("invalid referrers index of %s: %v", source.Reference().StringWithinTransport(), err)
+	}
+	var ret []imagev1.ImageSignature
+	for _, referrer := range index.Manifests {
+		if !strings.HasPrefix(referrer.ArtifactType, sigstoreBundleMediaTypePrefix) {
+			continue
+		}
+		manifestBlob, _, err := source.GetManifest(ctx, &referrer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var manifest imgspecv1.Manifest
+		if err := json.Unmarshal(manifestBlob, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid sigstore bundle manifest %s: %v", referrer.Digest, err)
+		}
+		for _, layer := range manifest.Layers {
+			if !strings.HasPrefix(layer.MediaType, sigstoreBundleMediaTypePrefix) {
+				continue
+			}
+			bundle, err := getBlob(ctx, source, layer)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, newImageSignature(image, ImageSignatureTypeSigstoreBundleV1, bundle))
+		}
+	}
+	return ret, nil
+}
+
+// getBlob returns the content of a layer, which must be no larger than maxSigstoreBlobSize.
+func getBlob(ctx context.Context, source types.ImageSource, layer imgspecv1.Descriptor) ([]byte, error) {
+	if layer.Size > maxSigstoreBlobSize {
+		return nil, fmt.Errorf("signature layer %s of %d bytes exceeds the limit of %d bytes", layer.Digest, layer.Size, maxSigstoreBlobSize)
+	}
+	reader, _, err := source.GetBlob(ctx, types.BlobInfo{Digest: layer.Digest, Size: layer.Size}, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	blob, err := io.ReadAll(io.LimitReader(reader, maxSigstoreBlobSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) > maxSigstoreBlobSize {
+		return nil, fmt.Errorf("signature layer %s exceeds the limit of %d bytes", layer.Digest, maxSigstoreBlobSize)
+	}
+	if err := layer.Digest.Validate(); err != nil || layer.Digest.Algorithm().FromBytes(blob) != layer.Digest {
+		return nil, fmt.Errorf("signature layer %s does not match its digest", layer.Digest)
+	}
+	return blob, nil
+}
+
+// newImageSignature returns a signature of the image of the type with the content. The
+// signature is named after the image and the SHA256 of its content, which makes the name
+// unique for each signature.
+func newImageSignature(image *imagev1.Image, signatureType string, content []byte) imagev1.ImageSignature {
+	sig := imagev1.ImageSignature{Type: signatureType}
+	sig.Name = imageutil.JoinImageStreamImage(image.Name, fmt.Sprintf("%x", sha256.Sum256(content)))
+	sig.Content = content
+	sig.CreationTimestamp = metav1.Now()
+	return sig
+}
+
+// manifestUnknown returns true if the registry reported the manifest requested does not
+// exist.
+func manifestUnknown(err error) bool {
+	var coder errcode.ErrorCoder
+	if !errors.As(err, &coder) {
+		return false
+	}
+	code := coder.ErrorCode()
+	return code == v2.ErrorCodeManifestUnknown || code == v2.ErrorCodeNameUnknown
+}
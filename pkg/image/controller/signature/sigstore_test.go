@@ -0,0 +1,181 @@
+package signature
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// staticSystemContext configures every download alike.
+type staticSystemContext struct {
+	sys *types.SystemContext
+}
+
+func (s staticSystemContext) SystemContext() (*types.SystemContext, error) { return s.sys, nil }
+func (s staticSystemContext) HasSynced() bool                              { return true }
+
+// fakeRegistry serves the manifests and blobs of the repository "ns/app".
+type fakeRegistry struct {
+	manifests map[string][]byte
+	blobs     map[digest.Digest][]byte
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{manifests: map[string][]byte{}, blobs: map[digest.Digest][]byte{}}
+}
+
+func (r *fakeRegistry) addBlob(content []byte) imgspecv1.Descriptor {
+	d := digest.FromBytes(content)
+	r.blobs[d] = content
+	return imgspecv1.Descriptor{Digest: d, Size: int64(len(content))}
+}
+
+func (r *fakeRegistry) addManifest(t *testing.T, tag string, manifest interface{}) imgspecv1.Descriptor {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := digest.FromBytes(content)
+	r.manifests[d.String()] = content
+	if len(tag) > 0 {
+		r.manifests[tag] = content
+	}
+	return imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: d, Size: int64(len(content))}
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	const repository = "/v2/ns/app/"
+	switch {
+	case req.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(req.URL.Path, repository+"manifests/"):
+		content, ok := r.manifests[strings.TrimPrefix(req.URL.Path, repository+"manifests/")]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+			return
+		}
+		var manifest struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal(content, &manifest)
+		w.Header().Set("Content-Type", manifest.MediaType)
+		w.Write(content)
+	case strings.HasPrefix(req.URL.Path, repository+"blobs/"):
+		content, ok := r.blobs[digest.Digest(strings.TrimPrefix(req.URL.Path, repository+"blobs/"))]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDownloadSigstoreSignatures(t *testing.T) {
+	testCases := []struct {
+		name   string
+		setup  func(t *testing.T, r *fakeRegistry, tag string)
+		expect map[string]int
+	}{
+		{
+			name:   "unsigned",
+			setup:  func(t *testing.T, r *fakeRegistry, tag string) {},
+			expect: map[string]int{},
+		},
+		{
+			name: "cosign signatures and bundles",
+			setup: func(t *testing.T, r *fakeRegistry, tag string) {
+				config := r.addBlob([]byte("{}"))
+				config.MediaType = imgspecv1.MediaTypeImageConfig
+				var layers []imgspecv1.Descriptor
+				for _, payload := range []string{`{"critical":{"image":{"docker-manifest-digest":"1"}}}`, `{"critical":{"image":{"docker-manifest-digest":"2"}}}`} {
+					layer := r.addBlob([]byte(payload))
+					layer.MediaType = sigstoreSignatureMediaType
+					layer.Annotations = map[string]string{"dev.cosignproject.cosign/signature": "MEUCIQ=="}
+					layers = append(layers, layer)
+				}
+				r.addManifest(t, tag+".sig", imgspecv1.Manifest{MediaType: imgspecv1.MediaTypeImageManifest, Config: config, Layers: layers})
+
+				bundle := r.addBlob([]byte(`{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json"}`))
+				bundle.MediaType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+				bundleManifest := r.addManifest(t, "", imgspecv1.Manifest{
+					MediaType:    imgspecv1.MediaTypeImageManifest,
+					ArtifactType: bundle.MediaType,
+					Config:       config,
+					Layers:       []imgspecv1.Descriptor{bundle},
+				})
+				bundleManifest.ArtifactType = bundle.MediaType
+				sbom := r.addManifest(t, "", imgspecv1.Manifest{MediaType: imgspecv1.MediaTypeImageManifest, Config: config})
+				sbom.ArtifactType = "application/spdx+json"
+				r.addManifest(t, tag, imgspecv1.Index{MediaType: imgspecv1.MediaTypeImageIndex, Manifests: []imgspecv1.Descriptor{bundleManifest, sbom}})
+			},
+			expect: map[string]int{ImageSignatureTypeSigstoreV1: 2, ImageSignatureTypeSigstoreBundleV1: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := newFakeRegistry()
+			config := registry.addBlob([]byte("{}"))
+			config.MediaType = imgspecv1.MediaTypeImageConfig
+			imageDigest := registry.addManifest(t, "latest", imgspecv1.Manifest{MediaType: imgspecv1.MediaTypeImageManifest, Config: config}).Digest
+			tc.setup(t, registry, strings.Replace(imageDigest.String(), ":", "-", 1))
+			server := httptest.NewTLSServer(registry)
+			defer server.Close()
+
+			dir := t.TempDir()
+			downloader := &containerImageSignatureDownloader{
+				ctx:     context.Background(),
+				timeout: 10 * time.Second,
+				systemContexts: staticSystemContext{&types.SystemContext{
+					DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+					RegistriesDirPath:           dir,
+					AuthFilePath:                filepath.Join(dir, "auth.json"),
+				}},
+			}
+			image := makeImage(imageDigest.String(), strings.TrimPrefix(server.URL, "https://")+"/ns/app@"+imageDigest.String(), nil)
+
+			signatures, err := downloader.DownloadImageSignatures(image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := map[string]int{}
+			for _, signature := range signatures {
+				counts[signature.Type]++
+				if signature.Type != ImageSignatureTypeSigstoreV1 {
+					continue
+				}
+				var content SigstoreSignature
+				if err := json.Unmarshal(signature.Content, &content); err != nil {
+					t.Fatal(err)
+				}
+				if content.MIMEType != sigstoreSignatureMediaType || len(content.Payload) == 0 || content.Annotations["dev.cosignproject.cosign/signature"] != "MEUCIQ==" {
+					t.Errorf("unexpected sigstore signature %#v", content)
+				}
+			}
+			if len(counts) != len(tc.expect) {
+				t.Fatalf("expected signatures %v, got %v", tc.expect, counts)
+			}
+			for signatureType, n := range tc.expect {
+				if counts[signatureType] != n {
+					t.Fatalf("expected signatures %v, got %v", tc.expect, counts)
+				}
+			}
+			if len(signatures) > 0 && signatures[0].Name == signatures[len(signatures)-1].Name {
+				t.Errorf("expected signatures to be named uniquely, got %s", signatures[0].Name)
+			}
+		})
+	}
+}
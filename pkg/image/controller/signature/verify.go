@@ -0,0 +1,718 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/signature"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/provenance"
+)
+
+const (
+	// SignatureTrusted is the condition of image signatures made by a key, or certified
+	// identity, trusted by the policy of the image's scope.
+	SignatureTrusted imagev1.SignatureConditionType = "Trusted"
+	// SignatureForImage is the condition of trusted image signatures claiming the digest of
+	// the image they are stored in.
+	SignatureForImage imagev1.SignatureConditionType = "ForImage"
+
+	// cosignSignatureAnnotation holds the base64 encoded signature of a cosign payload.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// cosignCertificateAnnotation holds the PEM encoded certificate of a keyless cosign
+	// signature.
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	// cosignChainAnnotation holds the PEM encoded intermediate certificates of a keyless
+	// cosign signature.
+	cosignChainAnnotation = "dev.sigstore.cosign/chain"
+)
+
+var (
+	// oidOIDCIssuer is the deprecated Fulcio extension holding the raw OIDC issuer.
+	oidOIDCIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// oidOIDCIssuerV2 is the Fulcio extension holding the DER encoded OIDC issuer.
+	oidOIDCIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// TrustPolicy lists the keys and identities whose signatures are trusted for the images of a
+// registry, or of a repository or repository namespace within it.
+type TrustPolicy struct {
+	// Scope is a registry host, such as "quay.io", or a repository or repository namespace,
+	// such as "quay.io/openshift". The policy with the longest scope matching an image applies.
+	Scope string `json:"scope"`
+	// GPGKeys are the ASCII armored public keys trusted to make atomic signatures.
+	GPGKeys []string `json:"gpgKeys,omitempty"`
+	// PublicKeys are the PEM encoded public keys trusted to make cosign signatures and
+	// sigstore bundles.
+	PublicKeys []string `json:"publicKeys,omitempty"`
+	// FulcioRoots are the PEM encoded root certificates trusted to certify the identities of
+	// keyless cosign signatures and sigstore bundles. Certificates are verified as of their
+	// issuance, inclusion in a transparency log is not checked.
+	FulcioRoots []string `json:"fulcioRoots,omitempty"`
+	// Identities are the certified identities trusted to make keyless signatures. Required
+	// with FulcioRoots.
+	Identities []SigstoreIdentity `json:"identities,omitempty"`
+}
+
+// SigstoreIdentity is an identity certified by Fulcio.
+type SigstoreIdentity struct {
+	// Issuer is the OIDC issuer which authenticated the signer.
+	Issuer string `json:"issuer"`
+	// Subject is the email address or URI of the signer.
+	Subject string `json:"subject"`
+}
+
+// Verifier evaluates image signatures against the trust policies.
+type Verifier struct {
+	// policies are sorted by descending scope length, so that the first match is the longest
+	policies []*trustPolicy
+}
+
+type trustPolicy struct {
+	scope       string
+	gpgKeys     [][]byte
+	publicKeys  []crypto.PublicKey
+	fulcioRoots *x509.CertPool
+	identities  []SigstoreIdentity
+}
+
+// NewVerifier returns a verifier of the trust policies, or an error if they are invalid.
+func NewVerifier(policies []TrustPolicy) (*Verifier, error) {
+	v := &Verifier{}
+	scopes := map[string]bool{}
+	for i, policy := range policies {
+		if err := validateScope(policy.Scope); err != nil {
+			return nil, fmt.Errorf("trustPolicies[%d]: %v", i, err)
+		}
+		if scopes[policy.Scope] {
+			return nil, fmt.Errorf("trustPolicies[%d]: duplicate scope %q", i, policy.Scope)
+		}
+		scopes[policy.Scope] = true
+		p, err := newTrustPolicy(policy)
+		if err != nil {
+			return nil, fmt.Errorf("trustPolicies[%d] of scope %q: %v", i, policy.Scope, err)
+		}
+		v.policies = append(v.policies, p)
+	}
+	sort.SliceStable(v.policies, func(i, j int) bool {
+		return len(v.policies[i].scope) > len(v.policies[j].scope)
+	})
+	return v, nil
+}
+
+func validateScope(scope string) error {
+	if len(scope) == 0 {
+		return fmt.Errorf("the scope must not be empty")
+	}
+	// the scope is validated as the prefix of the name of a repository
+	named, err := reference.ParseNormalizedNamed(scope + "/repository")
+	if err != nil {
+		return fmt.Errorf("invalid scope %q, tags and digests are not allowed: %v", scope, err)
+	}
+	if reference.Domain(named) != strings.SplitN(scope, "/", 2)[0] {
+		return fmt.Errorf("the scope %q must be a registry host, or a repository starting with one", scope)
+	}
+	return nil
+}
+
+func newTrustPolicy(policy TrustPolicy) (*trustPolicy, error) {
+	p := &trustPolicy{scope: policy.Scope, identities: policy.Identities}
+	for i, key := range policy.GPGKeys {
+		mech, identities, err := signature.NewEphemeralGPGSigningMechanism([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("gpgKeys[%d]: %v", i, err)
+		}
+		mech.Close()
+		if len(identities) == 0 {
+			return nil, fmt.Errorf("gpgKeys[%d]: no public key found", i)
+		}
+		p.gpgKeys = append(p.gpgKeys, []byte(key))
+	}
+	for i, key := range policy.PublicKeys {
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return nil, fmt.Errorf("publicKeys[%d]: no PEM data found", i)
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("publicKeys[%d]: %v", i, err)
+		}
+		p.publicKeys = append(p.publicKeys, pub)
+	}
+	if len(policy.FulcioRoots) > 0 {
+		p.fulcioRoots = x509.NewCertPool()
+		for i, root := range policy.FulcioRoots {
+			if !p.fulcioRoots.AppendCertsFromPEM([]byte(root)) {
+				return nil, fmt.Errorf("fulcioRoots[%d]: no PEM encoded certificate found", i)
+			}
+		}
+		if len(policy.Identities) == 0 {
+			return nil, fmt.Errorf("identities are required with fulcioRoots")
+		}
+	}
+	for i, identity := range policy.Identities {
+		if len(identity.Issuer) == 0 || len(identity.Subject) == 0 {
+			return nil, fmt.Errorf("identities[%d]: the issuer and subject are required", i)
+		}
+	}
+	if len(p.gpgKeys) == 0 && len(p.publicKeys) == 0 && p.fulcioRoots == nil {
+		return nil, fmt.Errorf("at least one of gpgKeys, publicKeys or fulcioRoots is required")
+	}
+	return p, nil
+}
+
+// Scope returns the scope of the trust policy applying to the image, false if there is none.
+func (v *Verifier) Scope(image *imagev1.Image) (string, bool) {
+	if p := v.policyFor(image); p != nil {
+		return p.scope, true
+	}
+	return "", false
+}
+
+func (v *Verifier) policyFor(image *imagev1.Image) *trustPolicy {
+	if v == nil {
+		return nil
+	}
+	named, err := reference.ParseNormalizedNamed(image.DockerImageReference)
+	if err != nil {
+		return nil
+	}
+	name := named.Name()
+	for _, p := range v.policies {
+		if name == p.scope || strings.HasPrefix(name, p.scope+"/") {
+			return p
+		}
+	}
+	return nil
+}
+
+// VerifyImage evaluates the signatures of the image against the trust policy of its scope,
+// and records the results in the signatures. It returns true if any signature changed. The
+// signatures of images no policy applies to are left alone.
+func (v *Verifier) VerifyImage(image *imagev1.Image) bool {
+	policy := v.policyFor(image)
+	if policy == nil {
+		return false
+	}
+	changed := false
+	now := metav1.Now()
+	for i := range image.Signatures {
+		sig := &image.Signatures[i]
+		verified := sig.DeepCopy()
+		recordVerification(verified, image.Name, policy.verify(sig), now)
+		if !equality.Semantic.DeepEqual(sig, verified) {
+			image.Signatures[i] = *verified
+			changed = true
+		}
+	}
+	return changed
+}
+
+// HasValidSignature returns true if any signature of the image is trusted and claims the
+// image.
+func HasValidSignature(image *imagev1.Image) bool {
+	for _, sig := range image.Signatures {
+		if conditionTrue(sig, SignatureTrusted) && conditionTrue(sig, SignatureForImage) {
+			return true
+		}
+	}
+	return false
+}
+
+func conditionTrue(sig imagev1.ImageSignature, conditionType imagev1.SignatureConditionType) bool {
+	for _, condition := range sig.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// verification is the result of the evaluation of a signature. The claims are only set for
+// trusted signatures.
+type verification struct {
+	trusted bool
+	reason  string
+	message string
+
+	manifestDigest string
+	identity       string
+	claims         map[string]string
+	created        *time.Time
+	issuedBy       *imagev1.SignatureIssuer
+	issuedTo       *imagev1.SignatureSubject
+}
+
+func untrusted(reason, format string, args ...interface{}) verification {
+	return verification{reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// recordVerification sets the conditions and the claims of the signature to the result of its
+// verification. The signature is stored in the image of the digest.
+func recordVerification(sig *imagev1.ImageSignature, imageDigest string, result verification, now metav1.Time) {
+	sig.ImageIdentity = result.identity
+	sig.SignedClaims = result.claims
+	sig.Created = nil
+	if result.created != nil {
+		created := metav1.NewTime(*result.created)
+		sig.Created = &created
+	}
+	sig.IssuedBy = result.issuedBy
+	sig.IssuedTo = result.issuedTo
+
+	if !result.trusted {
+		setCondition(sig, SignatureTrusted, corev1.ConditionFalse, result.reason, result.message, now)
+		removeCondition(sig, SignatureForImage)
+		return
+	}
+	setCondition(sig, SignatureTrusted, corev1.ConditionTrue, "Verified", result.message, now)
+	if result.manifestDigest == imageDigest {
+		setCondition(sig, SignatureForImage, corev1.ConditionTrue, "DigestMatched", "", now)
+	} else {
+		setCondition(sig, SignatureForImage, corev1.ConditionFalse, "DigestMismatch",
+			fmt.Sprintf("the signature claims the digest %q", result.manifestDigest), now)
+	}
+}
+
+func setCondition(sig *imagev1.ImageSignature, conditionType imagev1.SignatureConditionType, status corev1.ConditionStatus, reason, message string, now metav1.Time) {
+	condition := imagev1.SignatureCondition{
+		Type:               conditionType,
+		Status:             status,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	}
+	for i, existing := range sig.Conditions {
+		if existing.Type != conditionType {
+			continue
+		}
+		if existing.Status == status && existing.Reason == reason && existing.Message == message {
+			return
+		}
+		if existing.Status == status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		sig.Conditions[i] = condition
+		return
+	}
+	sig.Conditions = append(sig.Conditions, condition)
+}
+
+func removeCondition(sig *imagev1.ImageSignature, conditionType imagev1.SignatureConditionType) {
+	var conditions []imagev1.SignatureCondition
+	for _, condition := range sig.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	sig.Conditions = conditions
+}
+
+func (p *trustPolicy) verify(sig *imagev1.ImageSignature) verification {
+	switch sig.Type {
+	case imagev1.ImageSignatureTypeAtomicImageV1:
+		return p.verifyAtomic(sig.Content)
+	case ImageSignatureTypeSigstoreV1:
+		return p.verifyCosign(sig.Content)
+	case ImageSignatureTypeSigstoreBundleV1:
+		return p.verifyBundle(sig.Content)
+	default:
+		return untrusted("UnsupportedType", "signatures of type %q are not verified", sig.Type)
+	}
+}
+
+// simpleSigningPayload is the payload of atomic and cosign signatures.
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// parseSimpleSigningPayload returns the verification of the signed payload.
+func parseSimpleSigningPayload(payload []byte, result verification) verification {
+	var claims simpleSigningPayload
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return untrusted("InvalidSignature", "invalid signed payload: %v", err)
+	}
+	result.manifestDigest = claims.Critical.Image.DockerManifestDigest
+	result.identity = claims.Critical.Identity.DockerReference
+	for key, value := range claims.Optional {
+		if result.claims == nil {
+			result.claims = map[string]string{}
+		}
+		result.claims[key] = fmt.Sprint(value)
+	}
+	if timestamp, ok := claims.Optional["timestamp"].(float64); ok && result.created == nil {
+		created := time.Unix(int64(timestamp), 0).UTC()
+		result.created = &created
+	}
+	return result
+}
+
+func (p *trustPolicy) verifyAtomic(content []byte) verification {
+	for _, key := range p.gpgKeys {
+		if result, ok := verifyGPG(key, content); ok {
+			return result
+		}
+	}
+	return untrusted("NoMatchingKey", "the signature was not made by any trusted GPG key")
+}
+
+func verifyGPG(key, content []byte) (verification, bool) {
+	mech, identities, err := signature.NewEphemeralGPGSigningMechanism(key)
+	if err != nil {
+		return verification{}, false
+	}
+	defer mech.Close()
+	payload, keyIdentity, err := mech.Verify(content)
+	if err != nil {
+		return verification{}, false
+	}
+	for _, identity := range identities {
+		if identity == keyIdentity {
+			return parseSimpleSigningPayload(payload, verification{
+				trusted:  true,
+				issuedTo: &imagev1.SignatureSubject{PublicKeyID: keyIdentity},
+			}), true
+		}
+	}
+	return verification{}, false
+}
+
+func (p *trustPolicy) verifyCosign(content []byte) verification {
+	var sig SigstoreSignature
+	if err := json.Unmarshal(content, &sig); err != nil {
+		return untrusted("InvalidSignature", "invalid cosign signature: %v", err)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(sig.Annotations[cosignSignatureAnnotation])
+	if err != nil || len(signatureBytes) == 0 {
+		return untrusted("InvalidSignature", "the cosign signature has no valid %s annotation", cosignSignatureAnnotation)
+	}
+
+	if certPEM := sig.Annotations[cosignCertificateAnnotation]; len(certPEM) > 0 && p.fulcioRoots != nil {
+		cert, err := parseCertificatePEM([]byte(certPEM))
+		if err != nil {
+			return untrusted("InvalidSignature", "invalid cosign certificate: %v", err)
+		}
+		intermediates, err := parseCertificatesPEM([]byte(sig.Annotations[cosignChainAnnotation]))
+		if err != nil {
+			return untrusted("InvalidSignature", "invalid cosign certificate chain: %v", err)
+		}
+		result, err := p.verifyCertificate(cert, intermediates)
+		if err != nil {
+			return untrusted("UntrustedIdentity", "%v", err)
+		}
+		if err := verifyMessage(cert.PublicKey, sig.Payload, signatureBytes); err != nil {
+			return untrusted("InvalidSignature", "the signature does not match its certificate: %v", err)
+		}
+		return parseSimpleSigningPayload(sig.Payload, result)
+	}
+
+	for _, key := range p.publicKeys {
+		if verifyMessage(key, sig.Payload, signatureBytes) == nil {
+			return parseSimpleSigningPayload(sig.Payload, keyVerification(key))
+		}
+	}
+	return untrusted("NoMatchingKey", "the signature was not made by any trusted public key")
+}
+
+// sigstoreBundle is the part of a sigstore bundle that is verified.
+type sigstoreBundle struct {
+	VerificationMaterial struct {
+		Certificate *struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+	} `json:"verificationMaterial"`
+	DSSEEnvelope *struct {
+		Payload     []byte `json:"payload"`
+		PayloadType string `json:"payloadType"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	} `json:"dsseEnvelope"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+// inTotoStatement is the part of the in-toto statement of a DSSE envelope that is verified.
+type inTotoStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+}
+
+func (p *trustPolicy) verifyBundle(content []byte) verification {
+	var bundle sigstoreBundle
+	if err := json.Unmarshal(content, &bundle); err != nil {
+		return untrusted("InvalidSignature", "invalid sigstore bundle: %v", err)
+	}
+
+	var certs []*x509.Certificate
+	if bundle.VerificationMaterial.Certificate != nil {
+		cert, err := x509.ParseCertificate(bundle.VerificationMaterial.Certificate.RawBytes)
+		if err != nil {
+			return untrusted("InvalidSignature", "invalid sigstore bundle certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if chain := bundle.VerificationMaterial.X509CertificateChain; chain != nil {
+		for _, raw := range chain.Certificates {
+			cert, err := x509.ParseCertificate(raw.RawBytes)
+			if err != nil {
+				return untrusted("InvalidSignature", "invalid sigstore bundle certificate: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	var verify func(key crypto.PublicKey) error
+	var claims func(result verification) verification
+	switch {
+	case bundle.DSSEEnvelope != nil:
+		envelope := bundle.DSSEEnvelope
+		message := provenance.PreAuthEncoding(envelope.PayloadType, envelope.Payload)
+		verify = func(key crypto.PublicKey) error {
+			err := fmt.Errorf("the envelope has no signatures")
+			for _, sig := range envelope.Signatures {
+				if err = verifyMessage(key, message, sig.Sig); err == nil {
+					return nil
+				}
+			}
+			return err
+		}
+		claims = func(result verification) verification {
+			var statement inTotoStatement
+			if err := json.Unmarshal(envelope.Payload, &statement); err != nil {
+				return untrusted("InvalidSignature", "invalid in-toto statement: %v", err)
+			}
+			result.claims = map[string]string{"predicateType": statement.PredicateType}
+			for _, subject := range statement.Subject {
+				if sum, ok := subject.Digest["sha256"]; ok {
+					result.identity = subject.Name
+					result.manifestDigest = "sha256:" + sum
+					break
+				}
+			}
+			return result
+		}
+	case bundle.MessageSignature != nil:
+		signed := bundle.MessageSignature
+		if signed.MessageDigest.Algorithm != "SHA2_256" {
+			return untrusted("InvalidSignature", "unsupported message digest algorithm %q", signed.MessageDigest.Algorithm)
+		}
+		verify = func(key crypto.PublicKey) error {
+			return verifyDigest(key, signed.MessageDigest.Digest, signed.Signature)
+		}
+		claims = func(result verification) verification {
+			result.manifestDigest = "sha256:" + hex.EncodeToString(signed.MessageDigest.Digest)
+			return result
+		}
+	default:
+		return untrusted("InvalidSignature", "the sigstore bundle has neither a DSSE envelope nor a message signature")
+	}
+
+	if len(certs) > 0 && p.fulcioRoots != nil {
+		result, err := p.verifyCertificate(certs[0], certs[1:])
+		if err != nil {
+			return untrusted("UntrustedIdentity", "%v", err)
+		}
+		if err := verify(certs[0].PublicKey); err != nil {
+			return untrusted("InvalidSignature", "the signature does not match its certificate: %v", err)
+		}
+		return claims(result)
+	}
+	for _, key := range p.publicKeys {
+		if verify(key) == nil {
+			return claims(keyVerification(key))
+		}
+	}
+	return untrusted("NoMatchingKey", "the signature was not made by any trusted public key")
+}
+
+// verifyCertificate verifies the certificate chains to a trusted Fulcio root, as of its
+// issuance, and certifies a trusted identity.
+func (p *trustPolicy) verifyCertificate(cert *x509.Certificate, intermediates []*x509.Certificate) (verification, error) {
+	pool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		pool.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         p.fulcioRoots,
+		Intermediates: pool,
+		CurrentTime:   cert.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return verification{}, fmt.Errorf("the certificate is not issued by a trusted Fulcio root: %v", err)
+	}
+
+	identity, err := certificateIdentity(cert)
+	if err != nil {
+		return verification{}, err
+	}
+	trusted := false
+	for _, allowed := range p.identities {
+		if allowed == identity {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return verification{}, fmt.Errorf("the identity %q issued by %q is not trusted", identity.Subject, identity.Issuer)
+	}
+
+	created := cert.NotBefore.UTC()
+	result := keyVerification(cert.PublicKey)
+	result.created = &created
+	result.issuedBy = &imagev1.SignatureIssuer{SignatureGenericEntity: imagev1.SignatureGenericEntity{
+		Organization: strings.Join(cert.Issuer.Organization, ", "),
+		CommonName:   cert.Issuer.CommonName,
+	}}
+	result.issuedTo.CommonName = identity.Subject
+	result.claims = map[string]string{"oidcIssuer": identity.Issuer}
+	return result, nil
+}
+
+// certificateIdentity returns the identity a Fulcio certificate certifies.
+func certificateIdentity(cert *x509.Certificate) (SigstoreIdentity, error) {
+	var identity SigstoreIdentity
+	switch {
+	case len(cert.EmailAddresses) > 0:
+		identity.Subject = cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		identity.Subject = cert.URIs[0].String()
+	default:
+		return identity, fmt.Errorf("the certificate has no email address or URI subject")
+	}
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidOIDCIssuerV2):
+			if _, err := asn1.Unmarshal(ext.Value, &identity.Issuer); err != nil {
+				return identity, fmt.Errorf("invalid OIDC issuer extension: %v", err)
+			}
+		case ext.Id.Equal(oidOIDCIssuer) && len(identity.Issuer) == 0:
+			identity.Issuer = string(ext.Value)
+		}
+	}
+	if len(identity.Issuer) == 0 {
+		return identity, fmt.Errorf("the certificate has no OIDC issuer")
+	}
+	return identity, nil
+}
+
+// keyVerification returns a trusted verification of a signature made by the key.
+func keyVerification(key crypto.PublicKey) verification {
+	return verification{
+		trusted:  true,
+		issuedTo: &imagev1.SignatureSubject{PublicKeyID: publicKeyID(key)},
+	}
+}
+
+// publicKeyID returns the hex encoded SHA-256 fingerprint of the public key.
+func publicKeyID(key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der))
+}
+
+// verifyMessage verifies the signature of the message, which is hashed with SHA-256 unless the
+// key is an ed25519 key.
+func verifyMessage(key crypto.PublicKey, message, sig []byte) error {
+	if pub, ok := key.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(pub, message, sig) {
+			return fmt.Errorf("invalid ed25519 signature")
+		}
+		return nil
+	}
+	digest := sha256.Sum256(message)
+	return verifyDigest(key, digest[:], sig)
+}
+
+// verifyDigest verifies the signature of a SHA-256 digest.
+func verifyDigest(key crypto.PublicKey, digest, sig []byte) error {
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return fmt.Errorf("invalid ECDSA signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err != nil {
+			return rsa.VerifyPSS(pub, crypto.SHA256, digest, sig, nil)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+func parseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	certs, err := parseCertificatesPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return certs[0], nil
+}
+
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
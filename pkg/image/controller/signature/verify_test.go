@@ -0,0 +1,384 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	"github.com/openshift/openshift-controller-manager/pkg/build/controller/build/provenance"
+)
+
+const testDigest = "sha256:5e44a5c5c3a8ee4d6a5c6a5c3a9f0c1b0e2e4d7e8f9a0b1c2d3e4f5a6b7c8d9e"
+
+var gpgConfig = &packet.Config{DefaultHash: crypto.SHA256}
+
+func newECDSAKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func signMessageECDSA(t *testing.T, key *ecdsa.PrivateKey, message []byte) []byte {
+	digest := sha256.Sum256(message)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func simpleSigningPayloadFor(manifestDigest string) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"quay.io/openshift/app"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":{"creator":"test"}}`, manifestDigest))
+}
+
+func cosignSignature(t *testing.T, key *ecdsa.PrivateKey, payload []byte, annotations map[string]string) imagev1.ImageSignature {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[cosignSignatureAnnotation] = base64.StdEncoding.EncodeToString(signMessageECDSA(t, key, payload))
+	content, err := json.Marshal(SigstoreSignature{MIMEType: sigstoreSignatureMediaType, Payload: payload, Annotations: annotations})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newImageSignature(&imagev1.Image{}, ImageSignatureTypeSigstoreV1, content)
+}
+
+func dsseBundle(t *testing.T, key *ecdsa.PrivateKey, manifestDigest string) imagev1.ImageSignature {
+	statement := []byte(fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"quay.io/openshift/app","digest":{"sha256":%q}}],"predicateType":"https://sigstore.dev/cosign/sign/v1"}`, strings.TrimPrefix(manifestDigest, "sha256:")))
+	payloadType := "application/vnd.in-toto+json"
+	content, err := json.Marshal(map[string]interface{}{
+		"mediaType":            "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{"publicKey": map[string]string{"hint": "key"}},
+		"dsseEnvelope": map[string]interface{}{
+			"payload":     statement,
+			"payloadType": payloadType,
+			"signatures":  []map[string]interface{}{{"sig": signMessageECDSA(t, key, provenance.PreAuthEncoding(payloadType, statement))}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newImageSignature(&imagev1.Image{}, ImageSignatureTypeSigstoreBundleV1, content)
+}
+
+// newFulcio returns a PEM encoded root certificate, and a function issuing PEM encoded
+// certificates of the identity that expired an hour ago.
+func newFulcio(t *testing.T) (string, func(pub crypto.PublicKey, identity SigstoreIdentity) string) {
+	caKey, _ := newECDSAKey(t)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"sigstore.dev"}, CommonName: "sigstore"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err = x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(pub crypto.PublicKey, identity SigstoreIdentity) string {
+		issuer, err := asn1.Marshal(identity.Issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf := &x509.Certificate{
+			SerialNumber:    big.NewInt(2),
+			NotBefore:       time.Now().Add(-time.Hour),
+			NotAfter:        time.Now().Add(-50 * time.Minute),
+			EmailAddresses:  []string{identity.Subject},
+			KeyUsage:        x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+			ExtraExtensions: []pkix.Extension{{Id: oidOIDCIssuerV2, Value: issuer}},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, leaf, ca, pub, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})), issue
+}
+
+func newGPGKey(t *testing.T) (*openpgp.Entity, string) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", gpgConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return entity, buf.String()
+}
+
+func atomicSignature(t *testing.T, entity *openpgp.Entity, manifestDigest string) imagev1.ImageSignature {
+	buf := &bytes.Buffer{}
+	w, err := openpgp.Sign(buf, entity, nil, gpgConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"quay.io/openshift/app"},"image":{"docker-manifest-digest":%q},"type":"atomic container signature"},"optional":{"creator":"test","timestamp":1600000000}}`, manifestDigest)
+	if _, err := w.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return newImageSignature(&imagev1.Image{}, imagev1.ImageSignatureTypeAtomicImageV1, buf.Bytes())
+}
+
+func conditionStatus(sig imagev1.ImageSignature, conditionType imagev1.SignatureConditionType) (corev1.ConditionStatus, string) {
+	for _, condition := range sig.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status, condition.Reason
+		}
+	}
+	return "", ""
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, publicKey := newECDSAKey(t)
+	root, _ := newFulcio(t)
+	testCases := []struct {
+		name     string
+		policies []TrustPolicy
+		err      string
+	}{
+		{name: "none"},
+		{
+			name: "registry and repository scopes",
+			policies: []TrustPolicy{
+				{Scope: "quay.io", PublicKeys: []string{publicKey}},
+				{Scope: "quay.io/openshift", PublicKeys: []string{publicKey}},
+				{Scope: "localhost:5000/ns/app", FulcioRoots: []string{root}, Identities: []SigstoreIdentity{{Issuer: "https://issuer", Subject: "me@example.com"}}},
+			},
+		},
+		{name: "empty scope", policies: []TrustPolicy{{PublicKeys: []string{publicKey}}}, err: "must not be empty"},
+		{name: "scope without registry", policies: []TrustPolicy{{Scope: "openshift/app", PublicKeys: []string{publicKey}}}, err: "must be a registry host"},
+		{name: "scope with tag", policies: []TrustPolicy{{Scope: "quay.io/openshift/app:latest", PublicKeys: []string{publicKey}}}, err: "invalid scope"},
+		{
+			name:     "duplicate scope",
+			policies: []TrustPolicy{{Scope: "quay.io", PublicKeys: []string{publicKey}}, {Scope: "quay.io", PublicKeys: []string{publicKey}}},
+			err:      "duplicate scope",
+		},
+		{name: "no keys", policies: []TrustPolicy{{Scope: "quay.io"}}, err: "at least one of"},
+		{name: "invalid public key", policies: []TrustPolicy{{Scope: "quay.io", PublicKeys: []string{"key"}}}, err: "publicKeys[0]"},
+		{name: "roots without identities", policies: []TrustPolicy{{Scope: "quay.io", FulcioRoots: []string{root}}}, err: "identities are required"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewVerifier(tc.policies)
+			if len(tc.err) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tc.err) > 0 && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifierScope(t *testing.T) {
+	_, publicKey := newECDSAKey(t)
+	verifier, err := NewVerifier([]TrustPolicy{
+		{Scope: "quay.io", PublicKeys: []string{publicKey}},
+		{Scope: "quay.io/openshift", PublicKeys: []string{publicKey}},
+		{Scope: "docker.io/library", PublicKeys: []string{publicKey}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, expect := range map[string]string{
+		"quay.io/openshift/app@" + testDigest:  "quay.io/openshift",
+		"quay.io/openshiftx/app@" + testDigest: "quay.io",
+		"busybox@" + testDigest:                "docker.io/library",
+		"registry.io/app@" + testDigest:        "",
+	} {
+		scope, _ := verifier.Scope(makeImage(testDigest, ref, nil))
+		if scope != expect {
+			t.Errorf("expected the scope of %s to be %q, got %q", ref, expect, scope)
+		}
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	key, publicKey := newECDSAKey(t)
+	otherKey, _ := newECDSAKey(t)
+	entity, gpgKey := newGPGKey(t)
+	root, issue := newFulcio(t)
+	identity := SigstoreIdentity{Issuer: "https://issuer.example.com", Subject: "me@example.com"}
+
+	verifier, err := NewVerifier([]TrustPolicy{{
+		Scope:       "quay.io/openshift",
+		GPGKeys:     []string{gpgKey},
+		PublicKeys:  []string{publicKey},
+		FulcioRoots: []string{root},
+		Identities:  []SigstoreIdentity{identity},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keylessKey, _ := newECDSAKey(t)
+	untrustedKey, _ := newECDSAKey(t)
+	testCases := []struct {
+		name      string
+		signature imagev1.ImageSignature
+		trusted   string
+		forImage  corev1.ConditionStatus
+		check     func(t *testing.T, sig imagev1.ImageSignature)
+	}{
+		{
+			name:      "cosign signature of a trusted key",
+			signature: cosignSignature(t, key, simpleSigningPayloadFor(testDigest), nil),
+			trusted:   "Verified",
+			forImage:  corev1.ConditionTrue,
+			check: func(t *testing.T, sig imagev1.ImageSignature) {
+				if sig.ImageIdentity != "quay.io/openshift/app" || sig.SignedClaims["creator"] != "test" {
+					t.Errorf("unexpected claims %q %v", sig.ImageIdentity, sig.SignedClaims)
+				}
+				if sig.IssuedTo == nil || sig.IssuedTo.PublicKeyID != publicKeyID(key.Public()) {
+					t.Errorf("unexpected subject %#v", sig.IssuedTo)
+				}
+			},
+		},
+		{
+			name:      "cosign signature of another image",
+			signature: cosignSignature(t, key, simpleSigningPayloadFor("sha256:0000"), nil),
+			trusted:   "Verified",
+			forImage:  corev1.ConditionFalse,
+		},
+		{
+			name:      "cosign signature of an untrusted key",
+			signature: cosignSignature(t, otherKey, simpleSigningPayloadFor(testDigest), nil),
+			trusted:   "NoMatchingKey",
+		},
+		{
+			name: "keyless cosign signature of a trusted identity",
+			signature: cosignSignature(t, keylessKey, simpleSigningPayloadFor(testDigest), map[string]string{
+				cosignCertificateAnnotation: issue(keylessKey.Public(), identity),
+			}),
+			trusted:  "Verified",
+			forImage: corev1.ConditionTrue,
+			check: func(t *testing.T, sig imagev1.ImageSignature) {
+				if sig.IssuedBy == nil || sig.IssuedBy.CommonName != "sigstore" {
+					t.Errorf("unexpected issuer %#v", sig.IssuedBy)
+				}
+				if sig.IssuedTo == nil || sig.IssuedTo.CommonName != identity.Subject || sig.SignedClaims["oidcIssuer"] != identity.Issuer {
+					t.Errorf("unexpected subject %#v, claims %v", sig.IssuedTo, sig.SignedClaims)
+				}
+				if sig.Created == nil {
+					t.Errorf("expected the signature creation time to be recorded")
+				}
+			},
+		},
+		{
+			name: "keyless cosign signature of an untrusted identity",
+			signature: cosignSignature(t, untrustedKey, simpleSigningPayloadFor(testDigest), map[string]string{
+				cosignCertificateAnnotation: issue(untrustedKey.Public(), SigstoreIdentity{Issuer: identity.Issuer, Subject: "other@example.com"}),
+			}),
+			trusted: "UntrustedIdentity",
+		},
+		{
+			name:      "sigstore bundle of a trusted key",
+			signature: dsseBundle(t, key, testDigest),
+			trusted:   "Verified",
+			forImage:  corev1.ConditionTrue,
+			check: func(t *testing.T, sig imagev1.ImageSignature) {
+				if sig.SignedClaims["predicateType"] != "https://sigstore.dev/cosign/sign/v1" {
+					t.Errorf("unexpected claims %v", sig.SignedClaims)
+				}
+			},
+		},
+		{
+			name:      "sigstore bundle of an untrusted key",
+			signature: dsseBundle(t, otherKey, testDigest),
+			trusted:   "NoMatchingKey",
+		},
+		{
+			name:      "atomic signature of a trusted key",
+			signature: atomicSignature(t, entity, testDigest),
+			trusted:   "Verified",
+			forImage:  corev1.ConditionTrue,
+			check: func(t *testing.T, sig imagev1.ImageSignature) {
+				if sig.Created == nil || sig.Created.Unix() != 1600000000 {
+					t.Errorf("unexpected creation time %v", sig.Created)
+				}
+				if sig.IssuedTo == nil || sig.IssuedTo.PublicKeyID != strings.ToUpper(fmt.Sprintf("%x", entity.PrimaryKey.Fingerprint)) {
+					t.Errorf("unexpected subject %#v", sig.IssuedTo)
+				}
+			},
+		},
+		{
+			name:      "unsupported type",
+			signature: imagev1.ImageSignature{Type: "Unknown", Content: []byte("unknown")},
+			trusted:   "UnsupportedType",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			image := makeImage(testDigest, "quay.io/openshift/app@"+testDigest, []imagev1.ImageSignature{tc.signature})
+			if !verifier.VerifyImage(image) {
+				t.Fatalf("expected the signature to change")
+			}
+			sig := image.Signatures[0]
+			status, reason := conditionStatus(sig, SignatureTrusted)
+			if reason != tc.trusted || (status == corev1.ConditionTrue) != (tc.trusted == "Verified") {
+				t.Fatalf("expected trusted condition %s, got %s %s: %#v", tc.trusted, status, reason, sig.Conditions)
+			}
+			if status, _ := conditionStatus(sig, SignatureForImage); status != tc.forImage {
+				t.Errorf("expected for image condition %q, got %q", tc.forImage, status)
+			}
+			if HasValidSignature(image) != (tc.trusted == "Verified" && tc.forImage == corev1.ConditionTrue) {
+				t.Errorf("unexpected validity of the image signatures")
+			}
+			if tc.check != nil {
+				tc.check(t, sig)
+			}
+			if verifier.VerifyImage(image) {
+				t.Errorf("expected verifying the signature again not to change it")
+			}
+		})
+	}
+
+	image := makeImage(testDigest, "registry.io/app@"+testDigest, []imagev1.ImageSignature{cosignSignature(t, key, simpleSigningPayloadFor(testDigest), nil)})
+	if verifier.VerifyImage(image) || len(image.Signatures[0].Conditions) > 0 {
+		t.Errorf("expected the signatures of images outside of the trust policy scopes not to be verified")
+	}
+}
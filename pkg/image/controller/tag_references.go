@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+const (
+	defaultUnreferencedIntervalFactor = 4
+
+	// scheduledIntervalRefreshPeriod is how often the intervals of scheduled streams are
+	// recomputed, as image triggers start or stop referencing their tags.
+	scheduledIntervalRefreshPeriod = time.Minute
+)
+
+// TriggerPriorityConfig controls how much more often scheduled imports check the tags that
+// image triggers depend on than the tags nothing is triggered by.
+type TriggerPriorityConfig struct {
+	// UnreferencedIntervalFactor multiplies the interval between scheduled imports of tags
+	// which are not referenced by the image trigger of any Deployment, DeploymentConfig,
+	// BuildConfig or other trigger source. Defaults to 4. A factor of 1 imports all
+	// scheduled tags at the same interval.
+	UnreferencedIntervalFactor int `json:"unreferencedIntervalFactor,omitempty"`
+}
+
+// ValidateTriggerPriorityConfig returns an error if the trigger priority configuration is
+// invalid.
+func ValidateTriggerPriorityConfig(config TriggerPriorityConfig) error {
+	if config.UnreferencedIntervalFactor < 0 {
+		return fmt.Errorf("the unreferencedIntervalFactor must not be negative, got %d", config.UnreferencedIntervalFactor)
+	}
+	return nil
+}
+
+// TagReferences reports the image stream tags referenced by the image triggers of other
+// resources.
+type TagReferences interface {
+	// ReferencedTags returns the tags of the image stream referenced by unpaused triggers.
+	ReferencedTags(namespace, name string) sets.String
+	// HasSynced returns true once the triggers of all resources are known.
+	HasSynced() bool
+}
+
+// referencedTags returns the scheduled tags of the stream referenced by image triggers. It
+// returns false if they are unknown, in which case every tag is treated as referenced.
+func (s *ScheduledImageStreamController) referencedTags(stream *imagev1.ImageStream) (sets.String, bool) {
+	if s.references == nil || s.unreferencedFactor <= 1 || !s.references.HasSynced() {
+		return nil, false
+	}
+	referenced := s.references.ReferencedTags(stream.Namespace, stream.Name)
+	tags := sets.NewString()
+	for _, tagRef := range stream.Spec.Tags {
+		if referenced.Has(tagRef.Name) && tagScheduled(stream, tagRef) {
+			tags.Insert(tagRef.Name)
+		}
+	}
+	return tags, true
+}
+
+// deferUnreferencedTags reverts the generation bump of the scheduled tags which are not
+// referenced by image triggers, so that they are only imported once every unreferenced
+// interval. Streams without referenced tags are already scheduled at that interval, and
+// have all of their tags imported.
+func (s *ScheduledImageStreamController) deferUnreferencedTags(key string, stream, original *imagev1.ImageStream) {
+	referenced, ok := s.referencedTags(original)
+	if !ok || len(referenced) == 0 {
+		return
+	}
+
+	now := s.scheduler.clock.Now()
+	s.fullImportsLock.Lock()
+	defer s.fullImportsLock.Unlock()
+	if last, ok := s.fullImports[key]; !ok || now.Sub(last) >= s.baseInterval(original)*time.Duration(s.unreferencedFactor) {
+		s.fullImports[key] = now
+		return
+	}
+
+	for i, tagRef := range stream.Spec.Tags {
+		if referenced.Has(tagRef.Name) {
+			continue
+		}
+		originalRef, ok := scheduledForImport(original, tagRef)
+		if !ok {
+			continue
+		}
+		klog.V(5).Infof("Deferring scheduled import of unreferenced tag %s of stream %s/%s", tagRef.Name, stream.Namespace, stream.Name)
+		stream.Spec.Tags[i].Generation = originalRef.Generation
+	}
+}
+
+// refreshIntervals recomputes the interval of every scheduled stream, since the tags that
+// image triggers reference change without the streams themselves changing.
+func (s *ScheduledImageStreamController) refreshIntervals() {
+	for key := range s.scheduler.Map() {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key.(string))
+		if err != nil {
+			continue
+		}
+		stream, err := s.lister.ImageStreams(namespace).Get(name)
+		if err != nil {
+			continue
+		}
+		s.scheduler.SetInterval(key, s.importInterval(stream))
+	}
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/flowcontrol"
+
+	imagev1 "github.com/openshift/api/image/v1"
+)
+
+type fakeTagReferences struct {
+	synced bool
+	tags   sets.String
+}
+
+func (r *fakeTagReferences) ReferencedTags(namespace, name string) sets.String { return r.tags }
+func (r *fakeTagReferences) HasSynced() bool                                   { return r.synced }
+
+func TestTriggerPriorityIntervals(t *testing.T) {
+	one := int64(1)
+	stream := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "other", Generation: 1},
+		Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{
+			{Name: "used", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app:used"}, Generation: &one, ImportPolicy: imagev1.TagImportPolicy{Scheduled: true}},
+			{Name: "unused", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app:unused"}, Generation: &one, ImportPolicy: imagev1.TagImportPolicy{Scheduled: true}},
+			{Name: "manual", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app:manual"}, Generation: &one},
+		}},
+	}
+
+	tests := map[string]struct {
+		references TagReferences
+		factor     int
+		expected   time.Duration
+	}{
+		"no trigger controller": {
+			factor:   4,
+			expected: 15 * time.Minute,
+		},
+		"triggers not synced": {
+			references: &fakeTagReferences{tags: sets.NewString()},
+			factor:     4,
+			expected:   15 * time.Minute,
+		},
+		"referenced": {
+			references: &fakeTagReferences{synced: true, tags: sets.NewString("used")},
+			factor:     4,
+			expected:   15 * time.Minute,
+		},
+		"unreferenced": {
+			references: &fakeTagReferences{synced: true, tags: sets.NewString()},
+			factor:     4,
+			expected:   time.Hour,
+		},
+		"only a manual tag is referenced": {
+			references: &fakeTagReferences{synced: true, tags: sets.NewString("manual")},
+			factor:     4,
+			expected:   time.Hour,
+		},
+		"priority disabled": {
+			references: &fakeTagReferences{synced: true, tags: sets.NewString()},
+			factor:     1,
+			expected:   15 * time.Minute,
+		},
+	}
+	for name, test := range tests {
+		sched := &ScheduledImageStreamController{
+			minimumInterval:    15 * time.Minute,
+			references:         test.references,
+			unreferencedFactor: test.factor,
+		}
+		if actual := sched.importInterval(stream); actual != test.expected {
+			t.Errorf("%s: expected interval %s, got %s", name, test.expected, actual)
+		}
+	}
+}
+
+func TestDeferUnreferencedTags(t *testing.T) {
+	one := int64(1)
+	original := &imagev1.ImageStream{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "other", Generation: 1},
+		Spec: imagev1.ImageStreamSpec{Tags: []imagev1.TagReference{
+			{Name: "used", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app:used"}, Generation: &one, ImportPolicy: imagev1.TagImportPolicy{Scheduled: true}},
+			{Name: "unused", From: &corev1.ObjectReference{Kind: "DockerImage", Name: "quay.io/org/app:unused"}, Generation: &one, ImportPolicy: imagev1.TagImportPolicy{Scheduled: true}},
+		}},
+	}
+	clock, setTime := setClock()
+	references := &fakeTagReferences{synced: true, tags: sets.NewString("used")}
+	sched := &ScheduledImageStreamController{
+		minimumInterval:    15 * time.Minute,
+		references:         references,
+		unreferencedFactor: 4,
+		fullImports:        make(map[string]time.Time),
+		scheduler:          newScheduler(flowcontrol.NewFakeAlwaysRateLimiter(), clock, 0, func(key, value interface{}, due time.Time) {}),
+	}
+	imported := func() sets.String {
+		stream := original.DeepCopy()
+		resetScheduledTags(stream)
+		sched.deferUnreferencedTags("other/test", stream, original)
+		tags := sets.NewString()
+		for _, tagRef := range stream.Spec.Tags {
+			if *tagRef.Generation != one {
+				tags.Insert(tagRef.Name)
+			}
+		}
+		return tags
+	}
+
+	if tags := imported(); !tags.Equal(sets.NewString("used", "unused")) {
+		t.Errorf("expected the first import to include every tag, got %v", tags.List())
+	}
+	setTime(15 * time.Minute)
+	if tags := imported(); !tags.Equal(sets.NewString("used")) {
+		t.Errorf("expected only the referenced tag to be imported, got %v", tags.List())
+	}
+	setTime(time.Hour)
+	if tags := imported(); !tags.Equal(sets.NewString("used", "unused")) {
+		t.Errorf("expected every tag to be imported after the unreferenced interval, got %v", tags.List())
+	}
+
+	// streams without referenced tags are scheduled at the longer interval already
+	references.tags = sets.NewString()
+	setTime(75 * time.Minute)
+	if tags := imported(); !tags.Equal(sets.NewString("used", "unused")) {
+		t.Errorf("expected every tag of an unreferenced stream to be imported, got %v", tags.List())
+	}
+
+	sched.forgetStream("other/test")
+	if len(sched.fullImports) != 0 {
+		t.Errorf("expected the stream to be forgotten, got %v", sched.fullImports)
+	}
+}
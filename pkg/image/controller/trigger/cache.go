@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
@@ -99,3 +100,31 @@ func extractErrorForObj(obj interface{}, err error) error {
 	}
 	return fmt.Errorf("unable to extract cache data from %T %s/%s: %v", obj, accessor.GetNamespace(), accessor.GetName(), err)
 }
+
+// referencedTags returns the tags of the image stream namespace/name referenced by the
+// unpaused triggers in the cache.
+func referencedTags(c cache.ThreadSafeStore, namespace, name string) (sets.String, error) {
+	objs, err := c.ByIndex("images", namespace+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+	tags := sets.NewString()
+	for _, obj := range objs {
+		entry := obj.(*trigger.CacheEntry)
+		for _, t := range entry.Triggers {
+			if t.From.Kind != "ImageStreamTag" || len(t.From.APIVersion) != 0 || t.Paused {
+				continue
+			}
+			triggerNamespace := t.From.Namespace
+			if len(triggerNamespace) == 0 {
+				triggerNamespace = entry.Namespace
+			}
+			streamName, tag, ok := imageutil.SplitImageStreamTag(t.From.Name)
+			if !ok || streamName != name || triggerNamespace != namespace {
+				continue
+			}
+			tags.Insert(tag)
+		}
+	}
+	return tags, nil
+}
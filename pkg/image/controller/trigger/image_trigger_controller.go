@@ -10,13 +10,17 @@ import (
 	"k8s.io/klog/v2"
 
 	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	kscheme "k8s.io/client-go/kubernetes/scheme"
 	kv1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/kubernetes/pkg/api/legacyscheme"
 	"k8s.io/kubernetes/pkg/controller"
@@ -245,6 +249,27 @@ func (c *TriggerController) Run(workers int, stopCh <-chan struct{}) {
 	klog.Infof("Shutting down trigger controller")
 }
 
+// ReferencedTags returns the tags of the image stream namespace/name referenced by the
+// unpaused image triggers of any resource.
+func (c *TriggerController) ReferencedTags(namespace, name string) sets.String {
+	tags, err := referencedTags(c.triggerCache, namespace, name)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to list the triggers of image stream %s/%s: %v", namespace, name, err))
+		return sets.NewString()
+	}
+	return tags
+}
+
+// HasSynced returns true once the image streams and the triggers of all sources are known.
+func (c *TriggerController) HasSynced() bool {
+	for _, synced := range c.syncs {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *TriggerController) addImageStreamNotification(obj interface{}) {
 	is := obj.(*imagev1.ImageStream)
 	c.enqueueImageStreamFn(is)
@@ -388,5 +413,26 @@ func (c *TriggerController) syncResource(key string) error {
 		return nil
 	}
 
-	return source.Reactor.ImageChanged(obj.(runtime.Object), c.tagRetriever)
+	err = source.Reactor.ImageChanged(obj.(runtime.Object), c.tagRetriever)
+	if kerrors.IsInvalid(err) {
+		// The object rejects the triggered images, for example the immutable pod template of
+		// a Job. Retrying cannot succeed until the object or the image stream tags change,
+		// which queue it again.
+		klog.V(2).Infof("Unable to apply the triggered images to %s: %v", key, err)
+		if ref, refErr := objectReference(obj.(runtime.Object)); refErr == nil {
+			c.eventRecorder.Eventf(ref, v1.EventTypeWarning, "FailedImageTrigger", "Unable to apply the triggered images: %v", err)
+		}
+		return nil
+	}
+	return err
+}
+
+// objectReference returns a reference to an object of a trigger source for the events about
+// it. Objects of typed informers carry no kind, which is looked up in the schemes of the
+// OpenShift and Kubernetes types.
+func objectReference(obj runtime.Object) (*v1.ObjectReference, error) {
+	if ref, err := reference.GetReference(legacyscheme.Scheme, obj); err == nil {
+		return ref, nil
+	}
+	return reference.GetReference(kscheme.Scheme, obj)
 }
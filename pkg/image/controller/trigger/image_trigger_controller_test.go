@@ -7,12 +7,14 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	buildapply "github.com/openshift/client-go/build/applyconfigurations/build/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	kapierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -21,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
@@ -260,6 +263,40 @@ func TestTriggerControllerSyncImageStream(t *testing.T) {
 	}
 }
 
+func TestTriggerControllerReferencedTags(t *testing.T) {
+	controller := TriggerController{triggerCache: NewTriggerCache()}
+	controller.triggerCache.Add("buildconfigs/test/build1", &trigger.CacheEntry{
+		Key:       "buildconfigs/test/build1",
+		Namespace: "test",
+		Triggers: []triggerutil.ObjectFieldTrigger{
+			{From: triggerutil.ObjectReference{Kind: "ImageStreamTag", Name: "stream:1"}},
+			{From: triggerutil.ObjectReference{Kind: "ImageStreamTag", Name: "stream:paused"}, Paused: true},
+			{From: triggerutil.ObjectReference{Kind: "ImageStreamTag", Name: "other:2"}},
+			{From: triggerutil.ObjectReference{Kind: "ImageStreamTag", Name: "stream:3", Namespace: "shared"}},
+			{From: triggerutil.ObjectReference{Kind: "DockerImage", Name: "test/stream:4"}},
+		},
+	})
+	controller.triggerCache.Add("deployments/shared/app", &trigger.CacheEntry{
+		Key:       "deployments/shared/app",
+		Namespace: "shared",
+		Triggers: []triggerutil.ObjectFieldTrigger{
+			{From: triggerutil.ObjectReference{Kind: "ImageStreamTag", Name: "stream:5"}},
+			{From: triggerutil.ObjectReference{Kind: "ImageStreamTag", Name: "stream:6", Namespace: "test"}},
+		},
+	})
+	for key, expected := range map[string][]string{
+		"test/stream":   {"1", "6"},
+		"shared/stream": {"3", "5"},
+		"test/other":    {"2"},
+		"test/missing":  {},
+	} {
+		namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+		if actual := controller.ReferencedTags(namespace, name).List(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected referenced tags %v, got %v", key, expected, actual)
+		}
+	}
+}
+
 func TestTriggerControllerSyncBuildConfigResource(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -470,6 +507,69 @@ func TestTriggerControllerSyncBuildConfigResourceErrorHandling(t *testing.T) {
 	}
 }
 
+// immutableJobUpdater rejects updates of the pod template of Jobs, like the API server.
+type immutableJobUpdater struct {
+	updates int
+}
+
+func (u *immutableJobUpdater) Update(obj runtime.Object) error {
+	u.updates++
+	job := obj.(*batchv1.Job)
+	return kapierrs.NewInvalid(schema.GroupKind{Group: "batch", Kind: "Job"}, job.Name, field.ErrorList{
+		field.Invalid(field.NewPath("spec", "template"), job.Spec.Template, "field is immutable"),
+	})
+}
+
+func TestTriggerControllerSyncImmutableJob(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "job",
+			Namespace: "test",
+			Annotations: map[string]string{
+				triggerutil.TriggerAnnotationKey: `[{"from":{"kind":"ImageStreamTag","name":"stream:2"},"fieldPath":"spec.template.spec.containers[?(@.name==\"app\")].image"}]`,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "image/result:1"}}},
+			},
+		},
+	}
+	updater := &immutableJobUpdater{}
+	recorder := record.NewFakeRecorder(1)
+	controller := TriggerController{
+		eventRecorder: recorder,
+		triggerCache:  NewTriggerCache(),
+		triggerSources: map[string]TriggerSource{
+			"jobs.batch": {
+				Store: &cache.FakeCustomStore{
+					GetByKeyFunc: func(key string) (interface{}, bool, error) {
+						return job, true, nil
+					},
+				},
+				Reactor: &triggerutil.AnnotationReactor{Updater: updater},
+			},
+		},
+		tagRetriever: fakeTagRetriever{{Namespace: "test", Name: "stream:2", Ref: "image/result:2"}},
+	}
+
+	// The rejected update is not retried, and reported as an event on the Job.
+	if err := controller.syncResource("jobs.batch/test/job"); err != nil {
+		t.Fatalf("expected the rejected update not to be retried, got %v", err)
+	}
+	if updater.updates != 1 {
+		t.Errorf("expected the Job to be updated once, got %d updates", updater.updates)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "FailedImageTrigger") || !strings.Contains(event, "field is immutable") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Errorf("expected an event about the rejected update")
+	}
+}
+
 func TestBuildConfigTriggerIndexer(t *testing.T) {
 	stopCh := make(chan struct{})
 	defer close(stopCh)
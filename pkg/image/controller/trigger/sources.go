@@ -0,0 +1,135 @@
+package trigger
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	// BuiltInAnnotationSources are the compiled in resources whose objects can be
+	// triggered by annotation, with typed informers and clients.
+	BuiltInAnnotationSources = []schema.GroupResource{
+		{Group: "apps", Resource: "deployments"},
+		{Group: "apps", Resource: "daemonsets"},
+		{Group: "apps", Resource: "statefulsets"},
+		{Group: "apps", Resource: "replicasets"},
+		{Group: "batch", Resource: "cronjobs"},
+		{Group: "batch", Resource: "jobs"},
+		{Group: "", Resource: "pods"},
+	}
+
+	// DefaultAnnotationSources are the resources triggered by annotation when no sources
+	// are configured.
+	DefaultAnnotationSources = []AnnotationSource{
+		{Group: "apps", Resource: "deployments"},
+		{Group: "apps", Resource: "daemonsets"},
+		{Group: "apps", Resource: "statefulsets"},
+		{Group: "batch", Resource: "cronjobs"},
+	}
+
+	// reactorSources are the resources with their own trigger reactors, which cannot be
+	// triggered by annotation.
+	reactorSources = []schema.GroupResource{
+		{Group: "apps.openshift.io", Resource: "deploymentconfigs"},
+		{Group: "build.openshift.io", Resource: "buildconfigs"},
+	}
+)
+
+// Config controls the image trigger controller.
+type Config struct {
+	// AnnotationSources are the resources whose objects are updated when the image stream
+	// tags their image.openshift.io/triggers annotation references change. Defaults to
+	// Deployments, DaemonSets, StatefulSets and CronJobs. Updates rejected as invalid, such
+	// as those of the immutable pod template of Jobs, are reported as FailedImageTrigger
+	// events on the object and not retried.
+	AnnotationSources []AnnotationSource `json:"annotationSources,omitempty"`
+}
+
+// AnnotationSource is a resource triggered by annotation. Objects controlled by another
+// object, such as the ReplicaSets of Deployments which inherit their annotations, are
+// skipped.
+type AnnotationSource struct {
+	// Group is the API group of the resource, empty for the core group.
+	Group string `json:"group"`
+	// Version is the API version of a custom resource. Ignored for built in resources.
+	Version string `json:"version,omitempty"`
+	// Resource is the plural resource name, such as "rollouts".
+	Resource string `json:"resource"`
+	// PodSpecPath is the dot separated path to the pod spec within objects of a custom
+	// resource, such as "spec.template.spec". Required for resources that are not built in,
+	// which are watched and updated with the dynamic client. Such resources are skipped if
+	// they are not served when the controller starts.
+	PodSpecPath string `json:"podSpecPath,omitempty"`
+}
+
+// GroupResource returns the group resource of the source.
+func (s AnnotationSource) GroupResource() schema.GroupResource {
+	return schema.GroupResource{Group: s.Group, Resource: s.Resource}
+}
+
+// GroupVersionResource returns the group version resource of the source.
+func (s AnnotationSource) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: s.Group, Version: s.Version, Resource: s.Resource}
+}
+
+// PodSpecFields returns the fields of the path to the pod spec.
+func (s AnnotationSource) PodSpecFields() []string {
+	return strings.Split(s.PodSpecPath, ".")
+}
+
+// IsBuiltIn returns true if the source is a compiled in resource.
+func (s AnnotationSource) IsBuiltIn() bool {
+	return containsGroupResource(BuiltInAnnotationSources, s.GroupResource())
+}
+
+// Sources returns the configured annotation sources, or the defaults.
+func (c Config) Sources() []AnnotationSource {
+	if len(c.AnnotationSources) == 0 {
+		return DefaultAnnotationSources
+	}
+	return c.AnnotationSources
+}
+
+// ValidateConfig returns an error if the image trigger configuration is invalid.
+func ValidateConfig(config Config) error {
+	seen := map[schema.GroupResource]bool{}
+	for i, source := range config.AnnotationSources {
+		resource := source.GroupResource()
+		if len(source.Resource) == 0 {
+			return fmt.Errorf("the image trigger annotationSources[%d] must have a resource", i)
+		}
+		if seen[resource] {
+			return fmt.Errorf("the image trigger annotationSources[%d] %s is listed more than once", i, resource)
+		}
+		seen[resource] = true
+		if containsGroupResource(reactorSources, resource) {
+			return fmt.Errorf("the image trigger annotationSources[%d] %s is triggered by its own reactor", i, resource)
+		}
+		if source.IsBuiltIn() {
+			if len(source.PodSpecPath) > 0 {
+				return fmt.Errorf("the image trigger annotationSources[%d] %s is built in and must not have a podSpecPath", i, resource)
+			}
+			continue
+		}
+		if len(source.Version) == 0 || len(source.PodSpecPath) == 0 {
+			return fmt.Errorf("the image trigger annotationSources[%d] %s is not built in and must have a version and a podSpecPath", i, resource)
+		}
+		for _, field := range source.PodSpecFields() {
+			if len(field) == 0 {
+				return fmt.Errorf("the image trigger annotationSources[%d] podSpecPath %q is not a dot separated path", i, source.PodSpecPath)
+			}
+		}
+	}
+	return nil
+}
+
+func containsGroupResource(resources []schema.GroupResource, resource schema.GroupResource) bool {
+	for _, r := range resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
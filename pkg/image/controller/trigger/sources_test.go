@@ -0,0 +1,66 @@
+package trigger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sources []AnnotationSource
+		err     string
+	}{
+		{name: "defaults"},
+		{
+			name: "built in and custom resources",
+			sources: []AnnotationSource{
+				{Group: "apps", Resource: "replicasets"},
+				{Group: "batch", Resource: "jobs"},
+				{Resource: "pods"},
+				{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts", PodSpecPath: "spec.template.spec"},
+			},
+		},
+		{name: "no resource", sources: []AnnotationSource{{Group: "apps"}}, err: "must have a resource"},
+		{
+			name:    "duplicate",
+			sources: []AnnotationSource{{Group: "apps", Resource: "deployments"}, {Group: "apps", Resource: "deployments"}},
+			err:     "more than once",
+		},
+		{
+			name:    "deployment configs",
+			sources: []AnnotationSource{{Group: "apps.openshift.io", Version: "v1", Resource: "deploymentconfigs", PodSpecPath: "spec.template.spec"}},
+			err:     "its own reactor",
+		},
+		{
+			name:    "built in with pod spec path",
+			sources: []AnnotationSource{{Group: "apps", Resource: "deployments", PodSpecPath: "spec.template.spec"}},
+			err:     "must not have a podSpecPath",
+		},
+		{
+			name:    "custom resource without pod spec path",
+			sources: []AnnotationSource{{Group: "serving.knative.dev", Version: "v1", Resource: "services"}},
+			err:     "must have a version and a podSpecPath",
+		},
+		{
+			name:    "invalid pod spec path",
+			sources: []AnnotationSource{{Group: "serving.knative.dev", Version: "v1", Resource: "services", PodSpecPath: "spec..spec"}},
+			err:     "not a dot separated path",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateConfig(Config{AnnotationSources: tc.sources})
+			if len(tc.err) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tc.err) > 0 && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+
+	if sources := (Config{}).Sources(); len(sources) != len(DefaultAnnotationSources) {
+		t.Errorf("expected the default sources, got %v", sources)
+	}
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Notification formats, named by the last segment of the receiver path.
+const (
+	// FormatDistribution is the notification envelope of the Docker Distribution registry.
+	FormatDistribution = "distribution"
+	// FormatQuay is the repository push notification of Quay.
+	FormatQuay = "quay"
+	// FormatHarbor is the PUSH_ARTIFACT webhook of Harbor.
+	FormatHarbor = "harbor"
+)
+
+// parsers return the pull specs of the repository:tags pushed according to a notification.
+var parsers = map[string]func(body []byte) ([]string, error){
+	FormatDistribution: parseDistribution,
+	FormatQuay:         parseQuay,
+	FormatHarbor:       parseHarbor,
+}
+
+func formats() []string {
+	var names []string
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type distributionEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+			URL        string `json:"url"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// parseDistribution returns the tagged manifests pushed according to a Docker Distribution
+// notification envelope. Pushes of blobs and of untagged manifests are ignored.
+func parseDistribution(body []byte) ([]string, error) {
+	envelope := &distributionEnvelope{}
+	if err := json.Unmarshal(body, envelope); err != nil {
+		return nil, err
+	}
+	var pullSpecs []string
+	for _, event := range envelope.Events {
+		if event.Action != "push" || len(event.Target.Tag) == 0 || len(event.Target.Repository) == 0 {
+			continue
+		}
+		host := event.Request.Host
+		if len(host) == 0 {
+			if u, err := url.Parse(event.Target.URL); err == nil {
+				host = u.Host
+			}
+		}
+		if len(host) == 0 {
+			return nil, fmt.Errorf("the push of %s:%s has no registry host", event.Target.Repository, event.Target.Tag)
+		}
+		pullSpecs = append(pullSpecs, host+"/"+event.Target.Repository+":"+event.Target.Tag)
+	}
+	return pullSpecs, nil
+}
+
+type quayNotification struct {
+	DockerURL   string   `json:"docker_url"`
+	UpdatedTags []string `json:"updated_tags"`
+}
+
+// parseQuay returns the tags updated according to a Quay repository push notification.
+func parseQuay(body []byte) ([]string, error) {
+	notification := &quayNotification{}
+	if err := json.Unmarshal(body, notification); err != nil {
+		return nil, err
+	}
+	if len(notification.DockerURL) == 0 {
+		return nil, fmt.Errorf("the notification has no docker_url")
+	}
+	var pullSpecs []string
+	for _, tag := range notification.UpdatedTags {
+		pullSpecs = append(pullSpecs, notification.DockerURL+":"+tag)
+	}
+	return pullSpecs, nil
+}
+
+type harborNotification struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+}
+
+// parseHarbor returns the tagged artifacts pushed according to a Harbor webhook. Events
+// other than artifact pushes are ignored.
+func parseHarbor(body []byte) ([]string, error) {
+	notification := &harborNotification{}
+	if err := json.Unmarshal(body, notification); err != nil {
+		return nil, err
+	}
+	if notification.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+	var pullSpecs []string
+	for _, resource := range notification.EventData.Resources {
+		if len(resource.Tag) == 0 || len(resource.ResourceURL) == 0 {
+			continue
+		}
+		pullSpecs = append(pullSpecs, resource.ResourceURL)
+	}
+	return pullSpecs, nil
+}
@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// PushPath is the path prefix of the receiver, followed by the format of the notification.
+	PushPath = "/imagestreams/push/"
+
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the request body, prefixed with
+	// "sha256=".
+	SignatureHeader = "X-Hub-Signature-256"
+
+	signaturePrefix = "sha256="
+	maxBodyBytes    = 1 << 20
+)
+
+// Config controls the receiver of registry push notifications, which imports the image
+// stream tags tracking a pushed image right away. The receiver runs with the image import
+// controller, and thus only listens on the instance of the controller manager holding the
+// leader lease; registries must reach it through a service selecting that instance.
+type Config struct {
+	// BindAddress is the address the receiver listens on, e.g. ":8445". The receiver is
+	// not started if it is empty.
+	BindAddress string `json:"bindAddress"`
+	// CertFile and KeyFile are the serving certificate and key of the receiver. The
+	// receiver serves plain HTTP if they are empty, which is only allowed when
+	// notifications are authenticated by their signature.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// TokenFile holds the token shared with the registries. Notifications have to carry
+	// it as a bearer token or verbatim in the Authorization header. Since the token is
+	// sent in the clear, it requires the receiver to serve TLS.
+	TokenFile string `json:"tokenFile"`
+	// HMACSecretFile holds the secret of the HMAC-SHA256 signature of notifications, sent
+	// hex encoded as "sha256=<signature>" in the X-Hub-Signature-256 header.
+	HMACSecretFile string `json:"hmacSecretFile"`
+}
+
+// ValidateConfig returns an error if the receiver configuration is invalid.
+func ValidateConfig(config Config) error {
+	if len(config.BindAddress) == 0 {
+		return nil
+	}
+	if len(config.TokenFile) == 0 && len(config.HMACSecretFile) == 0 {
+		return fmt.Errorf("the push webhook requires a tokenFile or a hmacSecretFile")
+	}
+	if (len(config.CertFile) == 0) != (len(config.KeyFile) == 0) {
+		return fmt.Errorf("the push webhook requires both a certFile and a keyFile to serve TLS")
+	}
+	if len(config.TokenFile) > 0 && len(config.CertFile) == 0 {
+		return fmt.Errorf("the push webhook requires a certFile and a keyFile to serve TLS when a tokenFile is set")
+	}
+	return nil
+}
+
+// PushHandler imports the image stream tags tracking a pushed image.
+type PushHandler interface {
+	// Pushed is invoked with the pull spec of each pushed repository:tag. It returns the
+	// number of image streams queued for import.
+	Pushed(pullSpec string) (int, error)
+}
+
+// Receiver accepts registry push notifications over HTTP.
+type Receiver struct {
+	config  Config
+	handler PushHandler
+	token   []byte
+	secret  []byte
+}
+
+// NewReceiver returns a receiver passing the images pushed to the handler.
+func NewReceiver(config Config, handler PushHandler) (*Receiver, error) {
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
+	}
+	r := &Receiver{config: config, handler: handler}
+	var err error
+	if len(config.TokenFile) > 0 {
+		if r.token, err = readSecret(config.TokenFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.HMACSecretFile) > 0 {
+		if r.secret, err = readSecret(config.HMACSecretFile); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func readSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the push webhook secret: %v", err)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("the push webhook secret %s is empty", path)
+	}
+	return data, nil
+}
+
+// Run serves notifications until stopCh is closed.
+func (r *Receiver) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+
+	mux := http.NewServeMux()
+	mux.Handle(PushPath, r)
+	server := &http.Server{
+		Addr:              r.config.BindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	klog.Infof("Starting image push webhook receiver on %s", r.config.BindAddress)
+	var err error
+	if len(r.config.CertFile) > 0 {
+		err = server.ListenAndServeTLS(r.config.CertFile, r.config.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		utilruntime.HandleError(fmt.Errorf("image push webhook receiver failed: %v", err))
+	}
+	klog.Infof("Shutting down image push webhook receiver")
+}
+
+// ServeHTTP handles a push notification in the format named by the last path segment.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	parse, ok := parsers[strings.TrimPrefix(req.URL.Path, PushPath)]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown notification format, expected one of %s", strings.Join(formats(), ", ")), http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "unable to read the notification", http.StatusBadRequest)
+		return
+	}
+	if !r.authenticated(req, body) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pullSpecs, err := parse(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid notification: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	queued := 0
+	for _, pullSpec := range pullSpecs {
+		n, err := r.handler.Pushed(pullSpec)
+		if err != nil {
+			klog.V(2).Infof("Ignoring push of %s: %v", pullSpec, err)
+			continue
+		}
+		queued += n
+	}
+	klog.V(4).Infof("Push notification of %v queued %d image streams", pullSpecs, queued)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "queued %d image streams\n", queued)
+}
+
+// authenticated returns true if the Authorization header of the request carries the shared
+// token, or the request carries a valid signature of its body. The token is not accepted in
+// the URL, which ends up in access logs.
+func (r *Receiver) authenticated(req *http.Request, body []byte) bool {
+	if len(r.token) > 0 {
+		candidate := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if len(candidate) > 0 && subtle.ConstantTimeCompare([]byte(candidate), r.token) == 1 {
+			return true
+		}
+	}
+	if len(r.secret) > 0 {
+		signature := req.Header.Get(SignatureHeader)
+		if !strings.HasPrefix(signature, signaturePrefix) {
+			return false
+		}
+		actual, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, r.secret)
+		mac.Write(body)
+		return hmac.Equal(actual, mac.Sum(nil))
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakePushHandler struct {
+	pushed []string
+}
+
+func (h *fakePushHandler) Pushed(pullSpec string) (int, error) {
+	h.pushed = append(h.pushed, pullSpec)
+	return 1, nil
+}
+
+const (
+	testDistributionNotification = `{"events": [
+		{"action": "push", "target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "repository": "org/app", "tag": "latest", "url": "https://registry.example.com/v2/org/app/manifests/sha256:abc"}, "request": {"host": "registry.example.com:5000"}},
+		{"action": "push", "target": {"mediaType": "application/octet-stream", "repository": "org/app", "url": "https://registry.example.com/v2/org/app/blobs/sha256:def"}, "request": {"host": "registry.example.com:5000"}},
+		{"action": "pull", "target": {"repository": "org/app", "tag": "v1"}, "request": {"host": "registry.example.com:5000"}},
+		{"action": "push", "target": {"repository": "org/app", "tag": "v2", "url": "https://mirror.example.com/v2/org/app/manifests/v2"}, "request": {}}
+	]}`
+	testQuayNotification   = `{"repository": "org/app", "namespace": "org", "name": "app", "docker_url": "quay.io/org/app", "homepage": "https://quay.io/repository/org/app", "updated_tags": ["latest", "v1"]}`
+	testHarborNotification = `{"type": "PUSH_ARTIFACT", "occur_at": 1586922308, "operator": "admin", "event_data": {"resources": [
+		{"digest": "sha256:abc", "tag": "latest", "resource_url": "harbor.example.com/library/app:latest"},
+		{"digest": "sha256:def", "resource_url": "harbor.example.com/library/app@sha256:def"}
+	], "repository": {"name": "app", "namespace": "library", "repo_full_name": "library/app"}}}`
+)
+
+func TestParsers(t *testing.T) {
+	tests := map[string]struct {
+		body     string
+		expected []string
+	}{
+		FormatDistribution: {
+			body:     testDistributionNotification,
+			expected: []string{"registry.example.com:5000/org/app:latest", "mirror.example.com/org/app:v2"},
+		},
+		FormatQuay: {
+			body:     testQuayNotification,
+			expected: []string{"quay.io/org/app:latest", "quay.io/org/app:v1"},
+		},
+		FormatHarbor: {
+			body:     testHarborNotification,
+			expected: []string{"harbor.example.com/library/app:latest"},
+		},
+	}
+	for format, test := range tests {
+		actual, err := parsers[format]([]byte(test.body))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", format, test.expected, actual)
+		}
+	}
+
+	if pullSpecs, err := parseHarbor([]byte(`{"type": "DELETE_ARTIFACT", "event_data": {"resources": [{"tag": "latest", "resource_url": "harbor.example.com/library/app:latest"}]}}`)); err != nil || len(pullSpecs) != 0 {
+		t.Errorf("expected other harbor events to be ignored, got %v: %v", pullSpecs, err)
+	}
+	if _, err := parseQuay([]byte(`{"updated_tags": ["latest"]}`)); err == nil {
+		t.Errorf("expected a quay notification without docker_url to be rejected")
+	}
+	for format, parse := range parsers {
+		if _, err := parse([]byte(`not json`)); err == nil {
+			t.Errorf("%s: expected invalid JSON to be rejected", format)
+		}
+	}
+}
+
+func writeSecret(t *testing.T, dir, name, value string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(value+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReceiver(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{
+		BindAddress:    ":0",
+		CertFile:       "tls.crt",
+		KeyFile:        "tls.key",
+		TokenFile:      writeSecret(t, dir, "token", "shared-token"),
+		HMACSecretFile: writeSecret(t, dir, "secret", "hmac-secret"),
+	}
+	sign := func(body, secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := map[string]struct {
+		method   string
+		path     string
+		body     string
+		headers  map[string]string
+		expected int
+		pushed   []string
+	}{
+		"bearer token": {
+			path:     PushPath + FormatQuay,
+			body:     testQuayNotification,
+			headers:  map[string]string{"Authorization": "Bearer shared-token"},
+			expected: http.StatusAccepted,
+			pushed:   []string{"quay.io/org/app:latest", "quay.io/org/app:v1"},
+		},
+		"verbatim token": {
+			path:     PushPath + FormatHarbor,
+			body:     testHarborNotification,
+			headers:  map[string]string{"Authorization": "shared-token"},
+			expected: http.StatusAccepted,
+			pushed:   []string{"harbor.example.com/library/app:latest"},
+		},
+		"query token": {
+			path:     PushPath + FormatQuay + "?token=shared-token",
+			body:     testQuayNotification,
+			expected: http.StatusUnauthorized,
+		},
+		"signature": {
+			path:     PushPath + FormatDistribution,
+			body:     testDistributionNotification,
+			headers:  map[string]string{SignatureHeader: sign(testDistributionNotification, "hmac-secret")},
+			expected: http.StatusAccepted,
+			pushed:   []string{"registry.example.com:5000/org/app:latest", "mirror.example.com/org/app:v2"},
+		},
+		"wrong token": {
+			path:     PushPath + FormatQuay,
+			body:     testQuayNotification,
+			headers:  map[string]string{"Authorization": "Bearer other-token"},
+			expected: http.StatusUnauthorized,
+		},
+		"wrong signature": {
+			path:     PushPath + FormatQuay,
+			body:     testQuayNotification,
+			headers:  map[string]string{SignatureHeader: sign(testQuayNotification, "other-secret")},
+			expected: http.StatusUnauthorized,
+		},
+		"signature of another body": {
+			path:     PushPath + FormatQuay,
+			body:     testQuayNotification,
+			headers:  map[string]string{SignatureHeader: sign(testHarborNotification, "hmac-secret")},
+			expected: http.StatusUnauthorized,
+		},
+		"no credentials": {
+			path:     PushPath + FormatQuay,
+			body:     testQuayNotification,
+			expected: http.StatusUnauthorized,
+		},
+		"unknown format": {
+			path:     PushPath + "gitlab",
+			body:     testQuayNotification,
+			headers:  map[string]string{"Authorization": "Bearer shared-token"},
+			expected: http.StatusNotFound,
+		},
+		"invalid notification": {
+			path:     PushPath + FormatQuay,
+			body:     `{}`,
+			headers:  map[string]string{"Authorization": "Bearer shared-token"},
+			expected: http.StatusBadRequest,
+		},
+		"get": {
+			method:   http.MethodGet,
+			path:     PushPath + FormatQuay,
+			headers:  map[string]string{"Authorization": "Bearer shared-token"},
+			expected: http.StatusMethodNotAllowed,
+		},
+	}
+	for name, test := range tests {
+		handler := &fakePushHandler{}
+		receiver, err := NewReceiver(config, handler)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		method := test.method
+		if len(method) == 0 {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, test.path, strings.NewReader(test.body))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		receiver.ServeHTTP(rw, req)
+		if rw.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d: %s", name, test.expected, rw.Code, rw.Body.String())
+		}
+		if !reflect.DeepEqual(handler.pushed, test.pushed) {
+			t.Errorf("%s: expected pushes %v, got %v", name, test.pushed, handler.pushed)
+		}
+	}
+}
+
+func TestNewReceiver(t *testing.T) {
+	dir := t.TempDir()
+	token := writeSecret(t, dir, "token", "shared-token")
+	empty := writeSecret(t, dir, "empty", "")
+	for name, config := range map[string]Config{
+		"no authentication": {BindAddress: ":0"},
+		"certificate only":  {BindAddress: ":0", TokenFile: token, CertFile: "tls.crt"},
+		"token without TLS": {BindAddress: ":0", TokenFile: token},
+		"missing token":     {BindAddress: ":0", TokenFile: filepath.Join(dir, "missing"), CertFile: "tls.crt", KeyFile: "tls.key"},
+		"empty token":       {BindAddress: ":0", TokenFile: empty, CertFile: "tls.crt", KeyFile: "tls.key"},
+	} {
+		if _, err := NewReceiver(config, &fakePushHandler{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := ValidateConfig(Config{}); err != nil {
+		t.Errorf("expected a disabled receiver to be valid, got %v", err)
+	}
+	if err := ValidateConfig(Config{BindAddress: ":0", HMACSecretFile: token}); err != nil {
+		t.Errorf("expected a receiver authenticating signatures over plain HTTP to be valid, got %v", err)
+	}
+}
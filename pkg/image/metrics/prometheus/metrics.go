@@ -16,6 +16,7 @@ const (
 	metricCount        = "count"
 	metricSuccessCount = metricController + separator + "success" + separator + metricCount
 	metricErrorCount   = metricController + separator + "error" + separator + metricCount
+	metricBreakerOpen  = metricController + separator + "registry" + separator + "circuit" + separator + "open"
 
 	labelScheduled = "scheduled"
 	labelRegistry  = "registry"
@@ -35,6 +36,14 @@ type ImportSuccessCounts map[string]uint64
 // ImportErrorCounts serves as a container of counters for the error_count metric.
 type ImportErrorCounts map[ImportErrorInfo]uint64
 
+// RegistryBreakerStates maps registry hostname (with port) to whether the circuit breaker of scheduled
+// imports from the registry is open.
+type RegistryBreakerStates map[string]bool
+
+// RegistryBreakerFetcher is a callback passed to the importStatusCollector that is supposed to be invoked
+// by the scheduled image import controller with the current state of the circuit breakers.
+type RegistryBreakerFetcher func() RegistryBreakerStates
+
 // QueuedImageStreamFetcher is a callback passed to the importStatusCollector that is supposed to be invoked
 // by image import controller with the current state of counters.
 type QueuedImageStreamFetcher func() (ImportSuccessCounts, ImportErrorCounts, error)
@@ -53,6 +62,13 @@ var (
 		[]string{labelScheduled, labelRegistry, labelReason},
 		nil,
 	)
+	breakerOpenDesc = prometheus.NewDesc(
+		metricBreakerOpen,
+		"Indicates whether the circuit breaker of scheduled image stream imports from an image registry is"+
+			" open (1) and imports from the registry are skipped, or closed (0)",
+		[]string{labelRegistry},
+		nil,
+	)
 
 	isc          = importStatusCollector{}
 	registerLock = sync.Mutex{}
@@ -61,6 +77,8 @@ var (
 type importStatusCollector struct {
 	cbCollectISCounts        QueuedImageStreamFetcher
 	cbCollectScheduledCounts QueuedImageStreamFetcher
+	cbCollectBreakerStates   RegistryBreakerFetcher
+	cbCollectSchedule        ScheduledImportFetcher
 	isCreated                bool
 	createOnce               sync.Once
 	createLock               sync.RWMutex
@@ -88,6 +106,15 @@ func InitializeImportCollector(
 	}
 }
 
+// InitializeRegistryBreakerCollector is supposed to be called by the scheduled image import controller
+// together with InitializeImportCollector, to report the state of its circuit breakers.
+func InitializeRegistryBreakerCollector(cbCollectBreakerStates RegistryBreakerFetcher) {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+
+	isc.cbCollectBreakerStates = cbCollectBreakerStates
+}
+
 // Create satisfies the k8s metrics.Registerable interface. It is called when the metric is
 // registered with Prometheus via k8s metrics.
 func (isc *importStatusCollector) Create(v *semver.Version) bool {
@@ -107,9 +134,13 @@ func (isc *importStatusCollector) IsCreated() bool {
 func (isc *importStatusCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- successCountDesc
 	ch <- errorCountDesc
+	ch <- breakerOpenDesc
+	describeSchedule(ch)
 }
 
 func (isc *importStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	collectSchedule(isc.cbCollectSchedule, ch)
+
 	successCounts, errorCounts, err := isc.cbCollectISCounts()
 	if err != nil {
 		klog.Errorf("Failed to collect image import metrics: %v", err)
@@ -128,6 +159,10 @@ func (isc *importStatusCollector) Collect(ch chan<- prometheus.Metric) {
 
 	pushSuccessCounts("true", successCounts, ch)
 	pushErrorCounts("true", errorCounts, ch)
+
+	if isc.cbCollectBreakerStates != nil {
+		pushBreakerStates(isc.cbCollectBreakerStates(), ch)
+	}
 }
 
 func (isc *importStatusCollector) ClearState() {
@@ -162,3 +197,17 @@ func pushErrorCounts(scheduled string, counts ImportErrorCounts, ch chan<- prome
 			info.Reason)
 	}
 }
+
+func pushBreakerStates(states RegistryBreakerStates, ch chan<- prometheus.Metric) {
+	for registry, open := range states {
+		value := 0.0
+		if open {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			breakerOpenDesc,
+			prometheus.GaugeValue,
+			value,
+			registry)
+	}
+}
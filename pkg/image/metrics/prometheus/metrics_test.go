@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/component-base/metrics/legacyregistry"
@@ -38,6 +39,28 @@ func scheduledImportFetcher() (ImportSuccessCounts, ImportErrorCounts, error) {
 	return success, errors, nil
 }
 
+func breakerFetcher() RegistryBreakerStates {
+	return RegistryBreakerStates{
+		"registry.redhat.io": false,
+		"quay.io":            true,
+	}
+}
+
+func scheduleFetcher() []ScheduledImportState {
+	return []ScheduledImportState{
+		{Namespace: "ns", Name: "imported", LastAttempt: time.Unix(60, 0), Succeeded: true, Next: time.Unix(3660, 0)},
+		{Namespace: "ns", Name: "failed", LastAttempt: time.Unix(30, 0), Next: time.Unix(1830, 0)},
+		{Namespace: "ns", Name: "new", Next: time.Unix(120, 0)},
+	}
+}
+
+func unverifiedImageFetcher() (UnverifiedImageCounts, error) {
+	return UnverifiedImageCounts{
+		{Scope: "quay.io", Reason: "Unsigned"}:                  3,
+		{Scope: "registry.redhat.io/ubi9", Reason: "Untrusted"}: 1,
+	}, nil
+}
+
 type fakeResponseWriter struct {
 	bytes.Buffer
 	statusCode int
@@ -64,14 +87,45 @@ func TestMetrics(t *testing.T) {
 		"# TYPE openshift_imagestreamcontroller_error_count counter",
 		"openshift_imagestreamcontroller_error_count{reason=\"Missing\",registry=\"quay.io\",scheduled=\"true\"} 5",
 		"openshift_imagestreamcontroller_error_count{reason=\"Unauthorized\",registry=\"registry.redhat.io\",scheduled=\"false\"} 5",
+		"# TYPE openshift_imagestreamcontroller_registry_circuit_open gauge",
+		"openshift_imagestreamcontroller_registry_circuit_open{registry=\"quay.io\"} 1",
+		"openshift_imagestreamcontroller_registry_circuit_open{registry=\"registry.redhat.io\"} 0",
+		"# TYPE openshift_imagestreamcontroller_import_duration_seconds histogram",
+		"openshift_imagestreamcontroller_import_duration_seconds_count{registry=\"quay.io\",scheduled=\"true\"} 1",
+		"openshift_imagestreamcontroller_import_duration_seconds_bucket{registry=\"quay.io\",scheduled=\"true\",le=\"3.2\"} 1",
+		"# TYPE openshift_imagestreamcontroller_scheduled_import_lag_seconds histogram",
+		"openshift_imagestreamcontroller_scheduled_import_lag_seconds_count{registry=\"quay.io\"} 1",
+		"openshift_imagestreamcontroller_scheduled_import_lag_seconds_bucket{registry=\"quay.io\",le=\"64\"} 1",
+		"openshift_imagestreamcontroller_scheduled_import_lag_seconds_bucket{registry=\"quay.io\",le=\"32\"} 0",
+		"# TYPE openshift_imagestreamcontroller_scheduled_import_streams gauge",
+		"openshift_imagestreamcontroller_scheduled_import_streams{result=\"failed\"} 1",
+		"openshift_imagestreamcontroller_scheduled_import_streams{result=\"none\"} 1",
+		"openshift_imagestreamcontroller_scheduled_import_streams{result=\"succeeded\"} 1",
+		"# TYPE openshift_imagestreamcontroller_scheduled_import_oldest_attempt_timestamp_seconds gauge",
+		"openshift_imagestreamcontroller_scheduled_import_oldest_attempt_timestamp_seconds 30",
+		"# TYPE openshift_imagestreamcontroller_scheduled_import_earliest_next_attempt_timestamp_seconds gauge",
+		"openshift_imagestreamcontroller_scheduled_import_earliest_next_attempt_timestamp_seconds 120",
+		"# TYPE openshift_imagesignaturecontroller_unverified_images gauge",
+		"openshift_imagesignaturecontroller_unverified_images{reason=\"Unsigned\",scope=\"quay.io\"} 3",
+		"openshift_imagesignaturecontroller_unverified_images{reason=\"Untrusted\",scope=\"registry.redhat.io/ubi9\"} 1",
+	}
+	unexpected := []string{
+		// the schedule of individual streams is not reported
+		"name=\"imported\"",
 	}
 
 	is := importStatusCollector{
 		cbCollectISCounts:        importFetcher,
 		cbCollectScheduledCounts: scheduledImportFetcher,
+		cbCollectBreakerStates:   breakerFetcher,
+		cbCollectSchedule:        scheduleFetcher,
 	}
+	ObserveImportDuration(true, "quay.io", 3*time.Second)
+	ObserveScheduleLag("quay.io", 40*time.Second)
 
-	legacyregistry.MustRegister(&is)
+	signatures := signatureCollector{cbCollectUnverified: unverifiedImageFetcher}
+
+	legacyregistry.MustRegister(&is, &signatures)
 
 	h := promhttp.HandlerFor(legacyregistry.DefaultGatherer, promhttp.HandlerOpts{ErrorHandling: promhttp.PanicOnError})
 	rw := &fakeResponseWriter{header: http.Header{}}
@@ -85,4 +139,9 @@ func TestMetrics(t *testing.T) {
 			t.Errorf("expected string %s did not appear in %s", s, respStr)
 		}
 	}
+	for _, s := range unexpected {
+		if strings.Contains(respStr, s) {
+			t.Errorf("unexpected string %s appeared in %s", s, respStr)
+		}
+	}
 }
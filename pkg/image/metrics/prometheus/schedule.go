@@ -0,0 +1,155 @@
+package prometheus
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricImportDuration  = metricController + separator + "import" + separator + "duration" + separator + "seconds"
+	metricScheduledImport = metricController + separator + "scheduled" + separator + "import"
+	metricScheduleLag     = metricScheduledImport + separator + "lag" + separator + "seconds"
+	metricStreams         = metricScheduledImport + separator + "streams"
+	metricOldestAttempt   = metricScheduledImport + separator + "oldest" + separator + "attempt" + separator + "timestamp" + separator + "seconds"
+	metricEarliestNext    = metricScheduledImport + separator + "earliest" + separator + "next" + separator + "attempt" + separator + "timestamp" + separator + "seconds"
+
+	labelResult = "result"
+
+	// The results of the last scheduled import of the streams counted by metricStreams.
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+	resultNone      = "none"
+)
+
+var (
+	// importDurationBuckets range from a tenth of a second to about ten minutes.
+	importDurationBuckets = prometheus.ExponentialBuckets(0.1, 2, 13)
+	// scheduleLagBuckets range from a second to about four hours.
+	scheduleLagBuckets = prometheus.ExponentialBuckets(1, 2, 15)
+
+	importDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    metricImportDuration,
+			Help:    "Observes the seconds image stream import API calls took - both scheduled and not scheduled - per image registry",
+			Buckets: importDurationBuckets,
+		},
+		[]string{labelScheduled, labelRegistry},
+	)
+	scheduleLagHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    metricScheduleLag,
+			Help:    "Observes the seconds scheduled image stream imports ran later than they were due, per image registry",
+			Buckets: scheduleLagBuckets,
+		},
+		[]string{labelRegistry},
+	)
+
+	// The schedule of individual image streams is reported by their annotations; the metrics
+	// aggregate it, so that their cardinality does not grow with the number of streams.
+	streamsDesc = prometheus.NewDesc(
+		metricStreams,
+		"Counts scheduled image streams by the result of their last scheduled import: succeeded, failed, or none if there was none yet",
+		[]string{labelResult},
+		nil,
+	)
+	oldestAttemptDesc = prometheus.NewDesc(
+		metricOldestAttempt,
+		"The time of the least recent last scheduled import of all scheduled image streams",
+		nil,
+		nil,
+	)
+	earliestNextDesc = prometheus.NewDesc(
+		metricEarliestNext,
+		"The time the earliest next scheduled import of all scheduled image streams is due, which lies in the past while imports are overdue",
+		nil,
+		nil,
+	)
+)
+
+// ScheduledImportState is the schedule of the imports of an image stream.
+type ScheduledImportState struct {
+	Namespace string
+	Name      string
+	// LastAttempt is the time of the last scheduled import, zero if there was none yet.
+	LastAttempt time.Time
+	// Succeeded is true if all images of the last scheduled import were imported.
+	Succeeded bool
+	// Next is the time the next scheduled import is due.
+	Next time.Time
+}
+
+// ScheduledImportFetcher is a callback passed to the importStatusCollector that is supposed to be invoked
+// by the scheduled image import controller with the schedule of every image stream.
+type ScheduledImportFetcher func() []ScheduledImportState
+
+// InitializeScheduledImportCollector is supposed to be called by the scheduled image import controller
+// together with InitializeImportCollector, to report the schedule of the image streams.
+func InitializeScheduledImportCollector(cbCollectSchedule ScheduledImportFetcher) {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+
+	isc.cbCollectSchedule = cbCollectSchedule
+}
+
+// ObserveImportDuration observes the time an image stream import API call importing images from
+// the registry took.
+func ObserveImportDuration(scheduled bool, registry string, d time.Duration) {
+	importDurationHistogram.WithLabelValues(strconv.FormatBool(scheduled), registry).Observe(d.Seconds())
+}
+
+// ObserveScheduleLag observes how much later than it was due a scheduled import of images from the
+// registry ran.
+func ObserveScheduleLag(registry string, lag time.Duration) {
+	seconds := lag.Seconds()
+	if seconds < 0 {
+		seconds = 0
+	}
+	scheduleLagHistogram.WithLabelValues(registry).Observe(seconds)
+}
+
+func describeSchedule(ch chan<- *prometheus.Desc) {
+	importDurationHistogram.Describe(ch)
+	scheduleLagHistogram.Describe(ch)
+	ch <- streamsDesc
+	ch <- oldestAttemptDesc
+	ch <- earliestNextDesc
+}
+
+func collectSchedule(cbCollectSchedule ScheduledImportFetcher, ch chan<- prometheus.Metric) {
+	importDurationHistogram.Collect(ch)
+	scheduleLagHistogram.Collect(ch)
+	if cbCollectSchedule == nil {
+		return
+	}
+
+	streams := map[string]int{resultSucceeded: 0, resultFailed: 0, resultNone: 0}
+	var oldestAttempt, earliestNext time.Time
+	for _, state := range cbCollectSchedule() {
+		switch {
+		case state.LastAttempt.IsZero():
+			streams[resultNone]++
+		case state.Succeeded:
+			streams[resultSucceeded]++
+		default:
+			streams[resultFailed]++
+		}
+		if !state.LastAttempt.IsZero() && (oldestAttempt.IsZero() || state.LastAttempt.Before(oldestAttempt)) {
+			oldestAttempt = state.LastAttempt
+		}
+		if !state.Next.IsZero() && (earliestNext.IsZero() || state.Next.Before(earliestNext)) {
+			earliestNext = state.Next
+		}
+	}
+
+	for result, count := range streams {
+		ch <- prometheus.MustNewConstMetric(streamsDesc, prometheus.GaugeValue, float64(count), result)
+	}
+	if !oldestAttempt.IsZero() {
+		ch <- prometheus.MustNewConstMetric(oldestAttemptDesc, prometheus.GaugeValue, float64(oldestAttempt.Unix()))
+	}
+	if !earliestNext.IsZero() {
+		ch <- prometheus.MustNewConstMetric(earliestNextDesc, prometheus.GaugeValue, float64(earliestNext.Unix()))
+	}
+}
@@ -0,0 +1,115 @@
+package prometheus
+
+import (
+	"sync"
+
+	semver "github.com/blang/semver/v4"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	metricSignatureController = "openshift_imagesignaturecontroller"
+	metricUnverifiedImages    = metricSignatureController + separator + "unverified" + separator + "images"
+
+	labelScope = "scope"
+)
+
+// UnverifiedImageInfo contains dimensions of metricUnverifiedImages.
+type UnverifiedImageInfo struct {
+	// Scope is the scope of the trust policy applying to the images.
+	Scope string
+	// Reason is "Unsigned" for images without signatures, and "Untrusted" for images whose
+	// signatures are not trusted for them.
+	Reason string
+}
+
+// UnverifiedImageCounts serves as a container of gauges for the unverified_images metric.
+type UnverifiedImageCounts map[UnverifiedImageInfo]uint64
+
+// UnverifiedImageFetcher is a callback passed to the signatureCollector that is supposed to be
+// invoked by the image signature import controller with the current counts of images without a
+// valid signature.
+type UnverifiedImageFetcher func() (UnverifiedImageCounts, error)
+
+var (
+	unverifiedImagesDesc = prometheus.NewDesc(
+		metricUnverifiedImages,
+		"Counts images without a signature trusted by the trust policy of their scope, per scope and reason",
+		[]string{labelScope, labelReason},
+		nil,
+	)
+
+	sc = signatureCollector{}
+)
+
+type signatureCollector struct {
+	cbCollectUnverified UnverifiedImageFetcher
+	isCreated           bool
+	createOnce          sync.Once
+	createLock          sync.RWMutex
+}
+
+// InitializeSignatureCollector is supposed to be called by the image signature import controller
+// when it verifies signatures, to register the metrics of the images without a valid signature with
+// the prometheus.
+func InitializeSignatureCollector(cbCollectUnverified UnverifiedImageFetcher) {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+
+	sc.cbCollectUnverified = cbCollectUnverified
+
+	if !sc.IsCreated() {
+		legacyregistry.MustRegister(&sc)
+		klog.V(4).Info("Image signature controller metrics registered with prometherus")
+	}
+}
+
+// Create satisfies the k8s metrics.Registerable interface. It is called when the metric is
+// registered with Prometheus via k8s metrics.
+func (sc *signatureCollector) Create(v *semver.Version) bool {
+	sc.createOnce.Do(func() {
+		sc.createLock.Lock()
+		defer sc.createLock.Unlock()
+		sc.isCreated = true
+	})
+	return sc.IsCreated()
+}
+
+// IsCreated indicates if the metrics were created and registered with Prometheus.
+func (sc *signatureCollector) IsCreated() bool {
+	return sc.isCreated
+}
+
+func (sc *signatureCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- unverifiedImagesDesc
+}
+
+func (sc *signatureCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := sc.cbCollectUnverified()
+	if err != nil {
+		klog.Errorf("Failed to collect image signature metrics: %v", err)
+		ch <- prometheus.NewInvalidMetric(unverifiedImagesDesc, err)
+		return
+	}
+	for info, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			unverifiedImagesDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			info.Scope,
+			info.Reason)
+	}
+}
+
+func (sc *signatureCollector) ClearState() {
+	sc.createLock.Lock()
+	defer sc.createLock.Unlock()
+	sc.isCreated = false
+}
+
+func (sc *signatureCollector) FQName() string {
+	return metricSignatureController
+}
@@ -0,0 +1,55 @@
+package registryconf
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+	sysregistriesv2 "github.com/containers/image/v5/pkg/sysregistriesv2"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	rutil "github.com/openshift/runtime-utils/pkg/registries"
+)
+
+// TOML returns the contents of a registries.conf file applying the insecure and blocked
+// registries of the cluster image config, and the mirrors of the image content source
+// policies, image digest mirror sets and image tag mirror sets. It returns an empty string
+// when none are set, and the default registry settings apply.
+func TOML(config *configv1.Image, policies []*operatorv1alpha1.ImageContentSourcePolicy,
+	idmsRules []*configv1.ImageDigestMirrorSet, itmsRules []*configv1.ImageTagMirrorSet) (string, error) {
+
+	blockedRegs := []string{}
+	insecureRegs := []string{}
+	if config != nil {
+		insecureRegs = config.Spec.RegistrySources.InsecureRegistries
+		blockedRegs = config.Spec.RegistrySources.BlockedRegistries
+	}
+	if len(insecureRegs) == 0 && len(blockedRegs) == 0 && len(policies) == 0 && len(idmsRules) == 0 && len(itmsRules) == 0 {
+		klog.V(4).Info("using default registry settings")
+		return "", nil
+	}
+
+	configObj := sysregistriesv2.V2RegistriesConf{}
+	// line up with the search list in the default registries.conf in openshift/builder, see PR #266 there
+	configObj.UnqualifiedSearchRegistries = []string{"registry.redhat.io", "registry.access.redhat.com", "quay.io", "docker.io"}
+	err := rutil.EditRegistriesConfig(&configObj, insecureRegs, blockedRegs, policies, idmsRules, itmsRules)
+	if err != nil {
+		klog.V(0).Infof("MCO library had problem building registries config: %s", err.Error())
+		return "", err
+	}
+
+	var newData bytes.Buffer
+	encoder := toml.NewEncoder(&newData)
+	if err := encoder.Encode(configObj); err != nil {
+		return "", err
+	}
+
+	if len(newData.Bytes()) == 0 {
+		klog.V(4).Info("using default insecure registry settings")
+		return "", nil
+	}
+	klog.V(4).Info("overrode registry settings")
+	klog.V(5).Infof("generated registries.conf: \n%s", string(newData.Bytes()))
+	return string(newData.Bytes()), nil
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/cache"
 
@@ -14,12 +15,32 @@ import (
 // annotationTriggerIndexer uses annotations on objects to trigger changes.
 type annotationTriggerIndexer struct {
 	prefix string
+	// skipControlled ignores the triggers of objects controlled by another object
+	skipControlled bool
+	// imageChanged returns true if an image referenced by the triggers changed
+	imageChanged func(old, obj runtime.Object, triggers []triggerutil.ObjectFieldTrigger) bool
 }
 
 // NewAnnotationTriggerIndexer creates an indexer that deals with objects that have a pod spec and use
 // annotations to indicate the desire to trigger.
 func NewAnnotationTriggerIndexer(prefix string) trigger.Indexer {
-	return annotationTriggerIndexer{prefix: prefix}
+	return annotationTriggerIndexer{prefix: prefix, imageChanged: triggerutil.ContainerImageChanged}
+}
+
+// NewUncontrolledAnnotationTriggerIndexer creates an annotation trigger indexer that ignores objects
+// controlled by another object, whose pod spec is managed by their controller. The ReplicaSets of
+// Deployments, for instance, inherit the annotations of the Deployment.
+func NewUncontrolledAnnotationTriggerIndexer(prefix string) trigger.Indexer {
+	return annotationTriggerIndexer{prefix: prefix, skipControlled: true, imageChanged: triggerutil.ContainerImageChanged}
+}
+
+// calculateTriggers returns the key, namespace and triggers of the object.
+func (i annotationTriggerIndexer) calculateTriggers(m metav1.Object) (string, string, []triggerutil.ObjectFieldTrigger, error) {
+	key, namespace, triggers, err := triggerutil.CalculateAnnotationTriggers(m, i.prefix)
+	if i.skipControlled && metav1.GetControllerOfNoCopy(m) != nil {
+		return key, namespace, nil, err
+	}
+	return key, namespace, triggers, err
 }
 
 func (i annotationTriggerIndexer) Index(obj, old interface{}) (string, *trigger.CacheEntry, cache.DeltaType, error) {
@@ -36,7 +57,7 @@ func (i annotationTriggerIndexer) Index(obj, old interface{}) (string, *trigger.
 		if err != nil {
 			return "", nil, change, err
 		}
-		key, namespace, triggers, err = triggerutil.CalculateAnnotationTriggers(m, i.prefix)
+		key, namespace, triggers, err = i.calculateTriggers(m)
 		if err != nil {
 			return "", nil, change, err
 		}
@@ -54,7 +75,7 @@ func (i annotationTriggerIndexer) Index(obj, old interface{}) (string, *trigger.
 		if err != nil {
 			return "", nil, change, err
 		}
-		key, namespace, triggers, err = triggerutil.CalculateAnnotationTriggers(m, i.prefix)
+		key, namespace, triggers, err = i.calculateTriggers(m)
 		if err != nil {
 			return "", nil, change, err
 		}
@@ -65,7 +86,7 @@ func (i annotationTriggerIndexer) Index(obj, old interface{}) (string, *trigger.
 		if err != nil {
 			return "", nil, change, err
 		}
-		key, namespace, triggers, err = triggerutil.CalculateAnnotationTriggers(m, i.prefix)
+		key, namespace, triggers, err = i.calculateTriggers(m)
 		if err != nil {
 			return "", nil, change, err
 		}
@@ -73,7 +94,7 @@ func (i annotationTriggerIndexer) Index(obj, old interface{}) (string, *trigger.
 		if err != nil {
 			return "", nil, change, err
 		}
-		_, _, oldTriggers, err := triggerutil.CalculateAnnotationTriggers(oldM, i.prefix)
+		_, _, oldTriggers, err := i.calculateTriggers(oldM)
 		if err != nil {
 			return "", nil, change, err
 		}
@@ -82,7 +103,7 @@ func (i annotationTriggerIndexer) Index(obj, old interface{}) (string, *trigger.
 			change = cache.Added
 		case !reflect.DeepEqual(oldTriggers, triggers):
 			change = cache.Updated
-		case triggerutil.ContainerImageChanged(old.(runtime.Object), obj.(runtime.Object), triggers):
+		case i.imageChanged(old.(runtime.Object), obj.(runtime.Object), triggers):
 			change = cache.Updated
 		}
 	}
@@ -0,0 +1,240 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/library-go/pkg/image/referencemutator"
+	triggerutil "github.com/openshift/library-go/pkg/image/trigger"
+	"github.com/openshift/openshift-controller-manager/pkg/image/trigger"
+)
+
+// NewPodSpecPathAnnotationTriggerIndexer returns the TriggerFn of an annotation trigger indexer of
+// unstructured objects of resources that are not compiled in, with the pod spec at the path.
+// Objects controlled by another object are ignored.
+func NewPodSpecPathAnnotationTriggerIndexer(podSpecPath []string) func(prefix string) trigger.Indexer {
+	return func(prefix string) trigger.Indexer {
+		return annotationTriggerIndexer{
+			prefix:         prefix,
+			skipControlled: true,
+			imageChanged: func(old, obj runtime.Object, triggers []triggerutil.ObjectFieldTrigger) bool {
+				return unstructuredContainerImageChanged(old, obj, podSpecPath, triggers)
+			},
+		}
+	}
+}
+
+// UnstructuredReactor updates the container images of the pod spec at a path of unstructured
+// objects, through the dynamic client of their resource.
+type UnstructuredReactor struct {
+	Client      dynamic.NamespaceableResourceInterface
+	PodSpecPath []string
+}
+
+var _ trigger.ImageReactor = &UnstructuredReactor{}
+
+func (r *UnstructuredReactor) ImageChanged(obj runtime.Object, tagRetriever triggerutil.TagRetriever) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unrecognized object - no trigger update possible for %T", obj)
+	}
+	changed, err := UpdateUnstructuredFromImages(u, r.PodSpecPath, tagRetriever)
+	if err != nil || changed == nil {
+		return err
+	}
+	_, err = r.Client.Namespace(changed.GetNamespace()).Update(context.TODO(), changed, metav1.UpdateOptions{})
+	return err
+}
+
+// UpdateUnstructuredFromImages is triggerutil.UpdateObjectFromImages for unstructured objects with
+// the pod spec at the path. If changes are necessary, it lazily copies obj and returns it, or if no
+// changes are necessary returns nil.
+func UpdateUnstructuredFromImages(obj *unstructured.Unstructured, podSpecPath []string, tagRetriever triggerutil.TagRetriever) (*unstructured.Unstructured, error) {
+	_, _, triggers, err := triggerutil.CalculateAnnotationTriggers(obj, "/")
+	if err != nil {
+		return nil, err
+	}
+	spec := &unstructuredPodSpec{obj: obj, path: podSpecPath}
+	var updated *unstructured.Unstructured
+	for _, t := range triggers {
+		if t.Paused {
+			continue
+		}
+		container, remainder, err := containerForFieldPath(spec, t.FieldPath)
+		if err != nil {
+			klog.V(5).Infof("%s %s/%s trigger: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+			continue
+		}
+		if remainder != "image" {
+			return nil, fmt.Errorf("field path is not valid: %s", t.FieldPath)
+		}
+
+		namespace := t.From.Namespace
+		if len(namespace) == 0 {
+			namespace = obj.GetNamespace()
+		}
+		ref, _, ok := tagRetriever.ImageStreamTag(namespace, t.From.Name)
+		if !ok {
+			klog.V(5).Infof("%s %s/%s detected no pending image on %s from %#v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), t.FieldPath, t.From)
+			continue
+		}
+
+		if container.GetImage() != ref {
+			if updated == nil {
+				updated = obj.DeepCopy()
+				spec = &unstructuredPodSpec{obj: updated, path: podSpecPath}
+				container, _, _ = containerForFieldPath(spec, t.FieldPath)
+			}
+			klog.V(5).Infof("%s %s/%s detected change on %s = %s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), t.FieldPath, ref)
+			container.SetImage(ref)
+		}
+	}
+	return updated, nil
+}
+
+// unstructuredContainerImageChanged returns true if any container image referenced by the triggers
+// changed.
+func unstructuredContainerImageChanged(oldObj, newObj runtime.Object, podSpecPath []string, triggers []triggerutil.ObjectFieldTrigger) bool {
+	oldU, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	newU, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	oldSpec := &unstructuredPodSpec{obj: oldU, path: podSpecPath}
+	newSpec := &unstructuredPodSpec{obj: newU, path: podSpecPath}
+	for _, t := range triggers {
+		if t.Paused {
+			continue
+		}
+		newContainer, _, err := containerForFieldPath(newSpec, t.FieldPath)
+		if err != nil {
+			continue
+		}
+		oldContainer, _, err := containerForFieldPath(oldSpec, t.FieldPath)
+		if err != nil {
+			// might just be a result of the update
+			continue
+		}
+		if newContainer.GetImage() != oldContainer.GetImage() {
+			return true
+		}
+	}
+	return false
+}
+
+// containerForFieldPath returns the container of the pod spec the field path points into, and the
+// remaining field path beyond the container.
+func containerForFieldPath(spec referencemutator.PodSpecReferenceMutator, fieldPath string) (referencemutator.ContainerMutator, string, error) {
+	basePath := spec.Path().String() + "."
+	if !strings.HasPrefix(fieldPath, basePath) {
+		return nil, "", fmt.Errorf("field path %s does not match the pod spec path %s", fieldPath, basePath)
+	}
+	containerPath := strings.TrimPrefix(fieldPath, basePath)
+
+	var init bool
+	switch {
+	case strings.HasPrefix(containerPath, "containers["):
+		containerPath = strings.TrimPrefix(containerPath, "containers[")
+	case strings.HasPrefix(containerPath, "initContainers["):
+		init = true
+		containerPath = strings.TrimPrefix(containerPath, "initContainers[")
+	default:
+		return nil, "", fmt.Errorf("field path is not valid: %s", fieldPath)
+	}
+	end := strings.Index(containerPath, "]")
+	if end == -1 {
+		return nil, "", fmt.Errorf("field path is not valid: %s", fieldPath)
+	}
+	selector, remainder := containerPath[:end], strings.TrimPrefix(containerPath[end+1:], ".")
+
+	var container referencemutator.ContainerMutator
+	var ok bool
+	if i, err := strconv.Atoi(selector); err == nil {
+		container, ok = spec.GetContainerByIndex(init, i)
+	} else if name := strings.TrimSuffix(strings.TrimPrefix(selector, "?(@.name==\""), "\")"); name != selector {
+		container, ok = spec.GetContainerByName(name)
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("no such container: %s", selector)
+	}
+	return container, remainder, nil
+}
+
+// unstructuredPodSpec is a referencemutator.PodSpecReferenceMutator of the pod spec at a path of
+// an unstructured object. Containers are mutated in place.
+type unstructuredPodSpec struct {
+	obj  *unstructured.Unstructured
+	path []string
+}
+
+var _ referencemutator.PodSpecReferenceMutator = &unstructuredPodSpec{}
+
+func (s *unstructuredPodSpec) Path() *field.Path {
+	return field.NewPath(s.path[0], s.path[1:]...)
+}
+
+func (s *unstructuredPodSpec) containers(init bool) []interface{} {
+	name := "containers"
+	if init {
+		name = "initContainers"
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(s.obj.Object, append(append([]string{}, s.path...), name)...)
+	if !found || err != nil {
+		return nil
+	}
+	containers, _ := value.([]interface{})
+	return containers
+}
+
+func (s *unstructuredPodSpec) GetContainerByIndex(init bool, i int) (referencemutator.ContainerMutator, bool) {
+	containers := s.containers(init)
+	if i < 0 || i >= len(containers) {
+		return nil, false
+	}
+	container, ok := containers[i].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return unstructuredContainer(container), true
+}
+
+func (s *unstructuredPodSpec) GetContainerByName(name string) (referencemutator.ContainerMutator, bool) {
+	for _, init := range []bool{true, false} {
+		for _, c := range s.containers(init) {
+			container, ok := c.(map[string]interface{})
+			if ok && unstructuredContainer(container).GetName() == name {
+				return unstructuredContainer(container), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// unstructuredContainer is a referencemutator.ContainerMutator of an unstructured container.
+type unstructuredContainer map[string]interface{}
+
+func (c unstructuredContainer) GetName() string {
+	name, _ := c["name"].(string)
+	return name
+}
+
+func (c unstructuredContainer) GetImage() string {
+	image, _ := c["image"].(string)
+	return image
+}
+
+func (c unstructuredContainer) SetImage(image string) {
+	c["image"] = image
+}
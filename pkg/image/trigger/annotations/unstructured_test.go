@@ -0,0 +1,112 @@
+package annotations
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+
+	triggerutil "github.com/openshift/library-go/pkg/image/trigger"
+)
+
+type fakeTagRetriever map[string]string
+
+func (r fakeTagRetriever) ImageStreamTag(namespace, name string) (string, int64, bool) {
+	ref, ok := r[namespace+"/"+name]
+	return ref, 1, ok
+}
+
+func testRollout(image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata": map[string]interface{}{
+			"namespace": "ns",
+			"name":      "app",
+			"annotations": map[string]interface{}{
+				triggerutil.TriggerAnnotationKey: `[{"from":{"kind":"ImageStreamTag","name":"app:latest"},"fieldPath":"spec.template.spec.containers[?(@.name==\"app\")].image"}]`,
+			},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"initContainers": []interface{}{map[string]interface{}{"name": "init", "image": "init:1"}},
+					"containers":     []interface{}{map[string]interface{}{"name": "app", "image": image}},
+				},
+			},
+		},
+	}}
+}
+
+func TestUpdateUnstructuredFromImages(t *testing.T) {
+	path := []string{"spec", "template", "spec"}
+	rollout := testRollout("app:1")
+	tags := fakeTagRetriever{"ns/app:latest": "registry/ns/app@sha256:2"}
+
+	updated, err := UpdateUnstructuredFromImages(rollout, path, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated == nil {
+		t.Fatalf("expected the rollout to be updated")
+	}
+	containers, _, _ := unstructured.NestedSlice(updated.Object, "spec", "template", "spec", "containers")
+	if image := containers[0].(map[string]interface{})["image"]; image != "registry/ns/app@sha256:2" {
+		t.Errorf("expected the container image to be updated, got %v", image)
+	}
+	if original, _, _ := unstructured.NestedSlice(rollout.Object, "spec", "template", "spec", "containers"); original[0].(map[string]interface{})["image"] != "app:1" {
+		t.Errorf("expected the original rollout not to be mutated")
+	}
+
+	if updated, err := UpdateUnstructuredFromImages(testRollout("registry/ns/app@sha256:2"), path, tags); err != nil || updated != nil {
+		t.Errorf("expected no update of an up to date rollout, got %v, %v", updated, err)
+	}
+	if updated, err := UpdateUnstructuredFromImages(rollout, path, fakeTagRetriever{}); err != nil || updated != nil {
+		t.Errorf("expected no update without a pending image, got %v, %v", updated, err)
+	}
+}
+
+func TestPodSpecPathAnnotationTriggerIndexer(t *testing.T) {
+	indexer := NewPodSpecPathAnnotationTriggerIndexer([]string{"spec", "template", "spec"})("rollouts/")
+
+	key, entry, change, err := indexer.Index(testRollout("app:1"), nil)
+	if err != nil || key != "rollouts/ns/app" || entry == nil || len(entry.Triggers) != 1 || change != cache.Added {
+		t.Fatalf("unexpected index of an added rollout: %q %#v %q %v", key, entry, change, err)
+	}
+	if _, _, change, err := indexer.Index(testRollout("app:2"), testRollout("app:1")); err != nil || change != cache.Updated {
+		t.Errorf("expected a changed image to update the entry, got %q %v", change, err)
+	}
+	if _, _, change, err := indexer.Index(testRollout("app:1"), testRollout("app:1")); err != nil || len(change) > 0 {
+		t.Errorf("expected an unchanged rollout not to change the entry, got %q %v", change, err)
+	}
+
+	controlled := testRollout("app:1")
+	controlled.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Owner", Name: "owner", Controller: boolPtr(true)}})
+	if _, entry, _, err := indexer.Index(controlled, nil); err != nil || entry != nil {
+		t.Errorf("expected controlled objects to be ignored, got %#v %v", entry, err)
+	}
+}
+
+func TestUncontrolledAnnotationTriggerIndexer(t *testing.T) {
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "ns",
+		Name:        "app-1",
+		Annotations: map[string]string{triggerutil.TriggerAnnotationKey: `[{"from":{"kind":"ImageStreamTag","name":"app:latest"},"fieldPath":"spec.template.spec.containers[0].image"}]`},
+	}}
+	if _, entry, _, err := NewUncontrolledAnnotationTriggerIndexer("replicasets/").Index(replicaSet, nil); err != nil || entry == nil {
+		t.Fatalf("expected the triggers of a replica set to be indexed, got %#v %v", entry, err)
+	}
+	replicaSet.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Controller: boolPtr(true)}}
+	if _, entry, _, err := NewUncontrolledAnnotationTriggerIndexer("replicasets/").Index(replicaSet, nil); err != nil || entry != nil {
+		t.Errorf("expected the replica set of a deployment to be ignored, got %#v %v", entry, err)
+	}
+	if _, entry, _, err := NewAnnotationTriggerIndexer("replicasets/").Index(replicaSet, nil); err != nil || entry == nil {
+		t.Errorf("expected the annotation trigger indexer to index controlled objects, got %#v %v", entry, err)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}